@@ -0,0 +1,330 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-storage/pkg/util"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Format of an archive that can be extracted.
+type Format int
+
+const (
+	// Tar is an uncompressed tarball.
+	Tar Format = iota
+	// TarGzip is a tarball compressed using gzip.
+	TarGzip
+	// TarXz is a tarball compressed using xz.
+	TarXz
+	// TarZstd is a tarball compressed using Zstandard.
+	TarZstd
+	// TarBzip2 is a tarball compressed using bzip2.
+	TarBzip2
+	// Zip is a ZIP archive.
+	Zip
+)
+
+// The names of archive formats, matching the values accepted by the
+// 'type' attribute of Bazel's http_archive() rule.
+var formatNames = map[string]Format{
+	"tar":     Tar,
+	"tar.gz":  TarGzip,
+	"tgz":     TarGzip,
+	"tar.xz":  TarXz,
+	"txz":     TarXz,
+	"tar.zst": TarZstd,
+	"tzst":    TarZstd,
+	"tar.bz2": TarBzip2,
+	"tbz":     TarBzip2,
+	"zip":     Zip,
+	"jar":     Zip,
+	"war":     Zip,
+	"aar":     Zip,
+}
+
+// ParseFormat converts the name of an archive format, such as "tar.gz"
+// or "zip", to a Format.
+func ParseFormat(name string) (Format, error) {
+	format, ok := formatNames[strings.ToLower(name)]
+	if !ok {
+		return 0, status.Errorf(codes.InvalidArgument, "Unsupported archive type %#v", name)
+	}
+	return format, nil
+}
+
+// FormatFromPath derives the format of an archive from the extension of
+// its filename.
+func FormatFromPath(p string) (Format, bool) {
+	p = strings.ToLower(p)
+	// Check for the longest extension first, so that "foo.tar.gz"
+	// is not interpreted as "foo.tar" compressed using gzip.
+	longest := ""
+	for name := range formatNames {
+		if strings.HasSuffix(p, "."+name) && len(name) > len(longest) {
+			longest = name
+		}
+	}
+	if longest == "" {
+		return 0, false
+	}
+	return formatNames[longest], true
+}
+
+// Limits that are applied while extracting archives, protecting against
+// decompression bombs.
+type Limits struct {
+	// Maximum total size of all files contained in the archive.
+	MaximumExtractedSizeBytes int64
+	// Maximum number of entries contained in the archive.
+	MaximumEntries int64
+}
+
+// extractor keeps track of the state of an archive that is being
+// extracted into a directory.Builder.
+type extractor struct {
+	builder     *directory.Builder
+	stripPrefix string
+	limits      Limits
+
+	extractedSizeBytes int64
+	entries            int64
+	matchedPrefix      bool
+	// Paths added by the container image layer that is being
+	// extracted, if any.
+	layerPaths map[string]struct{}
+}
+
+// limitedReader returns an error once the total size of all files that
+// have been extracted exceeds the configured limit.
+type limitedReader struct {
+	r io.Reader
+	e *extractor
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.e.extractedSizeBytes += int64(n)
+	if r.e.extractedSizeBytes > r.e.limits.MaximumExtractedSizeBytes {
+		return n, status.Errorf(codes.ResourceExhausted, "Archive exceeds the maximum extracted size of %d bytes", r.e.limits.MaximumExtractedSizeBytes)
+	}
+	return n, err
+}
+
+// checkDeclaredSize rejects files whose size, as declared by the
+// archive, exceeds the remaining budget. This prevents space from being
+// reserved for files that could never be extracted.
+func (e *extractor) checkDeclaredSize(sizeBytes int64) error {
+	if sizeBytes > e.limits.MaximumExtractedSizeBytes-e.extractedSizeBytes {
+		return status.Errorf(codes.ResourceExhausted, "Archive exceeds the maximum extracted size of %d bytes", e.limits.MaximumExtractedSizeBytes)
+	}
+	return nil
+}
+
+// addEntry accounts for an entry of the archive, returning an error if
+// the archive contains too many of them.
+func (e *extractor) addEntry() error {
+	e.entries++
+	if e.entries > e.limits.MaximumEntries {
+		return status.Errorf(codes.ResourceExhausted, "Archive exceeds the maximum number of %d entries", e.limits.MaximumEntries)
+	}
+	return nil
+}
+
+// getPath applies the strip prefix to the path of an archive entry.
+// Entries that are not located underneath the strip prefix are skipped.
+func (e *extractor) getPath(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if e.stripPrefix == "" {
+		return name, true
+	}
+	if name == e.stripPrefix {
+		e.matchedPrefix = true
+		return ".", true
+	}
+	if !strings.HasPrefix(name, e.stripPrefix+"/") {
+		return "", false
+	}
+	e.matchedPrefix = true
+	return strings.TrimPrefix(name, e.stripPrefix+"/"), true
+}
+
+// Extract the contents of an archive into a directory.Builder. If a
+// strip prefix is provided, only the contents of the directory with
+// that path are extracted, placed at the root of the builder.
+func Extract(ctx context.Context, r io.ReaderAt, sizeBytes int64, format Format, stripPrefix string, limits Limits, builder *directory.Builder) error {
+	e := &extractor{
+		builder:     builder,
+		stripPrefix: strings.Trim(path.Clean("/"+stripPrefix), "/"),
+		limits:      limits,
+	}
+
+	var err error
+	if format == Zip {
+		err = e.extractZip(ctx, r, sizeBytes)
+	} else {
+		err = e.extractTar(ctx, io.NewSectionReader(r, 0, sizeBytes), format)
+	}
+	if err != nil {
+		return err
+	}
+	if e.stripPrefix != "" && !e.matchedPrefix {
+		return status.Errorf(codes.InvalidArgument, "Prefix %#v was given, but not found in the archive", stripPrefix)
+	}
+	return nil
+}
+
+func (e *extractor) extractTar(ctx context.Context, r io.Reader, format Format) error {
+	switch format {
+	case Tar:
+	case TarGzip:
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to decompress gzip stream")
+		}
+		defer gzipReader.Close()
+		r = gzipReader
+	case TarXz:
+		xzReader, err := xz.NewReader(r)
+		if err != nil {
+			return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to decompress xz stream")
+		}
+		r = xzReader
+	case TarZstd:
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to decompress Zstandard stream")
+		}
+		defer zstdReader.Close()
+		r = zstdReader
+	case TarBzip2:
+		r = bzip2.NewReader(r)
+	default:
+		return status.Errorf(codes.InvalidArgument, "Unsupported archive format %d", format)
+	}
+
+	tarReader := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return util.StatusFromContext(ctx)
+		}
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read tar archive")
+		}
+		if err := e.extractTarEntry(ctx, tarReader, header); err != nil {
+			return util.StatusWrapf(err, "Failed to extract %#v", header.Name)
+		}
+	}
+}
+
+// extractTarEntry extracts a single entry of a tarball.
+func (e *extractor) extractTarEntry(ctx context.Context, r io.Reader, header *tar.Header) error {
+	if err := e.addEntry(); err != nil {
+		return err
+	}
+	p, ok := e.getPath(header.Name)
+	if !ok {
+		return nil
+	}
+	if e.layerPaths != nil {
+		return e.extractLayerEntry(ctx, r, header, p)
+	}
+	return e.addTarEntry(ctx, r, header, p)
+}
+
+// addTarEntry adds a single entry of a tarball to the builder.
+func (e *extractor) addTarEntry(ctx context.Context, r io.Reader, header *tar.Header, p string) error {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return e.builder.AddDirectory(p)
+	case tar.TypeReg:
+		if err := e.checkDeclaredSize(header.Size); err != nil {
+			return err
+		}
+		return e.builder.AddFile(ctx, p, &limitedReader{r: r, e: e}, header.Size, header.Mode&0o111 != 0)
+	case tar.TypeSymlink:
+		return e.builder.AddSymlink(p, header.Linkname)
+	case tar.TypeLink:
+		target, ok := e.getPath(header.Linkname)
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "Hardlink target %#v is not located underneath the strip prefix", header.Linkname)
+		}
+		return e.builder.AddHardlink(p, target)
+	default:
+		// Device nodes, FIFOs, etc. cannot be represented in the
+		// CAS. Silently ignore these, similar to Bazel.
+		return nil
+	}
+}
+
+func (e *extractor) extractZip(ctx context.Context, r io.ReaderAt, sizeBytes int64) error {
+	zipReader, err := zip.NewReader(r, sizeBytes)
+	if err != nil {
+		return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read ZIP archive")
+	}
+	for _, file := range zipReader.File {
+		if err := ctx.Err(); err != nil {
+			return util.StatusFromContext(ctx)
+		}
+		if err := e.extractZipEntry(ctx, file); err != nil {
+			return util.StatusWrapf(err, "Failed to extract %#v", file.Name)
+		}
+	}
+	return nil
+}
+
+// extractZipEntry extracts a single entry of a ZIP archive.
+func (e *extractor) extractZipEntry(ctx context.Context, file *zip.File) error {
+	if err := e.addEntry(); err != nil {
+		return err
+	}
+	p, ok := e.getPath(file.Name)
+	if !ok {
+		return nil
+	}
+	mode := file.Mode()
+	if mode.IsDir() {
+		return e.builder.AddDirectory(p)
+	}
+
+	// Reject entries whose declared size already exceeds the limit,
+	// without decompressing them.
+	if file.UncompressedSize64 > uint64(e.limits.MaximumExtractedSizeBytes) {
+		return status.Errorf(codes.ResourceExhausted, "Archive exceeds the maximum extracted size of %d bytes", e.limits.MaximumExtractedSizeBytes)
+	}
+	if err := e.checkDeclaredSize(int64(file.UncompressedSize64)); err != nil {
+		return err
+	}
+	f, err := file.Open()
+	if err != nil {
+		return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to open file")
+	}
+	defer f.Close()
+
+	if mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(&limitedReader{r: f, e: e}, 4096))
+		if err != nil {
+			return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read symbolic link target")
+		}
+		return e.builder.AddSymlink(p, string(target))
+	}
+	if !mode.IsRegular() {
+		return nil
+	}
+	return e.builder.AddFile(ctx, p, &limitedReader{r: f, e: e}, int64(file.UncompressedSize64), mode&0o111 != 0)
+}
@@ -0,0 +1,239 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	"github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/buildbarn/bb-storage/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type tarEntry struct {
+	header   tar.Header
+	contents string
+}
+
+func createTarGzip(t *testing.T, entries []tarEntry) []byte {
+	var b bytes.Buffer
+	gzipWriter := gzip.NewWriter(&b)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.contents))
+		require.NoError(t, tarWriter.WriteHeader(&header))
+		_, err := tarWriter.Write([]byte(entry.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return b.Bytes()
+}
+
+// newFakeContentAddressableStorage returns a mock BlobAccess that
+// stores all objects written to it in a map.
+func newFakeContentAddressableStorage(ctrl *gomock.Controller) (*mock.MockBlobAccess, map[digest.Digest][]byte) {
+	contents := map[digest.Digest][]byte{}
+	cas := mock.NewMockBlobAccess(ctrl)
+	cas.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, blobDigest digest.Digest, b buffer.Buffer) error {
+			data, err := b.ToByteSlice(1 << 20)
+			if err != nil {
+				return err
+			}
+			contents[blobDigest] = data
+			return nil
+		}).AnyTimes()
+	return cas, contents
+}
+
+func getDirectory(t *testing.T, contents map[digest.Digest][]byte, digestFunction digest.Function, d *remoteexecution.Digest) *remoteexecution.Directory {
+	directoryDigest, err := digestFunction.NewDigestFromProto(d)
+	require.NoError(t, err)
+	var directory remoteexecution.Directory
+	require.NoError(t, proto.Unmarshal(contents[directoryDigest], &directory))
+	return &directory
+}
+
+var defaultLimits = archive.Limits{
+	MaximumExtractedSizeBytes: 1 << 20,
+	MaximumEntries:            100,
+}
+
+func TestExtractTarGzip(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	data := createTarGzip(t, []tarEntry{
+		{header: tar.Header{Name: "foo-1.0/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "foo-1.0/README", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Hello"},
+		{header: tar.Header{Name: "foo-1.0/bin/tool", Typeflag: tar.TypeReg, Mode: 0o755}, contents: "#!/bin/sh"},
+		{header: tar.Header{Name: "foo-1.0/link", Typeflag: tar.TypeSymlink, Linkname: "README"}},
+		{header: tar.Header{Name: "foo-1.0/copy", Typeflag: tar.TypeLink, Linkname: "foo-1.0/README"}},
+		{header: tar.Header{Name: "other", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Skipped"},
+	})
+
+	t.Run("StripPrefix", func(t *testing.T) {
+		cas, contents := newFakeContentAddressableStorage(ctrl)
+		builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+		require.NoError(t, archive.Extract(ctx, bytes.NewReader(data), int64(len(data)), archive.TarGzip, "foo-1.0", defaultLimits, builder))
+		rootDigest, err := builder.Finalize(ctx)
+		require.NoError(t, err)
+
+		helloDigest := digestFunction.NewGenerator(5)
+		helloDigest.Write([]byte("Hello"))
+		root := getDirectory(t, contents, digestFunction, rootDigest.GetProto())
+		require.Len(t, root.Directories, 1)
+		require.Equal(t, "bin", root.Directories[0].Name)
+		testutil.RequireEqualProto(t, &remoteexecution.Directory{
+			Directories: root.Directories,
+			Files: []*remoteexecution.FileNode{
+				{Name: "README", Digest: helloDigest.Sum().GetProto()},
+				{Name: "copy", Digest: helloDigest.Sum().GetProto()},
+			},
+			Symlinks: []*remoteexecution.SymlinkNode{
+				{Name: "link", Target: "README"},
+			},
+		}, root)
+
+		bin := getDirectory(t, contents, digestFunction, root.Directories[0].Digest)
+		require.Len(t, bin.Files, 1)
+		require.Equal(t, "tool", bin.Files[0].Name)
+		require.True(t, bin.Files[0].IsExecutable)
+	})
+
+	t.Run("MissingPrefix", func(t *testing.T) {
+		cas, _ := newFakeContentAddressableStorage(ctrl)
+		builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Prefix \"bar-1.0\" was given, but not found in the archive"),
+			archive.Extract(ctx, bytes.NewReader(data), int64(len(data)), archive.TarGzip, "bar-1.0", defaultLimits, builder))
+	})
+
+	t.Run("TooManyEntries", func(t *testing.T) {
+		cas, _ := newFakeContentAddressableStorage(ctrl)
+		builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+		err := archive.Extract(ctx, bytes.NewReader(data), int64(len(data)), archive.TarGzip, "", archive.Limits{
+			MaximumExtractedSizeBytes: 1 << 20,
+			MaximumEntries:            3,
+		}, builder)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		cas, _ := newFakeContentAddressableStorage(ctrl)
+		builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+		err := archive.Extract(ctx, bytes.NewReader(data), int64(len(data)), archive.TarGzip, "", archive.Limits{
+			MaximumExtractedSizeBytes: 10,
+			MaximumEntries:            100,
+		}, builder)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("DeclaredSizeTooLarge", func(t *testing.T) {
+		// Files whose declared size exceeds the limit must be
+		// rejected before space is reserved for them. Reserving
+		// space would block, as the quota is used up.
+		scratchStorage := scratch.NewStorage(t.TempDir(), 10, 0)
+		file, err := scratchStorage.NewFile(ctx, 10)
+		require.NoError(t, err)
+		defer file.Close()
+
+		largeData := createTarGzip(t, []tarEntry{
+			{header: tar.Header{Name: "large", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Contents exceeding the limit"},
+		})
+		cas, _ := newFakeContentAddressableStorage(ctrl)
+		builder := directory.NewBuilder(cas, digestFunction, scratchStorage)
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.ResourceExhausted, "Failed to extract \"large\": Archive exceeds the maximum extracted size of 10 bytes"),
+			archive.Extract(ctx, bytes.NewReader(largeData), int64(len(largeData)), archive.TarGzip, "", archive.Limits{
+				MaximumExtractedSizeBytes: 10,
+				MaximumEntries:            100,
+			}, builder))
+	})
+}
+
+func TestExtractTarGzipPathTraversal(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	for name, entries := range map[string][]tarEntry{
+		"DotDot": {
+			{header: tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Hello"},
+		},
+		"ThroughSymlink": {
+			{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"}},
+			{header: tar.Header{Name: "link/file", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Hello"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data := createTarGzip(t, entries)
+			cas, _ := newFakeContentAddressableStorage(ctrl)
+			builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+			err := archive.Extract(ctx, bytes.NewReader(data), int64(len(data)), archive.TarGzip, "", defaultLimits, builder)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	var b bytes.Buffer
+	zipWriter := zip.NewWriter(&b)
+	w, err := zipWriter.Create("dir/hello.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("Hello"))
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+	data := b.Bytes()
+
+	cas, contents := newFakeContentAddressableStorage(ctrl)
+	builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+	require.NoError(t, archive.Extract(ctx, bytes.NewReader(data), int64(len(data)), archive.Zip, "", defaultLimits, builder))
+	rootDigest, err := builder.Finalize(ctx)
+	require.NoError(t, err)
+
+	root := getDirectory(t, contents, digestFunction, rootDigest.GetProto())
+	require.Len(t, root.Directories, 1)
+	require.Equal(t, "dir", root.Directories[0].Name)
+	dir := getDirectory(t, contents, digestFunction, root.Directories[0].Digest)
+	require.Len(t, dir.Files, 1)
+	require.Equal(t, "hello.txt", dir.Files[0].Name)
+	require.Equal(t, int64(5), dir.Files[0].Digest.SizeBytes)
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for p, expected := range map[string]archive.Format{
+		"/foo-1.0.tar.gz": archive.TarGzip,
+		"/foo-1.0.TGZ":    archive.TarGzip,
+		"/foo.tar":        archive.Tar,
+		"/foo.tar.zst":    archive.TarZstd,
+		"/foo.jar":        archive.Zip,
+	} {
+		format, ok := archive.FormatFromPath(p)
+		require.True(t, ok, p)
+		require.Equal(t, expected, format, p)
+	}
+
+	_, ok := archive.FormatFromPath("/foo.txt")
+	require.False(t, ok)
+}
@@ -0,0 +1,152 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Files in container image layers whose names have this prefix
+	// mark the path without the prefix as deleted.
+	whiteoutPrefix = ".wh."
+	// File in container image layers that marks all contents of its
+	// directory in lower layers as deleted.
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// LayerExtractor applies the layers of a container image to a
+// directory.Builder, yielding the root file system of the image. The
+// limits apply to all layers combined.
+type LayerExtractor struct {
+	e extractor
+}
+
+// NewLayerExtractor creates a LayerExtractor that writes the root file
+// system of a container image into a directory.Builder.
+func NewLayerExtractor(builder *directory.Builder, limits Limits) *LayerExtractor {
+	return &LayerExtractor{
+		e: extractor{
+			builder: builder,
+			limits:  limits,
+		},
+	}
+}
+
+// Extract applies a single layer, which must be a tarball. Layers must
+// be applied in order, starting with the base layer. Entries replace
+// entries of lower layers having the same path, while whiteout files
+// delete them.
+func (le *LayerExtractor) Extract(ctx context.Context, r io.Reader, format Format) error {
+	if format == Zip {
+		return status.Error(codes.InvalidArgument, "Container image layers must be tarballs")
+	}
+	le.e.layerPaths = map[string]struct{}{}
+	return le.e.extractTar(ctx, r, format)
+}
+
+// extractLayerEntry extracts a single entry of a container image
+// layer. Whiteout files only apply to lower layers, meaning that
+// entries of the current layer are retained, regardless of the order in
+// which they appear.
+func (e *extractor) extractLayerEntry(ctx context.Context, r io.Reader, header *tar.Header, p string) error {
+	dir, name := path.Dir(p), path.Base(p)
+	if name == opaqueWhiteout {
+		return e.removeLowerEntries(dir)
+	}
+	if deleted, ok := strings.CutPrefix(name, whiteoutPrefix); ok {
+		deletedPath := path.Join(dir, deleted)
+		if _, ok := e.layerPaths[deletedPath]; ok {
+			if e.builder.IsDirectory(deletedPath) {
+				return e.removeLowerEntries(deletedPath)
+			}
+			return nil
+		}
+		return e.builder.Remove(deletedPath)
+	}
+	if p == "." {
+		return nil
+	}
+	// Parent directories are provided by the current layer as well,
+	// even if it contains no entries for them.
+	for d := p; d != "."; d = path.Dir(d) {
+		e.layerPaths[d] = struct{}{}
+	}
+
+	// Entries replace entries of lower layers of a different type,
+	// while directories are merged.
+	if header.Typeflag != tar.TypeDir || !e.builder.IsDirectory(p) {
+		if err := e.builder.Remove(p); err != nil {
+			return err
+		}
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		header.Linkname = rebaseSymlinkTarget(p, header.Linkname)
+	}
+	return e.addTarEntry(ctx, r, header, p)
+}
+
+// removeLowerEntries removes all contents of a directory that
+// originate from lower layers. Directories provided by the current
+// layer are merged with those of lower layers, meaning that their
+// contents are pruned recursively.
+func (e *extractor) removeLowerEntries(dir string) error {
+	var kept []string
+	if err := e.builder.RemoveChildren(dir, func(child string) bool {
+		childPath := path.Join(dir, child)
+		if _, ok := e.layerPaths[childPath]; ok {
+			kept = append(kept, childPath)
+			return true
+		}
+		return false
+	}); err != nil {
+		return err
+	}
+	for _, childPath := range kept {
+		if e.builder.IsDirectory(childPath) {
+			if err := e.removeLowerEntries(childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rebaseSymlinkTarget converts the target of a symbolic link contained
+// in a container image layer to a relative path that does not escape
+// the root directory. Absolute targets are resolved against the root
+// of the image, while ".." components leading above the root are
+// dropped, as is the case when the image is used as a root file system.
+func rebaseSymlinkTarget(p, target string) string {
+	dir := path.Dir(p)
+	if !path.IsAbs(target) {
+		if resolved := path.Join(dir, target); resolved != ".." && !strings.HasPrefix(resolved, "../") {
+			return target
+		}
+	}
+
+	resolved := strings.TrimPrefix(path.Join("/", dir, target), "/")
+	if path.IsAbs(target) {
+		resolved = strings.TrimPrefix(path.Clean(target), "/")
+	}
+	var components []string
+	if dir != "." {
+		for range strings.Split(dir, "/") {
+			components = append(components, "..")
+		}
+	}
+	if resolved != "" {
+		components = append(components, resolved)
+	}
+	if len(components) == 0 {
+		return "."
+	}
+	return strings.Join(components, "/")
+}
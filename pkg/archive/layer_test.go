@@ -0,0 +1,137 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"testing"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/buildbarn/bb-storage/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLayerExtractor(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	baseLayer := createTarGzip(t, []tarEntry{
+		{header: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "./etc/config", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Old"},
+		{header: tar.Header{Name: "./etc/removed", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Removed"},
+		{header: tar.Header{Name: "./opt/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "./opt/a", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "A"},
+		{header: tar.Header{Name: "./opt/b/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "./opt/b/old", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Old"},
+		{header: tar.Header{Name: "./opt/d/old", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Old"},
+		{header: tar.Header{Name: "./data/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "./data/file", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Data"},
+		{header: tar.Header{Name: "./usr/bin/tool", Typeflag: tar.TypeReg, Mode: 0o755}, contents: "#!/bin/sh"},
+	})
+	upperLayer := createTarGzip(t, []tarEntry{
+		{header: tar.Header{Name: "etc/.wh.removed", Typeflag: tar.TypeReg, Mode: 0o644}},
+		{header: tar.Header{Name: "etc/config", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "New"},
+		// Whiteouts only apply to lower layers, regardless of
+		// whether they precede entries of the same layer.
+		{header: tar.Header{Name: "opt/c", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "C"},
+		// Directories of lower layers that are merged with those
+		// of the current layer must be emptied by opaque
+		// whiteouts, regardless of whether the current layer
+		// contains entries for the directories themselves.
+		{header: tar.Header{Name: "opt/b/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "opt/d/new", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "New"},
+		{header: tar.Header{Name: "opt/.wh..wh..opq", Typeflag: tar.TypeReg, Mode: 0o644}},
+		{header: tar.Header{Name: "data", Typeflag: tar.TypeReg, Mode: 0o644}, contents: "Replaced"},
+		{header: tar.Header{Name: "bin", Typeflag: tar.TypeSymlink, Linkname: "/usr/bin"}},
+		{header: tar.Header{Name: "usr/lib/tool", Typeflag: tar.TypeSymlink, Linkname: "/usr/bin/tool"}},
+		{header: tar.Header{Name: "usr/lib/escape", Typeflag: tar.TypeSymlink, Linkname: "../../../etc"}},
+		{header: tar.Header{Name: "usr/.wh.nonexistent", Typeflag: tar.TypeReg, Mode: 0o644}},
+	})
+
+	cas, contents := newFakeContentAddressableStorage(ctrl)
+	builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+	layerExtractor := archive.NewLayerExtractor(builder, defaultLimits)
+	require.NoError(t, layerExtractor.Extract(ctx, bytes.NewReader(baseLayer), archive.TarGzip))
+	require.NoError(t, layerExtractor.Extract(ctx, bytes.NewReader(upperLayer), archive.TarGzip))
+	rootDigest, err := builder.Finalize(ctx)
+	require.NoError(t, err)
+
+	fileDigest := func(contents string) *remoteexecution.Digest {
+		generator := digestFunction.NewGenerator(int64(len(contents)))
+		generator.Write([]byte(contents))
+		return generator.Sum().GetProto()
+	}
+
+	root := getDirectory(t, contents, digestFunction, rootDigest.GetProto())
+	require.Len(t, root.Directories, 3)
+	require.Equal(t, "etc", root.Directories[0].Name)
+	require.Equal(t, "opt", root.Directories[1].Name)
+	require.Equal(t, "usr", root.Directories[2].Name)
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{
+		Directories: root.Directories,
+		Files: []*remoteexecution.FileNode{
+			{Name: "data", Digest: fileDigest("Replaced")},
+		},
+		Symlinks: []*remoteexecution.SymlinkNode{
+			{Name: "bin", Target: "usr/bin"},
+		},
+	}, root)
+
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{
+		Files: []*remoteexecution.FileNode{
+			{Name: "config", Digest: fileDigest("New")},
+		},
+	}, getDirectory(t, contents, digestFunction, root.Directories[0].Digest))
+
+	opt := getDirectory(t, contents, digestFunction, root.Directories[1].Digest)
+	require.Len(t, opt.Directories, 2)
+	require.Equal(t, "b", opt.Directories[0].Name)
+	require.Equal(t, "d", opt.Directories[1].Name)
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{
+		Directories: opt.Directories,
+		Files: []*remoteexecution.FileNode{
+			{Name: "c", Digest: fileDigest("C")},
+		},
+	}, opt)
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{}, getDirectory(t, contents, digestFunction, opt.Directories[0].Digest))
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{
+		Files: []*remoteexecution.FileNode{
+			{Name: "new", Digest: fileDigest("New")},
+		},
+	}, getDirectory(t, contents, digestFunction, opt.Directories[1].Digest))
+
+	usr := getDirectory(t, contents, digestFunction, root.Directories[2].Digest)
+	require.Len(t, usr.Directories, 2)
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{
+		Files: []*remoteexecution.FileNode{
+			{Name: "tool", Digest: fileDigest("#!/bin/sh"), IsExecutable: true},
+		},
+	}, getDirectory(t, contents, digestFunction, usr.Directories[0].Digest))
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{
+		Symlinks: []*remoteexecution.SymlinkNode{
+			{Name: "escape", Target: "../../etc"},
+			{Name: "tool", Target: "../../usr/bin/tool"},
+		},
+	}, getDirectory(t, contents, digestFunction, usr.Directories[1].Digest))
+}
+
+func TestLayerExtractorZip(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	cas, _ := newFakeContentAddressableStorage(ctrl)
+	builder := directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage())
+	testutil.RequireEqualStatus(
+		t,
+		status.Error(codes.InvalidArgument, "Container image layers must be tarballs"),
+		archive.NewLayerExtractor(builder, defaultLimits).Extract(ctx, bytes.NewReader(nil), archive.Zip))
+}
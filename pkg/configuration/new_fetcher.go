@@ -1,17 +1,27 @@
 package configuration
 
 import (
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
 	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
 	pb "github.com/buildbarn/bb-remote-asset/pkg/proto/configuration/bb_remote_asset/fetch"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
 	"github.com/buildbarn/bb-remote-asset/pkg/storage"
 	"github.com/buildbarn/bb-storage/pkg/auth"
 	"github.com/buildbarn/bb-storage/pkg/blobstore"
 	"github.com/buildbarn/bb-storage/pkg/clock"
+	"github.com/buildbarn/bb-storage/pkg/digest"
 	"github.com/buildbarn/bb-storage/pkg/grpc"
 	bb_http "github.com/buildbarn/bb-storage/pkg/http/client"
 	"github.com/buildbarn/bb-storage/pkg/program"
+	bb_http_pb "github.com/buildbarn/bb-storage/pkg/proto/configuration/http/client"
+	"github.com/buildbarn/bb-storage/pkg/util"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -27,37 +37,58 @@ func NewFetcherFromConfiguration(configuration *pb.FetcherConfiguration,
 	maximumMessageSizeBytes int,
 	authorizer auth.Authorizer,
 ) (fetch.Fetcher, error) {
+	var rewriter *fetch.URLRewriter
+	if urlRewriter := configuration.GetUrlRewriter(); urlRewriter != nil {
+		rewrites := make([]fetch.URLRewrite, 0, len(urlRewriter.Rewrites))
+		for _, rewrite := range urlRewriter.Rewrites {
+			rewrites = append(rewrites, fetch.URLRewrite{
+				Pattern:      rewrite.Pattern,
+				Replacements: rewrite.Replacements,
+			})
+		}
+		var err error
+		rewriter, err = fetch.NewURLRewriter(rewrites, urlRewriter.AllowedHosts, urlRewriter.BlockedHosts, urlRewriter.AllBlockedMessage)
+		if err != nil {
+			return nil, util.StatusWrap(err, "Invalid URL rewriter configuration")
+		}
+	}
+
 	var fetcher fetch.Fetcher
 	if configuration == nil {
 		fetcher = fetch.DefaultFetcher
 	} else {
-		switch backend := configuration.Backend.(type) {
-		case *pb.FetcherConfiguration_Http:
-			roundTripper, err := bb_http.NewRoundTripperFromConfiguration(backend.Http.Client)
-			if err != nil {
-				return nil, err
-			}
-			fetcher = fetch.NewHTTPFetcher(
-				&http.Client{Transport: roundTripper},
-				contentAddressableStorage)
-		case *pb.FetcherConfiguration_Error:
-			fetcher = fetch.NewErrorFetcher(backend.Error)
-		case *pb.FetcherConfiguration_RemoteExecution:
-			client, err := grpcClientFactory.NewClientFromConfiguration(
-				backend.RemoteExecution.ExecutionClient,
-				dependenciesGroup,
-			)
-			if err != nil {
-				return nil, err
-			}
-			fetcher = fetch.NewRemoteExecutionFetcher(contentAddressableStorage, client, maximumMessageSizeBytes)
-		default:
-			return nil, status.Errorf(codes.InvalidArgument, "Fetcher configuration is invalid as no supported Fetchers are defined.")
+		var err error
+		fetcher, err = newBackendFetcherFromConfiguration(configuration, contentAddressableStorage, grpcClientFactory, dependenciesGroup, maximumMessageSizeBytes, rewriter)
+		if err != nil {
+			return nil, err
 		}
 	}
+	// Collapse identical requests that miss the asset store at the
+	// same time, so that every asset is only fetched once.
+	fetcher = fetch.NewSingleflightFetcher(fetcher)
 	if assetStore != nil {
 		fetcher = fetch.NewCachingFetcher(fetcher, assetStore)
 	}
+	if gitRefResolution := configuration.GetGitRefResolution(); gitRefResolution != nil {
+		roundTripper, err := newHTTPRoundTripperFromConfiguration(gitRefResolution.Client, gitRefResolution.SsrfProtection)
+		if err != nil {
+			return nil, util.StatusWrap(err, "Invalid git ref resolution configuration")
+		}
+		var credentials fetch.CredentialStore
+		var credentialPrecedence fetch.CredentialPrecedence
+		if gitRefResolution.Credentials != nil {
+			if credentials, credentialPrecedence, err = newCredentialStoreFromConfiguration(gitRefResolution.Credentials); err != nil {
+				return nil, util.StatusWrap(err, "Invalid credentials for git ref resolution")
+			}
+		}
+		fetcher = fetch.NewGitRefResolvingFetcher(fetcher, &http.Client{
+			Transport:     roundTripper,
+			CheckRedirect: fetch.NewCredentialRedirectPolicy(credentials),
+		}, credentials, credentialPrecedence)
+	}
+	if rewriter != nil {
+		fetcher = fetch.NewURLRewritingFetcher(fetcher, rewriter)
+	}
 	return fetch.NewAuthorizingFetcher(
 		fetch.NewMetricsFetcher(
 			fetch.NewLoggingFetcher(
@@ -69,3 +100,626 @@ func NewFetcherFromConfiguration(configuration *pb.FetcherConfiguration,
 		authorizer,
 	), nil
 }
+
+// newBackendFetcherFromConfiguration creates the Fetcher that performs
+// the actual downloads, without any caching or validation of requests.
+// The URLRewriter of the top level configuration, if any, is provided
+// to backends that obtain URLs from the content they download.
+func newBackendFetcherFromConfiguration(configuration *pb.FetcherConfiguration,
+	contentAddressableStorage blobstore.BlobAccess,
+	grpcClientFactory grpc.ClientFactory,
+	dependenciesGroup program.Group,
+	maximumMessageSizeBytes int,
+	urlRewriter *fetch.URLRewriter,
+) (fetch.Fetcher, error) {
+	switch backend := configuration.Backend.(type) {
+	case *pb.FetcherConfiguration_Http:
+		roundTripper, err := newHTTPRoundTripperFromConfiguration(backend.Http.Client, backend.Http.SsrfProtection)
+		if err != nil {
+			return nil, err
+		}
+		options, err := newHTTPFetcherOptionsFromConfiguration(backend.Http)
+		if err != nil {
+			return nil, err
+		}
+		return fetch.NewHTTPFetcher(
+			&http.Client{
+				Transport:     roundTripper,
+				CheckRedirect: fetch.NewCredentialRedirectPolicy(options.Credentials),
+			},
+			contentAddressableStorage,
+			options), nil
+	case *pb.FetcherConfiguration_Error:
+		return fetch.NewErrorFetcher(backend.Error), nil
+	case *pb.FetcherConfiguration_RemoteExecution:
+		client, err := grpcClientFactory.NewClientFromConfiguration(
+			backend.RemoteExecution.ExecutionClient,
+			dependenciesGroup,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return fetch.NewRemoteExecutionFetcher(contentAddressableStorage, client, maximumMessageSizeBytes), nil
+	case *pb.FetcherConfiguration_File:
+		var scratchStorage *scratch.Storage
+		if backend.File.ScratchStorage != nil {
+			var err error
+			scratchStorage, err = newScratchStorageFromConfiguration(backend.File.ScratchStorage)
+			if err != nil {
+				return nil, util.StatusWrap(err, "Invalid scratch storage")
+			}
+		}
+		return fetch.NewFileFetcher(contentAddressableStorage, backend.File.AllowedRootDirectories, scratchStorage)
+	case *pb.FetcherConfiguration_SchemeDemultiplexing:
+		backends := map[string]fetch.Fetcher{}
+		for i, backendConfiguration := range backend.SchemeDemultiplexing.Backends {
+			if backendConfiguration.Fetcher.GetUrlRewriter() != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Backend at index %d has a URL rewriter, which is only supported at the top level", i)
+			}
+			if backendConfiguration.Fetcher.GetGitRefResolution() != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Backend at index %d has git ref resolution, which is only supported at the top level", i)
+			}
+			if backendConfiguration.Fetcher.GetBackend() == nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Backend at index %d has no fetcher", i)
+			}
+			fetcher, err := newBackendFetcherFromConfiguration(backendConfiguration.Fetcher, contentAddressableStorage, grpcClientFactory, dependenciesGroup, maximumMessageSizeBytes, urlRewriter)
+			if err != nil {
+				return nil, util.StatusWrapf(err, "Invalid backend at index %d", i)
+			}
+			for _, scheme := range backendConfiguration.Schemes {
+				scheme = strings.ToLower(scheme)
+				if _, ok := backends[scheme]; ok {
+					return nil, status.Errorf(codes.InvalidArgument, "Scheme %#v is handled by multiple backends", scheme)
+				}
+				backends[scheme] = fetcher
+			}
+		}
+		return fetch.NewSchemeDemultiplexingFetcher(backends), nil
+	case *pb.FetcherConfiguration_Oci:
+		roundTripper, err := newHTTPRoundTripperFromConfiguration(backend.Oci.Client, backend.Oci.SsrfProtection)
+		if err != nil {
+			return nil, err
+		}
+		options := fetch.OCIFetcherOptions{
+			PlainHTTPRegistries: backend.Oci.PlainHttpRegistries,
+		}
+		if backend.Oci.Credentials != nil {
+			if options.Credentials, _, err = newCredentialStoreFromConfiguration(backend.Oci.Credentials); err != nil {
+				return nil, util.StatusWrap(err, "Invalid credentials")
+			}
+		}
+		if backend.Oci.ScratchStorage != nil {
+			if options.ScratchStorage, err = newScratchStorageFromConfiguration(backend.Oci.ScratchStorage); err != nil {
+				return nil, util.StatusWrap(err, "Invalid scratch storage")
+			}
+		}
+		if backend.Oci.ImageExtraction != nil {
+			options.ImageExtractionLimits = newArchiveExtractionLimitsFromConfiguration(backend.Oci.ImageExtraction)
+		}
+		return fetch.NewOCIFetcher(
+			&http.Client{
+				Transport:     roundTripper,
+				CheckRedirect: fetch.NewCredentialRedirectPolicy(options.Credentials),
+			},
+			contentAddressableStorage,
+			clock.SystemClock,
+			options), nil
+	case *pb.FetcherConfiguration_S3:
+		roundTripper, err := newHTTPRoundTripperFromConfiguration(backend.S3.Client, backend.S3.SsrfProtection)
+		if err != nil {
+			return nil, err
+		}
+		var options fetch.S3FetcherOptions
+		for _, bucket := range backend.S3.Buckets {
+			s3Bucket := fetch.S3Bucket{
+				BucketNames: bucket.BucketNames,
+				Endpoint:    bucket.Endpoint,
+				Region:      bucket.Region,
+				PathStyle:   bucket.PathStyle,
+			}
+			if credentials := bucket.Credentials; credentials != nil {
+				s3Bucket.Credentials = &fetch.S3Credentials{
+					AccessKeyID:     credentials.AccessKeyId,
+					SecretAccessKey: credentials.SecretAccessKey,
+					SessionToken:    credentials.SessionToken,
+				}
+			}
+			options.Buckets = append(options.Buckets, s3Bucket)
+		}
+		if backend.S3.ScratchStorage != nil {
+			if options.ScratchStorage, err = newScratchStorageFromConfiguration(backend.S3.ScratchStorage); err != nil {
+				return nil, util.StatusWrap(err, "Invalid scratch storage")
+			}
+		}
+		return fetch.NewS3Fetcher(
+			&http.Client{
+				Transport:     roundTripper,
+				CheckRedirect: fetch.NewCredentialRedirectPolicy(nil),
+			},
+			contentAddressableStorage,
+			clock.SystemClock,
+			options)
+	case *pb.FetcherConfiguration_Git:
+		roundTripper, err := newHTTPRoundTripperFromConfiguration(backend.Git.Client, backend.Git.SsrfProtection)
+		if err != nil {
+			return nil, err
+		}
+		options := fetch.GitFetcherOptions{
+			URLRewriter: urlRewriter,
+		}
+		if backend.Git.Credentials != nil {
+			if options.Credentials, options.CredentialPrecedence, err = newCredentialStoreFromConfiguration(backend.Git.Credentials); err != nil {
+				return nil, util.StatusWrap(err, "Invalid credentials")
+			}
+		}
+		if backend.Git.ScratchStorage != nil {
+			if options.ScratchStorage, err = newScratchStorageFromConfiguration(backend.Git.ScratchStorage); err != nil {
+				return nil, util.StatusWrap(err, "Invalid scratch storage")
+			}
+		}
+		checkoutLimits := backend.Git.CheckoutLimits
+		if checkoutLimits == nil {
+			checkoutLimits = &pb.FetcherConfiguration_ArchiveExtractionConfiguration{}
+		}
+		options.CheckoutLimits = *newArchiveExtractionLimitsFromConfiguration(checkoutLimits)
+		return fetch.NewGitFetcher(
+			&http.Client{
+				Transport:     roundTripper,
+				CheckRedirect: fetch.NewCredentialRedirectPolicy(options.Credentials),
+			},
+			contentAddressableStorage,
+			options), nil
+	case *pb.FetcherConfiguration_GoModule:
+		roundTripper, err := newHTTPRoundTripperFromConfiguration(backend.GoModule.Client, backend.GoModule.SsrfProtection)
+		if err != nil {
+			return nil, err
+		}
+		options := fetch.GoModuleFetcherOptions{
+			Proxy: backend.GoModule.Proxy,
+		}
+		if backend.GoModule.Credentials != nil {
+			if options.Credentials, _, err = newCredentialStoreFromConfiguration(backend.GoModule.Credentials); err != nil {
+				return nil, util.StatusWrap(err, "Invalid credentials")
+			}
+		}
+		if database := backend.GoModule.ChecksumDatabase; database != nil {
+			options.ChecksumDatabase = &fetch.GoChecksumDatabase{
+				VerifierKey:            database.VerifierKey,
+				URL:                    database.Url,
+				ExcludedModulePatterns: database.ExcludedModulePatterns,
+			}
+		}
+		if backend.GoModule.ScratchStorage != nil {
+			if options.ScratchStorage, err = newScratchStorageFromConfiguration(backend.GoModule.ScratchStorage); err != nil {
+				return nil, util.StatusWrap(err, "Invalid scratch storage")
+			}
+		}
+		extractionLimits := backend.GoModule.ExtractionLimits
+		if extractionLimits == nil {
+			extractionLimits = &pb.FetcherConfiguration_ArchiveExtractionConfiguration{}
+		}
+		options.ExtractionLimits = *newArchiveExtractionLimitsFromConfiguration(extractionLimits)
+		return fetch.NewGoModuleFetcher(
+			&http.Client{
+				Transport:     roundTripper,
+				CheckRedirect: fetch.NewCredentialRedirectPolicy(options.Credentials),
+			},
+			contentAddressableStorage,
+			options)
+	case *pb.FetcherConfiguration_Maven:
+		roundTripper, err := newHTTPRoundTripperFromConfiguration(backend.Maven.Client, backend.Maven.SsrfProtection)
+		if err != nil {
+			return nil, err
+		}
+		var options fetch.MavenFetcherOptions
+		for _, repository := range backend.Maven.Repositories {
+			options.Repositories = append(options.Repositories, fetch.MavenRepository{URL: repository.Url})
+		}
+		if backend.Maven.Credentials != nil {
+			if options.Credentials, _, err = newCredentialStoreFromConfiguration(backend.Maven.Credentials); err != nil {
+				return nil, util.StatusWrap(err, "Invalid credentials")
+			}
+		}
+		if backend.Maven.ScratchStorage != nil {
+			if options.ScratchStorage, err = newScratchStorageFromConfiguration(backend.Maven.ScratchStorage); err != nil {
+				return nil, util.StatusWrap(err, "Invalid scratch storage")
+			}
+		}
+		return fetch.NewMavenFetcher(
+			&http.Client{
+				Transport:     roundTripper,
+				CheckRedirect: fetch.NewCredentialRedirectPolicy(options.Credentials),
+			},
+			contentAddressableStorage,
+			options)
+	case *pb.FetcherConfiguration_ResourceTypeDemultiplexing:
+		backends := map[string]fetch.Fetcher{}
+		for i, backendConfiguration := range backend.ResourceTypeDemultiplexing.Backends {
+			if backendConfiguration.Fetcher.GetUrlRewriter() != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Backend at index %d has a URL rewriter, which is only supported at the top level", i)
+			}
+			if backendConfiguration.Fetcher.GetGitRefResolution() != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Backend at index %d has git ref resolution, which is only supported at the top level", i)
+			}
+			if backendConfiguration.Fetcher.GetBackend() == nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Backend at index %d has no fetcher", i)
+			}
+			fetcher, err := newBackendFetcherFromConfiguration(backendConfiguration.Fetcher, contentAddressableStorage, grpcClientFactory, dependenciesGroup, maximumMessageSizeBytes, urlRewriter)
+			if err != nil {
+				return nil, util.StatusWrapf(err, "Invalid backend at index %d", i)
+			}
+			for _, resourceType := range backendConfiguration.ResourceTypes {
+				if _, ok := backends[resourceType]; ok {
+					return nil, status.Errorf(codes.InvalidArgument, "Resource type %#v is handled by multiple backends", resourceType)
+				}
+				backends[resourceType] = fetcher
+			}
+		}
+		var defaultFetcher fetch.Fetcher
+		if defaultConfiguration := backend.ResourceTypeDemultiplexing.DefaultFetcher; defaultConfiguration != nil {
+			if defaultConfiguration.GetUrlRewriter() != nil {
+				return nil, status.Error(codes.InvalidArgument, "Default backend has a URL rewriter, which is only supported at the top level")
+			}
+			if defaultConfiguration.GetGitRefResolution() != nil {
+				return nil, status.Error(codes.InvalidArgument, "Default backend has git ref resolution, which is only supported at the top level")
+			}
+			var err error
+			if defaultFetcher, err = newBackendFetcherFromConfiguration(defaultConfiguration, contentAddressableStorage, grpcClientFactory, dependenciesGroup, maximumMessageSizeBytes, urlRewriter); err != nil {
+				return nil, util.StatusWrap(err, "Invalid default backend")
+			}
+		}
+		return fetch.NewResourceTypeDemultiplexingFetcher(backends, defaultFetcher), nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Fetcher configuration is invalid as no supported Fetchers are defined.")
+	}
+}
+
+// newHTTPRoundTripperFromConfiguration creates the RoundTripper used by
+// the HTTP fetcher. Unless disabled, a DialPolicy is installed to
+// protect against server-side request forgery. As the transport
+// created by bb-storage does not permit overriding its dialer, it is
+// constructed here in the same way.
+//
+// Proxies can only be used if protection is disabled explicitly, as
+// the policy cannot be enforced on connections made by the proxy.
+func newHTTPRoundTripperFromConfiguration(configuration *bb_http_pb.Configuration, ssrfProtection *pb.FetcherConfiguration_SsrfProtectionConfiguration) (http.RoundTripper, error) {
+	if ssrfProtection.GetDisabled() {
+		return bb_http.NewRoundTripperFromConfiguration(configuration)
+	}
+	if configuration.GetProxyUrl() != "" {
+		return nil, status.Error(codes.InvalidArgument, "A proxy URL can only be used if SSRF protection is disabled, as the proxy connects to upstream hosts on behalf of the fetcher")
+	}
+
+	deniedNetworks := append([]netip.Prefix(nil), fetch.DefaultDeniedNetworks...)
+	for _, network := range ssrfProtection.GetDeniedNetworks() {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid denied network %#v", network)
+		}
+		deniedNetworks = append(deniedNetworks, prefix)
+	}
+	var allowedNetworks []netip.Prefix
+	for _, network := range ssrfProtection.GetAllowedNetworks() {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid allowed network %#v", network)
+		}
+		allowedNetworks = append(allowedNetworks, prefix)
+	}
+	dialPolicy := fetch.NewDialPolicy(deniedNetworks, allowedNetworks)
+
+	tlsConfig, err := util.NewTLSConfigFromClientConfiguration(configuration.GetTls())
+	if err != nil {
+		return nil, err
+	}
+	var roundTripper http.RoundTripper = &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   dialPolicy.Control,
+		}).DialContext,
+		ForceAttemptHTTP2: !configuration.GetDisableHttp2(),
+		TLSClientConfig:   tlsConfig,
+	}
+	if headerValues := configuration.GetAddHeaders(); len(headerValues) > 0 {
+		roundTripper = bb_http.NewHeaderAddingRoundTripper(roundTripper, headerValues)
+	}
+	if oauth2Config := configuration.GetOauth2(); oauth2Config != nil {
+		if roundTripper, err = bb_http.NewOAuth2AddingRoundTripper(roundTripper, oauth2Config); err != nil {
+			return nil, util.StatusWrap(err, "Failed to create oauth2 round tripper")
+		}
+	}
+	return roundTripper, nil
+}
+
+// newHTTPFetcherOptionsFromConfiguration converts the optional settings
+// of the HTTP fetcher from their configuration representation.
+func newHTTPFetcherOptionsFromConfiguration(configuration *pb.FetcherConfiguration_HttpFetcherConfiguration) (fetch.HTTPFetcherOptions, error) {
+	perURITimeout := configuration.PerUriTimeout
+	if perURITimeout != nil {
+		if err := perURITimeout.CheckValid(); err != nil {
+			return fetch.HTTPFetcherOptions{}, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid per URI timeout")
+		}
+	}
+	hedgingDelay := configuration.HedgingDelay
+	if hedgingDelay != nil {
+		if err := hedgingDelay.CheckValid(); err != nil {
+			return fetch.HTTPFetcherOptions{}, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid hedging delay")
+		}
+	}
+	var archiveExtractionLimits *archive.Limits
+	if configuration.ArchiveExtraction != nil {
+		archiveExtractionLimits = newArchiveExtractionLimitsFromConfiguration(configuration.ArchiveExtraction)
+	}
+	var credentials fetch.CredentialStore
+	var credentialPrecedence fetch.CredentialPrecedence
+	if configuration.Credentials != nil {
+		var err error
+		credentials, credentialPrecedence, err = newCredentialStoreFromConfiguration(configuration.Credentials)
+		if err != nil {
+			return fetch.HTTPFetcherOptions{}, util.StatusWrap(err, "Invalid credentials")
+		}
+	}
+	var downloadSizeLimits *fetch.DownloadSizeLimits
+	if configuration.DownloadSizeLimits != nil {
+		var err error
+		downloadSizeLimits, err = newDownloadSizeLimitsFromConfiguration(configuration.DownloadSizeLimits)
+		if err != nil {
+			return fetch.HTTPFetcherOptions{}, util.StatusWrap(err, "Invalid download size limits")
+		}
+	}
+	var retryPolicy *fetch.RetryPolicy
+	if configuration.RetryPolicy != nil {
+		var err error
+		retryPolicy, err = newRetryPolicyFromConfiguration(configuration.RetryPolicy)
+		if err != nil {
+			return fetch.HTTPFetcherOptions{}, util.StatusWrap(err, "Invalid retry policy")
+		}
+	}
+	var scratchStorage *scratch.Storage
+	if configuration.ScratchStorage != nil {
+		var err error
+		scratchStorage, err = newScratchStorageFromConfiguration(configuration.ScratchStorage)
+		if err != nil {
+			return fetch.HTTPFetcherOptions{}, util.StatusWrap(err, "Invalid scratch storage")
+		}
+	}
+	checksumFilePolicies := make([]fetch.ChecksumFilePolicy, 0, len(configuration.ChecksumFilePolicies))
+	for i, policyConfiguration := range configuration.ChecksumFilePolicies {
+		policy, err := newChecksumFilePolicyFromConfiguration(policyConfiguration)
+		if err != nil {
+			return fetch.HTTPFetcherOptions{}, util.StatusWrapf(err, "Invalid checksum file policy at index %d", i)
+		}
+		checksumFilePolicies = append(checksumFilePolicies, policy)
+	}
+	return fetch.HTTPFetcherOptions{
+		PerURITimeout:                perURITimeout.AsDuration(),
+		HedgingDelay:                 hedgingDelay.AsDuration(),
+		MaximumResumeAttempts:        int(configuration.MaximumResumeAttempts),
+		ArchiveExtractionLimits:      archiveExtractionLimits,
+		SkipDownloadsOfExistingBlobs: configuration.SkipDownloadsOfExistingBlobs,
+		Credentials:                  credentials,
+		CredentialPrecedence:         credentialPrecedence,
+		DownloadSizeLimits:           downloadSizeLimits,
+		RetryPolicy:                  retryPolicy,
+		ScratchStorage:               scratchStorage,
+		ChecksumFilePolicies:         checksumFilePolicies,
+	}, nil
+}
+
+// newChecksumFilePolicyFromConfiguration converts a policy for
+// verifying downloads against checksum files.
+func newChecksumFilePolicyFromConfiguration(configuration *pb.FetcherConfiguration_ChecksumFilePolicyConfiguration) (fetch.ChecksumFilePolicy, error) {
+	if len(configuration.UrlPatterns) == 0 {
+		return fetch.ChecksumFilePolicy{}, status.Error(codes.InvalidArgument, "No URL patterns provided")
+	}
+	if len(configuration.ChecksumFiles) == 0 {
+		return fetch.ChecksumFilePolicy{}, status.Error(codes.InvalidArgument, "No checksum files provided")
+	}
+	policy := fetch.ChecksumFilePolicy{
+		Required: configuration.Required,
+	}
+	for _, pattern := range configuration.UrlPatterns {
+		policy.URLPatterns = append(policy.URLPatterns, fetch.URLPattern(pattern))
+	}
+	for i, checksumFile := range configuration.ChecksumFiles {
+		switch location := checksumFile.Location.(type) {
+		case *pb.FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Suffix:
+			if location.Suffix == "" || strings.Contains(location.Suffix, "/") {
+				return fetch.ChecksumFilePolicy{}, status.Errorf(codes.InvalidArgument, "Invalid suffix %#v of checksum file at index %d", location.Suffix, i)
+			}
+			policy.ChecksumFiles = append(policy.ChecksumFiles, fetch.ChecksumFile{Suffix: location.Suffix})
+		case *pb.FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_ManifestName:
+			if location.ManifestName == "" || strings.Contains(location.ManifestName, "/") {
+				return fetch.ChecksumFilePolicy{}, status.Errorf(codes.InvalidArgument, "Invalid manifest name %#v of checksum file at index %d", location.ManifestName, i)
+			}
+			policy.ChecksumFiles = append(policy.ChecksumFiles, fetch.ChecksumFile{ManifestName: location.ManifestName})
+		default:
+			return fetch.ChecksumFilePolicy{}, status.Errorf(codes.InvalidArgument, "No location provided for checksum file at index %d", i)
+		}
+	}
+	return policy, nil
+}
+
+// newArchiveExtractionLimitsFromConfiguration converts the limits that
+// apply while extracting archives, filling in defaults.
+func newArchiveExtractionLimitsFromConfiguration(configuration *pb.FetcherConfiguration_ArchiveExtractionConfiguration) *archive.Limits {
+	limits := &archive.Limits{
+		MaximumExtractedSizeBytes: configuration.MaximumExtractedSizeBytes,
+		MaximumEntries:            configuration.MaximumEntries,
+	}
+	if limits.MaximumExtractedSizeBytes <= 0 {
+		limits.MaximumExtractedSizeBytes = 10 << 30
+	}
+	if limits.MaximumEntries <= 0 {
+		limits.MaximumEntries = 1000000
+	}
+	return limits
+}
+
+// newScratchStorageFromConfiguration creates the storage in which the
+// HTTP fetcher holds the contents of downloads. Files left behind in
+// the scratch directory by earlier runs are removed.
+func newScratchStorageFromConfiguration(configuration *pb.FetcherConfiguration_ScratchStorageConfiguration) (*scratch.Storage, error) {
+	if configuration.MaximumSizeBytes < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Maximum size cannot be negative")
+	}
+	maximumInMemorySizeBytes := configuration.MaximumInMemorySizeBytes
+	if maximumInMemorySizeBytes < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Maximum in-memory size cannot be negative")
+	} else if maximumInMemorySizeBytes == 0 {
+		maximumInMemorySizeBytes = scratch.DefaultMaximumInMemorySizeBytes
+	}
+	if configuration.Directory == "" {
+		return scratch.NewStorage("", configuration.MaximumSizeBytes, maximumInMemorySizeBytes), nil
+	}
+
+	if err := os.MkdirAll(configuration.Directory, 0o700); err != nil {
+		return nil, util.StatusWrapfWithCode(err, codes.Internal, "Failed to create scratch directory %#v", configuration.Directory)
+	}
+	scratchStorage := scratch.NewStorage(configuration.Directory, configuration.MaximumSizeBytes, maximumInMemorySizeBytes)
+	if err := scratchStorage.RemoveLeftoverFiles(); err != nil {
+		return nil, err
+	}
+	return scratchStorage, nil
+}
+
+// newRetryPolicyFromConfiguration converts the policy for retrying
+// requests of the HTTP fetcher, filling in defaults.
+func newRetryPolicyFromConfiguration(configuration *pb.FetcherConfiguration_RetryPolicyConfiguration) (*fetch.RetryPolicy, error) {
+	retryPolicy := &fetch.RetryPolicy{
+		MaximumAttempts:      int(configuration.MaximumAttempts),
+		InitialBackoff:       100 * time.Millisecond,
+		MaximumBackoff:       10 * time.Second,
+		BackoffMultiplier:    2,
+		RetryableStatusCodes: fetch.DefaultRetryableStatusCodes,
+		RetryNetworkErrors:   configuration.RetryNetworkErrors,
+	}
+	if initialBackoff := configuration.InitialBackoff; initialBackoff != nil {
+		if err := initialBackoff.CheckValid(); err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid initial backoff")
+		}
+		retryPolicy.InitialBackoff = initialBackoff.AsDuration()
+	}
+	if maximumBackoff := configuration.MaximumBackoff; maximumBackoff != nil {
+		if err := maximumBackoff.CheckValid(); err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid maximum backoff")
+		}
+		retryPolicy.MaximumBackoff = maximumBackoff.AsDuration()
+	}
+	if configuration.BackoffMultiplier != 0 {
+		if configuration.BackoffMultiplier < 1 {
+			return nil, status.Error(codes.InvalidArgument, "Backoff multiplier must be at least 1")
+		}
+		retryPolicy.BackoffMultiplier = configuration.BackoffMultiplier
+	}
+	if len(configuration.RetryableStatusCodes) > 0 {
+		retryPolicy.RetryableStatusCodes = make([]int, 0, len(configuration.RetryableStatusCodes))
+		for _, statusCode := range configuration.RetryableStatusCodes {
+			retryPolicy.RetryableStatusCodes = append(retryPolicy.RetryableStatusCodes, int(statusCode))
+		}
+	}
+	return retryPolicy, nil
+}
+
+// newDownloadSizeLimitsFromConfiguration converts the limits on the
+// size of blobs downloaded by the HTTP fetcher.
+func newDownloadSizeLimitsFromConfiguration(configuration *pb.FetcherConfiguration_DownloadSizeLimitsConfiguration) (*fetch.DownloadSizeLimits, error) {
+	if configuration.DefaultMaximumSizeBytes < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Default maximum size cannot be negative")
+	}
+	limits := &fetch.DownloadSizeLimits{
+		DefaultMaximumSizeBytes: configuration.DefaultMaximumSizeBytes,
+	}
+	for i, override := range configuration.Overrides {
+		instanceNamePrefix, err := digest.NewInstanceName(override.InstanceNamePrefix)
+		if err != nil {
+			return nil, util.StatusWrapf(err, "Invalid instance name prefix for override at index %d", i)
+		}
+		if override.MaximumSizeBytes < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Maximum size for override at index %d cannot be negative", i)
+		}
+		limits.Overrides = append(limits.Overrides, fetch.DownloadSizeLimit{
+			InstanceNamePrefix: instanceNamePrefix,
+			ResourceType:       override.ResourceType,
+			MaximumSizeBytes:   override.MaximumSizeBytes,
+		})
+	}
+	return limits, nil
+}
+
+// newCredentialStoreFromConfiguration creates a CredentialStore that
+// provides the credentials of the server for upstream hosts.
+func newCredentialStoreFromConfiguration(configuration *pb.FetcherConfiguration_HttpCredentialsConfiguration) (fetch.CredentialStore, fetch.CredentialPrecedence, error) {
+	var stores []fetch.CredentialStore
+	for i, credential := range configuration.Credentials {
+		if len(credential.UrlPatterns) == 0 {
+			return nil, 0, status.Errorf(codes.InvalidArgument, "Credential at index %d has no URL patterns", i)
+		}
+		patterns := make([]fetch.URLPattern, 0, len(credential.UrlPatterns))
+		for _, pattern := range credential.UrlPatterns {
+			patterns = append(patterns, fetch.URLPattern(pattern))
+		}
+
+		var source fetch.CredentialSource
+		switch kind := credential.Credential.(type) {
+		case *pb.FetcherConfiguration_HttpCredential_Headers_:
+			headers := http.Header{}
+			for name, value := range kind.Headers.Headers {
+				headers.Set(name, value)
+			}
+			source = fetch.NewStaticCredentialSource(headers)
+		case *pb.FetcherConfiguration_HttpCredential_BasicAuth_:
+			source = fetch.NewBasicAuthCredentialSource(kind.BasicAuth.Username, kind.BasicAuth.Password)
+		case *pb.FetcherConfiguration_HttpCredential_BearerTokenPath:
+			source = fetch.NewBearerTokenFileCredentialSource(kind.BearerTokenPath)
+		default:
+			return nil, 0, status.Errorf(codes.InvalidArgument, "Credential at index %d has no credential type specified", i)
+		}
+		stores = append(stores, fetch.NewPatternCredentialStore(patterns, source))
+	}
+	for i, helper := range configuration.CredentialHelpers {
+		if helper.Path == "" {
+			return nil, 0, status.Errorf(codes.InvalidArgument, "Credential helper at index %d has no path", i)
+		}
+		timeout := 10 * time.Second
+		if helper.Timeout != nil {
+			if err := helper.Timeout.CheckValid(); err != nil {
+				return nil, 0, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid timeout for credential helper at index %d", i)
+			}
+			timeout = helper.Timeout.AsDuration()
+		}
+		defaultCacheDuration := 30 * time.Minute
+		if helper.DefaultCacheDuration != nil {
+			if err := helper.DefaultCacheDuration.CheckValid(); err != nil {
+				return nil, 0, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid default cache duration for credential helper at index %d", i)
+			}
+			defaultCacheDuration = helper.DefaultCacheDuration.AsDuration()
+		}
+		store := fetch.NewCredentialHelperCredentialStore(helper.Path, helper.Arguments, timeout, defaultCacheDuration, clock.SystemClock)
+		if len(helper.UrlPatterns) > 0 {
+			patterns := make([]fetch.URLPattern, 0, len(helper.UrlPatterns))
+			for _, pattern := range helper.UrlPatterns {
+				patterns = append(patterns, fetch.URLPattern(pattern))
+			}
+			store = fetch.NewFilteringCredentialStore(patterns, store)
+		}
+		stores = append(stores, store)
+	}
+	for _, path := range configuration.NetrcPaths {
+		stores = append(stores, fetch.NewNetrcCredentialStore(path))
+	}
+
+	var precedence fetch.CredentialPrecedence
+	switch configuration.Precedence {
+	case pb.FetcherConfiguration_HttpCredentialsConfiguration_CLIENT:
+		precedence = fetch.ClientCredentialPrecedence
+	case pb.FetcherConfiguration_HttpCredentialsConfiguration_SERVER:
+		precedence = fetch.ServerCredentialPrecedence
+	case pb.FetcherConfiguration_HttpCredentialsConfiguration_SERVER_ONLY:
+		precedence = fetch.ServerOnlyCredentialPrecedence
+	default:
+		return nil, 0, status.Errorf(codes.InvalidArgument, "Unknown credential precedence %s", configuration.Precedence)
+	}
+	return fetch.NewMultiCredentialStore(stores), precedence, nil
+}
@@ -0,0 +1,363 @@
+package directory
+
+import (
+	"context"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-remote-asset/pkg/storage"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	"github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// node is a directory in the hierarchy that is being built.
+type node struct {
+	directories map[string]*node
+	files       map[string]*remoteexecution.FileNode
+	symlinks    map[string]*remoteexecution.SymlinkNode
+}
+
+func newNode() *node {
+	return &node{
+		directories: map[string]*node{},
+		files:       map[string]*remoteexecution.FileNode{},
+		symlinks:    map[string]*remoteexecution.SymlinkNode{},
+	}
+}
+
+func (n *node) contains(name string) bool {
+	_, isDirectory := n.directories[name]
+	_, isFile := n.files[name]
+	_, isSymlink := n.symlinks[name]
+	return isDirectory || isFile || isSymlink
+}
+
+// Builder constructs a hierarchy of REv2 Directory messages in memory.
+// The contents of files are uploaded to the Content Addressable Storage
+// as they are added, while the Directory messages are only uploaded
+// once the hierarchy is complete.
+//
+// All paths provided to the Builder are relative to the root directory.
+// Paths that attempt to escape the root directory, either directly or
+// by traversing symbolic links, are rejected. The targets of symbolic
+// links are not interpreted.
+type Builder struct {
+	contentAddressableStorage blobstore.BlobAccess
+	digestFunction            digest.Function
+	scratchStorage            *scratch.Storage
+	root                      *node
+}
+
+// NewBuilder creates a Builder for an empty root directory. The
+// contents of files are held in scratch storage while they are hashed,
+// prior to being uploaded to the CAS. Builders are typically used while
+// the caller holds space in scratch storage for an archive. Adding
+// files therefore fails if the quota of scratch storage is used up,
+// instead of waiting for space to become available.
+func NewBuilder(contentAddressableStorage blobstore.BlobAccess, digestFunction digest.Function, scratchStorage *scratch.Storage) *Builder {
+	return &Builder{
+		contentAddressableStorage: contentAddressableStorage,
+		digestFunction:            digestFunction,
+		scratchStorage:            scratchStorage,
+		root:                      newNode(),
+	}
+}
+
+// splitPath converts a relative path to its components, rejecting
+// paths that are absolute or point outside of the root directory.
+func splitPath(p string) ([]string, error) {
+	if strings.HasPrefix(p, "/") {
+		return nil, status.Errorf(codes.InvalidArgument, "Path %#v is absolute", p)
+	}
+	if strings.ContainsRune(p, 0) {
+		return nil, status.Errorf(codes.InvalidArgument, "Path %#v contains a null byte", p)
+	}
+	cleaned := path.Clean(p)
+	if cleaned == "." {
+		return nil, nil
+	}
+	components := strings.Split(cleaned, "/")
+	if components[0] == ".." {
+		return nil, status.Errorf(codes.InvalidArgument, "Path %#v escapes the root directory", p)
+	}
+	return components, nil
+}
+
+// lookupDirectory returns the directory at the provided path. Missing
+// directories are created if requested.
+func (b *Builder) lookupDirectory(components []string, create bool) (*node, error) {
+	n := b.root
+	for i, component := range components {
+		child, ok := n.directories[component]
+		if !ok {
+			if n.contains(component) {
+				return nil, status.Errorf(codes.InvalidArgument, "Path %#v traverses a file or symbolic link", strings.Join(components[:i+1], "/"))
+			}
+			if !create {
+				return nil, status.Errorf(codes.NotFound, "Directory %#v does not exist", strings.Join(components[:i+1], "/"))
+			}
+			child = newNode()
+			n.directories[component] = child
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// lookupParent returns the parent directory of the provided path and
+// the name of the final component, creating missing directories.
+func (b *Builder) lookupParent(p string) (*node, string, error) {
+	components, err := splitPath(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(components) == 0 {
+		return nil, "", status.Error(codes.InvalidArgument, "Path refers to the root directory")
+	}
+	parent, err := b.lookupDirectory(components[:len(components)-1], true)
+	if err != nil {
+		return nil, "", err
+	}
+	return parent, components[len(components)-1], nil
+}
+
+// removeExisting removes an existing file or symbolic link with a given
+// name, so that it may be replaced. Archives may contain the same path
+// more than once, in which case the last entry wins.
+func removeExisting(parent *node, name, p string) error {
+	if _, ok := parent.directories[name]; ok {
+		return status.Errorf(codes.InvalidArgument, "Path %#v already exists as a directory", p)
+	}
+	delete(parent.files, name)
+	delete(parent.symlinks, name)
+	return nil
+}
+
+// AddDirectory creates a directory and any missing parent directories.
+func (b *Builder) AddDirectory(p string) error {
+	components, err := splitPath(p)
+	if err != nil {
+		return err
+	}
+	_, err = b.lookupDirectory(components, true)
+	return err
+}
+
+// AddFile uploads the contents of a file to the CAS and adds it to the
+// hierarchy. The size of the file must be provided up front, which is
+// used to determine whether it can be hashed in memory.
+func (b *Builder) AddFile(ctx context.Context, p string, r io.Reader, sizeBytes int64, isExecutable bool) error {
+	parent, name, err := b.lookupParent(p)
+	if err != nil {
+		return err
+	}
+	if err := removeExisting(parent, name, p); err != nil {
+		return err
+	}
+
+	fileDigest, err := b.uploadFile(ctx, r, sizeBytes)
+	if err != nil {
+		return util.StatusWrapf(err, "Failed to upload file %#v", p)
+	}
+	parent.files[name] = &remoteexecution.FileNode{
+		Name:         name,
+		Digest:       fileDigest.GetProto(),
+		IsExecutable: isExecutable,
+	}
+	return nil
+}
+
+func (b *Builder) uploadFile(ctx context.Context, r io.Reader, sizeBytes int64) (digest.Digest, error) {
+	f, err := b.scratchStorage.TryNewFile(sizeBytes)
+	if err != nil {
+		return digest.BadDigest, err
+	}
+	generator := b.digestFunction.NewGenerator(sizeBytes)
+	if _, err := io.Copy(io.MultiWriter(f, generator), r); err != nil {
+		if err := f.Close(); err != nil {
+			log.Printf("Failed to close scratch file: %v", err)
+		}
+		return digest.BadDigest, err
+	}
+	fileDigest := generator.Sum()
+	if err := b.contentAddressableStorage.Put(ctx, fileDigest, buffer.NewValidatedBufferFromReaderAt(f, fileDigest.GetSizeBytes())); err != nil {
+		return digest.BadDigest, err
+	}
+	return fileDigest, nil
+}
+
+// AddHardlink adds a file that has the same contents as a file that was
+// added previously.
+func (b *Builder) AddHardlink(p, target string) error {
+	targetComponents, err := splitPath(target)
+	if err != nil {
+		return err
+	}
+	if len(targetComponents) == 0 {
+		return status.Errorf(codes.InvalidArgument, "Hardlink %#v refers to the root directory", p)
+	}
+	targetParent, err := b.lookupDirectory(targetComponents[:len(targetComponents)-1], false)
+	if err != nil {
+		return util.StatusWrapf(err, "Invalid target for hardlink %#v", p)
+	}
+	targetFile, ok := targetParent.files[targetComponents[len(targetComponents)-1]]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "Hardlink %#v refers to %#v, which is not a file", p, target)
+	}
+
+	parent, name, err := b.lookupParent(p)
+	if err != nil {
+		return err
+	}
+	if err := removeExisting(parent, name, p); err != nil {
+		return err
+	}
+	parent.files[name] = &remoteexecution.FileNode{
+		Name:         name,
+		Digest:       targetFile.Digest,
+		IsExecutable: targetFile.IsExecutable,
+	}
+	return nil
+}
+
+// AddSymlink adds a symbolic link. Targets are stored verbatim, meaning
+// they may be absolute or point outside of the root directory, just
+// like in the archives and repositories from which they originate.
+// This is safe, as the Builder never follows symbolic links. Whether
+// such symbolic links are permitted is up to the consumer of the
+// resulting directory (e.g., a worker creating an input root).
+func (b *Builder) AddSymlink(p, target string) error {
+	if target == "" {
+		return status.Errorf(codes.InvalidArgument, "Symbolic link %#v has an empty target", p)
+	}
+	if strings.ContainsRune(target, 0) {
+		return status.Errorf(codes.InvalidArgument, "Symbolic link %#v has a target that contains a null byte", p)
+	}
+	parent, name, err := b.lookupParent(p)
+	if err != nil {
+		return err
+	}
+	if err := removeExisting(parent, name, p); err != nil {
+		return err
+	}
+	parent.symlinks[name] = &remoteexecution.SymlinkNode{
+		Name:   name,
+		Target: target,
+	}
+	return nil
+}
+
+// IsDirectory returns whether the provided path refers to a directory.
+func (b *Builder) IsDirectory(p string) bool {
+	components, err := splitPath(p)
+	if err != nil {
+		return false
+	}
+	_, err = b.lookupDirectory(components, false)
+	return err == nil
+}
+
+// Remove removes the file, symbolic link or directory at the provided
+// path. Removing a path that does not exist is not an error. This
+// permits applying changes to the hierarchy, such as the whiteouts
+// contained in layers of container images.
+func (b *Builder) Remove(p string) error {
+	components, err := splitPath(p)
+	if err != nil {
+		return err
+	}
+	if len(components) == 0 {
+		return status.Error(codes.InvalidArgument, "Path refers to the root directory")
+	}
+	parent, err := b.lookupDirectory(components[:len(components)-1], false)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	}
+	name := components[len(components)-1]
+	delete(parent.directories, name)
+	delete(parent.files, name)
+	delete(parent.symlinks, name)
+	return nil
+}
+
+// RemoveChildren removes the contents of the directory at the provided
+// path, creating the directory if it does not exist. Children for which
+// the keep function returns true are retained.
+func (b *Builder) RemoveChildren(p string, keep func(name string) bool) error {
+	components, err := splitPath(p)
+	if err != nil {
+		return err
+	}
+	n, err := b.lookupDirectory(components, true)
+	if err != nil {
+		return err
+	}
+	for name := range n.directories {
+		if !keep(name) {
+			delete(n.directories, name)
+		}
+	}
+	for name := range n.files {
+		if !keep(name) {
+			delete(n.files, name)
+		}
+	}
+	for name := range n.symlinks {
+		if !keep(name) {
+			delete(n.symlinks, name)
+		}
+	}
+	return nil
+}
+
+// Finalize uploads all Directory messages of the hierarchy to the CAS,
+// returning the digest of the root directory.
+func (b *Builder) Finalize(ctx context.Context) (digest.Digest, error) {
+	return b.uploadDirectory(ctx, b.root)
+}
+
+func (b *Builder) uploadDirectory(ctx context.Context, n *node) (digest.Digest, error) {
+	directory := &remoteexecution.Directory{}
+	for name, child := range n.directories {
+		childDigest, err := b.uploadDirectory(ctx, child)
+		if err != nil {
+			return digest.BadDigest, err
+		}
+		directory.Directories = append(directory.Directories, &remoteexecution.DirectoryNode{
+			Name:   name,
+			Digest: childDigest.GetProto(),
+		})
+	}
+	for _, file := range n.files {
+		directory.Files = append(directory.Files, file)
+	}
+	for _, symlink := range n.symlinks {
+		directory.Symlinks = append(directory.Symlinks, symlink)
+	}
+
+	// REv2 requires the children of a directory to be sorted by name.
+	sort.Slice(directory.Directories, func(i, j int) bool { return directory.Directories[i].Name < directory.Directories[j].Name })
+	sort.Slice(directory.Files, func(i, j int) bool { return directory.Files[i].Name < directory.Files[j].Name })
+	sort.Slice(directory.Symlinks, func(i, j int) bool { return directory.Symlinks[i].Name < directory.Symlinks[j].Name })
+
+	directoryBuffer, directoryDigest, err := storage.ProtoSerialise(directory, b.digestFunction)
+	if err != nil {
+		return digest.BadDigest, err
+	}
+	if err := b.contentAddressableStorage.Put(ctx, directoryDigest, directoryBuffer); err != nil {
+		return digest.BadDigest, util.StatusWrap(err, "Failed to upload directory")
+	}
+	return directoryDigest, nil
+}
@@ -0,0 +1,208 @@
+package directory_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	"github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/buildbarn/bb-storage/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// newBuilder returns a Builder that stores all objects written to the
+// CAS in a map.
+func newBuilder(ctrl *gomock.Controller, digestFunction digest.Function) (*directory.Builder, map[digest.Digest][]byte) {
+	contents := map[digest.Digest][]byte{}
+	cas := mock.NewMockBlobAccess(ctrl)
+	cas.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, blobDigest digest.Digest, b buffer.Buffer) error {
+			data, err := b.ToByteSlice(1 << 20)
+			if err != nil {
+				return err
+			}
+			contents[blobDigest] = data
+			return nil
+		}).AnyTimes()
+	return directory.NewBuilder(cas, digestFunction, scratch.NewDefaultStorage()), contents
+}
+
+func getDirectory(t *testing.T, contents map[digest.Digest][]byte, d digest.Digest) *remoteexecution.Directory {
+	var directory remoteexecution.Directory
+	require.NoError(t, proto.Unmarshal(contents[d], &directory))
+	return &directory
+}
+
+func TestBuilderFinalize(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	builder, contents := newBuilder(ctrl, digestFunction)
+	require.NoError(t, builder.AddFile(ctx, "b/hello.txt", bytes.NewBufferString("Hello"), 5, false))
+	require.NoError(t, builder.AddFile(ctx, "a.sh", bytes.NewBufferString("#!/bin/sh"), 9, true))
+	require.NoError(t, builder.AddHardlink("b/copy.txt", "b/hello.txt"))
+	require.NoError(t, builder.AddDirectory("c/d"))
+	require.NoError(t, builder.Remove("c/d"))
+	require.NoError(t, builder.AddSymlink("link", "b/hello.txt"))
+	rootDigest, err := builder.Finalize(ctx)
+	require.NoError(t, err)
+
+	helloGenerator := digestFunction.NewGenerator(5)
+	helloGenerator.Write([]byte("Hello"))
+	helloDigest := helloGenerator.Sum()
+	scriptGenerator := digestFunction.NewGenerator(9)
+	scriptGenerator.Write([]byte("#!/bin/sh"))
+
+	emptyDigest := digestFunction.NewGenerator(0).Sum()
+	bGenerator := digestFunction.NewGenerator(0)
+	bData, err := proto.Marshal(&remoteexecution.Directory{
+		Files: []*remoteexecution.FileNode{
+			{Name: "copy.txt", Digest: helloDigest.GetProto()},
+			{Name: "hello.txt", Digest: helloDigest.GetProto()},
+		},
+	})
+	require.NoError(t, err)
+	bGenerator.Write(bData)
+	bDigest := bGenerator.Sum()
+
+	testutil.RequireEqualProto(t, &remoteexecution.Directory{
+		Files: []*remoteexecution.FileNode{
+			{Name: "a.sh", Digest: scriptGenerator.Sum().GetProto(), IsExecutable: true},
+		},
+		Directories: []*remoteexecution.DirectoryNode{
+			{Name: "b", Digest: bDigest.GetProto()},
+			{Name: "c", Digest: emptyDigest.GetProto()},
+		},
+		Symlinks: []*remoteexecution.SymlinkNode{
+			{Name: "link", Target: "b/hello.txt"},
+		},
+	}, getDirectory(t, contents, rootDigest))
+}
+
+func TestBuilderPathValidation(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	builder, _ := newBuilder(ctrl, digestFunction)
+	require.NoError(t, builder.AddSymlink("x/a", ".."))
+	require.NoError(t, builder.AddFile(ctx, "x/file", bytes.NewBufferString("Hello"), 5, false))
+
+	t.Run("Absolute", func(t *testing.T) {
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Path \"/etc/passwd\" is absolute"),
+			builder.AddFile(ctx, "/etc/passwd", bytes.NewBufferString("Hello"), 5, false))
+	})
+
+	t.Run("DotDot", func(t *testing.T) {
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Path \"x/../../evil\" escapes the root directory"),
+			builder.AddDirectory("x/../../evil"))
+	})
+
+	t.Run("ThroughSymlink", func(t *testing.T) {
+		// Symbolic links are never followed, meaning paths
+		// traversing them are rejected.
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Path \"x/a\" traverses a file or symbolic link"),
+			builder.AddFile(ctx, "x/a/evil", bytes.NewBufferString("Hello"), 5, false))
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Invalid target for hardlink \"copy\": Path \"x/a\" traverses a file or symbolic link"),
+			builder.AddHardlink("copy", "x/a/file"))
+		require.False(t, builder.IsDirectory("x/a"))
+	})
+
+	t.Run("ThroughFile", func(t *testing.T) {
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Path \"x/file\" traverses a file or symbolic link"),
+			builder.AddDirectory("x/file/dir"))
+	})
+
+	t.Run("ReplaceDirectory", func(t *testing.T) {
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Path \"x\" already exists as a directory"),
+			builder.AddSymlink("x", "y"))
+	})
+}
+
+func TestBuilderAddSymlink(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := util.Must(util.Must(digest.NewInstanceName("")).GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0))
+
+	t.Run("TargetsStoredVerbatim", func(t *testing.T) {
+		// Targets are not interpreted, meaning absolute targets
+		// and targets pointing outside of the root directory,
+		// either directly or through other symbolic links, are
+		// stored as is.
+		builder, contents := newBuilder(ctrl, digestFunction)
+		require.NoError(t, builder.AddSymlink("absolute", "/usr/bin/env"))
+		require.NoError(t, builder.AddSymlink("escaping", "../../etc/passwd"))
+		require.NoError(t, builder.AddSymlink("x/a", ".."))
+		require.NoError(t, builder.AddSymlink("x/b", "a/.."))
+		rootDigest, err := builder.Finalize(ctx)
+		require.NoError(t, err)
+
+		root := getDirectory(t, contents, rootDigest)
+		require.Len(t, root.Directories, 1)
+		testutil.RequireEqualProto(t, &remoteexecution.Directory{
+			Directories: root.Directories,
+			Symlinks: []*remoteexecution.SymlinkNode{
+				{Name: "absolute", Target: "/usr/bin/env"},
+				{Name: "escaping", Target: "../../etc/passwd"},
+			},
+		}, root)
+		x, err := digestFunction.NewDigestFromProto(root.Directories[0].Digest)
+		require.NoError(t, err)
+		testutil.RequireEqualProto(t, &remoteexecution.Directory{
+			Symlinks: []*remoteexecution.SymlinkNode{
+				{Name: "a", Target: ".."},
+				{Name: "b", Target: "a/.."},
+			},
+		}, getDirectory(t, contents, x))
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		// The last entry for a given path wins.
+		builder, contents := newBuilder(ctrl, digestFunction)
+		require.NoError(t, builder.AddFile(ctx, "link", bytes.NewBufferString("Hello"), 5, false))
+		require.NoError(t, builder.AddSymlink("link", "target"))
+		rootDigest, err := builder.Finalize(ctx)
+		require.NoError(t, err)
+		testutil.RequireEqualProto(t, &remoteexecution.Directory{
+			Symlinks: []*remoteexecution.SymlinkNode{
+				{Name: "link", Target: "target"},
+			},
+		}, getDirectory(t, contents, rootDigest))
+	})
+
+	t.Run("EmptyTarget", func(t *testing.T) {
+		builder, _ := newBuilder(ctrl, digestFunction)
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Symbolic link \"link\" has an empty target"),
+			builder.AddSymlink("link", ""))
+	})
+
+	t.Run("RootDirectory", func(t *testing.T) {
+		builder, _ := newBuilder(ctrl, digestFunction)
+		testutil.RequireEqualStatus(
+			t,
+			status.Error(codes.InvalidArgument, "Path refers to the root directory"),
+			builder.AddSymlink(".", "target"))
+	})
+}
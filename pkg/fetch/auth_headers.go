@@ -28,11 +28,33 @@ func (ah AuthHeaders) AddHeader(uri, header, value string) {
 	ah[uri][header] = value
 }
 
-// ApplyHeaders mutates a http.Request to apply headers requested by the client.
-func (ah AuthHeaders) ApplyHeaders(uri string, req *http.Request) {
-	if headers, ok := ah[uri]; ok {
-		for header, val := range headers {
+// ApplyHeaders mutates a http.Request to apply headers requested by the
+// client, merged with credentials of the server for the same URI.
+func (ah AuthHeaders) ApplyHeaders(uri string, req *http.Request, credentials http.Header, precedence CredentialPrecedence) {
+	clientHeaders := ah[uri]
+	if precedence == ServerOnlyCredentialPrecedence && credentials != nil {
+		clientHeaders = nil
+	}
+	applyClientHeaders := func() {
+		for header, val := range clientHeaders {
 			req.Header.Set(header, val)
 		}
 	}
+	applyCredentials := func() {
+		for header, values := range credentials {
+			req.Header.Del(header)
+			for _, value := range values {
+				req.Header.Add(header, value)
+			}
+		}
+	}
+
+	// Headers that are applied last take precedence.
+	if precedence == ServerCredentialPrecedence {
+		applyClientHeaders()
+		applyCredentials()
+	} else {
+		applyCredentials()
+		applyClientHeaders()
+	}
 }
@@ -48,12 +48,16 @@ func (cf *cachingFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchB
 	}
 
 	allCachingErrors := []error{}
+	r := &revalidation{staleAssets: map[string]*asset.Asset{}}
 
 	// Check assetStore
 	for _, uri := range req.Uris {
 		assetData, err := getAndCheckAsset(ctx, cf.assetStore, uri, removeVolatileQualifiers(req.Qualifiers), digestFunction, oldestContentAccepted)
 		if err != nil {
 			allCachingErrors = append(allCachingErrors, err)
+			if assetData != nil && assetData.UpstreamValidators != nil {
+				r.staleAssets[uri] = assetData
+			}
 			continue
 		}
 
@@ -67,8 +71,9 @@ func (cf *cachingFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchB
 	}
 
 	// Cache Miss
-	// Fetch from wrapped fetcher
-	response, err := cf.fetcher.FetchBlob(ctx, req)
+	// Fetch from wrapped fetcher. Stale assets are provided to it, so
+	// that they can be reused if the upstream resource is unchanged.
+	response, err := cf.fetcher.FetchBlob(newContextWithRevalidation(ctx, r), req)
 	if err != nil {
 		errAsStatus := status.Convert(err)
 		return nil, status.Errorf(
@@ -82,9 +87,13 @@ func (cf *cachingFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchB
 		return response, nil
 	}
 
-	// Cache fetched blob with single URI
-	assetRef := storage.NewAssetReference([]string{response.Uri}, removeVolatileQualifiers(response.Qualifiers))
+	// Cache fetched blob with single URI. The asset is stored under
+	// the qualifiers of the request, as opposed to those of the
+	// response, as backends may add qualifiers to the response (e.g.,
+	// vcs.commit) that are absent in subsequent requests.
+	assetRef := storage.NewAssetReference([]string{response.Uri}, removeVolatileQualifiers(req.Qualifiers))
 	assetData := storage.NewBlobAsset(response.BlobDigest, getDefaultTimestamp())
+	assetData.UpstreamValidators = r.upstreamValidators
 	err = cf.assetStore.Put(ctx, assetRef, assetData, digestFunction)
 	if err != nil {
 		return response, err
@@ -123,11 +132,13 @@ func getAndCheckAsset(
 		}
 	}
 
-	// Check that content is newer than the oldest accepted by the request
+	// Check that content is newer than the oldest accepted by the
+	// request. The asset is returned alongside the error, so that it
+	// can be revalidated against the upstream server.
 	if oldestContentAccepted != time.Unix(0, 0) {
 		updateTime := assetData.LastUpdated.AsTime()
 		if updateTime.Before(oldestContentAccepted) {
-			return nil, fmt.Errorf("Asset older than %v", oldestContentAccepted)
+			return assetData, fmt.Errorf("Asset older than %v", oldestContentAccepted)
 		}
 	}
 
@@ -162,11 +173,16 @@ func (cf *cachingFetcher) FetchDirectory(ctx context.Context, req *remoteasset.F
 
 	allCachingErrors := []error{}
 
+	r := &revalidation{staleAssets: map[string]*asset.Asset{}}
+
 	// Check refStore
 	for _, uri := range req.Uris {
 		assetData, err := getAndCheckAsset(ctx, cf.assetStore, uri, removeVolatileQualifiers(req.Qualifiers), digestFunction, oldestContentAccepted)
 		if err != nil {
 			allCachingErrors = append(allCachingErrors, err)
+			if assetData != nil && assetData.UpstreamValidators != nil {
+				r.staleAssets[uri] = assetData
+			}
 			continue
 		}
 
@@ -180,8 +196,9 @@ func (cf *cachingFetcher) FetchDirectory(ctx context.Context, req *remoteasset.F
 	}
 
 	// Cache Miss
-	// Fetch from wrapped fetcher
-	response, err := cf.fetcher.FetchDirectory(ctx, req)
+	// Fetch from wrapped fetcher. Stale assets are provided to it, so
+	// that they can be reused if the upstream resource is unchanged.
+	response, err := cf.fetcher.FetchDirectory(newContextWithRevalidation(ctx, r), req)
 	if err != nil {
 		errAsStatus := status.Convert(err)
 		return nil, status.Errorf(
@@ -193,8 +210,9 @@ func (cf *cachingFetcher) FetchDirectory(ctx context.Context, req *remoteasset.F
 	}
 
 	// Cache fetched blob with single URI
-	assetRef := storage.NewAssetReference([]string{response.Uri}, removeVolatileQualifiers(response.Qualifiers))
+	assetRef := storage.NewAssetReference([]string{response.Uri}, removeVolatileQualifiers(req.Qualifiers))
 	assetData := storage.NewDirectoryAsset(response.RootDirectoryDigest, getDefaultTimestamp())
+	assetData.UpstreamValidators = r.upstreamValidators
 	err = cf.assetStore.Put(ctx, assetRef, assetData, digestFunction)
 	if err != nil {
 		return response, err
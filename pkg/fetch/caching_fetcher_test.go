@@ -49,7 +49,7 @@ func TestFetchBlobCaching(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		backendGetCall := backend.EXPECT().Get(ctx, refDigest).Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "Blob not found")))
-		fetchBlobCall := mockFetcher.EXPECT().FetchBlob(ctx, request).Return(&remoteasset.FetchBlobResponse{
+		fetchBlobCall := mockFetcher.EXPECT().FetchBlob(gomock.Any(), request).Return(&remoteasset.FetchBlobResponse{
 			Status:     status.New(codes.OK, "Success!").Proto(),
 			Uri:        uri,
 			BlobDigest: blobDigest,
@@ -70,7 +70,7 @@ func TestFetchBlobCaching(t *testing.T) {
 
 	t.Run("Failure", func(t *testing.T) {
 		backendGetCall := backend.EXPECT().Get(ctx, gomock.Any()).Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "Blob not found")))
-		mockFetcher.EXPECT().FetchBlob(ctx, request).Return(nil, status.Error(codes.NotFound, "Not Found!")).After(backendGetCall)
+		mockFetcher.EXPECT().FetchBlob(gomock.Any(), request).Return(nil, status.Error(codes.NotFound, "Not Found!")).After(backendGetCall)
 		_, err := cachingFetcher.FetchBlob(ctx, request)
 		require.NotNil(t, err)
 	})
@@ -107,7 +107,7 @@ func TestFetchDirectoryCaching(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		backendGetCall := backend.EXPECT().Get(ctx, refDigest).Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "Directory not found")))
-		fetchDirectoryCall := mockFetcher.EXPECT().FetchDirectory(ctx, request).Return(&remoteasset.FetchDirectoryResponse{
+		fetchDirectoryCall := mockFetcher.EXPECT().FetchDirectory(gomock.Any(), request).Return(&remoteasset.FetchDirectoryResponse{
 			Status:              status.New(codes.OK, "Success!").Proto(),
 			Uri:                 uri,
 			RootDirectoryDigest: dirDigest,
@@ -128,7 +128,7 @@ func TestFetchDirectoryCaching(t *testing.T) {
 
 	t.Run("Failure", func(t *testing.T) {
 		backendGetCall := backend.EXPECT().Get(ctx, gomock.Any()).Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "Directory not found")))
-		mockFetcher.EXPECT().FetchDirectory(ctx, request).Return(nil, status.Error(codes.NotFound, "Not Found!")).After(backendGetCall)
+		mockFetcher.EXPECT().FetchDirectory(gomock.Any(), request).Return(nil, status.Error(codes.NotFound, "Not Found!")).After(backendGetCall)
 		_, err := cachingFetcher.FetchDirectory(ctx, request)
 		require.NotNil(t, err)
 	})
@@ -269,7 +269,7 @@ func TestFetchBlobVolatileQualifiersIgnored(t *testing.T) {
 		Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "miss")))
 	mockFetcher.
 		EXPECT().
-		FetchBlob(ctx, req1).
+		FetchBlob(gomock.Any(), req1).
 		After(getMiss).
 		Return(&remoteasset.FetchBlobResponse{
 			Status:     status.New(codes.OK, "fetched").Proto(),
@@ -309,7 +309,7 @@ func TestFetchBlobVolatileQualifiersIgnored(t *testing.T) {
 		Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "miss")))
 	mockFetcher.
 		EXPECT().
-		FetchBlob(ctx, req3).
+		FetchBlob(gomock.Any(), req3).
 		After(getMiss).
 		Return(&remoteasset.FetchBlobResponse{
 			Status:     status.New(codes.OK, "fetched").Proto(),
@@ -373,7 +373,7 @@ func TestFetchDirectoryVolatileQualifiersIgnored(t *testing.T) {
 		Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "miss")))
 	mockFetcher.
 		EXPECT().
-		FetchDirectory(ctx, req1).
+		FetchDirectory(gomock.Any(), req1).
 		After(getMiss).
 		Return(&remoteasset.FetchDirectoryResponse{
 			Status:              status.New(codes.OK, "fetched").Proto(),
@@ -413,7 +413,7 @@ func TestFetchDirectoryVolatileQualifiersIgnored(t *testing.T) {
 		Return(buffer.NewBufferFromError(status.Error(codes.NotFound, "miss")))
 	mockFetcher.
 		EXPECT().
-		FetchDirectory(ctx, req3).
+		FetchDirectory(gomock.Any(), req3).
 		After(getMiss).
 		Return(&remoteasset.FetchDirectoryResponse{
 			Status:              status.New(codes.OK, "fetched").Proto(),
@@ -431,3 +431,28 @@ func TestFetchDirectoryVolatileQualifiersIgnored(t *testing.T) {
 	_, err = cachingFetcher.FetchDirectory(ctx, req3)
 	require.NoError(t, err)
 }
+
+// newInMemoryAssetStore creates an AssetStore that retains assets in
+// memory, keyed by their asset references.
+func newInMemoryAssetStore(t *testing.T, ctrl *gomock.Controller) *mock.MockAssetStore {
+	assets := map[string]*asset.Asset{}
+	getKey := func(ref *asset.AssetReference) string {
+		key, err := proto.MarshalOptions{Deterministic: true}.Marshal(ref)
+		require.NoError(t, err)
+		return string(key)
+	}
+	assetStore := mock.NewMockAssetStore(ctrl)
+	assetStore.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, ref *asset.AssetReference, digestFunction digest.Function) (*asset.Asset, error) {
+			if data, ok := assets[getKey(ref)]; ok {
+				return data, nil
+			}
+			return nil, status.Error(codes.NotFound, "Asset not found")
+		}).AnyTimes()
+	assetStore.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, ref *asset.AssetReference, data *asset.Asset, digestFunction digest.Function) error {
+			assets[getKey(ref)] = data
+			return nil
+		}).AnyTimes()
+	return assetStore
+}
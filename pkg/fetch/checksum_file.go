@@ -0,0 +1,212 @@
+package fetch
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Maximum size of checksum files. Manifests listing the hashes of all
+// files of a release are generally no more than a couple of kilobytes.
+const maximumChecksumFileSizeBytes = 1 << 20
+
+// ChecksumFile describes where the checksum file of a download is
+// located. Exactly one of the fields is set.
+type ChecksumFile struct {
+	// Suffix appended to the path of the URI (e.g., ".sha256"). The
+	// file starts with the hash of the download, optionally followed
+	// by its name.
+	Suffix string
+
+	// Name of a file in the same directory as the URI (e.g.,
+	// "SHA256SUMS"), listing the hashes of multiple files in the
+	// format written by sha256sum(1).
+	ManifestName string
+}
+
+// ChecksumFilePolicy causes downloads of URIs matching any of the
+// patterns to be verified against checksum files, if no checksum.sri
+// qualifier is provided.
+type ChecksumFilePolicy struct {
+	URLPatterns []URLPattern
+
+	// Checksum files to consult, in order of preference.
+	ChecksumFiles []ChecksumFile
+
+	// Whether downloads fail if none of the checksum files is
+	// present. When false, such downloads are not verified.
+	Required bool
+}
+
+// Algorithms that may be used by checksum files, keyed by the length of
+// their hashes in hexadecimal form.
+var checksumFileAlgorithms = map[int]struct {
+	algorithm      string
+	digestFunction remoteexecution.DigestFunction_Value
+}{
+	40:  {"sha1", remoteexecution.DigestFunction_SHA1},
+	64:  {"sha256", remoteexecution.DigestFunction_SHA256},
+	96:  {"sha384", remoteexecution.DigestFunction_SHA384},
+	128: {"sha512", remoteexecution.DigestFunction_SHA512},
+}
+
+// getChecksumFromFiles obtains the hash against which the download of a
+// URI is verified from the checksum files of the first policy matching
+// the URI. If no policy matches, or if no checksum file is present and
+// the policy does not require one, nil is returned.
+func (hf *httpFetcher) getChecksumFromFiles(ctx context.Context, uri string, auth *AuthHeaders) (*checksumSRI, error) {
+	if len(hf.options.ChecksumFilePolicies) == 0 {
+		return nil, nil
+	}
+	parsedURI, err := url.Parse(uri)
+	if err != nil {
+		return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URI %#v", uri)
+	}
+	var policy *ChecksumFilePolicy
+	for i := range hf.options.ChecksumFilePolicies {
+		for _, pattern := range hf.options.ChecksumFilePolicies[i].URLPatterns {
+			if pattern.Matches(parsedURI) {
+				policy = &hf.options.ChecksumFilePolicies[i]
+				break
+			}
+		}
+		if policy != nil {
+			break
+		}
+	}
+	if policy == nil {
+		return nil, nil
+	}
+
+	for _, checksumFile := range policy.ChecksumFiles {
+		checksum, err := hf.getChecksumFromFile(ctx, uri, parsedURI, checksumFile, auth)
+		if err == nil {
+			return checksum, nil
+		}
+		if status.Code(err) != codes.NotFound {
+			return nil, err
+		}
+	}
+	if policy.Required {
+		return nil, status.Errorf(codes.NotFound, "No checksum file is present for URI %s, while one is required to verify its contents", uri)
+	}
+	return nil, nil
+}
+
+// getChecksumFromFile obtains the hash of a URI from a single checksum
+// file. NotFound is returned if the checksum file is absent, or if it
+// is a manifest that does not list the URI.
+func (hf *httpFetcher) getChecksumFromFile(ctx context.Context, uri string, parsedURI *url.URL, checksumFile ChecksumFile, auth *AuthHeaders) (*checksumSRI, error) {
+	checksumFileURI := checksumFile.getURL(parsedURI).String()
+
+	// Headers provided by the client for the URI also apply to
+	// its checksum file, as it is served by the same host.
+	checksumFileAuth := AuthHeaders{}
+	if auth != nil {
+		if headers, ok := (*auth)[uri]; ok {
+			checksumFileAuth[checksumFileURI] = headers
+		}
+	}
+	req, err := hf.newRequest(ctx, http.MethodGet, checksumFileURI, &checksumFileAuth)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hf.httpClient.Do(req)
+	if err != nil {
+		return nil, wrapDownloadError(ctx, err, "HTTP request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPStatusError(checksumFileURI, resp)
+	}
+	return checksumFile.parse(ctx, resp.Body, parsedURI, checksumFileURI)
+}
+
+// getURL returns the URL of the checksum file of a download.
+func (checksumFile *ChecksumFile) getURL(parsedURI *url.URL) *url.URL {
+	if checksumFile.ManifestName != "" {
+		return parsedURI.ResolveReference(&url.URL{Path: checksumFile.ManifestName})
+	}
+	u := *parsedURI
+	u.Path += checksumFile.Suffix
+	if u.RawPath != "" {
+		u.RawPath += checksumFile.Suffix
+	}
+	return &u
+}
+
+// parse reads the contents of the checksum file of a download,
+// returning the hash of the download contained in it. NotFound is
+// returned if the checksum file is a manifest that does not list the
+// download.
+func (checksumFile *ChecksumFile) parse(ctx context.Context, r io.Reader, parsedURI *url.URL, checksumFileURI string) (*checksumSRI, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maximumChecksumFileSizeBytes+1))
+	if err != nil {
+		return nil, wrapDownloadError(ctx, err, "Failed to read checksum file")
+	}
+	if len(data) > maximumChecksumFileSizeBytes {
+		return nil, status.Errorf(codes.Internal, "Checksum file %s exceeds the maximum size of %d bytes", checksumFileURI, maximumChecksumFileSizeBytes)
+	}
+
+	var hash string
+	if checksumFile.ManifestName != "" {
+		fileName := path.Base(parsedURI.Path)
+		var ok bool
+		if hash, ok = getHashFromChecksumManifest(string(data), fileName); !ok {
+			return nil, status.Errorf(codes.NotFound, "Checksum file %s does not list %#v", checksumFileURI, fileName)
+		}
+	} else if fields := strings.Fields(string(data)); len(fields) > 0 {
+		hash = fields[0]
+	}
+	return newChecksumFromFile(hash, checksumFileURI)
+}
+
+// getHashFromChecksumManifest returns the hash of a file listed in a
+// manifest written by sha256sum(1) and similar tools. Every line
+// contains a hash, followed by a space, a character indicating the
+// mode in which the file was read, and the name of the file.
+func getHashFromChecksumManifest(manifest, fileName string) (string, bool) {
+	for _, line := range strings.Split(manifest, "\n") {
+		hash, name, ok := strings.Cut(strings.TrimSuffix(line, "\r"), " ")
+		if !ok || len(name) == 0 {
+			continue
+		}
+		if name = strings.TrimPrefix(name[1:], "./"); name == fileName {
+			return hash, true
+		}
+	}
+	return "", false
+}
+
+// newChecksumFromFile converts a hash contained in a checksum file to
+// the form in which checksum.sri qualifiers are verified. The
+// algorithm is derived from the length of the hash.
+func newChecksumFromFile(hash, checksumFileURI string) (*checksumSRI, error) {
+	hash = strings.ToLower(hash)
+	algorithm, ok := checksumFileAlgorithms[len(hash)]
+	if _, err := hex.DecodeString(hash); err != nil || !ok {
+		return nil, status.Errorf(codes.Internal, "Checksum file %s does not contain a valid SHA-1, SHA-256, SHA-384 or SHA-512 hash", checksumFileURI)
+	}
+	instance := util.Must(bb_digest.NewInstanceName(""))
+	checksumFunction, err := instance.GetDigestFunction(algorithm.digestFunction, len(hash))
+	if err != nil {
+		return nil, util.StatusWrapfWithCode(err, codes.Internal, "Failed to get checksum function for checksum file %s", checksumFileURI)
+	}
+	return &checksumSRI{
+		algorithm: algorithm.algorithm,
+		source:    "checksum file " + checksumFileURI,
+		function:  checksumFunction,
+		hashes:    []string{hash},
+	}, nil
+}
@@ -0,0 +1,196 @@
+package fetch_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPFetcherFetchBlobChecksumFiles(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	artifact := "Contents of artifact"
+	sha256Hash := sha256.Sum256([]byte(artifact))
+	sha512Hash := sha512.Sum512([]byte(artifact))
+	otherHash := sha256.Sum256([]byte("Other artifact"))
+	files := map[string]string{
+		"/required/sidecar/file.tar.gz":                   artifact,
+		"/required/sidecar/file.tar.gz.sha256":            hex.EncodeToString(sha256Hash[:]) + "  file.tar.gz\n",
+		"/required/sha512/file.tar.gz":                    artifact,
+		"/required/sha512/file.tar.gz.sha512":             hex.EncodeToString(sha512Hash[:]),
+		"/required/manifest/file.tar.gz":                  artifact,
+		"/required/manifest/SHA256SUMS":                   hex.EncodeToString(otherHash[:]) + "  other.tar.gz\n" + hex.EncodeToString(sha256Hash[:]) + " *file.tar.gz\n",
+		"/required/corrupted/file.tar.gz":                 "Corrupted artifact",
+		"/required/corrupted/file.tar.gz.sha256":          hex.EncodeToString(sha256Hash[:]),
+		"/required/invalid/file.tar.gz":                   artifact,
+		"/required/invalid/file.tar.gz.sha256":            "Not a hash",
+		"/required/unverified/file.tar.gz":                artifact,
+		"/required/unlisted/file.tar.gz":                  artifact,
+		"/required/unlisted/SHA256SUMS":                   hex.EncodeToString(otherHash[:]) + "  other.tar.gz\n",
+		"/optional/unverified/file.tar.gz":                artifact,
+		"/authenticated/file.tar.gz":                      artifact,
+		"/authenticated/file.tar.gz.sha256":               hex.EncodeToString(sha256Hash[:]),
+		"/required/checksum-sri/file.tar.gz":              artifact,
+		"/required/checksum-sri/file.tar.gz.sha256":       hex.EncodeToString(otherHash[:]),
+		"/unmatched/file.tar.gz":                          artifact,
+		"/unmatched/file.tar.gz.sha256":                   hex.EncodeToString(otherHash[:]),
+		"/required/sidecar-precedence/file.tar.gz":        artifact,
+		"/required/sidecar-precedence/file.tar.gz.sha256": hex.EncodeToString(sha256Hash[:]),
+		"/required/sidecar-precedence/SHA256SUMS":         hex.EncodeToString(otherHash[:]) + "  file.tar.gz\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/authenticated/file.tar.gz" || r.URL.Path == "/authenticated/file.tar.gz.sha256" {
+			if r.Header.Get("Authorization") != "Bearer client" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		contents, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(contents))
+	}))
+	defer server.Close()
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	httpFetcher := fetch.NewHTTPFetcher(server.Client(), casBlobAccess, fetch.HTTPFetcherOptions{
+		ChecksumFilePolicies: []fetch.ChecksumFilePolicy{
+			{
+				URLPatterns: []fetch.URLPattern{
+					fetch.URLPattern(server.URL + "/required/"),
+					fetch.URLPattern(server.URL + "/authenticated/"),
+				},
+				ChecksumFiles: []fetch.ChecksumFile{
+					{Suffix: ".sha256"},
+					{Suffix: ".sha512"},
+					{ManifestName: "SHA256SUMS"},
+				},
+				Required: true,
+			},
+			{
+				URLPatterns: []fetch.URLPattern{
+					fetch.URLPattern(server.URL + "/optional/"),
+				},
+				ChecksumFiles: []fetch.ChecksumFile{
+					{Suffix: ".sha256"},
+				},
+			},
+		},
+	})
+	expectArtifact := func() {
+		casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, blobDigest bb_digest.Digest, b buffer.Buffer) error {
+				data, err := b.ToByteSlice(1 << 20)
+				require.NoError(t, err)
+				require.Equal(t, artifact, string(data))
+				return nil
+			})
+	}
+	fetchBlob := func(path string, qualifiers ...*remoteasset.Qualifier) (*remoteasset.FetchBlobResponse, error) {
+		return httpFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris:       []string{server.URL + path},
+			Qualifiers: qualifiers,
+		})
+	}
+
+	for _, path := range []string{
+		"/required/sidecar/file.tar.gz",
+		"/required/sha512/file.tar.gz",
+		"/required/manifest/file.tar.gz",
+		// Checksum files are consulted in order of preference,
+		// meaning the manifest containing an incorrect hash is
+		// not used.
+		"/required/sidecar-precedence/file.tar.gz",
+		// Downloads not matching any policy are not verified.
+		"/unmatched/file.tar.gz",
+		// Policies may permit checksum files to be absent.
+		"/optional/unverified/file.tar.gz",
+	} {
+		t.Run("Success"+path, func(t *testing.T) {
+			expectArtifact()
+			response, err := fetchBlob(path)
+			require.NoError(t, err)
+			require.Equal(t, server.URL+path, response.Uri)
+		})
+	}
+
+	t.Run("ClientHeaders", func(t *testing.T) {
+		// Headers provided by the client for a URI are also sent
+		// when requesting its checksum file.
+		expectArtifact()
+		_, err := fetchBlob("/authenticated/file.tar.gz", &remoteasset.Qualifier{
+			Name:  "http_header:Authorization",
+			Value: "Bearer client",
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("ChecksumSRI", func(t *testing.T) {
+		// The checksum.sri qualifier takes precedence over
+		// checksum files.
+		expectArtifact()
+		_, err := fetchBlob("/required/checksum-sri/file.tar.gz", &remoteasset.Qualifier{
+			Name:  "checksum.sri",
+			Value: "sha256-" + base64.StdEncoding.EncodeToString(sha256Hash[:]),
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		corruptedHash := sha256.Sum256([]byte("Corrupted artifact"))
+		_, err := fetchBlob("/required/corrupted/file.tar.gz")
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: Fetched content did not match sha256 hash of checksum file %s/required/corrupted/file.tar.gz.sha256: Expected %s, Got %s", server.URL, hex.EncodeToString(sha256Hash[:]), hex.EncodeToString(corruptedHash[:])), err)
+	})
+
+	t.Run("MismatchFallsBackToNextURI", func(t *testing.T) {
+		// A mirror serving content that does not match its
+		// checksum file should not prevent other URIs from
+		// being attempted.
+		expectArtifact()
+		response, err := httpFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{
+				server.URL + "/required/corrupted/file.tar.gz",
+				server.URL + "/required/sidecar/file.tar.gz",
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, server.URL+"/required/sidecar/file.tar.gz", response.Uri)
+	})
+
+	t.Run("InvalidChecksumFile", func(t *testing.T) {
+		_, err := fetchBlob("/required/invalid/file.tar.gz")
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: Checksum file %s/required/invalid/file.tar.gz.sha256 does not contain a valid SHA-1, SHA-256, SHA-384 or SHA-512 hash", server.URL), err)
+	})
+
+	t.Run("RequiredChecksumFileMissing", func(t *testing.T) {
+		// Downloads for which no checksum file is present must
+		// fail if the policy requires one, without downloading
+		// the file.
+		_, err := fetchBlob("/required/unverified/file.tar.gz")
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: No checksum file is present for URI %s/required/unverified/file.tar.gz, while one is required to verify its contents", server.URL), err)
+	})
+
+	t.Run("NotListedInManifest", func(t *testing.T) {
+		_, err := fetchBlob("/required/unlisted/file.tar.gz")
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: No checksum file is present for URI %s/required/unlisted/file.tar.gz, while one is required to verify its contents", server.URL), err)
+	})
+}
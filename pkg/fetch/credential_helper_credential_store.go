@@ -0,0 +1,147 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buildbarn/bb-storage/pkg/clock"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// credentialHelperRequest is the request that is written to the
+// standard input of a credential helper, as described in
+// https://github.com/EngFlow/credential-helper-spec.
+type credentialHelperRequest struct {
+	URI string `json:"uri"`
+}
+
+// credentialHelperResponse is the response that a credential helper
+// writes to its standard output.
+type credentialHelperResponse struct {
+	Headers map[string][]string `json:"headers"`
+	Expires string              `json:"expires,omitempty"`
+}
+
+type cachedCredentials struct {
+	headers   http.Header
+	expiresAt time.Time
+}
+
+type credentialHelperCredentialStore struct {
+	path                 string
+	arguments            []string
+	timeout              time.Duration
+	defaultCacheDuration time.Duration
+	clock                clock.Clock
+
+	lock  sync.Mutex
+	cache map[string]cachedCredentials
+}
+
+// NewCredentialHelperCredentialStore creates a CredentialStore that
+// obtains credentials by running a credential helper, using the same
+// protocol as Bazel's --credential_helper flag. The helper is invoked
+// with the "get" command. Headers it returns are cached until the
+// expiration time it provides, or for a default duration if it does
+// not provide one.
+func NewCredentialHelperCredentialStore(path string, arguments []string, timeout, defaultCacheDuration time.Duration, clock clock.Clock) CredentialStore {
+	return &credentialHelperCredentialStore{
+		path:                 path,
+		arguments:            arguments,
+		timeout:              timeout,
+		defaultCacheDuration: defaultCacheDuration,
+		clock:                clock,
+		cache:                map[string]cachedCredentials{},
+	}
+}
+
+func (cs *credentialHelperCredentialStore) GetCredentials(ctx context.Context, uri *url.URL) (http.Header, error) {
+	key := uri.String()
+	now := cs.clock.Now()
+	cs.lock.Lock()
+	cached, ok := cs.cache[key]
+	cs.lock.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.headers, nil
+	}
+
+	headers, expiresAt, err := cs.runHelper(ctx, key, now)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	// Prevent the cache from growing indefinitely by purging
+	// entries that have expired.
+	for cachedKey, cached := range cs.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(cs.cache, cachedKey)
+		}
+	}
+	if now.Before(expiresAt) {
+		cs.cache[key] = cachedCredentials{
+			headers:   headers,
+			expiresAt: expiresAt,
+		}
+	}
+	return headers, nil
+}
+
+// runHelper invokes the credential helper for a single URI, returning
+// the headers it provided and the time at which they expire.
+func (cs *credentialHelperCredentialStore) runHelper(ctx context.Context, uri string, now time.Time) (http.Header, time.Time, error) {
+	if cs.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.timeout)
+		defer cancel()
+	}
+
+	request, err := json.Marshal(credentialHelperRequest{URI: uri})
+	if err != nil {
+		return nil, time.Time{}, util.StatusWrapWithCode(err, codes.Internal, "Failed to marshal credential helper request")
+	}
+	cmd := exec.CommandContext(ctx, cs.path, append(append([]string(nil), cs.arguments...), "get")...)
+	cmd.Stdin = bytes.NewReader(request)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, time.Time{}, util.StatusFromContext(ctx)
+		}
+		return nil, time.Time{}, status.Errorf(codes.Unavailable, "Credential helper %#v failed: %v: %s", cs.path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var response credentialHelperResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, time.Time{}, util.StatusWrapfWithCode(err, codes.Internal, "Credential helper %#v returned a malformed response", cs.path)
+	}
+	expiresAt := now.Add(cs.defaultCacheDuration)
+	if response.Expires != "" {
+		expiresAt, err = time.Parse(time.RFC3339, response.Expires)
+		if err != nil {
+			return nil, time.Time{}, util.StatusWrapfWithCode(err, codes.Internal, "Credential helper %#v returned a malformed expiration time", cs.path)
+		}
+	}
+	if len(response.Headers) == 0 {
+		return nil, expiresAt, nil
+	}
+	headers := http.Header{}
+	for name, values := range response.Headers {
+		for _, value := range values {
+			headers.Add(name, value)
+		}
+	}
+	return headers, expiresAt, nil
+}
@@ -0,0 +1,86 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/clock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// writeCredentialHelper writes a stub credential helper that records
+// its invocations and prints a fixed response.
+func writeCredentialHelper(t *testing.T, response string) (string, string) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "log")
+	responsePath := filepath.Join(dir, "response")
+	require.NoError(t, os.WriteFile(responsePath, []byte(response), 0o644))
+	helperPath := filepath.Join(dir, "helper.sh")
+	require.NoError(t, os.WriteFile(helperPath, []byte("#!/bin/sh\necho \"$@ $(cat)\" >> "+logPath+"\ncat "+responsePath+"\n"), 0o755))
+	return helperPath, logPath
+}
+
+func readCredentialHelperLog(t *testing.T, logPath string) string {
+	log, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	return string(log)
+}
+
+func TestCredentialHelperCredentialStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Cached", func(t *testing.T) {
+		helperPath, logPath := writeCredentialHelper(t, `{"headers": {"Authorization": ["Bearer token"]}, "expires": "`+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+`"}`)
+		credentialStore := fetch.NewCredentialHelperCredentialStore(helperPath, []string{"--verbose"}, 10*time.Second, time.Minute, clock.SystemClock)
+
+		for i := 0; i < 2; i++ {
+			headers, err := credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/file"))
+			require.NoError(t, err)
+			require.Equal(t, http.Header{"Authorization": []string{"Bearer token"}}, headers)
+		}
+		require.Equal(t, "--verbose get {\"uri\":\"https://example.com/file\"}\n", readCredentialHelperLog(t, logPath))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		helperPath, logPath := writeCredentialHelper(t, `{"headers": {"Authorization": ["Bearer token"]}, "expires": "2000-01-01T00:00:00Z"}`)
+		credentialStore := fetch.NewCredentialHelperCredentialStore(helperPath, nil, 10*time.Second, time.Minute, clock.SystemClock)
+
+		for i := 0; i < 2; i++ {
+			headers, err := credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/file"))
+			require.NoError(t, err)
+			require.Equal(t, http.Header{"Authorization": []string{"Bearer token"}}, headers)
+		}
+		require.Equal(t, "get {\"uri\":\"https://example.com/file\"}\nget {\"uri\":\"https://example.com/file\"}\n", readCredentialHelperLog(t, logPath))
+	})
+
+	t.Run("NoHeaders", func(t *testing.T) {
+		helperPath, _ := writeCredentialHelper(t, `{}`)
+		credentialStore := fetch.NewCredentialHelperCredentialStore(helperPath, nil, 10*time.Second, time.Minute, clock.SystemClock)
+
+		headers, err := credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/file"))
+		require.NoError(t, err)
+		require.Nil(t, headers)
+	})
+
+	t.Run("MalformedResponse", func(t *testing.T) {
+		helperPath, _ := writeCredentialHelper(t, `Hello`)
+		credentialStore := fetch.NewCredentialHelperCredentialStore(helperPath, nil, 10*time.Second, time.Minute, clock.SystemClock)
+
+		_, err := credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/file"))
+		require.Equal(t, codes.Internal, status.Code(err))
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		credentialStore := fetch.NewCredentialHelperCredentialStore("/nonexistent", nil, 10*time.Second, time.Minute, clock.SystemClock)
+
+		_, err := credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/file"))
+		require.Equal(t, codes.Unavailable, status.Code(err))
+	})
+}
@@ -0,0 +1,237 @@
+package fetch
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CredentialStore provides the headers that the server uses to
+// authenticate against upstream hosts, as opposed to headers that are
+// provided by clients through qualifiers. A nil header is returned if
+// no credentials are known for a URI.
+type CredentialStore interface {
+	GetCredentials(ctx context.Context, uri *url.URL) (http.Header, error)
+}
+
+// CredentialPrecedence determines how credentials provided by the
+// CredentialStore are merged with headers provided by clients.
+type CredentialPrecedence int
+
+const (
+	// ClientCredentialPrecedence causes headers provided by clients to
+	// override credentials of the server with the same name.
+	ClientCredentialPrecedence CredentialPrecedence = iota
+	// ServerCredentialPrecedence causes credentials of the server to
+	// override headers provided by clients with the same name.
+	ServerCredentialPrecedence
+	// ServerOnlyCredentialPrecedence causes headers provided by
+	// clients to be ignored entirely for URIs for which the server
+	// has credentials.
+	ServerOnlyCredentialPrecedence
+)
+
+// CredentialSource yields the headers that should be sent to a host
+// for which credentials are configured.
+type CredentialSource interface {
+	GetHeaders() (http.Header, error)
+}
+
+type staticCredentialSource struct {
+	headers http.Header
+}
+
+// NewStaticCredentialSource creates a CredentialSource that always
+// yields the same set of headers.
+func NewStaticCredentialSource(headers http.Header) CredentialSource {
+	return &staticCredentialSource{
+		headers: headers,
+	}
+}
+
+// NewBasicAuthCredentialSource creates a CredentialSource that yields
+// an Authorization header for HTTP basic authentication.
+func NewBasicAuthCredentialSource(username, password string) CredentialSource {
+	return NewStaticCredentialSource(http.Header{
+		"Authorization": []string{"Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))},
+	})
+}
+
+func (cs *staticCredentialSource) GetHeaders() (http.Header, error) {
+	return cs.headers, nil
+}
+
+// reloadingFile holds the contents of a file, which are reloaded when
+// its modification time or size changes. This permits credentials to
+// be rotated without restarting the server.
+type reloadingFile struct {
+	path string
+
+	lock      sync.Mutex
+	modTime   time.Time
+	sizeBytes int64
+	contents  []byte
+}
+
+func (f *reloadingFile) get() ([]byte, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, util.StatusWrapfWithCode(err, codes.Internal, "Failed to stat %#v", f.path)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.contents == nil || !info.ModTime().Equal(f.modTime) || info.Size() != f.sizeBytes {
+		contents, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.Internal, "Failed to read %#v", f.path)
+		}
+		f.modTime = info.ModTime()
+		f.sizeBytes = info.Size()
+		f.contents = contents
+	}
+	return f.contents, nil
+}
+
+type bearerTokenFileCredentialSource struct {
+	file reloadingFile
+}
+
+// NewBearerTokenFileCredentialSource creates a CredentialSource that
+// yields an Authorization header containing a bearer token that is
+// read from a file. The file is read again when it changes.
+func NewBearerTokenFileCredentialSource(path string) CredentialSource {
+	return &bearerTokenFileCredentialSource{
+		file: reloadingFile{path: path},
+	}
+}
+
+func (cs *bearerTokenFileCredentialSource) GetHeaders() (http.Header, error) {
+	contents, err := cs.file.get()
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return nil, status.Errorf(codes.Internal, "Bearer token file %#v is empty", cs.file.path)
+	}
+	return http.Header{
+		"Authorization": []string{"Bearer " + token},
+	}, nil
+}
+
+// URLPattern matches URLs either by host name or by prefix. Patterns
+// containing "://" are URL prefixes, such as
+// "https://example.com/private/". These match URLs having the same
+// scheme, host and port, and a path that is equal to or underneath the
+// path of the pattern. Other patterns are host names, where a leading
+// "*." matches any subdomain, such as "*.example.com".
+type URLPattern string
+
+// Matches returns whether a URL matches the pattern.
+func (p URLPattern) Matches(uri *url.URL) bool {
+	pattern := string(p)
+	if strings.Contains(pattern, "://") {
+		prefix, err := url.Parse(pattern)
+		if err != nil || !strings.EqualFold(uri.Scheme, prefix.Scheme) || !strings.EqualFold(uri.Host, prefix.Host) {
+			return false
+		}
+		// Only match paths on component boundaries, so that
+		// "/private" does not match "/private-other".
+		prefixPath, uriPath := prefix.EscapedPath(), uri.EscapedPath()
+		if !strings.HasSuffix(prefixPath, "/") {
+			if uriPath == prefixPath {
+				return true
+			}
+			prefixPath += "/"
+		}
+		return strings.HasPrefix(uriPath, prefixPath) || uriPath+"/" == prefixPath
+	}
+	host := strings.ToLower(uri.Hostname())
+	pattern = strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+type patternCredentialStore struct {
+	patterns []URLPattern
+	source   CredentialSource
+}
+
+// NewPatternCredentialStore creates a CredentialStore that yields the
+// headers of a CredentialSource for all URLs matching one of the
+// provided patterns.
+func NewPatternCredentialStore(patterns []URLPattern, source CredentialSource) CredentialStore {
+	return &patternCredentialStore{
+		patterns: patterns,
+		source:   source,
+	}
+}
+
+func (cs *patternCredentialStore) GetCredentials(ctx context.Context, uri *url.URL) (http.Header, error) {
+	for _, pattern := range cs.patterns {
+		if pattern.Matches(uri) {
+			return cs.source.GetHeaders()
+		}
+	}
+	return nil, nil
+}
+
+type filteringCredentialStore struct {
+	patterns []URLPattern
+	store    CredentialStore
+}
+
+// NewFilteringCredentialStore creates a decorator for CredentialStore
+// that only consults the underlying CredentialStore for URLs matching
+// one of the provided patterns.
+func NewFilteringCredentialStore(patterns []URLPattern, store CredentialStore) CredentialStore {
+	return &filteringCredentialStore{
+		patterns: patterns,
+		store:    store,
+	}
+}
+
+func (cs *filteringCredentialStore) GetCredentials(ctx context.Context, uri *url.URL) (http.Header, error) {
+	for _, pattern := range cs.patterns {
+		if pattern.Matches(uri) {
+			return cs.store.GetCredentials(ctx, uri)
+		}
+	}
+	return nil, nil
+}
+
+type multiCredentialStore struct {
+	stores []CredentialStore
+}
+
+// NewMultiCredentialStore creates a CredentialStore that consults
+// multiple CredentialStores in order, returning the credentials of
+// the first one that has credentials for a URI.
+func NewMultiCredentialStore(stores []CredentialStore) CredentialStore {
+	return &multiCredentialStore{
+		stores: stores,
+	}
+}
+
+func (cs *multiCredentialStore) GetCredentials(ctx context.Context, uri *url.URL) (http.Header, error) {
+	for _, store := range cs.stores {
+		headers, err := store.GetCredentials(ctx, uri)
+		if err != nil || headers != nil {
+			return headers, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,117 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseURL(t *testing.T, uri string) *url.URL {
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	return u
+}
+
+func TestURLPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern fetch.URLPattern
+		uri     string
+		matches bool
+	}{
+		{"example.com", "https://example.com/foo", true},
+		{"example.com", "https://EXAMPLE.com:8443/foo", true},
+		{"example.com", "https://www.example.com/foo", false},
+		{"*.example.com", "https://www.example.com/foo", true},
+		{"*.example.com", "https://example.com/foo", false},
+		{"*.example.com", "https://evil-example.com/foo", false},
+		{"https://example.com/private/", "https://example.com/private/foo", true},
+		{"https://example.com/private/", "https://example.com/public/foo", false},
+		{"https://example.com/private/", "http://example.com/private/foo", false},
+		{"https://example.com/private/", "https://EXAMPLE.com/private/foo", true},
+		{"https://example.com/private", "https://example.com/private", true},
+		{"https://example.com/private", "https://example.com/private/foo", true},
+		{"https://example.com/private", "https://example.com/private-foo", false},
+		{"https://example.com", "https://example.com/foo", true},
+		{"https://example.com", "https://example.com.attacker.net/", false},
+		{"https://example.com", "https://example.com@evil/", false},
+		{"https://example.com", "https://example.com:8443/foo", false},
+		{"https://example.com:8443/", "https://example.com:8443/foo", true},
+	} {
+		require.Equal(t, tc.matches, tc.pattern.Matches(mustParseURL(t, tc.uri)), "%s %s", tc.pattern, tc.uri)
+	}
+}
+
+func TestMultiCredentialStore(t *testing.T) {
+	ctx := context.Background()
+	credentialStore := fetch.NewMultiCredentialStore([]fetch.CredentialStore{
+		fetch.NewPatternCredentialStore(
+			[]fetch.URLPattern{"https://example.com/private/"},
+			fetch.NewStaticCredentialSource(http.Header{"X-Api-Key": []string{"secret"}})),
+		fetch.NewPatternCredentialStore(
+			[]fetch.URLPattern{"example.com"},
+			fetch.NewBasicAuthCredentialSource("user", "pass")),
+	})
+
+	headers, err := credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/private/file"))
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"X-Api-Key": []string{"secret"}}, headers)
+
+	headers, err = credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/file"))
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"Authorization": []string{"Basic dXNlcjpwYXNz"}}, headers)
+
+	headers, err = credentialStore.GetCredentials(ctx, mustParseURL(t, "https://other.com/file"))
+	require.NoError(t, err)
+	require.Nil(t, headers)
+}
+
+func TestBearerTokenFileCredentialSource(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("token1\n"), 0o600))
+	credentialSource := fetch.NewBearerTokenFileCredentialSource(tokenPath)
+
+	headers, err := credentialSource.GetHeaders()
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"Authorization": []string{"Bearer token1"}}, headers)
+
+	// Rotating the token should be picked up without recreating
+	// the credential source.
+	require.NoError(t, os.WriteFile(tokenPath, []byte("token2\n"), 0o600))
+	require.NoError(t, os.Chtimes(tokenPath, time.Now(), time.Now().Add(time.Minute)))
+	headers, err = credentialSource.GetHeaders()
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"Authorization": []string{"Bearer token2"}}, headers)
+}
+
+func TestNetrcCredentialStore(t *testing.T) {
+	ctx := context.Background()
+	netrcPath := filepath.Join(t.TempDir(), "netrc")
+	require.NoError(t, os.WriteFile(netrcPath, []byte(`# Comment
+default login anonymous password guest
+
+macdef init
+cd /pub
+
+machine example.com
+  login user
+  password pass
+`), 0o600))
+	credentialStore := fetch.NewNetrcCredentialStore(netrcPath)
+
+	headers, err := credentialStore.GetCredentials(ctx, mustParseURL(t, "https://example.com/file"))
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"Authorization": []string{"Basic dXNlcjpwYXNz"}}, headers)
+
+	// Default entries must be ignored, as they would send
+	// credentials to arbitrary hosts.
+	headers, err = credentialStore.GetCredentials(ctx, mustParseURL(t, "https://other.com/file"))
+	require.NoError(t, err)
+	require.Nil(t, headers)
+}
@@ -0,0 +1,91 @@
+package fetch
+
+import (
+	"net"
+	"net/netip"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultDeniedNetworks are the networks to which the HTTP fetcher may
+// not connect by default. These cover loopback, link-local (including
+// cloud metadata endpoints), private and otherwise non-public ranges.
+var DefaultDeniedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("255.255.255.255/32"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	// NAT64 and 6to4 addresses embed IPv4 addresses, which may
+	// be part of any of the ranges above.
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// DialPolicy decides which IP addresses the HTTP fetcher may connect
+// to, protecting against server-side request forgery. The policy is
+// enforced on every connection that is established, after DNS
+// resolution has taken place. This means that it also applies to
+// redirects and cannot be bypassed by DNS rebinding.
+type DialPolicy struct {
+	deniedNetworks  []netip.Prefix
+	allowedNetworks []netip.Prefix
+}
+
+// NewDialPolicy creates a DialPolicy that denies connections to the
+// provided networks, unless they are also part of one of the allowed
+// networks.
+func NewDialPolicy(deniedNetworks, allowedNetworks []netip.Prefix) *DialPolicy {
+	return &DialPolicy{
+		deniedNetworks:  deniedNetworks,
+		allowedNetworks: allowedNetworks,
+	}
+}
+
+// IsAllowed returns whether a connection to an IP address is permitted.
+func (dp *DialPolicy) IsAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range dp.allowedNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	for _, network := range dp.deniedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Control can be used as the Control function of a net.Dialer. It is
+// called for every address to which a connection is attempted,
+// returning an error if the address is not permitted.
+func (dp *DialPolicy) Control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !dp.IsAllowed(addr) {
+		return status.Errorf(codes.PermissionDenied, "Connecting to address %s is not permitted", addr)
+	}
+	return nil
+}
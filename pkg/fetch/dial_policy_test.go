@@ -0,0 +1,71 @@
+package fetch_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialPolicyIsAllowed(t *testing.T) {
+	dialPolicy := fetch.NewDialPolicy(
+		append(fetch.DefaultDeniedNetworks, netip.MustParsePrefix("203.0.113.0/24")),
+		[]netip.Prefix{netip.MustParsePrefix("10.1.2.0/24")})
+
+	for address, allowed := range map[string]bool{
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"::ffff:127.0.0.1": false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"10.0.0.1":         false,
+		"172.16.5.4":       false,
+		"192.168.1.1":      false,
+		"192.0.0.8":        false,
+		"198.18.0.1":       false,
+		"198.19.255.254":   false,
+		"240.0.0.1":        false,
+		"255.255.255.255":  false,
+		"198.20.0.1":       true,
+		"fd00::1":          false,
+		"64:ff9b::7f00:1":  false,
+		"2002:7f00:1::1":   false,
+		"203.0.113.7":      false,
+		"10.1.2.3":         true,
+	} {
+		require.Equal(t, allowed, dialPolicy.IsAllowed(netip.MustParseAddr(address)), address)
+	}
+}
+
+func TestDialPolicyControl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+	}))
+	defer server.Close()
+
+	newClient := func(dialPolicy *fetch.DialPolicy) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{Control: dialPolicy.Control}).DialContext,
+			},
+		}
+	}
+
+	t.Run("Denied", func(t *testing.T) {
+		_, err := newClient(fetch.NewDialPolicy(fetch.DefaultDeniedNetworks, nil)).Get(server.URL)
+		require.ErrorContains(t, err, "is not permitted")
+	})
+
+	t.Run("Allowed", func(t *testing.T) {
+		resp, err := newClient(fetch.NewDialPolicy(fetch.DefaultDeniedNetworks, []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})).Get(server.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
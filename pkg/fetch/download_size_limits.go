@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+)
+
+// DownloadSizeLimit is the maximum size of blobs that may be downloaded
+// on behalf of requests matching an instance name prefix and, if
+// provided, a resource type.
+type DownloadSizeLimit struct {
+	InstanceNamePrefix bb_digest.InstanceName
+	// Value of the resource_type qualifier to which the limit
+	// applies. When empty, the limit applies to all resource types.
+	ResourceType string
+	// Maximum size in bytes. Zero means unlimited.
+	MaximumSizeBytes int64
+}
+
+// DownloadSizeLimits bounds the size of blobs that the HTTP fetcher is
+// willing to download, so that a single request for a huge or endless
+// resource cannot exhaust the server's disk.
+type DownloadSizeLimits struct {
+	// Maximum size in bytes of blobs downloaded for requests that do
+	// not match any of the overrides. Zero means unlimited.
+	DefaultMaximumSizeBytes int64
+	// Limits for specific instance names and resource types. The
+	// first override matching a request is used.
+	Overrides []DownloadSizeLimit
+}
+
+// GetMaximumSizeBytes returns the maximum size of blobs that may be
+// downloaded for a request, or zero if the size is unlimited.
+func (l *DownloadSizeLimits) GetMaximumSizeBytes(instanceName bb_digest.InstanceName, qualifiers []*remoteasset.Qualifier) int64 {
+	resourceType := ""
+	for _, q := range qualifiers {
+		if q.Name == "resource_type" {
+			resourceType = q.Value
+		}
+	}
+	components := instanceName.GetComponents()
+	for _, override := range l.Overrides {
+		if override.ResourceType != "" && override.ResourceType != resourceType {
+			continue
+		}
+		if hasInstanceNamePrefix(components, override.InstanceNamePrefix.GetComponents()) {
+			return override.MaximumSizeBytes
+		}
+	}
+	return l.DefaultMaximumSizeBytes
+}
+
+func hasInstanceNamePrefix(components, prefix []string) bool {
+	if len(prefix) > len(components) {
+		return false
+	}
+	for i, component := range prefix {
+		if components[i] != component {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,291 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fileFetcherRoot is a directory from which files may be served.
+type fileFetcherRoot struct {
+	path string
+	root *os.Root
+}
+
+type fileFetcher struct {
+	contentAddressableStorage blobstore.BlobAccess
+	roots                     []fileFetcherRoot
+	scratchStorage            *scratch.Storage
+}
+
+// NewFileFetcher creates a Fetcher that serves file:// URIs from local
+// directories, such as read-only mirrors of third-party archives.
+// Only files and directories beneath one of the allowed root
+// directories may be accessed. Symbolic links are followed, as long as
+// they don't point outside of the root directory containing them.
+func NewFileFetcher(contentAddressableStorage blobstore.BlobAccess, allowedRootDirectories []string, scratchStorage *scratch.Storage) (Fetcher, error) {
+	roots := make([]fileFetcherRoot, 0, len(allowedRootDirectories))
+	for _, rootDirectory := range allowedRootDirectories {
+		if !path.IsAbs(rootDirectory) {
+			return nil, status.Errorf(codes.InvalidArgument, "Allowed root directory %#v is not an absolute path", rootDirectory)
+		}
+		root, err := os.OpenRoot(rootDirectory)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Failed to open allowed root directory %#v", rootDirectory)
+		}
+		roots = append(roots, fileFetcherRoot{
+			path: path.Clean(rootDirectory),
+			root: root,
+		})
+	}
+	if scratchStorage == nil {
+		scratchStorage = scratch.NewDefaultStorage()
+	}
+	return &fileFetcher{
+		contentAddressableStorage: contentAddressableStorage,
+		roots:                     roots,
+		scratchStorage:            scratchStorage,
+	}, nil
+}
+
+// resolve converts a file:// URI to the root directory containing it
+// and the path of the file relative to that root directory.
+func (ff *fileFetcher) resolve(uri string) (*os.Root, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid URI")
+	}
+	if u.Scheme != "file" {
+		return nil, "", status.Errorf(codes.InvalidArgument, "URI has scheme %#v, while only \"file\" is supported", u.Scheme)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, "", status.Errorf(codes.InvalidArgument, "URI refers to host %#v, while only local files are supported", u.Host)
+	}
+	if !path.IsAbs(u.Path) {
+		return nil, "", status.Errorf(codes.InvalidArgument, "URI has path %#v, which is not absolute", u.Path)
+	}
+
+	p := path.Clean(u.Path)
+	for _, root := range ff.roots {
+		if p == root.path {
+			return root.root, ".", nil
+		}
+		prefix := root.path
+		if prefix != "/" {
+			prefix += "/"
+		}
+		if relativePath, ok := strings.CutPrefix(p, prefix); ok {
+			return root.root, relativePath, nil
+		}
+	}
+	return nil, "", status.Errorf(codes.PermissionDenied, "Path %#v is not beneath any of the allowed root directories", p)
+}
+
+// wrapFileError converts an error returned by os.Root to a gRPC
+// status, so that missing files can be told apart from other errors,
+// such as paths escaping the root directory.
+func wrapFileError(err error, msg string) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return util.StatusWrapWithCode(err, codes.NotFound, msg)
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return util.StatusWrapWithCode(err, codes.PermissionDenied, msg)
+	}
+	return util.StatusWrapWithCode(err, codes.Internal, msg)
+}
+
+func (ff *fileFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := getChecksumSri(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		blobDigest, checksumMismatch, err := ff.uploadFile(ctx, uri, digestFunction, checksum)
+		if err != nil {
+			log.Printf("Error reading blob with URI %s: %v", uri, err)
+			if checksumMismatch || ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		return &remoteasset.FetchBlobResponse{
+			Status:     status.New(codes.OK, "Blob fetched successfully!").Proto(),
+			Uri:        uri,
+			Qualifiers: req.Qualifiers,
+			BlobDigest: blobDigest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to read blob from any provided URI")
+}
+
+// uploadFile writes the contents of a file into the CAS. As the file
+// is read twice, once for computing its digest and once for uploading
+// it, the contents are validated while uploading. It is reported
+// whether the contents did not match the checksum.sri qualifier, as
+// there is no point in attempting other URIs in that case.
+func (ff *fileFetcher) uploadFile(ctx context.Context, uri string, digestFunction bb_digest.Function, checksum *checksumSRI) (bb_digest.Digest, bool, error) {
+	root, relativePath, err := ff.resolve(uri)
+	if err != nil {
+		return bb_digest.BadDigest, false, err
+	}
+	f, err := root.Open(relativePath)
+	if err != nil {
+		return bb_digest.BadDigest, false, wrapFileError(err, "Failed to open file")
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return bb_digest.BadDigest, false, wrapFileError(err, "Failed to obtain file properties")
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return bb_digest.BadDigest, false, status.Errorf(codes.InvalidArgument, "Path %#v is not a regular file", relativePath)
+	}
+
+	sizeBytes := fileInfo.Size()
+	hasher := digestFunction.NewGenerator(sizeBytes)
+	verifier := checksum.newVerifier(sizeBytes)
+	if _, err := io.Copy(io.MultiWriter(hasher, verifier), io.NewSectionReader(f, 0, sizeBytes)); err != nil {
+		return bb_digest.BadDigest, false, wrapFileError(err, "Failed to read file")
+	}
+	if err := verifier.verify(); err != nil {
+		return bb_digest.BadDigest, true, err
+	}
+
+	blobDigest := hasher.Sum()
+	if err := ff.contentAddressableStorage.Put(ctx, blobDigest, buffer.NewCASBufferFromReader(blobDigest, io.NopCloser(io.NewSectionReader(f, 0, sizeBytes)), buffer.UserProvided)); err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrapWithCode(err, codes.Internal, "Failed to place blob into CAS")
+	}
+	return blobDigest, false, nil
+}
+
+func (ff *fileFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+	// Directories on disk have no canonical serialization against
+	// which checksum.sri could be verified. Ignoring it would cause
+	// unverified contents to be cached under the qualifier.
+	for _, q := range req.Qualifiers {
+		if q.Name == "checksum.sri" {
+			return nil, status.Error(codes.InvalidArgument, "The checksum.sri qualifier is not supported when fetching directories from the local file system")
+		}
+	}
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		rootDirectoryDigest, err := ff.uploadDirectory(ctx, uri, digestFunction)
+		if err != nil {
+			log.Printf("Error reading directory with URI %s: %v", uri, err)
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		return &remoteasset.FetchDirectoryResponse{
+			Status:              status.New(codes.OK, "Directory fetched successfully!").Proto(),
+			Uri:                 uri,
+			Qualifiers:          req.Qualifiers,
+			RootDirectoryDigest: rootDirectoryDigest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to read directory from any provided URI")
+}
+
+// uploadDirectory writes the contents of a directory into the CAS,
+// returning the digest of the resulting Directory hierarchy.
+func (ff *fileFetcher) uploadDirectory(ctx context.Context, uri string, digestFunction bb_digest.Function) (bb_digest.Digest, error) {
+	root, relativePath, err := ff.resolve(uri)
+	if err != nil {
+		return bb_digest.BadDigest, err
+	}
+	fileInfo, err := root.Stat(relativePath)
+	if err != nil {
+		return bb_digest.BadDigest, wrapFileError(err, "Failed to obtain directory properties")
+	}
+	if !fileInfo.IsDir() {
+		return bb_digest.BadDigest, status.Errorf(codes.InvalidArgument, "Path %#v is not a directory", relativePath)
+	}
+
+	// Walk the directory using a root that is confined to it, so that
+	// symbolic links pointing outside of the directory are rejected.
+	directoryRoot, err := root.OpenRoot(relativePath)
+	if err != nil {
+		return bb_digest.BadDigest, wrapFileError(err, "Failed to open directory")
+	}
+	defer directoryRoot.Close()
+
+	builder := directory.NewBuilder(ff.contentAddressableStorage, digestFunction, ff.scratchStorage)
+	fsys := directoryRoot.FS()
+	if err := fs.WalkDir(fsys, ".", func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return wrapFileError(err, "Failed to read directory")
+		}
+		if ctx.Err() != nil {
+			return util.StatusFromContext(ctx)
+		}
+		if p == "." {
+			return nil
+		}
+		switch entry.Type() {
+		case fs.ModeDir:
+			return builder.AddDirectory(p)
+		case fs.ModeSymlink:
+			target, err := fs.ReadLink(fsys, p)
+			if err != nil {
+				return wrapFileError(err, "Failed to read symbolic link")
+			}
+			return builder.AddSymlink(p, target)
+		case 0:
+			return ff.addFile(ctx, builder, directoryRoot, p)
+		default:
+			return status.Errorf(codes.InvalidArgument, "Path %#v has unsupported file type %s", p, entry.Type())
+		}
+	}); err != nil {
+		return bb_digest.BadDigest, err
+	}
+	return builder.Finalize(ctx)
+}
+
+func (ff *fileFetcher) addFile(ctx context.Context, builder *directory.Builder, root *os.Root, p string) error {
+	f, err := root.Open(p)
+	if err != nil {
+		return wrapFileError(err, "Failed to open file")
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return wrapFileError(err, "Failed to obtain file properties")
+	}
+	return builder.AddFile(ctx, p, io.NewSectionReader(f, 0, fileInfo.Size()), fileInfo.Size(), fileInfo.Mode()&0o111 != 0)
+}
+
+func (ff *fileFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return qualifier.Difference(qualifiers, qualifier.NewSet([]string{"checksum.sri", "bazel.canonical_id"}))
+}
@@ -0,0 +1,198 @@
+package fetch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// createFileFetcherRoot creates a directory containing a mirror of
+// files that may be served by the file fetcher, next to a file that
+// may not be served.
+func createFileFetcherRoot(t *testing.T) string {
+	parent := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret"), []byte("Secret"), 0o644))
+	root := filepath.Join(parent, "mirror")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "foo-1.0", "bin"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "hello.txt"), []byte("Hello"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo-1.0", "README"), []byte("Hello"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo-1.0", "bin", "tool"), []byte("#!/bin/sh"), 0o755))
+	require.NoError(t, os.Symlink("README", filepath.Join(root, "foo-1.0", "link")))
+	require.NoError(t, os.Symlink("../secret", filepath.Join(root, "escape")))
+	return root
+}
+
+func TestFileFetcherFetchBlob(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	root := createFileFetcherRoot(t)
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	fileFetcher, err := fetch.NewFileFetcher(casBlobAccess, []string{root}, scratch.NewDefaultStorage())
+	require.NoError(t, err)
+
+	helloDigest := bb_digest.MustNewDigest("", remoteexecution.DigestFunction_SHA256, "185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969", 5)
+
+	t.Run("Success", func(t *testing.T) {
+		casBlobAccess.EXPECT().Put(ctx, helloDigest, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, digest bb_digest.Digest, b buffer.Buffer) error {
+				data, err := b.ToByteSlice(1024)
+				require.NoError(t, err)
+				require.Equal(t, []byte("Hello"), data)
+				return nil
+			})
+
+		response, err := fileFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file://" + root + "/hello.txt"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+		require.Equal(t, "file://"+root+"/hello.txt", response.Uri)
+		testutil.RequireEqualProto(t, helloDigest.GetProto(), response.BlobDigest)
+	})
+
+	t.Run("FallbackToNextURI", func(t *testing.T) {
+		casBlobAccess.EXPECT().Put(ctx, helloDigest, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, digest bb_digest.Digest, b buffer.Buffer) error {
+				b.Discard()
+				return nil
+			})
+
+		response, err := fileFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{
+				"file://" + root + "/nonexistent.txt",
+				"file://localhost" + root + "/hello.txt",
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "file://localhost"+root+"/hello.txt", response.Uri)
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		_, err := fileFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file://" + root + "/hello.txt"},
+			Qualifiers: []*remoteasset.Qualifier{{
+				Name:  "checksum.sri",
+				Value: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			}},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.Internal, "Fetched content did not match sha256 hash of checksum.sri qualifier: Expected e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855, Got 185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969"), err)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := fileFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file://" + root + "/nonexistent.txt"},
+		})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("OutsideRootDirectory", func(t *testing.T) {
+		_, err := fileFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file://" + root + "/../secret"},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to read blob from any provided URI: Path %#v is not beneath any of the allowed root directories", filepath.Join(filepath.Dir(root), "secret")), err)
+	})
+
+	t.Run("SymlinkEscapingRootDirectory", func(t *testing.T) {
+		_, err := fileFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file://" + root + "/escape"},
+		})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), "Failed to open file")
+	})
+
+	t.Run("RemoteHost", func(t *testing.T) {
+		_, err := fileFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file://example.com" + root + "/hello.txt"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to read blob from any provided URI: URI refers to host \"example.com\", while only local files are supported"), err)
+	})
+}
+
+func TestFileFetcherFetchDirectory(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := bb_digest.MustNewFunction("", remoteexecution.DigestFunction_SHA256)
+
+	root := createFileFetcherRoot(t)
+	contents := map[bb_digest.Digest][]byte{}
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, blobDigest bb_digest.Digest, b buffer.Buffer) error {
+			data, err := b.ToByteSlice(1 << 20)
+			if err != nil {
+				return err
+			}
+			contents[blobDigest] = data
+			return nil
+		}).AnyTimes()
+	fileFetcher, err := fetch.NewFileFetcher(casBlobAccess, []string{root}, scratch.NewDefaultStorage())
+	require.NoError(t, err)
+
+	getDirectory := func(d *remoteexecution.Digest) *remoteexecution.Directory {
+		directoryDigest, err := digestFunction.NewDigestFromProto(d)
+		require.NoError(t, err)
+		var directory remoteexecution.Directory
+		require.NoError(t, proto.Unmarshal(contents[directoryDigest], &directory))
+		return &directory
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		response, err := fileFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"file://" + root + "/foo-1.0"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+
+		rootDirectory := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, rootDirectory.Files, 1)
+		require.Equal(t, "README", rootDirectory.Files[0].Name)
+		require.False(t, rootDirectory.Files[0].IsExecutable)
+		require.Equal(t, []byte("Hello"), contents[bb_digest.MustNewDigest("", remoteexecution.DigestFunction_SHA256, rootDirectory.Files[0].Digest.Hash, rootDirectory.Files[0].Digest.SizeBytes)])
+		testutil.RequireEqualProto(t, &remoteexecution.SymlinkNode{Name: "link", Target: "README"}, rootDirectory.Symlinks[0])
+		require.Len(t, rootDirectory.Directories, 1)
+		require.Equal(t, "bin", rootDirectory.Directories[0].Name)
+
+		binDirectory := getDirectory(rootDirectory.Directories[0].Digest)
+		require.Len(t, binDirectory.Files, 1)
+		require.Equal(t, "tool", binDirectory.Files[0].Name)
+		require.True(t, binDirectory.Files[0].IsExecutable)
+	})
+
+	t.Run("NotADirectory", func(t *testing.T) {
+		_, err := fileFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"file://" + root + "/hello.txt"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to read directory from any provided URI: Path \"hello.txt\" is not a directory"), err)
+	})
+
+	t.Run("ChecksumSRI", func(t *testing.T) {
+		_, err := fileFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"file://" + root},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "checksum.sri", Value: "sha256-GF+NsyJx/iX1Yab8k4suJkMG7DBO2lGAB9F2SCY4GWk="},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "The checksum.sri qualifier is not supported when fetching directories from the local file system"), err)
+	})
+}
+
+func TestFileFetcherInvalidRootDirectory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	_, err := fetch.NewFileFetcher(mock.NewMockBlobAccess(ctrl), []string{"relative/path"}, nil)
+	testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Allowed root directory \"relative/path\" is not an absolute path"), err)
+}
@@ -0,0 +1,418 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/git"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ResourceTypeGit is the value of the resource_type qualifier
+	// for directories that are checked out from git repositories.
+	ResourceTypeGit = "application/x-git"
+
+	// QualifierVCSBranch is a qualifier to select the branch of a
+	// repository whose tip is checked out. Full names of refs, such
+	// as "refs/tags/v1.0", are accepted as well.
+	QualifierVCSBranch = "vcs.branch"
+	// QualifierVCSCommit is a qualifier to select the commit of a
+	// repository that is checked out. It takes precedence over
+	// vcs.branch.
+	QualifierVCSCommit = "vcs.commit"
+	// QualifierVCSSubmodules is a qualifier that, when set to
+	// "true", causes submodules to be checked out as well.
+	QualifierVCSSubmodules = "vcs.submodules"
+)
+
+// Maximum nesting depth of submodules that are checked out.
+const maximumGitSubmoduleDepth = 8
+
+// GitFetcherOptions contains optional settings that alter the behaviour
+// of the git fetcher. The zero value corresponds to the default
+// behaviour.
+type GitFetcherOptions struct {
+	// Credentials of the server for authenticating against hosts
+	// serving repositories, and how they are merged with headers
+	// provided by clients.
+	Credentials          CredentialStore
+	CredentialPrecedence CredentialPrecedence
+
+	// Storage for holding packs and files contained in them, until
+	// the checkout has been written into the CAS. When nil, small
+	// files are held in memory, while larger files are written to
+	// the system's temporary directory.
+	ScratchStorage *scratch.Storage
+
+	// Limits that are applied to the checkout of a repository and
+	// its submodules combined. The maximum extracted size also
+	// bounds the size of individual objects contained in packs.
+	CheckoutLimits archive.Limits
+
+	// When set, URLs of submodules are rewritten and checked against
+	// the hosts that are blocked, similar to the URIs of requests.
+	// URLs of submodules are obtained from repositories, meaning they
+	// are not subject to any URLRewritingFetcher.
+	URLRewriter *URLRewriter
+}
+
+type gitFetcher struct {
+	clients                   gitClientFactory
+	contentAddressableStorage blobstore.BlobAccess
+	options                   GitFetcherOptions
+}
+
+// NewGitFetcher creates a Fetcher that checks out commits of git
+// repositories, using git's smart HTTP protocol (version 2). Only
+// directories are supported, and the resource_type qualifier must be
+// set to application/x-git. The commit to check out is selected
+// through the vcs.commit or vcs.branch qualifiers, defaulting to the
+// repository's HEAD.
+//
+// Only the objects reachable from the requested commit are fetched.
+// The .git directory is not part of the resulting directory.
+// Submodules are left empty, unless vcs.submodules is set to true. If
+// the commit was not provided through vcs.commit, it is added to the
+// qualifiers of the response. As it is not part of the key under which
+// CachingFetcher stores the asset, branches remain resolved to the same
+// commit for as long as the asset is cached, unless requests are
+// resolved by GitRefResolvingFetcher up front.
+func NewGitFetcher(httpClient *http.Client, contentAddressableStorage blobstore.BlobAccess, options GitFetcherOptions) Fetcher {
+	if options.ScratchStorage == nil {
+		options.ScratchStorage = scratch.NewDefaultStorage()
+	}
+	return &gitFetcher{
+		clients: gitClientFactory{
+			httpClient:           httpClient,
+			credentials:          options.Credentials,
+			credentialPrecedence: options.CredentialPrecedence,
+		},
+		contentAddressableStorage: contentAddressableStorage,
+		options:                   options,
+	}
+}
+
+func (gf *gitFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	return nil, status.Error(codes.PermissionDenied, "Fetching of blobs from git repositories is not supported")
+}
+
+// gitCheckoutParameters contains the properties of a FetchDirectory
+// request that are used to check out each of its URIs.
+type gitCheckoutParameters struct {
+	digestFunction bb_digest.Function
+	auth           *AuthHeaders
+	commit         string
+	branch         string
+	submodules     bool
+}
+
+func (gf *gitFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	auth, err := getAuthHeaders(req.Uris, req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	params := gitCheckoutParameters{
+		digestFunction: digestFunction,
+		auth:           auth,
+	}
+	resourceType := ""
+	for _, q := range req.Qualifiers {
+		switch q.Name {
+		case "resource_type":
+			resourceType = q.Value
+		case QualifierVCSBranch:
+			params.branch = q.Value
+		case QualifierVCSCommit:
+			params.commit = q.Value
+		case QualifierVCSSubmodules:
+			params.submodules = q.Value == "true"
+		}
+	}
+	if resourceType != ResourceTypeGit {
+		return nil, status.Errorf(codes.InvalidArgument, "Resource type %#v is not supported, as only %#v is", resourceType, ResourceTypeGit)
+	}
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		rootDirectoryDigest, commitID, err := gf.fetchDirectory(ctx, uri, params)
+		if err != nil {
+			log.Printf("Error checking out repository with URI %s: %v", uri, err)
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		qualifiers := req.Qualifiers
+		if params.commit == "" {
+			qualifiers = append(qualifiers[:len(qualifiers):len(qualifiers)], &remoteasset.Qualifier{
+				Name:  QualifierVCSCommit,
+				Value: commitID.String(),
+			})
+		}
+		return &remoteasset.FetchDirectoryResponse{
+			Status:              status.New(codes.OK, "Directory fetched successfully!").Proto(),
+			Uri:                 uri,
+			Qualifiers:          qualifiers,
+			RootDirectoryDigest: rootDirectoryDigest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to download directory from any provided URI")
+}
+
+// gitClientFactory creates clients for accessing repositories.
+type gitClientFactory struct {
+	httpClient           *http.Client
+	credentials          CredentialStore
+	credentialPrecedence CredentialPrecedence
+}
+
+// newClient creates a client for accessing a repository, which sends
+// both the headers provided by the client and the credentials of the
+// server.
+func (f *gitClientFactory) newClient(uri string, auth *AuthHeaders) *git.Client {
+	return git.NewClient(f.httpClient, func(ctx context.Context, req *http.Request) error {
+		var credentials http.Header
+		if f.credentials != nil {
+			var err error
+			credentials, err = f.credentials.GetCredentials(ctx, req.URL)
+			if err != nil {
+				return util.StatusWrapf(err, "Failed to obtain credentials for URI %#v", uri)
+			}
+		}
+		auth.ApplyHeaders(uri, req, credentials, f.credentialPrecedence)
+		return nil
+	})
+}
+
+// getRepositoryURL validates the URI of a repository, removing any
+// trailing slashes.
+func getRepositoryURL(uri string) (string, error) {
+	parsedURI, err := url.Parse(uri)
+	if err != nil {
+		return "", util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URI %#v", uri)
+	}
+	if parsedURI.Scheme != "http" && parsedURI.Scheme != "https" {
+		return "", status.Errorf(codes.InvalidArgument, "URI %#v does not use the http or https scheme", uri)
+	}
+	return strings.TrimRight(uri, "/"), nil
+}
+
+// resolveCommit returns the commit to check out. If no commit is
+// provided explicitly, the tip of the requested branch is looked up.
+func resolveCommit(ctx context.Context, client *git.Client, repositoryURL, commit, branch string) (git.ObjectID, error) {
+	if commit != "" {
+		return git.NewObjectIDFromString(commit)
+	}
+	refName := "HEAD"
+	if branch != "" {
+		refName = branch
+		if !strings.HasPrefix(refName, "refs/") {
+			refName = "refs/heads/" + branch
+		}
+	}
+	refs, err := client.LsRefs(ctx, repositoryURL, []string{refName})
+	if err != nil {
+		return git.ObjectID{}, util.StatusWrap(err, "Failed to list refs")
+	}
+	for _, ref := range refs {
+		if ref.Name == refName {
+			return ref.ID, nil
+		}
+	}
+	return git.ObjectID{}, status.Errorf(codes.NotFound, "Repository does not contain ref %#v", refName)
+}
+
+// fetchDirectory checks out the requested commit of the repository
+// referenced by a URI, returning the digest of the resulting directory
+// and the ID of the commit.
+func (gf *gitFetcher) fetchDirectory(ctx context.Context, uri string, params gitCheckoutParameters) (bb_digest.Digest, git.ObjectID, error) {
+	repositoryURL, err := getRepositoryURL(uri)
+	if err != nil {
+		return bb_digest.BadDigest, git.ObjectID{}, err
+	}
+	client := gf.clients.newClient(uri, params.auth)
+	commitID, err := resolveCommit(ctx, client, repositoryURL, params.commit, params.branch)
+	if err != nil {
+		return bb_digest.BadDigest, git.ObjectID{}, err
+	}
+
+	builder := directory.NewBuilder(gf.contentAddressableStorage, params.digestFunction, gf.options.ScratchStorage)
+	checkout := git.NewCheckout(builder, gf.options.CheckoutLimits)
+	if err := gf.checkoutCommit(ctx, client, checkout, repositoryURL, []string{repositoryURL}, commitID, "", params.submodules, 0); err != nil {
+		return bb_digest.BadDigest, git.ObjectID{}, err
+	}
+	rootDirectoryDigest, err := builder.Finalize(ctx)
+	if err != nil {
+		return bb_digest.BadDigest, git.ObjectID{}, util.StatusWrapWithCode(err, codes.Internal, "Failed to place directory into CAS")
+	}
+	return rootDirectoryDigest, commitID, nil
+}
+
+// checkoutCommit fetches a pack containing a commit and adds its tree
+// to the checkout at the provided path. The pack is fetched from the
+// first of the provided URLs from which it can be obtained, while
+// relative URLs of submodules are resolved against repositoryURL.
+// Submodules are checked out recursively if requested.
+func (gf *gitFetcher) checkoutCommit(ctx context.Context, client *git.Client, checkout *git.Checkout, repositoryURL string, fetchURLs []string, commitID git.ObjectID, p string, submodules bool, depth int) error {
+	var packFile *scratch.File
+	var packSizeBytes int64
+	var err error
+	for _, fetchURL := range fetchURLs {
+		if packFile, packSizeBytes, err = gf.fetchPack(ctx, client, fetchURL, commitID); err == nil {
+			break
+		}
+		log.Printf("Error fetching pack from repository with URI %s: %v", fetchURL, err)
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer closeDownloadedContent(packFile)
+	pack, err := git.NewPack(packFile, packSizeBytes, gf.options.CheckoutLimits.MaximumExtractedSizeBytes)
+	if err != nil {
+		return util.StatusWrap(err, "Invalid pack")
+	}
+	foundSubmodules, err := checkout.Add(ctx, pack, commitID, p)
+	if err != nil {
+		return util.StatusWrapf(err, "Failed to check out commit %s", commitID)
+	}
+	if !submodules {
+		return nil
+	}
+
+	for _, submodule := range foundSubmodules {
+		if depth >= maximumGitSubmoduleDepth {
+			return status.Errorf(codes.InvalidArgument, "Submodule %#v exceeds the maximum nesting depth of %d", submodule.Path, maximumGitSubmoduleDepth)
+		}
+		submoduleURL, err := resolveSubmoduleURL(repositoryURL, submodule)
+		if err != nil {
+			return err
+		}
+		submoduleFetchURLs, err := gf.getSubmoduleFetchURLs(submoduleURL)
+		if err != nil {
+			return util.StatusWrapf(err, "Failed to check out submodule %#v", submodule.Path)
+		}
+		// Submodules may be hosted elsewhere, meaning that headers
+		// provided by the client for the superproject must not be
+		// sent. Only credentials of the server are used.
+		submoduleClient := gf.clients.newClient(submoduleURL, &AuthHeaders{})
+		if err := gf.checkoutCommit(ctx, submoduleClient, checkout, submoduleURL, submoduleFetchURLs, submodule.CommitID, submodule.Path, true, depth+1); err != nil {
+			return util.StatusWrapf(err, "Failed to check out submodule %#v", submodule.Path)
+		}
+	}
+	return nil
+}
+
+// fetchPack fetches a pack containing a commit from a repository,
+// returning the file containing the pack and its size.
+func (gf *gitFetcher) fetchPack(ctx context.Context, client *git.Client, repositoryURL string, commitID git.ObjectID) (*scratch.File, int64, error) {
+	packFile, err := gf.options.ScratchStorage.NewFile(ctx, -1)
+	if err != nil {
+		return nil, 0, err
+	}
+	packWriter := &countingWriter{w: packFile}
+	if err := client.Fetch(ctx, repositoryURL, commitID, packWriter); err != nil {
+		closeDownloadedContent(packFile)
+		return nil, 0, wrapDownloadError(ctx, err, "Failed to fetch pack")
+	}
+	return packFile, packWriter.sizeBytes, nil
+}
+
+// getSubmoduleFetchURLs applies the URLRewriter to the URL of a
+// submodule, yielding the URLs from which the submodule is fetched.
+func (gf *gitFetcher) getSubmoduleFetchURLs(submoduleURL string) ([]string, error) {
+	if gf.options.URLRewriter == nil {
+		return []string{submoduleURL}, nil
+	}
+	rewritten, err := gf.options.URLRewriter.Rewrite([]string{submoduleURL})
+	if err != nil {
+		return nil, err
+	}
+	fetchURLs := make([]string, 0, len(rewritten))
+	for _, r := range rewritten {
+		fetchURL, err := getRepositoryURL(r.URI)
+		if err != nil {
+			return nil, err
+		}
+		fetchURLs = append(fetchURLs, fetchURL)
+	}
+	return fetchURLs, nil
+}
+
+// resolveSubmoduleURL returns the URL of the repository of a
+// submodule. URLs starting with "./" or "../" are relative to the URL
+// of the superproject, which git treats as if it were a directory.
+func resolveSubmoduleURL(repositoryURL string, submodule git.Submodule) (string, error) {
+	if submodule.URL == "" {
+		return "", status.Errorf(codes.InvalidArgument, "Submodule %#v is not listed in .gitmodules", submodule.Path)
+	}
+	submoduleURL := submodule.URL
+	if strings.HasPrefix(submoduleURL, "./") || strings.HasPrefix(submoduleURL, "../") {
+		base, err := url.Parse(repositoryURL + "/")
+		if err != nil {
+			return "", util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URI %#v", repositoryURL)
+		}
+		relative, err := url.Parse(submoduleURL)
+		if err != nil {
+			return "", util.StatusWrapfWithCode(err, codes.InvalidArgument, "Submodule %#v has invalid URL %#v", submodule.Path, submoduleURL)
+		}
+		submoduleURL = base.ResolveReference(relative).String()
+	}
+	resolvedURL, err := getRepositoryURL(submoduleURL)
+	if err != nil {
+		return "", util.StatusWrapf(err, "Invalid URL for submodule %#v", submodule.Path)
+	}
+	return resolvedURL, nil
+}
+
+// countingWriter forwards writes to another io.Writer, keeping track
+// of the number of bytes written.
+type countingWriter struct {
+	w         io.Writer
+	sizeBytes int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.sizeBytes += int64(n)
+	return n, err
+}
+
+func (gf *gitFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	toRemove := qualifier.NewSet([]string{"resource_type", QualifierVCSBranch, QualifierVCSCommit, QualifierVCSSubmodules, QualifierLegacyBazelHTTPHeaders, "bazel.canonical_id"})
+	for name := range qualifiers {
+		if strings.HasPrefix(name, QualifierHTTPHeaderPrefix) || strings.HasPrefix(name, QualifierHTTPHeaderURLPrefix) {
+			toRemove.Add(name)
+		}
+	}
+	return qualifier.Difference(qualifiers, toRemove)
+}
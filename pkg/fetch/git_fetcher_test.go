@@ -0,0 +1,448 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// gitRepositories creates git repositories and serves them over
+// HTTP, using the smart HTTP server that ships with git.
+type gitRepositories struct {
+	t      *testing.T
+	root   string
+	server *httptest.Server
+}
+
+func newGitRepositories(t *testing.T) *gitRepositories {
+	return newGitRepositoriesWithMiddleware(t, func(h http.Handler) http.Handler { return h })
+}
+
+// newGitRepositoriesWithMiddleware is identical to newGitRepositories,
+// except that requests are passed through a middleware before being
+// handled by git, so that they can be inspected.
+func newGitRepositoriesWithMiddleware(t *testing.T, middleware func(http.Handler) http.Handler) *gitRepositories {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	server := httptest.NewServer(middleware(&cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + root,
+			"GIT_HTTP_EXPORT_ALL=1",
+			"GIT_CONFIG_NOSYSTEM=1",
+			"HOME=" + root,
+		},
+	}))
+	t.Cleanup(server.Close)
+	return &gitRepositories{t: t, root: root, server: server}
+}
+
+func (r *gitRepositories) run(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Author",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_COMMITTER_NAME=Committer",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"HOME="+r.root,
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(r.t, err, "git %s: %s", strings.Join(args, " "), output)
+	return strings.TrimSpace(string(output))
+}
+
+// newWorkTree creates a non-bare repository, in which commits can be
+// created prior to publishing them.
+func (r *gitRepositories) newWorkTree() string {
+	dir := r.t.TempDir()
+	r.run(dir, "init", "--quiet", "--initial-branch=main")
+	return dir
+}
+
+// commit writes files into a work tree and commits them, returning the
+// ID of the commit.
+func (r *gitRepositories) commit(dir string, files map[string]string) string {
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(r.t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(r.t, os.WriteFile(p, []byte(contents), 0o644))
+		r.run(dir, "add", name)
+	}
+	r.run(dir, "commit", "--quiet", "-m", "Commit")
+	return r.run(dir, "rev-parse", "HEAD")
+}
+
+// publish copies a work tree into a bare repository that is served
+// over HTTP, returning its URL.
+func (r *gitRepositories) publish(dir, name string) string {
+	r.run(r.root, "clone", "--quiet", "--bare", "--no-local", dir, name)
+	return r.server.URL + "/" + name
+}
+
+func TestGitFetcherFetchDirectory(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := bb_digest.MustNewFunction("", remoteexecution.DigestFunction_SHA256)
+
+	repositories := newGitRepositories(t)
+	library := repositories.newWorkTree()
+	libraryCommit := repositories.commit(library, map[string]string{"library.txt": "Library"})
+	repositories.publish(library, "library.git")
+
+	project := repositories.newWorkTree()
+	initialCommit := repositories.commit(project, map[string]string{"README": "Initial"})
+	repositories.commit(project, map[string]string{
+		"README":      "Hello",
+		"bin/tool":    "#!/bin/sh",
+		".gitmodules": "[submodule \"library\"]\n\tpath = third_party/library\n\turl = ../library.git\n",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(project, "bin/tool"), 0o755))
+	repositories.run(project, "add", "bin/tool")
+	repositories.run(project, "update-index", "--add", "--cacheinfo", "160000,"+libraryCommit+",third_party/library")
+	require.NoError(t, os.Symlink("README", filepath.Join(project, "link")))
+	repositories.run(project, "add", "link")
+	repositories.run(project, "commit", "--quiet", "-m", "Add submodule")
+	repositories.run(project, "tag", "-a", "-m", "Release", "v1.0", initialCommit)
+	repositories.run(project, "checkout", "--quiet", "-b", "feature", initialCommit)
+	repositories.commit(project, map[string]string{"FEATURE": "Feature"})
+	repositories.run(project, "checkout", "--quiet", "main")
+	projectURL := repositories.publish(project, "project.git")
+
+	contents := map[bb_digest.Digest][]byte{}
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, blobDigest bb_digest.Digest, b buffer.Buffer) error {
+			data, err := b.ToByteSlice(1 << 20)
+			if err != nil {
+				return err
+			}
+			contents[blobDigest] = data
+			return nil
+		}).AnyTimes()
+	getDirectory := func(d *remoteexecution.Digest) *remoteexecution.Directory {
+		directoryDigest, err := digestFunction.NewDigestFromProto(d)
+		require.NoError(t, err)
+		var directory remoteexecution.Directory
+		require.NoError(t, proto.Unmarshal(contents[directoryDigest], &directory))
+		return &directory
+	}
+	getFile := func(file *remoteexecution.FileNode) string {
+		fileDigest, err := digestFunction.NewDigestFromProto(file.Digest)
+		require.NoError(t, err)
+		return string(contents[fileDigest])
+	}
+
+	gitFetcher := fetch.NewGitFetcher(http.DefaultClient, casBlobAccess, fetch.GitFetcherOptions{
+		CheckoutLimits: archive.Limits{
+			MaximumExtractedSizeBytes: 1 << 20,
+			MaximumEntries:            100,
+		},
+	})
+	resourceType := &remoteasset.Qualifier{Name: "resource_type", Value: "application/x-git"}
+
+	t.Run("Head", func(t *testing.T) {
+		// Without vcs.branch or vcs.commit, the commit
+		// referenced by HEAD is checked out. Submodules are left
+		// empty.
+		response, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+		require.Equal(t, projectURL, response.Uri)
+		// The resolved commit is reported back, so that the
+		// checkout can be reproduced.
+		require.Len(t, response.Qualifiers, 2)
+		testutil.RequireEqualProto(t, &remoteasset.Qualifier{
+			Name:  "vcs.commit",
+			Value: repositories.run(project, "rev-parse", "main"),
+		}, response.Qualifiers[1])
+
+		root := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, root.Files, 2)
+		require.Equal(t, ".gitmodules", root.Files[0].Name)
+		require.Equal(t, "README", root.Files[1].Name)
+		require.Equal(t, "Hello", getFile(root.Files[1]))
+		require.False(t, root.Files[1].IsExecutable)
+		testutil.RequireEqualProto(t, &remoteexecution.SymlinkNode{Name: "link", Target: "README"}, root.Symlinks[0])
+		require.Len(t, root.Directories, 2)
+		require.Equal(t, "bin", root.Directories[0].Name)
+		require.Equal(t, "third_party", root.Directories[1].Name)
+
+		bin := getDirectory(root.Directories[0].Digest)
+		require.Len(t, bin.Files, 1)
+		require.Equal(t, "tool", bin.Files[0].Name)
+		require.True(t, bin.Files[0].IsExecutable)
+
+		thirdParty := getDirectory(root.Directories[1].Digest)
+		require.Len(t, thirdParty.Directories, 1)
+		require.Equal(t, "library", thirdParty.Directories[0].Name)
+		testutil.RequireEqualProto(t, &remoteexecution.Directory{}, getDirectory(thirdParty.Directories[0].Digest))
+	})
+
+	t.Run("Submodules", func(t *testing.T) {
+		response, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.submodules", Value: "true"},
+			},
+		})
+		require.NoError(t, err)
+
+		root := getDirectory(response.RootDirectoryDigest)
+		thirdParty := getDirectory(root.Directories[1].Digest)
+		library := getDirectory(thirdParty.Directories[0].Digest)
+		require.Len(t, library.Files, 1)
+		require.Equal(t, "library.txt", library.Files[0].Name)
+		require.Equal(t, "Library", getFile(library.Files[0]))
+	})
+
+	t.Run("Branch", func(t *testing.T) {
+		response, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.branch", Value: "feature"},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, response.Qualifiers, 3)
+		testutil.RequireEqualProto(t, &remoteasset.Qualifier{
+			Name:  "vcs.commit",
+			Value: repositories.run(project, "rev-parse", "feature"),
+		}, response.Qualifiers[2])
+
+		root := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, root.Files, 2)
+		require.Equal(t, "FEATURE", root.Files[0].Name)
+		require.Equal(t, "README", root.Files[1].Name)
+		require.Equal(t, "Initial", getFile(root.Files[1]))
+	})
+
+	t.Run("AnnotatedTag", func(t *testing.T) {
+		// Tags are peeled to obtain the commit to check out.
+		response, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.branch", Value: "refs/tags/v1.0"},
+			},
+		})
+		require.NoError(t, err)
+
+		root := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, root.Files, 1)
+		require.Equal(t, "Initial", getFile(root.Files[0]))
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		// Commits that are not at the tip of a branch can be
+		// fetched as well.
+		response, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.commit", Value: initialCommit},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, response.Qualifiers, 2)
+
+		root := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, root.Files, 1)
+		require.Equal(t, "README", root.Files[0].Name)
+		require.Equal(t, "Initial", getFile(root.Files[0]))
+	})
+
+	t.Run("FallbackToNextURI", func(t *testing.T) {
+		response, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{repositories.server.URL + "/nonexistent.git", projectURL},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		require.NoError(t, err)
+		require.Equal(t, projectURL, response.Uri)
+	})
+
+	t.Run("UnknownBranch", func(t *testing.T) {
+		_, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.branch", Value: "nonexistent"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download directory from any provided URI: Repository does not contain ref \"refs/heads/nonexistent\""), err)
+	})
+
+	t.Run("TooManyEntries", func(t *testing.T) {
+		limitedGitFetcher := fetch.NewGitFetcher(http.DefaultClient, casBlobAccess, fetch.GitFetcherOptions{
+			CheckoutLimits: archive.Limits{
+				MaximumExtractedSizeBytes: 1 << 20,
+				MaximumEntries:            3,
+			},
+		})
+		_, err := limitedGitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.ErrorContains(t, err, "Checkout exceeds the maximum number of 3 entries")
+	})
+
+	t.Run("MissingResourceType", func(t *testing.T) {
+		_, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Resource type \"\" is not supported, as only \"application/x-git\" is"), err)
+	})
+
+	t.Run("FetchBlob", func(t *testing.T) {
+		_, err := gitFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris:       []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.PermissionDenied, "Fetching of blobs from git repositories is not supported"), err)
+	})
+}
+
+func TestGitFetcherFetchDirectorySubmoduleHeaders(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	// Headers provided by the client for the superproject must not be
+	// sent to hosts of submodules. Credentials of the server for those
+	// hosts should be used instead.
+	requireHeader := func(header, value string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(header) != value {
+					http.Error(w, "Unexpected "+header+" header", http.StatusForbidden)
+					return
+				}
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	libraryRepositories := newGitRepositoriesWithMiddleware(t, func(h http.Handler) http.Handler {
+		return requireHeader("Authorization", "Bearer server")(requireHeader("X-Client", "")(h))
+	})
+	library := libraryRepositories.newWorkTree()
+	libraryCommit := libraryRepositories.commit(library, map[string]string{"library.txt": "Library"})
+	libraryURL := libraryRepositories.publish(library, "library.git")
+
+	projectRepositories := newGitRepositoriesWithMiddleware(t, requireHeader("X-Client", "secret"))
+	project := projectRepositories.newWorkTree()
+	projectRepositories.commit(project, map[string]string{
+		".gitmodules": "[submodule \"library\"]\n\tpath = library\n\turl = " + libraryURL + "\n",
+	})
+	projectRepositories.run(project, "update-index", "--add", "--cacheinfo", "160000,"+libraryCommit+",library")
+	projectRepositories.run(project, "commit", "--quiet", "-m", "Add submodule")
+	projectURL := projectRepositories.publish(project, "project.git")
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	gitFetcher := fetch.NewGitFetcher(http.DefaultClient, casBlobAccess, fetch.GitFetcherOptions{
+		Credentials: fetch.NewPatternCredentialStore(
+			[]fetch.URLPattern{fetch.URLPattern(libraryRepositories.server.URL + "/")},
+			fetch.NewStaticCredentialSource(http.Header{"Authorization": []string{"Bearer server"}})),
+		CheckoutLimits: archive.Limits{
+			MaximumExtractedSizeBytes: 1 << 20,
+			MaximumEntries:            100,
+		},
+	})
+	_, err := gitFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+		Uris: []string{projectURL},
+		Qualifiers: []*remoteasset.Qualifier{
+			{Name: "resource_type", Value: "application/x-git"},
+			{Name: "vcs.submodules", Value: "true"},
+			{Name: "http_header:X-Client", Value: "secret"},
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestGitFetcherFetchDirectorySubmoduleURLRewriting(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	// URLs of submodules are obtained from repositories. They must
+	// be subject to the same rewriting and blocking as the URIs of
+	// requests.
+	repositories := newGitRepositories(t)
+	library := repositories.newWorkTree()
+	libraryCommit := repositories.commit(library, map[string]string{"library.txt": "Library"})
+	repositories.publish(library, "library.git")
+
+	project := repositories.newWorkTree()
+	repositories.commit(project, map[string]string{
+		".gitmodules": "[submodule \"library\"]\n\tpath = library\n\turl = https://upstream.example.com/library.git\n",
+	})
+	repositories.run(project, "update-index", "--add", "--cacheinfo", "160000,"+libraryCommit+",library")
+	repositories.run(project, "commit", "--quiet", "-m", "Add submodule")
+	projectURL := repositories.publish(project, "project.git")
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	request := &remoteasset.FetchDirectoryRequest{
+		Uris: []string{projectURL},
+		Qualifiers: []*remoteasset.Qualifier{
+			{Name: "resource_type", Value: "application/x-git"},
+			{Name: "vcs.submodules", Value: "true"},
+		},
+	}
+	newGitFetcher := func(rewrites []fetch.URLRewrite, blockedHosts []string) fetch.Fetcher {
+		urlRewriter, err := fetch.NewURLRewriter(rewrites, nil, blockedHosts, "")
+		require.NoError(t, err)
+		return fetch.NewGitFetcher(http.DefaultClient, casBlobAccess, fetch.GitFetcherOptions{
+			CheckoutLimits: archive.Limits{
+				MaximumExtractedSizeBytes: 1 << 20,
+				MaximumEntries:            100,
+			},
+			URLRewriter: urlRewriter,
+		})
+	}
+
+	t.Run("Mirror", func(t *testing.T) {
+		// The submodule should be fetched from the first mirror
+		// from which it can be obtained.
+		_, err := newGitFetcher([]fetch.URLRewrite{{
+			Pattern: "upstream.example.com/(.*)",
+			Replacements: []string{
+				repositories.server.URL + "/nonexistent/${1}",
+				repositories.server.URL + "/${1}",
+			},
+		}}, []string{"upstream.example.com"}).FetchDirectory(ctx, request)
+		require.NoError(t, err)
+	})
+
+	t.Run("Blocked", func(t *testing.T) {
+		_, err := newGitFetcher(nil, []string{"upstream.example.com"}).FetchDirectory(ctx, request)
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download directory from any provided URI: Failed to check out submodule \"library\": All URIs are blocked: https://upstream.example.com/library.git"), err)
+	})
+}
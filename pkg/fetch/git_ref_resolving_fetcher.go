@@ -0,0 +1,106 @@
+package fetch
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/git"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+type gitRefResolvingFetcher struct {
+	fetcher Fetcher
+	clients gitClientFactory
+}
+
+// NewGitRefResolvingFetcher creates a decorator for Fetcher
+// implementations that resolves the branch of git repositories to a
+// commit, before forwarding FetchDirectory requests. The commit is
+// added to the request through the vcs.commit qualifier. Placing this
+// decorator in front of a CachingFetcher causes the commit to become
+// part of the key under which the asset is stored, so that changes to
+// the branch are picked up.
+//
+// Only requests having resource_type set to application/x-git and not
+// having vcs.commit set are altered. If vcs.branch is not set, the
+// repository's HEAD is resolved. The commit is obtained from the first
+// URI from which the repository's refs can be listed.
+func NewGitRefResolvingFetcher(fetcher Fetcher, httpClient *http.Client, credentials CredentialStore, credentialPrecedence CredentialPrecedence) Fetcher {
+	return &gitRefResolvingFetcher{
+		fetcher: fetcher,
+		clients: gitClientFactory{
+			httpClient:           httpClient,
+			credentials:          credentials,
+			credentialPrecedence: credentialPrecedence,
+		},
+	}
+}
+
+func (rf *gitRefResolvingFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	return rf.fetcher.FetchBlob(ctx, req)
+}
+
+func (rf *gitRefResolvingFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	resourceType, branch := "", ""
+	for _, q := range req.Qualifiers {
+		switch q.Name {
+		case "resource_type":
+			resourceType = q.Value
+		case QualifierVCSBranch:
+			branch = q.Value
+		case QualifierVCSCommit:
+			return rf.fetcher.FetchDirectory(ctx, req)
+		}
+	}
+	if resourceType != ResourceTypeGit {
+		return rf.fetcher.FetchDirectory(ctx, req)
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	auth, err := getAuthHeaders(req.Uris, req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, uri := range req.Uris {
+		commitID, err := rf.resolveCommit(ctx, uri, auth, branch)
+		if err != nil {
+			log.Printf("Error resolving ref of repository with URI %s: %v", uri, err)
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		resolvedReq := proto.Clone(req).(*remoteasset.FetchDirectoryRequest)
+		resolvedReq.Qualifiers = append(resolvedReq.Qualifiers, &remoteasset.Qualifier{
+			Name:  QualifierVCSCommit,
+			Value: commitID.String(),
+		})
+		return rf.fetcher.FetchDirectory(ctx, resolvedReq)
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to resolve ref from any provided URI")
+}
+
+func (rf *gitRefResolvingFetcher) resolveCommit(ctx context.Context, uri string, auth *AuthHeaders, branch string) (git.ObjectID, error) {
+	repositoryURL, err := getRepositoryURL(uri)
+	if err != nil {
+		return git.ObjectID{}, err
+	}
+	return resolveCommit(ctx, rf.clients.newClient(uri, auth), repositoryURL, "", branch)
+}
+
+func (rf *gitRefResolvingFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return rf.fetcher.CheckQualifiers(qualifiers)
+}
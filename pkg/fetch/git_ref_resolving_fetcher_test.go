@@ -0,0 +1,127 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGitRefResolvingFetcherFetchDirectory(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	repositories := newGitRepositories(t)
+	project := repositories.newWorkTree()
+	firstCommit := repositories.commit(project, map[string]string{"README": "First"})
+	repositories.run(project, "branch", "feature")
+	projectURL := repositories.publish(project, "project.git")
+
+	baseFetcher := mock.NewMockFetcher(ctrl)
+	fetcher := fetch.NewGitRefResolvingFetcher(baseFetcher, http.DefaultClient, nil, fetch.ClientCredentialPrecedence)
+	resourceType := &remoteasset.Qualifier{Name: "resource_type", Value: "application/x-git"}
+	response := &remoteasset.FetchDirectoryResponse{
+		Status: status.New(codes.OK, "Directory fetched successfully!").Proto(),
+		Uri:    projectURL,
+	}
+
+	t.Run("Head", func(t *testing.T) {
+		baseFetcher.EXPECT().FetchDirectory(ctx, testutil.EqProto(t, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.commit", Value: firstCommit},
+			},
+		})).Return(response, nil)
+
+		actualResponse, err := fetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("BranchMoved", func(t *testing.T) {
+		// Once the branch is updated, requests must resolve to
+		// the new commit, causing them to no longer match any
+		// previously cached asset.
+		request := &remoteasset.FetchDirectoryRequest{
+			Uris: []string{repositories.server.URL + "/missing.git", projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.branch", Value: "feature"},
+			},
+		}
+		expectResolvedRequest := func(commitID string) {
+			baseFetcher.EXPECT().FetchDirectory(ctx, testutil.EqProto(t, &remoteasset.FetchDirectoryRequest{
+				Uris: request.Uris,
+				Qualifiers: []*remoteasset.Qualifier{
+					resourceType,
+					{Name: "vcs.branch", Value: "feature"},
+					{Name: "vcs.commit", Value: commitID},
+				},
+			})).Return(response, nil)
+		}
+
+		expectResolvedRequest(firstCommit)
+		actualResponse, err := fetcher.FetchDirectory(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+
+		secondCommit := repositories.commit(project, map[string]string{"README": "Second"})
+		repositories.run(project, "push", "--quiet", filepath.Join(repositories.root, "project.git"), "main:feature")
+		expectResolvedRequest(secondCommit)
+		actualResponse, err = fetcher.FetchDirectory(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("CommitProvided", func(t *testing.T) {
+		// Requests that already refer to a commit don't need to
+		// be resolved.
+		request := &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://nonexistent.example.com/project.git"},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.commit", Value: firstCommit},
+			},
+		}
+		baseFetcher.EXPECT().FetchDirectory(ctx, testutil.EqProto(t, request)).Return(response, nil)
+
+		actualResponse, err := fetcher.FetchDirectory(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("OtherResourceType", func(t *testing.T) {
+		request := &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://nonexistent.example.com/archive.tar.gz"},
+		}
+		baseFetcher.EXPECT().FetchDirectory(ctx, testutil.EqProto(t, request)).Return(response, nil)
+
+		actualResponse, err := fetcher.FetchDirectory(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("UnknownBranch", func(t *testing.T) {
+		_, err := fetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{projectURL},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "vcs.branch", Value: "nonexistent"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to resolve ref from any provided URI: Repository does not contain ref \"refs/heads/nonexistent\""), err)
+	})
+}
@@ -0,0 +1,155 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Maximum size of responses of a checksum database. Lookups and tiles
+// are only a couple of kilobytes in size.
+const maximumGoChecksumDatabaseResponseSizeBytes = 1 << 20
+
+// goChecksumDatabase provides access to a Go checksum database (e.g.,
+// sum.golang.org), using golang.org/x/mod/sumdb to verify that records
+// are contained in its transparency log. The latest signed tree head
+// that has been observed is retained, so that the database cannot
+// present different views of the log over time without being noticed.
+type goChecksumDatabase struct {
+	client          *goModuleHTTPClient
+	url             string
+	verifierKey     string
+	excludedModules string
+
+	lock   sync.Mutex
+	latest []byte
+}
+
+func newGoChecksumDatabase(client *goModuleHTTPClient, verifierKey, url string, excludedModulePatterns []string) (*goChecksumDatabase, error) {
+	verifier, err := note.NewVerifier(verifierKey)
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid verifier key")
+	}
+	if url == "" {
+		url = "https://" + verifier.Name()
+	}
+	return &goChecksumDatabase{
+		client:          client,
+		url:             strings.TrimSuffix(url, "/"),
+		verifierKey:     verifierKey,
+		excludedModules: strings.Join(excludedModulePatterns, ","),
+	}, nil
+}
+
+// lookup returns the hashes of a module's zip file and go.mod file
+// that are stored in the checksum database. False is returned if the
+// module is excluded from verification.
+func (db *goChecksumDatabase) lookup(ctx context.Context, modulePath, version string) (string, string, bool, error) {
+	// Clients of golang.org/x/mod/sumdb are not context aware.
+	// Create one per request, sharing the state that needs to be
+	// retained across requests.
+	client := sumdb.NewClient(&goChecksumDatabaseOps{
+		database: db,
+		ctx:      ctx,
+	})
+	client.SetGONOSUMDB(db.excludedModules)
+	var hashes [2]string
+	for i, hashedVersion := range []string{version, version + "/go.mod"} {
+		lines, err := client.Lookup(modulePath, hashedVersion)
+		if err == sumdb.ErrGONOSUMDB {
+			return "", "", false, nil
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return "", "", false, util.StatusFromContext(ctx)
+			}
+			return "", "", false, util.StatusWrapWithCode(err, codes.Internal, "Failed to look up module in checksum database")
+		}
+		// Lines are of the form "module version hash".
+		for _, line := range lines {
+			if fields := strings.Fields(line); len(fields) == 3 && strings.HasPrefix(fields[2], "h1:") {
+				hashes[i] = fields[2]
+			}
+		}
+		if hashes[i] == "" {
+			return "", "", false, status.Errorf(codes.Internal, "Checksum database did not return an h1: hash for %s %s", modulePath, hashedVersion)
+		}
+	}
+	return hashes[0], hashes[1], true, nil
+}
+
+// goChecksumDatabaseOps implements sumdb.ClientOps on behalf of a
+// single request. Tiles and lookups are not cached, as requests for
+// modules are already deduplicated by the asset store.
+type goChecksumDatabaseOps struct {
+	database *goChecksumDatabase
+	ctx      context.Context
+}
+
+func (ops *goChecksumDatabaseOps) ReadRemote(path string) ([]byte, error) {
+	resp, err := ops.database.client.get(ops.ctx, ops.database.url+path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readGoModuleResponse(ops.ctx, resp, maximumGoChecksumDatabaseResponseSizeBytes)
+}
+
+func (ops *goChecksumDatabaseOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(ops.database.verifierKey), nil
+	}
+	if strings.HasSuffix(file, "/latest") {
+		ops.database.lock.Lock()
+		defer ops.database.lock.Unlock()
+		return ops.database.latest, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "Unknown configuration file %#v", file)
+}
+
+func (ops *goChecksumDatabaseOps) WriteConfig(file string, old, new []byte) error {
+	ops.database.lock.Lock()
+	defer ops.database.lock.Unlock()
+	if !bytes.Equal(old, ops.database.latest) {
+		return sumdb.ErrWriteConflict
+	}
+	ops.database.latest = new
+	return nil
+}
+
+func (ops *goChecksumDatabaseOps) ReadCache(file string) ([]byte, error) {
+	return nil, status.Error(codes.NotFound, "Caching is not supported")
+}
+
+func (ops *goChecksumDatabaseOps) WriteCache(file string, data []byte) {}
+
+func (ops *goChecksumDatabaseOps) Log(msg string) {
+	log.Print(msg)
+}
+
+func (ops *goChecksumDatabaseOps) SecurityError(msg string) {
+	log.Printf("Security error reported by checksum database %s: %s", ops.database.url, msg)
+}
+
+// readGoModuleResponse reads the body of a response of a module proxy
+// or checksum database, failing if it exceeds a maximum size.
+func readGoModuleResponse(ctx context.Context, resp *http.Response, maximumSizeBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maximumSizeBytes+1))
+	if err != nil {
+		return nil, wrapDownloadError(ctx, err, "Failed to read response body")
+	}
+	if int64(len(data)) > maximumSizeBytes {
+		return nil, status.Errorf(codes.ResourceExhausted, "Response exceeds the maximum size of %d bytes", maximumSizeBytes)
+	}
+	return data, nil
+}
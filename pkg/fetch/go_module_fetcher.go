@@ -0,0 +1,446 @@
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ResourceTypeGoModule is the value of the resource_type
+	// qualifier for directories containing the source tree of a Go
+	// module, obtained from a module proxy.
+	ResourceTypeGoModule = "application/x-go-module"
+
+	// QualifierGoSum is a qualifier containing the hash of a Go
+	// module, as stored in go.sum files (e.g., "h1:...").
+	QualifierGoSum = "go.sum"
+)
+
+// Maximum sizes of files served by module proxies, matching the limits
+// used by the go command.
+const (
+	maximumGoModuleMetadataSizeBytes = 16 << 20
+	maximumGoModuleZipSizeBytes      = 500 << 20
+)
+
+// GoChecksumDatabase contains the settings of a Go checksum database
+// against which modules are verified.
+type GoChecksumDatabase struct {
+	// Key of the database, in the format used by GOSUMDB (e.g.,
+	// "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ak2sUgc8S8C2zWq").
+	VerifierKey string
+	// URL of the database. When empty, it is derived from the
+	// name contained in the key.
+	URL string
+	// Patterns of module paths that are not verified, in the format
+	// used by GONOSUMDB.
+	ExcludedModulePatterns []string
+}
+
+// GoModuleFetcherOptions contains settings that alter the behaviour of
+// the Go module fetcher.
+type GoModuleFetcherOptions struct {
+	// List of module proxies, in the format used by GOPROXY (e.g.,
+	// "https://proxy.example.com,https://proxy.golang.org"). The
+	// "direct" and "off" keywords are not supported.
+	Proxy string
+
+	// Credentials of the server for authenticating against module
+	// proxies and the checksum database.
+	Credentials CredentialStore
+
+	// When set, modules are verified against a checksum database.
+	ChecksumDatabase *GoChecksumDatabase
+
+	// Storage for holding module zip files and the files contained
+	// in them, until they have been written into the CAS. When nil,
+	// small files are held in memory, while larger files are
+	// written to the system's temporary directory.
+	ScratchStorage *scratch.Storage
+
+	// Limits that are applied while extracting module zip files.
+	ExtractionLimits archive.Limits
+}
+
+// goModuleProxy is a single entry of a GOPROXY list.
+type goModuleProxy struct {
+	url string
+	// Whether the next proxy is attempted for all errors, as
+	// opposed to only when the module or version is not found.
+	fallBackOnAllErrors bool
+}
+
+// parseGoProxyList parses a list of module proxies in the format used
+// by GOPROXY.
+func parseGoProxyList(list string) ([]goModuleProxy, error) {
+	var proxies []goModuleProxy
+	for list != "" {
+		entry, fallBackOnAllErrors := list, false
+		if i := strings.IndexAny(list, ",|"); i >= 0 {
+			entry, fallBackOnAllErrors, list = list[:i], list[i] == '|', list[i+1:]
+		} else {
+			list = ""
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "direct" || entry == "off" {
+			return nil, status.Errorf(codes.InvalidArgument, "Proxy %#v is not supported, as modules can only be downloaded from module proxies", entry)
+		}
+		proxyURL, err := url.Parse(entry)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid proxy URL %#v", entry)
+		}
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+			return nil, status.Errorf(codes.InvalidArgument, "Proxy URL %#v does not use scheme http or https", entry)
+		}
+		proxies = append(proxies, goModuleProxy{
+			url:                 strings.TrimSuffix(entry, "/"),
+			fallBackOnAllErrors: fallBackOnAllErrors,
+		})
+	}
+	if len(proxies) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No module proxies provided")
+	}
+	return proxies, nil
+}
+
+// goModuleHTTPClient performs requests against module proxies and
+// checksum databases, attaching credentials of the server.
+type goModuleHTTPClient struct {
+	httpClient  *http.Client
+	credentials CredentialStore
+}
+
+func (c *goModuleHTTPClient) get(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to create HTTP request")
+	}
+	if c.credentials != nil {
+		headers, err := c.credentials.GetCredentials(ctx, req.URL)
+		if err != nil {
+			return nil, util.StatusWrap(err, "Failed to obtain credentials")
+		}
+		for header, values := range headers {
+			req.Header[header] = values
+		}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, wrapDownloadError(ctx, err, "HTTP request failed")
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return nil, newHTTPStatusError(uri, resp)
+}
+
+type goModuleFetcher struct {
+	client                    goModuleHTTPClient
+	proxies                   []goModuleProxy
+	checksumDatabase          *goChecksumDatabase
+	contentAddressableStorage blobstore.BlobAccess
+	scratchStorage            *scratch.Storage
+	extractionLimits          archive.Limits
+}
+
+// NewGoModuleFetcher creates a Fetcher that downloads Go modules from
+// module proxies, using URIs of the form "module@version". Only
+// directories are supported, and the resource_type qualifier must be
+// set to application/x-go-module. The resulting directory contains the
+// source tree of the module, as it would be extracted into the module
+// cache.
+//
+// Proxies are attempted in the order in which they are listed. Like
+// the go command, the next proxy is only attempted if a proxy does not
+// have the module, unless proxies are separated by a pipe character.
+//
+// Modules are verified against the go.sum qualifier and the checksum
+// database, if provided. A mismatch causes the request to fail.
+func NewGoModuleFetcher(httpClient *http.Client, contentAddressableStorage blobstore.BlobAccess, options GoModuleFetcherOptions) (Fetcher, error) {
+	proxies, err := parseGoProxyList(options.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	scratchStorage := options.ScratchStorage
+	if scratchStorage == nil {
+		scratchStorage = scratch.NewDefaultStorage()
+	}
+	gf := &goModuleFetcher{
+		client: goModuleHTTPClient{
+			httpClient:  httpClient,
+			credentials: options.Credentials,
+		},
+		proxies:                   proxies,
+		contentAddressableStorage: contentAddressableStorage,
+		scratchStorage:            scratchStorage,
+		extractionLimits:          options.ExtractionLimits,
+	}
+	if database := options.ChecksumDatabase; database != nil {
+		if gf.checksumDatabase, err = newGoChecksumDatabase(&gf.client, database.VerifierKey, database.URL, database.ExcludedModulePatterns); err != nil {
+			return nil, util.StatusWrap(err, "Invalid checksum database")
+		}
+	}
+	return gf, nil
+}
+
+func (gf *goModuleFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	return nil, status.Error(codes.PermissionDenied, "Fetching of blobs from Go module proxies is not supported")
+}
+
+func (gf *goModuleFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	resourceType, expectedHash := "", ""
+	for _, q := range req.Qualifiers {
+		switch q.Name {
+		case "resource_type":
+			resourceType = q.Value
+		case QualifierGoSum:
+			if !strings.HasPrefix(q.Value, "h1:") {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid %s qualifier %#v, as only h1: hashes are supported", QualifierGoSum, q.Value)
+			}
+			expectedHash = q.Value
+		}
+	}
+	if resourceType != ResourceTypeGoModule {
+		return nil, status.Errorf(codes.InvalidArgument, "Resource type %#v is not supported, as only %#v is", resourceType, ResourceTypeGoModule)
+	}
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		rootDirectoryDigest, hashMismatch, err := gf.fetchDirectory(ctx, uri, digestFunction, expectedHash)
+		if err != nil {
+			log.Printf("Error downloading Go module with URI %s: %v", uri, err)
+			if hashMismatch || ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		return &remoteasset.FetchDirectoryResponse{
+			Status:              status.New(codes.OK, "Directory fetched successfully!").Proto(),
+			Uri:                 uri,
+			Qualifiers:          req.Qualifiers,
+			RootDirectoryDigest: rootDirectoryDigest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to download directory from any provided URI")
+}
+
+// parseGoModuleURI splits a URI of the form "module@version", where
+// version is a canonical semantic version or pseudo-version.
+func parseGoModuleURI(uri string) (string, string, error) {
+	i := strings.LastIndexByte(uri, '@')
+	if i < 0 {
+		return "", "", status.Errorf(codes.InvalidArgument, "Invalid URI %#v, as it is not of the form \"module@version\"", uri)
+	}
+	modulePath, version := uri[:i], uri[i+1:]
+	if err := module.CheckPath(modulePath); err != nil {
+		return "", "", util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid module path")
+	}
+	if version == "" {
+		return "", "", status.Errorf(codes.InvalidArgument, "Invalid URI %#v, as it does not contain a version", uri)
+	}
+	// Queries such as branch names and "latest" are not accepted,
+	// as the module they resolve to changes over time. This would
+	// cause stale modules to be returned from the asset cache.
+	if module.CanonicalVersion(version) != version {
+		return "", "", status.Errorf(codes.InvalidArgument, "Invalid URI %#v, as version %#v is not canonical", uri, version)
+	}
+	if err := module.Check(modulePath, version); err != nil {
+		return "", "", util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid module version")
+	}
+	return modulePath, version, nil
+}
+
+// fetchDirectory downloads a module and writes its source tree into
+// the CAS. It is reported whether the module did not match its
+// expected hash, as there is no point in attempting other URIs in
+// that case.
+func (gf *goModuleFetcher) fetchDirectory(ctx context.Context, uri string, digestFunction bb_digest.Function, expectedHash string) (bb_digest.Digest, bool, error) {
+	modulePath, version, err := parseGoModuleURI(uri)
+	if err != nil {
+		return bb_digest.BadDigest, false, err
+	}
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid module path")
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid version")
+	}
+
+	modData, err := gf.getMetadata(ctx, escapedPath+"/@v/"+escapedVersion+".mod")
+	if err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrap(err, "Failed to obtain go.mod file")
+	}
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(modData)), nil
+	})
+	if err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrapWithCode(err, codes.Internal, "Failed to hash go.mod file")
+	}
+
+	zipFile, zipSizeBytes, err := gf.downloadZip(ctx, escapedPath+"/@v/"+escapedVersion+".zip")
+	if err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrap(err, "Failed to obtain module zip file")
+	}
+	defer closeDownloadedContent(zipFile)
+	zipHash, err := hashGoModuleZip(zipFile, zipSizeBytes)
+	if err != nil {
+		return bb_digest.BadDigest, false, err
+	}
+
+	if expectedHash != "" && zipHash != expectedHash {
+		return bb_digest.BadDigest, true, status.Errorf(codes.Internal, "Module %s@%s did not match %s qualifier: Expected %s, Got %s", modulePath, version, QualifierGoSum, expectedHash, zipHash)
+	}
+	if gf.checksumDatabase != nil {
+		expectedZipHash, expectedModHash, verify, err := gf.checksumDatabase.lookup(ctx, modulePath, version)
+		if err != nil {
+			return bb_digest.BadDigest, false, err
+		}
+		if verify && zipHash != expectedZipHash {
+			return bb_digest.BadDigest, true, status.Errorf(codes.Internal, "Module %s@%s did not match checksum database: Expected %s, Got %s", modulePath, version, expectedZipHash, zipHash)
+		}
+		if verify && modHash != expectedModHash {
+			return bb_digest.BadDigest, true, status.Errorf(codes.Internal, "go.mod file of module %s@%s did not match checksum database: Expected %s, Got %s", modulePath, version, expectedModHash, modHash)
+		}
+	}
+
+	builder := directory.NewBuilder(gf.contentAddressableStorage, digestFunction, gf.scratchStorage)
+	if err := archive.Extract(ctx, zipFile, zipSizeBytes, archive.Zip, modulePath+"@"+version, gf.extractionLimits, builder); err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrap(err, "Failed to extract module zip file")
+	}
+	rootDirectoryDigest, err := builder.Finalize(ctx)
+	if err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrapWithCode(err, codes.Internal, "Failed to place directory into CAS")
+	}
+	return rootDirectoryDigest, false, nil
+}
+
+// get requests a file from the module proxies, in the order in which
+// they are listed.
+func (gf *goModuleFetcher) get(ctx context.Context, p string) (*http.Response, error) {
+	var lastErr error
+	for _, proxy := range gf.proxies {
+		resp, err := gf.client.get(ctx, proxy.url+"/"+p)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil || (!proxy.fallBackOnAllErrors && status.Code(err) != codes.NotFound) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// getMetadata requests a small file, such as a .mod file,
+// from the module proxies.
+func (gf *goModuleFetcher) getMetadata(ctx context.Context, p string) ([]byte, error) {
+	resp, err := gf.get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readGoModuleResponse(ctx, resp, maximumGoModuleMetadataSizeBytes)
+}
+
+// downloadZip copies a module zip file from the module proxies into
+// scratch storage.
+func (gf *goModuleFetcher) downloadZip(ctx context.Context, p string) (*scratch.File, int64, error) {
+	resp, err := gf.get(ctx, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > maximumGoModuleZipSizeBytes {
+		return nil, 0, status.Errorf(codes.ResourceExhausted, "Module zip file exceeds the maximum size of %d bytes", maximumGoModuleZipSizeBytes)
+	}
+
+	zipFile, err := gf.scratchStorage.NewFile(ctx, resp.ContentLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	sizeBytes, err := io.Copy(zipFile, io.LimitReader(resp.Body, maximumGoModuleZipSizeBytes+1))
+	if err != nil {
+		closeDownloadedContent(zipFile)
+		if status.Code(err) == codes.ResourceExhausted {
+			return nil, 0, err
+		}
+		return nil, 0, wrapDownloadError(ctx, err, "Failed to read response body")
+	}
+	if sizeBytes > maximumGoModuleZipSizeBytes {
+		closeDownloadedContent(zipFile)
+		return nil, 0, status.Errorf(codes.ResourceExhausted, "Module zip file exceeds the maximum size of %d bytes", maximumGoModuleZipSizeBytes)
+	}
+	return zipFile, sizeBytes, nil
+}
+
+// hashGoModuleZip computes the h1: hash of a module zip file, as
+// stored in go.sum files and the checksum database.
+func hashGoModuleZip(r io.ReaderAt, sizeBytes int64) (string, error) {
+	zipReader, err := zip.NewReader(r, sizeBytes)
+	if err != nil {
+		return "", util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid module zip file")
+	}
+	files := make([]string, 0, len(zipReader.File))
+	zipFiles := make(map[string]*zip.File, len(zipReader.File))
+	for _, file := range zipReader.File {
+		if _, ok := zipFiles[file.Name]; ok {
+			return "", status.Errorf(codes.InvalidArgument, "Module zip file contains multiple files named %#v", file.Name)
+		}
+		files = append(files, file.Name)
+		zipFiles[file.Name] = file
+	}
+	hash, err := dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		file, ok := zipFiles[name]
+		if !ok {
+			return nil, fmt.Errorf("file %#v not found", name)
+		}
+		return file.Open()
+	})
+	if err != nil {
+		return "", util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to hash module zip file")
+	}
+	return hash, nil
+}
+
+func (gf *goModuleFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return qualifier.Difference(qualifiers, qualifier.NewSet([]string{"resource_type", QualifierGoSum, "bazel.canonical_id"}))
+}
@@ -0,0 +1,254 @@
+package fetch_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// goModuleProxy is a directory in the format expected by GOPROXY,
+// which is served over HTTP.
+type goModuleProxy struct {
+	t      *testing.T
+	root   string
+	server *httptest.Server
+}
+
+func newGoModuleProxy(t *testing.T) *goModuleProxy {
+	root := t.TempDir()
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	t.Cleanup(server.Close)
+	return &goModuleProxy{t: t, root: root, server: server}
+}
+
+// addModule writes the .mod and .zip files of a module version
+// into the proxy, returning the hashes of the zip and go.mod files.
+func (p *goModuleProxy) addModule(modulePath, version string, files map[string]string) (string, string) {
+	directory := filepath.Join(p.root, modulePath, "@v")
+	require.NoError(p.t, os.MkdirAll(directory, 0o755))
+	require.NoError(p.t, os.WriteFile(filepath.Join(directory, version+".mod"), []byte(files["go.mod"]), 0o644))
+
+	var zipData bytes.Buffer
+	zipWriter := zip.NewWriter(&zipData)
+	for name, contents := range files {
+		w, err := zipWriter.Create(modulePath + "@" + version + "/" + name)
+		require.NoError(p.t, err)
+		_, err = w.Write([]byte(contents))
+		require.NoError(p.t, err)
+	}
+	require.NoError(p.t, zipWriter.Close())
+	zipPath := filepath.Join(directory, version+".zip")
+	require.NoError(p.t, os.WriteFile(zipPath, zipData.Bytes(), 0o644))
+
+	zipHash, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	require.NoError(p.t, err)
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewBufferString(files["go.mod"])), nil
+	})
+	require.NoError(p.t, err)
+	return zipHash, modHash
+}
+
+func TestGoModuleFetcherFetchDirectory(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := bb_digest.MustNewFunction("", remoteexecution.DigestFunction_SHA256)
+	contents := map[bb_digest.Digest][]byte{}
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, blobDigest bb_digest.Digest, b buffer.Buffer) error {
+			data, err := b.ToByteSlice(1 << 20)
+			if err != nil {
+				return err
+			}
+			contents[blobDigest] = data
+			return nil
+		}).AnyTimes()
+	getDirectory := func(d *remoteexecution.Digest) *remoteexecution.Directory {
+		directoryDigest, err := digestFunction.NewDigestFromProto(d)
+		require.NoError(t, err)
+		var directory remoteexecution.Directory
+		require.NoError(t, proto.Unmarshal(contents[directoryDigest], &directory))
+		return &directory
+	}
+
+	// The first proxy only has a private module, while the second
+	// proxy has public modules.
+	privateProxy := newGoModuleProxy(t)
+	privateProxy.addModule("private.example.com/secret", "v1.0.0", map[string]string{
+		"go.mod": "module private.example.com/secret\n",
+	})
+	publicProxy := newGoModuleProxy(t)
+	helloHash, helloModHash := publicProxy.addModule("example.com/hello", "v1.0.0", map[string]string{
+		"go.mod":          "module example.com/hello\n",
+		"hello.go":        "package hello\n",
+		"internal/say.go": "package internal\n",
+	})
+	publicProxy.addModule("example.com/tampered", "v1.0.0", map[string]string{
+		"go.mod": "module example.com/tampered\n",
+	})
+
+	signerKey, verifierKey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.NoError(t, err)
+	checksumDatabase := httptest.NewServer(sumdb.NewServer(sumdb.NewTestServer(signerKey, func(modulePath, version string) ([]byte, error) {
+		switch modulePath + "@" + version {
+		case "example.com/hello@v1.0.0":
+			return []byte(fmt.Sprintf("example.com/hello v1.0.0 %s\nexample.com/hello v1.0.0/go.mod %s\n", helloHash, helloModHash)), nil
+		case "example.com/tampered@v1.0.0":
+			return []byte(fmt.Sprintf("example.com/tampered v1.0.0 %s\nexample.com/tampered v1.0.0/go.mod %s\n", helloHash, helloModHash)), nil
+		default:
+			return nil, fmt.Errorf("module %s@%s not found", modulePath, version)
+		}
+	})))
+	defer checksumDatabase.Close()
+
+	goModuleFetcher, err := fetch.NewGoModuleFetcher(http.DefaultClient, casBlobAccess, fetch.GoModuleFetcherOptions{
+		Proxy: privateProxy.server.URL + "," + publicProxy.server.URL,
+		ChecksumDatabase: &fetch.GoChecksumDatabase{
+			VerifierKey:            verifierKey,
+			URL:                    checksumDatabase.URL,
+			ExcludedModulePatterns: []string{"private.example.com"},
+		},
+		ExtractionLimits: archive.Limits{
+			MaximumExtractedSizeBytes: 1 << 20,
+			MaximumEntries:            100,
+		},
+	})
+	require.NoError(t, err)
+	resourceType := &remoteasset.Qualifier{Name: "resource_type", Value: "application/x-go-module"}
+
+	t.Run("Success", func(t *testing.T) {
+		response, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"example.com/hello@v1.0.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "go.sum", Value: helloHash},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+		require.Equal(t, "example.com/hello@v1.0.0", response.Uri)
+
+		// The module@version prefix of the zip file is stripped.
+		root := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, root.Files, 2)
+		require.Equal(t, "go.mod", root.Files[0].Name)
+		require.Equal(t, "hello.go", root.Files[1].Name)
+		require.Len(t, root.Directories, 1)
+		require.Equal(t, "internal", root.Directories[0].Name)
+		internal := getDirectory(root.Directories[0].Digest)
+		require.Len(t, internal.Files, 1)
+		require.Equal(t, "say.go", internal.Files[0].Name)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		// Queries resolve to different versions over time,
+		// meaning they cannot be cached.
+		for _, version := range []string{"main", "latest", "v1", "v1.0"} {
+			_, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+				Uris:       []string{"example.com/hello@" + version},
+				Qualifiers: []*remoteasset.Qualifier{resourceType},
+			})
+			testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download directory from any provided URI: Invalid URI \"example.com/hello@%s\", as version \"%s\" is not canonical", version, version), err)
+		}
+	})
+
+	t.Run("ExcludedFromChecksumDatabase", func(t *testing.T) {
+		response, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{"private.example.com/secret@v1.0.0"},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		require.NoError(t, err)
+		root := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, root.Files, 1)
+		require.Equal(t, "go.mod", root.Files[0].Name)
+	})
+
+	t.Run("GoSumMismatch", func(t *testing.T) {
+		// Hash mismatches are fatal, even if other URIs are
+		// provided.
+		_, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"example.com/hello@v1.0.0", "example.com/tampered@v1.0.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				resourceType,
+				{Name: "go.sum", Value: "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.Internal, "Module example.com/hello@v1.0.0 did not match go.sum qualifier: Expected h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=, Got %s", helloHash), err)
+	})
+
+	t.Run("ChecksumDatabaseMismatch", func(t *testing.T) {
+		_, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{"example.com/tampered@v1.0.0"},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.ErrorContains(t, err, "Module example.com/tampered@v1.0.0 did not match checksum database: Expected "+helloHash)
+	})
+
+	t.Run("UnknownModule", func(t *testing.T) {
+		_, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{"example.com/unknown@v1.0.0"},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.ErrorContains(t, err, "Unable to download directory from any provided URI: Failed to obtain go.mod file: HTTP request to "+publicProxy.server.URL+"/example.com/unknown/@v/v1.0.0.mod failed with status \"404 Not Found\"")
+	})
+
+	t.Run("InvalidURI", func(t *testing.T) {
+		_, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris:       []string{"example.com/hello"},
+			Qualifiers: []*remoteasset.Qualifier{resourceType},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download directory from any provided URI: Invalid URI \"example.com/hello\", as it is not of the form \"module@version\""), err)
+	})
+
+	t.Run("MissingResourceType", func(t *testing.T) {
+		_, err := goModuleFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"example.com/hello@v1.0.0"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Resource type \"\" is not supported, as only \"application/x-go-module\" is"), err)
+	})
+}
+
+func TestNewGoModuleFetcher(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+
+	t.Run("Direct", func(t *testing.T) {
+		_, err := fetch.NewGoModuleFetcher(http.DefaultClient, casBlobAccess, fetch.GoModuleFetcherOptions{
+			Proxy: "https://proxy.golang.org,direct",
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Proxy \"direct\" is not supported, as modules can only be downloaded from module proxies"), err)
+	})
+
+	t.Run("NoProxies", func(t *testing.T) {
+		_, err := fetch.NewGoModuleFetcher(http.DefaultClient, casBlobAccess, fetch.GoModuleFetcherOptions{})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "No module proxies provided"), err)
+	})
+}
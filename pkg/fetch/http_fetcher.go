@@ -2,27 +2,64 @@ package fetch
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/hex"
-	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/buildbarn/bb-storage/pkg/blobstore"
 	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
 	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
 	"github.com/buildbarn/bb-storage/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/proto/asset"
 	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
 
 	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
-	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var (
+	httpFetcherPrometheusMetrics sync.Once
+
+	httpFetcherDownloadDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "buildbarn",
+			Subsystem: "remote_asset",
+			Name:      "http_fetcher_download_duration_seconds",
+			Help:      "Amount of time spent per download of a single URI by the http fetcher, in seconds.",
+			Buckets:   util.DecimalExponentialBuckets(-3, 6, 2),
+		},
+		[]string{"attempt", "outcome"})
+	httpFetcherBlobSizeBytes = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "buildbarn",
+			Subsystem: "remote_asset",
+			Name:      "http_fetcher_blob_size_bytes",
+			Help:      "Size of blobs downloaded by the http fetcher, in bytes.",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 16),
+		},
+		[]string{"outcome"})
+	httpFetcherHTTPRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "buildbarn",
+			Subsystem: "remote_asset",
+			Name:      "http_fetcher_http_requests_total",
+			Help:      "Number of HTTP requests made by the http fetcher to download a URI, including retries.",
+		},
+		[]string{"attempt", "outcome"})
 )
 
 const (
@@ -34,38 +71,98 @@ const (
 	// QualifierHTTPHeaderURLPrefix is a qualifier to add a header to a specific URI.
 	// Qualifier will be in the form http_header_url:<index>:<header>
 	QualifierHTTPHeaderURLPrefix = "http_header_url:"
+	// QualifierArchiveType is a qualifier to explicitly specify the
+	// format of the archive downloaded by FetchDirectory, using the
+	// same values as the 'type' attribute of http_archive().
+	QualifierArchiveType = "archive.type"
+	// QualifierArchiveStripPrefix is a qualifier to only return a
+	// directory contained in the archive downloaded by FetchDirectory.
+	QualifierArchiveStripPrefix = "archive.strip_prefix"
 )
 
-type httpFetcher struct {
-	httpClient                *http.Client
-	contentAddressableStorage blobstore.BlobAccess
-}
+// HTTPFetcherOptions contains optional settings that alter the behaviour
+// of the HTTP fetcher. The zero value corresponds to the default
+// behaviour.
+type HTTPFetcherOptions struct {
+	// Maximum amount of time to spend on downloading a single URI.
+	// When zero, a download may take as long as the request permits.
+	PerURITimeout time.Duration
+
+	// Amount of time after which the next URI is downloaded in
+	// parallel, if the previous download has not completed yet.
+	// When zero, URIs are downloaded one after the other.
+	HedgingDelay time.Duration
+
+	// Maximum number of times a download that got interrupted is
+	// continued using a range request. Downloads are only continued if
+	// the server indicates support for range requests and provides an
+	// ETag or Last-Modified header.
+	MaximumResumeAttempts int
 
-type temporaryFile struct {
-	*os.File
+	// When set, FetchDirectory is supported by downloading an archive
+	// and extracting it, subject to the limits provided.
+	ArchiveExtractionLimits *archive.Limits
+
+	// Prior to downloading a blob whose checksum.sri qualifier uses
+	// the digest function of the request, obtain its size from the
+	// server and check whether it is already present in the CAS. If
+	// so, the download is skipped.
+	SkipDownloadsOfExistingBlobs bool
+
+	// Credentials of the server for authenticating against upstream
+	// hosts, and how they are merged with headers provided by clients.
+	Credentials          CredentialStore
+	CredentialPrecedence CredentialPrecedence
+
+	// Limits on the size of blobs that may be downloaded. When nil,
+	// the size of downloads is unbounded.
+	DownloadSizeLimits *DownloadSizeLimits
+
+	// When set, requests for a URI that fail due to the server being
+	// temporarily unavailable are retried, for as long as the
+	// deadline of the request permits.
+	RetryPolicy *RetryPolicy
+
+	// Storage for holding the contents of downloads and files
+	// extracted from archives, until they have been written into the
+	// CAS. When nil, small files are held in memory, while larger
+	// files are written to the system's temporary directory.
+	ScratchStorage *scratch.Storage
+
+	// Policies for verifying downloads against checksum files
+	// published alongside them, if no checksum.sri qualifier is
+	// provided. The first policy matching a URI is used. Unlike
+	// mismatches against checksum.sri, mismatches against checksum
+	// files cause the next URI to be attempted, as checksum files
+	// are specific to the URI.
+	ChecksumFilePolicies []ChecksumFilePolicy
 }
 
-func (f *temporaryFile) Close() error {
-	path := f.Name()
-	closeErr := f.File.Close()
-	removeErr := os.Remove(path)
-	if closeErr != nil {
-		return closeErr
-	}
-	if removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
-		return removeErr
-	}
-	return nil
+type httpFetcher struct {
+	httpClient                *http.Client
+	contentAddressableStorage blobstore.BlobAccess
+	options                   HTTPFetcherOptions
 }
 
 // NewHTTPFetcher creates a remoteasset FetchServer compatible service for handling requests which involve downloading
 // assets over HTTP and storing them into a CAS.
 func NewHTTPFetcher(httpClient *http.Client,
 	contentAddressableStorage blobstore.BlobAccess,
+	options HTTPFetcherOptions,
 ) Fetcher {
+	httpFetcherPrometheusMetrics.Do(func() {
+		prometheus.MustRegister(httpFetcherDownloadDurationSeconds)
+		prometheus.MustRegister(httpFetcherBlobSizeBytes)
+		prometheus.MustRegister(httpFetcherHTTPRequestsTotal)
+	})
+
+	if options.ScratchStorage == nil {
+		options.ScratchStorage = scratch.NewDefaultStorage()
+	}
 	return &httpFetcher{
 		httpClient:                httpClient,
 		contentAddressableStorage: contentAddressableStorage,
+		options:                   options,
 	}
 }
 
@@ -75,10 +172,13 @@ func (hf *httpFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlob
 		return nil, err
 	}
 
-	// TODO: Address the following fields
-	// timeout := ptypes.Duration(req.timeout)
-	// oldestContentAccepted := ptypes.Timestamp(req.oldestContentAccepted)
-	expectedDigest, checksumFunction, err := getChecksumSri(req.Qualifiers)
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	checksum, err := getChecksumSri(req.Qualifiers)
 	if err != nil {
 		return nil, err
 	}
@@ -88,39 +188,346 @@ func (hf *httpFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlob
 		return nil, err
 	}
 
-	for _, uri := range req.Uris {
-		buffer, digest, checksum := hf.downloadBlob(ctx, uri, digestFunction, checksumFunction, expectedDigest, auth)
-		if _, err = buffer.GetSizeBytes(); err != nil {
-			log.Printf("Error downloading blob with URI %s: %v", uri, err)
-			continue
-		}
+	params := downloadParameters{
+		digestFunction:   digestFunction,
+		checksum:         checksum,
+		auth:             auth,
+		maximumSizeBytes: hf.getMaximumSizeBytes(req.InstanceName, req.Qualifiers),
+		staleAssets:      getStaleAssets(ctx, hf.contentAddressableStorage, digestFunction, asset.Asset_BLOB),
+		streamToCAS:      checksum != nil && len(checksum.hashes) == 1 && checksum.function.GetEnumValue() == digestFunction.GetEnumValue(),
+	}
 
-		if expectedDigest != "" && checksum != expectedDigest {
-			buffer.Discard()
-			return nil, status.Errorf(codes.Internal, "Fetched content did not match checksum.sri qualifier: Expected %s, Got %s", expectedDigest, checksum)
+	if hf.options.SkipDownloadsOfExistingBlobs && checksum != nil && checksum.function.GetEnumValue() == digestFunction.GetEnumValue() {
+		if uri, blobDigest, ok := hf.findExistingBlob(ctx, req.Uris, digestFunction, checksum.hashes, auth); ok {
+			return &remoteasset.FetchBlobResponse{
+				Status:     status.New(codes.OK, "Blob fetched successfully!").Proto(),
+				Uri:        uri,
+				Qualifiers: req.Qualifiers,
+				BlobDigest: blobDigest.GetProto(),
+			}, nil
 		}
+	}
 
-		if err = hf.contentAddressableStorage.Put(ctx, digest, buffer); err != nil {
-			log.Printf("Error downloading blob with URI %s: %v", uri, err)
-			return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to place blob into CAS")
-		}
+	result, err := hf.downloadFromURIs(ctx, req.Uris, params)
+	if err != nil {
+		return nil, err
+	}
+	if r := getRevalidation(ctx); r != nil {
+		r.upstreamValidators = result.upstreamValidators
+	}
+	if result.notModified {
+		return &remoteasset.FetchBlobResponse{
+			Status:     status.New(codes.OK, "Blob has not been modified since it was last fetched").Proto(),
+			Uri:        result.uri,
+			Qualifiers: req.Qualifiers,
+			BlobDigest: result.digest.GetProto(),
+		}, nil
+	}
+	if result.storedInCAS {
 		return &remoteasset.FetchBlobResponse{
 			Status:     status.New(codes.OK, "Blob fetched successfully!").Proto(),
-			Uri:        uri,
+			Uri:        result.uri,
 			Qualifiers: req.Qualifiers,
-			BlobDigest: digest.GetProto(),
+			BlobDigest: result.digest.GetProto(),
 		}, nil
 	}
+	if err = hf.contentAddressableStorage.Put(ctx, result.digest, buffer.NewValidatedBufferFromReaderAt(result.content, result.digest.GetSizeBytes())); err != nil {
+		log.Printf("Error downloading blob with URI %s: %v", result.uri, err)
+		return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to place blob into CAS")
+	}
+	return &remoteasset.FetchBlobResponse{
+		Status:     status.New(codes.OK, "Blob fetched successfully!").Proto(),
+		Uri:        result.uri,
+		Qualifiers: req.Qualifiers,
+		BlobDigest: result.digest.GetProto(),
+	}, nil
+}
+
+// downloadParameters contains the properties of a request that apply
+// to the download of each of its URIs.
+type downloadParameters struct {
+	digestFunction bb_digest.Function
+	checksum       *checksumSRI
+	auth           *AuthHeaders
+	// Maximum size of the blob in bytes. Zero means unlimited.
+	maximumSizeBytes int64
+	// Assets previously fetched from the URIs, which are reused if
+	// the upstream server indicates the resource has not changed.
+	staleAssets map[string]staleAsset
+	// Whether the blob may be written into the CAS while it is being
+	// downloaded, as its digest is known up front.
+	streamToCAS bool
+}
+
+// staleAsset is the content of an asset that is older than the request
+// permits, together with the validators of the upstream resource from
+// which it was obtained.
+type staleAsset struct {
+	digest             bb_digest.Digest
+	upstreamValidators *asset.UpstreamValidators
+}
+
+// downloadResult is the outcome of downloading a single URI.
+type downloadResult struct {
+	uri                string
+	content            buffer.ReadAtCloser
+	digest             bb_digest.Digest
+	checksum           string
+	upstreamValidators *asset.UpstreamValidators
+	// Set if the upstream resource is unchanged since it was last
+	// fetched, meaning the digest refers to a stale asset and there
+	// is no content.
+	notModified bool
+	// Set if the content has already been written into the CAS
+	// while downloading, meaning there is no content.
+	storedInCAS      bool
+	err              error
+	checksumMismatch bool
+	// Set if the content could not be written into the CAS. Other
+	// URIs are not attempted, as the CAS would fail again.
+	casFailure bool
+}
+
+// downloadFromURIs downloads the first URI that yields content matching
+// the expected checksum. URIs are attempted in order. When hedging is
+// enabled, the next URI is also started if the previous download has
+// not completed within the hedging delay, after which the first
+// successful download is used and all others are cancelled. Blobs
+// exceeding the maximum size cause the fetch to fail immediately, as
+// other URIs are expected to yield the same content.
+func (hf *httpFetcher) downloadFromURIs(ctx context.Context, uris []string, params downloadParameters) (downloadResult, error) {
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan downloadResult, len(uris))
+	started, running := 0, 0
+	startNext := func() {
+		uri, attempt := uris[started], "Primary"
+		if running > 0 {
+			attempt = "Hedged"
+		}
+		started++
+		running++
+		go func() {
+			timeStart := time.Now()
+			// Without a checksum.sri qualifier, the content may
+			// need to be verified against a checksum file that
+			// is specific to the URI.
+			checksum := params.checksum
+			var result downloadResult
+			var err error
+			if checksum == nil {
+				checksum, err = hf.getChecksumFromFiles(downloadCtx, uri, params.auth)
+			}
+			if err == nil {
+				uriParams := params
+				uriParams.checksum = checksum
+				result, err = hf.downloadBlob(downloadCtx, uri, uriParams)
+			}
+			result.uri = uri
+			outcome := "Succeeded"
+			if err != nil {
+				result.err = err
+				outcome = status.Code(err).String()
+			} else if result.notModified {
+				// The checksum was validated when the stale
+				// asset was fetched originally.
+				outcome = "NotModified"
+			} else if checksum != nil {
+				if err := checksum.verify(result.checksum); err != nil {
+					if result.content != nil {
+						closeDownloadedContent(result.content)
+						result.content = nil
+					}
+					result.err = err
+					// Checksum files are served by the
+					// same host as the content, meaning
+					// other URIs may still yield content
+					// matching the checksum.sri qualifier.
+					result.checksumMismatch = params.checksum != nil
+					outcome = "ChecksumMismatch"
+				}
+			}
+			httpFetcherDownloadDurationSeconds.WithLabelValues(attempt, outcome).Observe(time.Since(timeStart).Seconds())
+			results <- result
+		}()
+	}
+
+	// Cancel all downloads that are still in flight and release
+	// their contents.
+	releaseRemaining := func() {
+		cancel()
+		go func(remaining int) {
+			for i := 0; i < remaining; i++ {
+				if content := (<-results).content; content != nil {
+					closeDownloadedContent(content)
+				}
+			}
+		}(running)
+	}
+
+	var hedgingTimer *time.Timer
+	var hedgingTimerChannel <-chan time.Time
+	if hf.options.HedgingDelay > 0 {
+		hedgingTimer = time.NewTimer(hf.options.HedgingDelay)
+		defer hedgingTimer.Stop()
+		hedgingTimerChannel = hedgingTimer.C
+	}
+
+	var err, checksumMismatchErr error
+	var timedOutURIs []string
+	startNext()
+	for running > 0 {
+		select {
+		case <-hedgingTimerChannel:
+			if started < len(uris) && ctx.Err() == nil {
+				startNext()
+				hedgingTimer.Reset(hf.options.HedgingDelay)
+			}
+		case result := <-results:
+			running--
+			if result.err == nil {
+				releaseRemaining()
+				return result, nil
+			}
+
+			err = result.err
+			log.Printf("Error downloading blob with URI %s: %v", result.uri, err)
+			if status.Code(err) == codes.ResourceExhausted || result.casFailure {
+				releaseRemaining()
+				return downloadResult{}, err
+			}
+			if result.checksumMismatch {
+				if hedgingTimer == nil {
+					return downloadResult{}, err
+				}
+				checksumMismatchErr = err
+			}
+			if status.Code(err) == codes.DeadlineExceeded {
+				timedOutURIs = append(timedOutURIs, result.uri)
+			}
+			// Immediately start the next URI, as there is no
+			// point in waiting for the hedging delay once a
+			// download has failed. There is no point in trying
+			// other URIs if the request as a whole has expired.
+			if started < len(uris) && ctx.Err() == nil {
+				startNext()
+				if hedgingTimer != nil {
+					hedgingTimer.Reset(hf.options.HedgingDelay)
+				}
+			}
+		}
+	}
 
-	return nil, util.StatusWrapWithCode(err, codes.NotFound, "Unable to download blob from any provided URI")
+	if len(timedOutURIs) > 0 {
+		return downloadResult{}, status.Errorf(codes.DeadlineExceeded, "Timed out downloading blob from URIs %s: %v", strings.Join(timedOutURIs, ", "), status.Convert(err).Message())
+	}
+	if checksumMismatchErr != nil {
+		return downloadResult{}, checksumMismatchErr
+	}
+	return downloadResult{}, util.StatusWrapWithCode(err, codes.NotFound, "Unable to download blob from any provided URI")
 }
 
 func (hf *httpFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
-	return nil, status.Errorf(codes.PermissionDenied, "HTTP Fetching of directories is not supported!")
+	if hf.options.ArchiveExtractionLimits == nil {
+		return nil, status.Errorf(codes.PermissionDenied, "HTTP Fetching of directories is not supported!")
+	}
+
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	checksum, err := getChecksumSri(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := getAuthHeaders(req.Uris, req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var explicitFormat *archive.Format
+	stripPrefix := ""
+	for _, q := range req.Qualifiers {
+		switch q.Name {
+		case QualifierArchiveType:
+			format, err := archive.ParseFormat(q.Value)
+			if err != nil {
+				return nil, err
+			}
+			explicitFormat = &format
+		case QualifierArchiveStripPrefix:
+			stripPrefix = q.Value
+		}
+	}
+
+	result, err := hf.downloadFromURIs(ctx, req.Uris, downloadParameters{
+		digestFunction:   digestFunction,
+		checksum:         checksum,
+		auth:             auth,
+		maximumSizeBytes: hf.getMaximumSizeBytes(req.InstanceName, req.Qualifiers),
+		staleAssets:      getStaleAssets(ctx, hf.contentAddressableStorage, digestFunction, asset.Asset_DIRECTORY),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r := getRevalidation(ctx); r != nil {
+		r.upstreamValidators = result.upstreamValidators
+	}
+	if result.notModified {
+		return &remoteasset.FetchDirectoryResponse{
+			Status:              status.New(codes.OK, "Directory has not been modified since it was last fetched").Proto(),
+			Uri:                 result.uri,
+			Qualifiers:          req.Qualifiers,
+			RootDirectoryDigest: result.digest.GetProto(),
+		}, nil
+	}
+	defer closeDownloadedContent(result.content)
+
+	var format archive.Format
+	if explicitFormat != nil {
+		format = *explicitFormat
+	} else {
+		parsedURI, err := url.Parse(result.uri)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URI %#v", result.uri)
+		}
+		var ok bool
+		if format, ok = archive.FormatFromPath(parsedURI.Path); !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "Cannot determine the archive type of URI %#v, as its extension is not recognized. Please provide the %#v qualifier", result.uri, QualifierArchiveType)
+		}
+	}
+
+	builder := directory.NewBuilder(hf.contentAddressableStorage, digestFunction, hf.options.ScratchStorage)
+	if err := archive.Extract(ctx, result.content, result.digest.GetSizeBytes(), format, stripPrefix, *hf.options.ArchiveExtractionLimits, builder); err != nil {
+		return nil, util.StatusWrapf(err, "Failed to extract archive with URI %#v", result.uri)
+	}
+	rootDirectoryDigest, err := builder.Finalize(ctx)
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to place directory into CAS")
+	}
+	return &remoteasset.FetchDirectoryResponse{
+		Status:              status.New(codes.OK, "Directory fetched successfully!").Proto(),
+		Uri:                 result.uri,
+		Qualifiers:          req.Qualifiers,
+		RootDirectoryDigest: rootDirectoryDigest.GetProto(),
+	}, nil
 }
 
 func (hf *httpFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
 	toRemove := qualifier.NewSet([]string{"checksum.sri", QualifierLegacyBazelHTTPHeaders, "bazel.canonical_id"})
+	if hf.options.ArchiveExtractionLimits != nil {
+		toRemove.Add(QualifierArchiveType)
+		toRemove.Add(QualifierArchiveStripPrefix)
+	}
 	for name := range qualifiers {
 		if strings.HasPrefix(name, QualifierHTTPHeaderPrefix) || strings.HasPrefix(name, QualifierHTTPHeaderURLPrefix) {
 			toRemove.Add(name)
@@ -129,122 +536,570 @@ func (hf *httpFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
 	return qualifier.Difference(qualifiers, toRemove)
 }
 
-// downloadBlob performs the actual blob download, yielding a buffer of the content, its Digest, and checksum.
-func (hf *httpFetcher) downloadBlob(ctx context.Context, uri string, digestFunction, checksumFunction bb_digest.Function, expectedDigest string, auth *AuthHeaders) (buffer.Buffer, bb_digest.Digest, string) {
-	// Generate the HTTP Request
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
-	if err != nil {
-		return buffer.NewBufferFromError(util.StatusWrapWithCode(err, codes.Internal, "Failed to create HTTP request")), bb_digest.BadDigest, ""
-	}
-	if auth != nil {
-		auth.ApplyHeaders(uri, req)
+// downloadBlob performs the actual blob download, yielding a scratch file holding the content, its Digest, and checksum.
+// If permitted by the parameters, the content is instead written into the CAS directly.
+func (hf *httpFetcher) downloadBlob(ctx context.Context, uri string, params downloadParameters) (downloadResult, error) {
+	// The returned content is backed by a scratch file, meaning it
+	// remains valid after the context of the download is cancelled.
+	if hf.options.PerURITimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hf.options.PerURITimeout)
+		defer cancel()
 	}
 
-	// Perform the request, check for status
-	resp, err := hf.httpClient.Do(req)
+	staleAsset, hasStaleAsset := params.staleAssets[uri]
+	resp, err := hf.performRequest(ctx, uri, params.auth, staleAsset.upstreamValidators)
 	if err != nil {
-		log.Printf("Error downloading blob with URI %s: %v", uri, err)
-		return buffer.NewBufferFromError(util.StatusWrapWithCode(err, codes.Internal, "HTTP request failed")), bb_digest.BadDigest, ""
-	}
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Error downloading blob with URI %s: %v", uri, resp.StatusCode)
-		return buffer.NewBufferFromError(status.Errorf(codes.Internal, "HTTP request failed with status %#v", resp.Status)), bb_digest.BadDigest, ""
+		return downloadResult{}, err
 	}
 	defer func() {
 		if resp.Body != nil {
 			_ = resp.Body.Close()
 		}
 	}()
+	if resp.StatusCode == http.StatusNotModified && hasStaleAsset {
+		upstreamValidators := getUpstreamValidators(resp)
+		if upstreamValidators == nil {
+			upstreamValidators = staleAsset.upstreamValidators
+		}
+		return downloadResult{
+			digest:             staleAsset.digest,
+			upstreamValidators: upstreamValidators,
+			notModified:        true,
+		}, nil
+	}
+	upstreamValidators := getUpstreamValidators(resp)
+	if params.maximumSizeBytes > 0 && resp.ContentLength > params.maximumSizeBytes {
+		httpFetcherBlobSizeBytes.WithLabelValues("ResourceExhausted").Observe(float64(resp.ContentLength))
+		return downloadResult{}, status.Errorf(codes.ResourceExhausted, "Blob has a size of %d bytes, which exceeds the maximum size of %d bytes", resp.ContentLength, params.maximumSizeBytes)
+	}
 
-	tempFileHandle, err := os.CreateTemp("", "bb-remote-asset-*")
+	// Continue the download where it left off if reading the
+	// response body fails and the server permits it. The digest
+	// generators are fed incrementally, so hashing continues where
+	// it left off as well.
+	body := hf.newResumingReader(ctx, uri, params.auth, resp)
+	resp.Body = nil
+	defer body.Close()
+
+	if params.streamToCAS && resp.ContentLength >= 0 {
+		return hf.streamBlobToCAS(ctx, body, resp.ContentLength, params, upstreamValidators)
+	}
+
+	// Depending on its size, the blob is held in memory or written
+	// to the scratch directory. Space is reserved up front if the
+	// size is known, meaning the download may need to wait for
+	// others to complete.
+	content, err := hf.options.ScratchStorage.NewFile(ctx, resp.ContentLength)
 	if err != nil {
-		return buffer.NewBufferFromError(util.StatusWrapWithCode(err, codes.Internal, "Failed to create temporary file")), bb_digest.BadDigest, ""
+		return downloadResult{}, err
 	}
-	tempFile := &temporaryFile{File: tempFileHandle}
-	shouldCloseTempFile := true
+	shouldCloseContent := true
 	defer func() {
-		if shouldCloseTempFile {
-			if err := tempFile.Close(); err != nil {
-				log.Printf("Failed to close temporary file %s: %v", tempFile.Name(), err)
-			}
+		if shouldCloseContent {
+			closeDownloadedContent(content)
 		}
 	}()
 
-	// Compute digests while streaming the response body to disk.
-	hasher := digestFunction.NewGenerator(resp.ContentLength)
-	writers := []io.Writer{tempFile, hasher}
+	// Compute digests while storing the response body.
+	// The size of the blob is checked before any data is written, as
+	// the Content-Length announced by the server may be absent or
+	// incorrect.
+	hasher := params.digestFunction.NewGenerator(resp.ContentLength)
+	writers := []io.Writer{content, hasher}
+	if params.maximumSizeBytes > 0 {
+		writers = append([]io.Writer{&sizeLimitingWriter{
+			remainingBytes:   params.maximumSizeBytes,
+			maximumSizeBytes: params.maximumSizeBytes,
+		}}, writers...)
+	}
 	var checksumGenerator *bb_digest.Generator
-	if expectedDigest != "" {
-		checksumGenerator = checksumFunction.NewGenerator(resp.ContentLength)
+	if params.checksum != nil {
+		checksumGenerator = params.checksum.function.NewGenerator(resp.ContentLength)
 		writers = append(writers, checksumGenerator)
 	}
-	if _, err := io.Copy(io.MultiWriter(writers...), resp.Body); err != nil {
-		return buffer.NewBufferFromError(util.StatusWrapWithCode(err, codes.Internal, "Failed to read response body")), bb_digest.BadDigest, ""
-	}
-	err = resp.Body.Close()
+	sizeBytes, err := io.Copy(io.MultiWriter(writers...), body)
 	if err != nil {
-		return buffer.NewBufferFromError(util.StatusWrapWithCode(err, codes.Internal, "Failed to close response body")), bb_digest.BadDigest, ""
+		if status.Code(err) == codes.ResourceExhausted {
+			httpFetcherBlobSizeBytes.WithLabelValues("ResourceExhausted").Observe(float64(sizeBytes))
+			return downloadResult{}, err
+		}
+		return downloadResult{}, wrapDownloadError(ctx, err, "Failed to read response body")
 	}
-	resp.Body = nil
-	digest := hasher.Sum()
-	checksum := ""
-	if expectedDigest != "" {
-		checksum = checksumGenerator.Sum().GetProto().GetHash()
+	if err := body.Close(); err != nil {
+		return downloadResult{}, util.StatusWrapWithCode(err, codes.Internal, "Failed to close response body")
+	}
+	httpFetcherBlobSizeBytes.WithLabelValues("Succeeded").Observe(float64(sizeBytes))
+	result := downloadResult{
+		content:            content,
+		digest:             hasher.Sum(),
+		upstreamValidators: upstreamValidators,
+	}
+	if params.checksum != nil {
+		result.checksum = checksumGenerator.Sum().GetProto().GetHash()
 	}
 
-	shouldCloseTempFile = false
-	return buffer.NewValidatedBufferFromReaderAt(tempFile, digest.GetSizeBytes()), digest, checksum
+	shouldCloseContent = false
+	return result, nil
 }
 
-// getChecksumSri parses the checksum.sri qualifier into an expected digest and a digest function to use
-func getChecksumSri(qualifiers []*remoteasset.Qualifier) (string, bb_digest.Function, error) {
-	hashTypes := map[string]remoteexecution.DigestFunction_Value{
-		"sha256":     remoteexecution.DigestFunction_SHA256,
-		"sha1":       remoteexecution.DigestFunction_SHA1,
-		"md5":        remoteexecution.DigestFunction_MD5,
-		"sha384":     remoteexecution.DigestFunction_SHA384,
-		"sha512":     remoteexecution.DigestFunction_SHA512,
-		"sha256tree": remoteexecution.DigestFunction_SHA256TREE,
+// streamBlobToCAS writes the response body directly into the CAS,
+// without storing it in a scratch file first. This is only possible
+// if the digest of the blob is known before the download starts,
+// meaning the checksum.sri qualifier uses the digest function of the
+// request and the server announced the size of the blob. The CAS
+// rejects the blob if its contents don't match the digest.
+func (hf *httpFetcher) streamBlobToCAS(ctx context.Context, body *resumingReader, sizeBytes int64, params downloadParameters, upstreamValidators *asset.UpstreamValidators) (downloadResult, error) {
+	blobDigest, err := params.digestFunction.NewDigest(params.checksum.hashes[0], sizeBytes)
+	if err != nil {
+		return downloadResult{}, util.StatusWrapWithCode(err, codes.Internal, "Failed to create digest for blob")
 	}
-	expectedDigest := ""
-	digestFunctionEnum := remoteexecution.DigestFunction_UNKNOWN
-	for _, qualifier := range qualifiers {
-		if qualifier.Name == "checksum.sri" {
-			if digestFunctionEnum != remoteexecution.DigestFunction_UNKNOWN {
-				return "", bb_digest.Function{}, status.Errorf(codes.InvalidArgument, "Multiple checksum.sri provided")
-			}
-			parts := strings.SplitN(qualifier.Value, "-", 2)
-			if len(parts) != 2 {
-				return "", bb_digest.Function{}, status.Errorf(codes.InvalidArgument, "Bad checksum.sri hash expression: %s", qualifier.Value)
+	// Compute the checksum of the blob separately, so that a
+	// mismatch can be told apart from failures of the CAS.
+	checksumGenerator := params.checksum.function.NewGenerator(sizeBytes)
+	validatedBody := struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, checksumGenerator), body}
+	if err := hf.contentAddressableStorage.Put(ctx, blobDigest, buffer.NewCASBufferFromReader(blobDigest, validatedBody, buffer.UserProvided)); err != nil {
+		if body.err != nil {
+			return downloadResult{}, wrapDownloadError(ctx, body.err, "Failed to read response body")
+		}
+		if body.offsetBytes == sizeBytes {
+			if checksum := checksumGenerator.Sum().GetProto().GetHash(); !params.checksum.matches(checksum) {
+				return downloadResult{checksum: checksum}, nil
 			}
-			hashName := parts[0]
-			b64hash := parts[1]
+		}
+		return downloadResult{casFailure: true}, util.StatusWrapWithCode(err, codes.Internal, "Failed to place blob into CAS")
+	}
+	httpFetcherBlobSizeBytes.WithLabelValues("Succeeded").Observe(float64(sizeBytes))
+	return downloadResult{
+		digest:             blobDigest,
+		checksum:           checksumGenerator.Sum().GetProto().GetHash(),
+		upstreamValidators: upstreamValidators,
+		storedInCAS:        true,
+	}, nil
+}
 
-			digestFunctionEnum, ok := hashTypes[hashName]
-			if !ok {
-				return "", bb_digest.Function{}, status.Errorf(codes.InvalidArgument, "Unsupported checksum algorithm %s", hashName)
+// performRequest requests the contents of a URI. Requests that fail due
+// to the server being temporarily unavailable are retried according to
+// the retry policy, as long as the backoff and any delay requested
+// through the Retry-After header permit doing so before the deadline.
+//
+// If validators of a previous download of the resource are provided,
+// the request is made conditional. The server may then respond with
+// status 304, indicating that the resource has not changed.
+func (hf *httpFetcher) performRequest(ctx context.Context, uri string, auth *AuthHeaders, upstreamValidators *asset.UpstreamValidators) (*http.Response, error) {
+	retryPolicy := hf.options.RetryPolicy
+	for attempt := 1; ; attempt++ {
+		attemptLabel := "Initial"
+		if attempt > 1 {
+			attemptLabel = "Retry"
+		}
+
+		req, err := hf.newRequest(ctx, http.MethodGet, uri, auth)
+		if err != nil {
+			return nil, err
+		}
+		if etag := upstreamValidators.GetEtag(); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := upstreamValidators.GetLastModified(); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+		resp, err := hf.httpClient.Do(req)
+		retryable := false
+		var retryAfter time.Duration
+		if err != nil {
+			log.Printf("Error downloading blob with URI %s: %v", uri, err)
+			httpFetcherHTTPRequestsTotal.WithLabelValues(attemptLabel, "NetworkError").Inc()
+			retryable = retryPolicy != nil && retryPolicy.isRetryableNetworkError(ctx, err)
+			err = wrapDownloadError(ctx, err, "HTTP request failed")
+		} else {
+			httpFetcherHTTPRequestsTotal.WithLabelValues(attemptLabel, strconv.Itoa(resp.StatusCode)).Inc()
+			if resp.StatusCode == http.StatusOK || (resp.StatusCode == http.StatusNotModified && upstreamValidators != nil) {
+				return resp, nil
 			}
+			log.Printf("Error downloading blob with URI %s: %v", uri, resp.StatusCode)
+			if resp.Body != nil {
+				_ = resp.Body.Close()
+			}
+			retryable = retryPolicy != nil && retryPolicy.isRetryableStatusCode(resp.StatusCode)
+			retryAfter = getRetryAfter(resp, time.Now())
+			err = status.Errorf(codes.Internal, "HTTP request failed with status %#v", resp.Status)
+		}
+		if !retryable || attempt >= retryPolicy.MaximumAttempts {
+			return nil, err
+		}
+
+		delay := retryPolicy.getBackoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, util.StatusWrapf(err, "Not retrying, as waiting %s would exceed the deadline", delay)
+		}
+		log.Printf("Retrying download of blob with URI %s in %s (attempt %d)", uri, delay, attempt+1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, wrapDownloadError(ctx, err, "HTTP request failed")
+		case <-timer.C:
+		}
+	}
+}
+
+// getUpstreamValidators returns the validators provided by the server as
+// part of a response, which can be used to check whether the resource
+// has changed at a later point in time.
+func getUpstreamValidators(resp *http.Response) *asset.UpstreamValidators {
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+	return &asset.UpstreamValidators{
+		Etag:         etag,
+		LastModified: lastModified,
+	}
+}
+
+// sizeLimitingWriter is an io.Writer that discards its input, but fails
+// once more data is written to it than permitted. It is placed in front
+// of the other writers of an io.MultiWriter, so that data exceeding the
+// limit is never written to disk.
+type sizeLimitingWriter struct {
+	remainingBytes   int64
+	maximumSizeBytes int64
+}
+
+func (w *sizeLimitingWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.remainingBytes {
+		return 0, status.Errorf(codes.ResourceExhausted, "Blob exceeds the maximum size of %d bytes", w.maximumSizeBytes)
+	}
+	w.remainingBytes -= int64(len(p))
+	return len(p), nil
+}
+
+// getMaximumSizeBytes returns the maximum size of blobs that may be
+// downloaded on behalf of a request, or zero if unlimited.
+func (hf *httpFetcher) getMaximumSizeBytes(instanceName string, qualifiers []*remoteasset.Qualifier) int64 {
+	if hf.options.DownloadSizeLimits == nil {
+		return 0
+	}
+	parsedInstanceName, err := bb_digest.NewInstanceName(instanceName)
+	if err != nil {
+		// Invalid instance names are rejected by
+		// getDigestFunction() before any download takes place.
+		return hf.options.DownloadSizeLimits.DefaultMaximumSizeBytes
+	}
+	return hf.options.DownloadSizeLimits.GetMaximumSizeBytes(parsedInstanceName, qualifiers)
+}
 
-			// Convert expected digest to hex
-			decoded, err := base64.StdEncoding.DecodeString(b64hash)
+// findExistingBlob checks whether the blob referenced by the
+// checksum.sri qualifier is already present in the CAS. As the size of
+// a blob is part of its digest, it is obtained from the first URI that
+// is able to provide it. Failures are not fatal, as the blob can still
+// be downloaded afterwards.
+func (hf *httpFetcher) findExistingBlob(ctx context.Context, uris []string, digestFunction bb_digest.Function, expectedHashes []string, auth *AuthHeaders) (string, bb_digest.Digest, bool) {
+	for _, uri := range uris {
+		sizeBytes, err := hf.probeSize(ctx, uri, auth)
+		if err != nil {
+			log.Printf("Failed to obtain size of blob with URI %s: %v", uri, err)
+			if ctx.Err() != nil {
+				return "", bb_digest.BadDigest, false
+			}
+			continue
+		}
+		blobDigests := make([]bb_digest.Digest, 0, len(expectedHashes))
+		digestsToCheck := bb_digest.NewSetBuilder()
+		for _, expectedHash := range expectedHashes {
+			blobDigest, err := digestFunction.NewDigest(expectedHash, sizeBytes)
 			if err != nil {
-				return "", bb_digest.Function{}, status.Errorf(codes.InvalidArgument, "Failed to decode checksum as base64 encoded %s sum: %s", hashName, err.Error())
+				return "", bb_digest.BadDigest, false
 			}
-			expectedDigest = hex.EncodeToString(decoded)
+			blobDigests = append(blobDigests, blobDigest)
+			digestsToCheck.Add(blobDigest)
+		}
+		missing, err := hf.contentAddressableStorage.FindMissing(ctx, digestsToCheck.Build())
+		if err != nil {
+			log.Printf("Failed to check for existence of blobs %v: %v", blobDigests, err)
+			return "", bb_digest.BadDigest, false
+		}
+		missingDigests := map[bb_digest.Digest]bool{}
+		for _, missingDigest := range missing.Items() {
+			missingDigests[missingDigest] = true
+		}
+		for _, blobDigest := range blobDigests {
+			if !missingDigests[blobDigest] {
+				return uri, blobDigest, true
+			}
+		}
+		return "", bb_digest.BadDigest, false
+	}
+	return "", bb_digest.BadDigest, false
+}
 
-			// Convert to a proper digest function.
-			// Note: The Instance name doesn't matter here, this function is used only
-			// to give us a convenient API when actually checking the checksum.
-			instance := util.Must(bb_digest.NewInstanceName(""))
-			checksumFunction, err := instance.GetDigestFunction(digestFunctionEnum, len(expectedDigest))
-			if err != nil {
-				return "", bb_digest.Function{}, status.Errorf(codes.InvalidArgument, "Failed to get checksum function for checksum.sri: %s", err.Error())
+// probeSize obtains the size of a resource without downloading it. A
+// HEAD request is attempted first. If the server does not support it or
+// does not announce the size, a request for the first byte of the
+// resource is made, whose Content-Range header contains the full size.
+func (hf *httpFetcher) probeSize(ctx context.Context, uri string, auth *AuthHeaders) (int64, error) {
+	if hf.options.PerURITimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hf.options.PerURITimeout)
+		defer cancel()
+	}
+
+	req, err := hf.newRequest(ctx, http.MethodHead, uri, auth)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := hf.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 {
+		return resp.ContentLength, nil
+	}
+
+	req, err = hf.newRequest(ctx, http.MethodGet, uri, auth)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err = hf.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		contentRange := resp.Header.Get("Content-Range")
+		if _, totalSize, ok := strings.Cut(contentRange, "/"); ok && strings.HasPrefix(contentRange, "bytes ") {
+			if sizeBytes, err := strconv.ParseInt(totalSize, 10, 64); err == nil && sizeBytes >= 0 {
+				return sizeBytes, nil
 			}
-			return expectedDigest, checksumFunction, nil
 		}
+		return 0, fmt.Errorf("unexpected content range %#v", contentRange)
+	case http.StatusOK:
+		// The server ignored the range and started sending the
+		// entire resource, which has been aborted.
+		if resp.ContentLength >= 0 {
+			return resp.ContentLength, nil
+		}
+	}
+	return 0, fmt.Errorf("HTTP request failed with status %#v", resp.Status)
+}
+
+// newRequest creates an HTTP request for a URI, carrying both the
+// headers provided by the client and the credentials of the server.
+func (hf *httpFetcher) newRequest(ctx context.Context, method, uri string, auth *AuthHeaders) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, nil)
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to create HTTP request")
+	}
+	var credentials http.Header
+	if hf.options.Credentials != nil {
+		credentials, err = hf.options.Credentials.GetCredentials(ctx, req.URL)
+		if err != nil {
+			return nil, util.StatusWrapf(err, "Failed to obtain credentials for URI %#v", uri)
+		}
+	}
+	if auth == nil {
+		auth = NewAuthHeaders()
+	}
+	auth.ApplyHeaders(uri, req, credentials, hf.options.CredentialPrecedence)
+	return req, nil
+}
+
+// getResumeValidator returns the value to send as part of an If-Range
+// header when resuming the download of a response. An empty string is
+// returned if the server does not permit resuming the download, either
+// because it does not support range requests or because it does not
+// provide a validator guaranteeing that the content remains the same.
+func getResumeValidator(resp *http.Response) string {
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return ""
+	}
+	// Weak entity tags may not be used in If-Range headers.
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// resumeDownload requests the remainder of a resource, starting at a
+// given offset. The server must respond with the partial content
+// requested, as any other response indicates that the resource has
+// changed since the download was started.
+func (hf *httpFetcher) resumeDownload(ctx context.Context, uri string, auth *AuthHeaders, validator string, offset int64) (*http.Response, error) {
+	req, err := hf.newRequest(ctx, http.MethodGet, uri, auth)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	req.Header.Set("If-Range", validator)
+
+	resp, err := hf.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		if resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+		return nil, fmt.Errorf("resumed HTTP request failed with status %#v", resp.Status)
+	}
+	if contentRange := resp.Header.Get("Content-Range"); !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", offset)) {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("resumed HTTP request returned unexpected content range %#v", contentRange)
+	}
+	return resp, nil
+}
+
+// closeDownloadedContent releases the scratch file holding the
+// contents of a download that is not used.
+func closeDownloadedContent(content buffer.ReadAtCloser) {
+	if err := content.Close(); err != nil {
+		log.Printf("Failed to close downloaded content: %v", err)
+	}
+}
+
+// applyRequestTimeout bounds the duration of the entire fetch, including
+// all URIs that are attempted and storing the result in the CAS.
+func applyRequestTimeout(ctx context.Context, timeout *durationpb.Duration) (context.Context, context.CancelFunc, error) {
+	if timeout != nil {
+		if err := timeout.CheckValid(); err != nil {
+			return nil, nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid timeout")
+		}
+		if d := timeout.AsDuration(); d > 0 {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			return ctx, cancel, nil
+		}
+	}
+	return ctx, func() {}, nil
+}
+
+// wrapDownloadError converts an error that occurred while performing an
+// HTTP request to a gRPC status. Errors caused by the context expiring
+// are reported as such, so that timeouts can be told apart from
+// failures of the upstream server.
+func wrapDownloadError(ctx context.Context, err error, msg string) error {
+	if ctx.Err() != nil {
+		return util.StatusWrap(util.StatusFromContext(ctx), msg)
+	}
+	return util.StatusWrapWithCode(err, codes.Internal, msg)
+}
+
+// checksumSRI contains the hashes of a checksum.sri qualifier or a
+// checksum file against which downloaded content is verified. Only
+// hashes using the strongest algorithm contained in the qualifier are
+// retained.
+type checksumSRI struct {
+	algorithm string
+	// Where the hashes originate from, for use in error messages.
+	source   string
+	function bb_digest.Function
+	// Expected hashes, in hexadecimal form. Content is valid if it
+	// matches any of them.
+	hashes []string
+}
+
+func (c *checksumSRI) matches(hash string) bool {
+	for _, expectedHash := range c.hashes {
+		if hash == expectedHash {
+			return true
+		}
+	}
+	return false
+}
+
+// verify returns an error if a hash computed over fetched content does
+// not match any of the expected hashes.
+func (c *checksumSRI) verify(hash string) error {
+	if c.matches(hash) {
+		return nil
+	}
+	return status.Errorf(codes.Internal, "Fetched content did not match %s hash of %s: Expected %s, Got %s", c.algorithm, c.source, strings.Join(c.hashes, " or "), hash)
+}
+
+// newVerifier creates a checksumVerifier for content of a given size,
+// or -1 if unknown. The checksum may be nil, in which case all content
+// is accepted.
+func (c *checksumSRI) newVerifier(sizeBytes int64) *checksumVerifier {
+	if c == nil {
+		return &checksumVerifier{}
+	}
+	return &checksumVerifier{
+		checksum:  c,
+		generator: c.function.NewGenerator(sizeBytes),
+	}
+}
+
+// checksumVerifier hashes content while it is being written into
+// scratch storage or the CAS, so that it can be verified against a
+// checksum once it has been fetched completely.
+type checksumVerifier struct {
+	checksum  *checksumSRI
+	generator *bb_digest.Generator
+}
+
+func (v *checksumVerifier) Write(p []byte) (int, error) {
+	if v.checksum == nil {
+		return len(p), nil
 	}
+	return v.generator.Write(p)
+}
 
-	return "", bb_digest.Function{}, nil
+// verify returns an error if the content written into the verifier
+// does not match the checksum.
+func (v *checksumVerifier) verify() error {
+	if v.checksum == nil {
+		return nil
+	}
+	return v.checksum.verify(v.generator.Sum().GetProto().GetHash())
+}
+
+// getChecksumSri parses the checksum.sri qualifier. If no such
+// qualifier is provided, nil is returned.
+func getChecksumSri(qualifiers []*remoteasset.Qualifier) (*checksumSRI, error) {
+	var checksum *checksumSRI
+	for _, q := range qualifiers {
+		if q.Name != "checksum.sri" {
+			continue
+		}
+		if checksum != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Multiple checksum.sri provided")
+		}
+		sri, err := qualifier.ParseChecksumSRI(q.Value)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		// Convert to a proper digest function.
+		// Note: The Instance name doesn't matter here, this function is used only
+		// to give us a convenient API when actually checking the checksum.
+		instance := util.Must(bb_digest.NewInstanceName(""))
+		checksumFunction, err := instance.GetDigestFunction(sri.DigestFunction, 2*len(sri.Hashes[0]))
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Failed to get checksum function for checksum.sri: %s", err.Error())
+		}
+		checksum = &checksumSRI{
+			algorithm: sri.Algorithm,
+			source:    "checksum.sri qualifier",
+			function:  checksumFunction,
+		}
+		for _, hash := range sri.Hashes {
+			checksum.hashes = append(checksum.hashes, hex.EncodeToString(hash))
+		}
+	}
+	return checksum, nil
 }
 
 func getAuthHeaders(uris []string, qualifiers []*remoteasset.Qualifier) (*AuthHeaders, error) {
@@ -1,18 +1,26 @@
 package fetch_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
 	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-remote-asset/pkg/proto/asset"
 	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-remote-asset/pkg/storage"
 	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
 	"github.com/buildbarn/bb-storage/pkg/digest"
 	"github.com/buildbarn/bb-storage/pkg/testutil"
@@ -25,6 +33,8 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type headerMatcher struct {
@@ -112,8 +122,11 @@ func requireNoTemporaryFiles(t *testing.T, tempDir string) {
 	require.Empty(t, entries)
 }
 
-func expectBlobPut(t *testing.T, casBlobAccess *mock.MockBlobAccess, ctx context.Context, blobDigest digest.Digest) *gomock.Call {
-	return casBlobAccess.EXPECT().Put(ctx, blobDigest, gomock.Any()).DoAndReturn(
+// expectBlobPut expects a blob to be written into the CAS. The context
+// is not matched, as blobs whose digest is known up front are written
+// while downloading, using the context of the individual download.
+func expectBlobPut(t *testing.T, casBlobAccess *mock.MockBlobAccess, blobDigest digest.Digest) *gomock.Call {
+	return casBlobAccess.EXPECT().Put(gomock.Any(), blobDigest, gomock.Any()).DoAndReturn(
 		func(_ context.Context, _ digest.Digest, blobBuffer buffer.Buffer) error {
 			requireBlobBufferContentsFromChunkReader(t, blobBuffer)
 			return nil
@@ -121,8 +134,8 @@ func expectBlobPut(t *testing.T, casBlobAccess *mock.MockBlobAccess, ctx context
 	)
 }
 
-func expectBlobPutIntoWriter(t *testing.T, casBlobAccess *mock.MockBlobAccess, ctx context.Context, blobDigest digest.Digest) *gomock.Call {
-	return casBlobAccess.EXPECT().Put(ctx, blobDigest, gomock.Any()).DoAndReturn(
+func expectBlobPutIntoWriter(t *testing.T, casBlobAccess *mock.MockBlobAccess, blobDigest digest.Digest) *gomock.Call {
+	return casBlobAccess.EXPECT().Put(gomock.Any(), blobDigest, gomock.Any()).DoAndReturn(
 		func(_ context.Context, _ digest.Digest, blobBuffer buffer.Buffer) error {
 			requireBlobBufferContentsIntoWriter(t, blobBuffer)
 			return nil
@@ -130,6 +143,17 @@ func expectBlobPutIntoWriter(t *testing.T, casBlobAccess *mock.MockBlobAccess, c
 	)
 }
 
+// expectCorruptedBlobPut expects a blob that does not match its digest
+// to be streamed into the CAS, which rejects it.
+func expectCorruptedBlobPut(casBlobAccess *mock.MockBlobAccess) *gomock.Call {
+	return casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ digest.Digest, blobBuffer buffer.Buffer) error {
+			_, err := blobBuffer.ToByteSlice(100)
+			return err
+		},
+	)
+}
+
 func TestHTTPFetcherFetchBlobSuccessSHA256(t *testing.T) {
 	testHTTPFetcherFetchBlobSuccessWithHasher(
 		t,
@@ -195,7 +219,7 @@ func testHTTPFetcherFetchBlobSuccessWithHasher(t *testing.T, digestFunctionEnum
 	}
 	casBlobAccess := mock.NewMockBlobAccess(ctrl)
 	roundTripper := mock.NewMockRoundTripper(ctrl)
-	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{})
 
 	t.Run("Success"+helloDigest.GetDigestFunction().GetEnumValue().String(), func(t *testing.T) {
 		tempDir := t.TempDir()
@@ -207,7 +231,7 @@ func testHTTPFetcherFetchBlobSuccessWithHasher(t *testing.T, digestFunctionEnum
 			Body:          body,
 			ContentLength: 5,
 		}, nil)
-		expectBlobPut(t, casBlobAccess, ctx, helloDigest).After(httpDoCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.NoError(t, err)
@@ -226,7 +250,7 @@ func testHTTPFetcherFetchBlobSuccessWithHasher(t *testing.T, digestFunctionEnum
 			Body:          body,
 			ContentLength: -1,
 		}, nil)
-		expectBlobPut(t, casBlobAccess, ctx, helloDigest)
+		expectBlobPut(t, casBlobAccess, helloDigest)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.NoError(t, err)
@@ -259,7 +283,7 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 	}
 	casBlobAccess := mock.NewMockBlobAccess(ctrl)
 	roundTripper := mock.NewMockRoundTripper(ctrl)
-	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{})
 
 	t.Run("SuccessNoExpectedDigest", func(t *testing.T) {
 		tempDir := t.TempDir()
@@ -276,7 +300,7 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 			Body:          body,
 			ContentLength: 5,
 		}, nil)
-		expectBlobPut(t, casBlobAccess, ctx, helloDigest).After(httpDoCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.NoError(t, err)
@@ -300,7 +324,7 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 			Body:          body,
 			ContentLength: -1,
 		}, nil)
-		expectBlobPut(t, casBlobAccess, ctx, helloDigest).After(httpDoCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.NoError(t, err)
@@ -319,7 +343,7 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 			Body:          body,
 			ContentLength: 5,
 		}, nil)
-		expectBlobPutIntoWriter(t, casBlobAccess, ctx, helloDigest).After(httpDoCall)
+		expectBlobPutIntoWriter(t, casBlobAccess, helloDigest).After(httpDoCall)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.NoError(t, err)
@@ -391,6 +415,9 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 				ContentLength: 5,
 			}, nil
 		})
+		// As the digest is known up front, the blob is streamed
+		// into the CAS, which rejects it.
+		expectCorruptedBlobPut(casBlobAccess)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
 			InstanceName: InstanceName,
@@ -402,11 +429,91 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 				},
 			},
 		})
-		testutil.RequireEqualStatus(t, status.Error(codes.Internal, "Fetched content did not match checksum.sri qualifier: Expected e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855, Got 185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969"), err)
+		testutil.RequireEqualStatus(t, status.Error(codes.Internal, "Fetched content did not match sha256 hash of checksum.sri qualifier: Expected e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855, Got 185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969"), err)
 		require.Nil(t, response)
 		requireNoTemporaryFiles(t, tempDir)
 	})
 
+	t.Run("StreamedIntoCAS", func(t *testing.T) {
+		// The checksum.sri qualifier uses the digest function of
+		// the request, meaning the blob can be written into the
+		// CAS without storing it in a temporary file first.
+		tempDir := t.TempDir()
+		t.Setenv("TMPDIR", tempDir)
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil)
+		casBlobAccess.EXPECT().Put(gomock.Any(), helloDigest, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ digest.Digest, blobBuffer buffer.Buffer) error {
+				requireNoTemporaryFiles(t, tempDir)
+				data, err := blobBuffer.ToByteSlice(100)
+				require.NoError(t, err)
+				require.Equal(t, TestData, string(data))
+				return nil
+			})
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+	})
+
+	t.Run("StreamedIntoCASFailure", func(t *testing.T) {
+		// Failures of the CAS should not be reported as checksum
+		// mismatches. Other URIs should not be attempted, as
+		// the CAS would fail again.
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil)
+		casBlobAccess.EXPECT().Put(gomock.Any(), helloDigest, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ digest.Digest, blobBuffer buffer.Buffer) error {
+				blobBuffer.Discard()
+				return status.Error(codes.Unavailable, "Storage offline")
+			})
+
+		_, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         []string{uri, "http://www.another.com/hello"},
+			Qualifiers:   request.Qualifiers,
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.Internal, "Failed to place blob into CAS: Storage offline"), err)
+	})
+
+	t.Run("MultiHashChecksumSri", func(t *testing.T) {
+		// Only hashes of the strongest algorithm are checked, and the
+		// content may match any of them. The MD5 hash is incorrect,
+		// but ignored.
+		emptyDigest := digestFunction.NewGenerator(0).Sum()
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         []string{uri, "www.another.com"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{
+					Name: "checksum.sri",
+					Value: fmt.Sprintf(
+						"md5-AAAAAAAAAAAAAAAAAAAAAA== %s?opt %s",
+						digestToChecksumSri(remoteexecution.DigestFunction_SHA256, emptyDigest),
+						digestToChecksumSri(remoteexecution.DigestFunction_SHA256, helloDigest)),
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+	})
+
 	t.Run("OneFailOneSuccess", func(t *testing.T) {
 		httpFailCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
 			Status:     "404 Not Found",
@@ -419,7 +526,7 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 			Body:          body,
 			ContentLength: 5,
 		}, nil).After(httpFailCall)
-		expectBlobPut(t, casBlobAccess, ctx, helloDigest).After(httpSuccessCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpSuccessCall)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.NoError(t, err)
@@ -466,7 +573,7 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 			Body:          body,
 			ContentLength: 5,
 		}, nil)
-		expectBlobPut(t, casBlobAccess, ctx, helloDigest).After(httpDoCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.NoError(t, err)
@@ -522,7 +629,7 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 			ContentLength: 5,
 		}, nil)
 
-		expectBlobPut(t, casBlobAccess, ctx, helloDigest).After(httpDoCall2)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall2)
 
 		response, err := HTTPFetcher.FetchBlob(ctx, request)
 		require.Nil(t, err)
@@ -531,6 +638,296 @@ func TestHTTPFetcherFetchBlob(t *testing.T) {
 	})
 }
 
+func TestHTTPFetcherFetchBlobTimeout(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		PerURITimeout: 100 * time.Millisecond,
+	})
+
+	// Simulates a mirror that never responds.
+	stall := func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+
+	t.Run("PerURITimeoutFallsBackToNextURI", func(t *testing.T) {
+		stallCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(stall)
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil).After(stallCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         []string{"www.example.com", "www.another.com"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "www.another.com", response.Uri)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+	})
+
+	t.Run("AllURIsTimedOut", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(stall).Times(2)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         []string{"www.example.com", "www.another.com"},
+		})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), "www.example.com, www.another.com")
+	})
+
+	t.Run("RequestTimeout", func(t *testing.T) {
+		// The request timeout is shorter than the per URI
+		// timeout, meaning the second URI is never attempted.
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(stall)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         []string{"www.example.com", "www.another.com"},
+			Timeout:      durationpb.New(10 * time.Millisecond),
+		})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), "www.example.com")
+		require.NotContains(t, status.Convert(err).Message(), "www.another.com")
+	})
+
+	t.Run("InvalidTimeout", func(t *testing.T) {
+		_, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         []string{"www.example.com"},
+			Timeout:      &durationpb.Duration{Seconds: -1, Nanos: 1},
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestHTTPFetcherFetchBlobHedging(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		HedgingDelay: 10 * time.Millisecond,
+	})
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName: InstanceName,
+		Uris:         []string{"http://slow.example.com/", "http://fast.example.com/"},
+		Qualifiers: []*remoteasset.Qualifier{
+			{
+				Name:  "checksum.sri",
+				Value: digestToChecksumSri(remoteexecution.DigestFunction_SHA256, helloDigest),
+			},
+		},
+	}
+
+	t.Run("SlowMirrorIsCancelled", func(t *testing.T) {
+		slowCancelled := make(chan struct{})
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "slow.example.com" {
+				<-req.Context().Done()
+				close(slowCancelled)
+				return nil, req.Context().Err()
+			}
+			return &http.Response{
+				Status:        "200 Success",
+				StatusCode:    200,
+				Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+				ContentLength: 5,
+			}, nil
+		}).Times(2)
+		expectBlobPut(t, casBlobAccess, helloDigest)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, "http://fast.example.com/", response.Uri)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+		<-slowCancelled
+	})
+
+	t.Run("ChecksumMismatchFallsBackToOtherMirror", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			data := TestData
+			if req.URL.Host == "slow.example.com" {
+				data = "Corrupted"
+			}
+			return &http.Response{
+				Status:        "200 Success",
+				StatusCode:    200,
+				Body:          io.NopCloser(bytes.NewBuffer([]byte(data))),
+				ContentLength: int64(len(data)),
+			}, nil
+		}).Times(2)
+		expectBlobPut(t, casBlobAccess, helloDigest)
+		expectCorruptedBlobPut(casBlobAccess)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, "http://fast.example.com/", response.Uri)
+	})
+
+	t.Run("AllMirrorsMismatch", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				Status:        "200 Success",
+				StatusCode:    200,
+				Body:          io.NopCloser(bytes.NewBuffer([]byte("Corrupted"))),
+				ContentLength: 9,
+			}, nil
+		}).Times(2)
+		expectCorruptedBlobPut(casBlobAccess).Times(2)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), "Fetched content did not match sha256 hash of checksum.sri qualifier")
+	})
+}
+
+// interruptedReader returns the data it has been provided, followed by
+// an error simulating a connection that got dropped.
+type interruptedReader struct {
+	data []byte
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestHTTPFetcherFetchBlobResume(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		MaximumResumeAttempts: 1,
+	})
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName: InstanceName,
+		Uris:         []string{"http://www.example.com/archive.tar.gz"},
+		Qualifiers: []*remoteasset.Qualifier{
+			{
+				Name:  "checksum.sri",
+				Value: digestToChecksumSri(remoteexecution.DigestFunction_SHA256, helloDigest),
+			},
+		},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		tempDir := t.TempDir()
+		t.Setenv("TMPDIR", tempDir)
+		initialCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			require.Empty(t, req.Header.Get("Range"))
+			return &http.Response{
+				Status:     "200 Success",
+				StatusCode: 200,
+				Header: http.Header{
+					"Accept-Ranges": []string{"bytes"},
+					"Etag":          []string{`"v1"`},
+				},
+				Body:          io.NopCloser(&interruptedReader{data: []byte(TestData[:3])}),
+				ContentLength: 5,
+			}, nil
+		})
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			require.Equal(t, "bytes=3-", req.Header.Get("Range"))
+			require.Equal(t, `"v1"`, req.Header.Get("If-Range"))
+			return &http.Response{
+				Status:     "206 Partial Content",
+				StatusCode: 206,
+				Header: http.Header{
+					"Content-Range": []string{"bytes 3-4/5"},
+				},
+				Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData[3:]))),
+				ContentLength: 2,
+			}, nil
+		}).After(initialCall)
+		// The blob is streamed into the CAS, meaning it is
+		// written while the download is resumed.
+		expectBlobPut(t, casBlobAccess, helloDigest).After(initialCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+		requireNoTemporaryFiles(t, tempDir)
+	})
+
+	t.Run("ResourceChanged", func(t *testing.T) {
+		tempDir := t.TempDir()
+		t.Setenv("TMPDIR", tempDir)
+		initialCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:     "200 Success",
+			StatusCode: 200,
+			Header: http.Header{
+				"Accept-Ranges": []string{"bytes"},
+				"Last-Modified": []string{"Wed, 21 Oct 2015 07:28:00 GMT"},
+			},
+			Body:          io.NopCloser(&interruptedReader{data: []byte(TestData[:3])}),
+			ContentLength: 5,
+		}, nil)
+		// The If-Range validator no longer matches, causing the
+		// server to return the full resource.
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte("Goodbye"))),
+			ContentLength: 7,
+		}, nil).After(initialCall)
+		expectCorruptedBlobPut(casBlobAccess)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.Equal(t, codes.NotFound, status.Code(err))
+		requireNoTemporaryFiles(t, tempDir)
+	})
+
+	t.Run("NoRangeSupport", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:     "200 Success",
+			StatusCode: 200,
+			Header: http.Header{
+				"Etag": []string{`"v1"`},
+			},
+			Body:          io.NopCloser(&interruptedReader{data: []byte(TestData[:3])}),
+			ContentLength: 5,
+		}, nil)
+		expectCorruptedBlobPut(casBlobAccess)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
 func TestHTTPFetcherFetchDirectory(t *testing.T) {
 	ctrl, ctx := gomock.WithContext(context.Background(), t)
 
@@ -541,8 +938,637 @@ func TestHTTPFetcherFetchDirectory(t *testing.T) {
 	}
 	casBlobAccess := mock.NewMockBlobAccess(ctrl)
 	roundTripper := mock.NewMockRoundTripper(ctrl)
-	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{})
 	_, err := HTTPFetcher.FetchDirectory(ctx, request)
 	require.NotNil(t, err)
 	require.Equal(t, status.Code(err), codes.PermissionDenied)
 }
+
+func TestHTTPFetcherFetchDirectoryArchive(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	var archiveData bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archiveData)
+	tarWriter := tar.NewWriter(gzipWriter)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "foo-1.0/hello.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(TestData))}))
+	_, err := tarWriter.Write([]byte(TestData))
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		ArchiveExtractionLimits: &archive.Limits{
+			MaximumExtractedSizeBytes: 1 << 20,
+			MaximumEntries:            100,
+		},
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewReader(archiveData.Bytes())),
+			ContentLength: int64(archiveData.Len()),
+		}, nil)
+		fileDigest := digest.MustNewDigest("", remoteexecution.DigestFunction_SHA256, "185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969", 5)
+		fileCall := casBlobAccess.EXPECT().Put(ctx, fileDigest, gomock.Any()).Return(nil)
+		casBlobAccess.EXPECT().Put(ctx, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, directoryDigest digest.Digest, b buffer.Buffer) error {
+				directory, err := b.ToProto(&remoteexecution.Directory{}, 1<<20)
+				require.NoError(t, err)
+				testutil.RequireEqualProto(t, &remoteexecution.Directory{
+					Files: []*remoteexecution.FileNode{
+						{Name: "hello.txt", Digest: fileDigest.GetProto()},
+					},
+				}, directory)
+				return nil
+			}).After(fileCall)
+
+		response, err := HTTPFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/foo-1.0.tar.gz"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: fetch.QualifierArchiveStripPrefix, Value: "foo-1.0"},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/foo-1.0.tar.gz", response.Uri)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+		require.NotNil(t, response.RootDirectoryDigest)
+	})
+
+	t.Run("ScratchStorageQuota", func(t *testing.T) {
+		// The archive holds space in scratch storage while it is
+		// extracted. Files extracted from it should not wait for
+		// space to become available, as this would cause the
+		// request to hang until its deadline.
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewReader(archiveData.Bytes())),
+			ContentLength: int64(archiveData.Len()),
+		}, nil)
+		quotaFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+			ArchiveExtractionLimits: &archive.Limits{
+				MaximumExtractedSizeBytes: 1 << 20,
+				MaximumEntries:            100,
+			},
+			ScratchStorage: scratch.NewStorage(t.TempDir(), int64(archiveData.Len())+1, 0),
+		})
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		_, err := quotaFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/foo-1.0.tar.gz"},
+		})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.ErrorContains(t, err, "Scratch directory quota")
+	})
+
+	t.Run("UnknownArchiveType", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewReader(archiveData.Bytes())),
+			ContentLength: int64(archiveData.Len()),
+		}, nil)
+
+		_, err := HTTPFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/download"},
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("InvalidArchiveType", func(t *testing.T) {
+		_, err := HTTPFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/download"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: fetch.QualifierArchiveType, Value: "rar"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Unsupported archive type \"rar\""), err)
+	})
+}
+
+func TestHTTPFetcherFetchBlobSkipExisting(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName: InstanceName,
+		Uris:         []string{"www.example.com"},
+		Qualifiers: []*remoteasset.Qualifier{
+			{
+				Name:  "checksum.sri",
+				Value: digestToChecksumSri(remoteexecution.DigestFunction_SHA256, helloDigest),
+			},
+		},
+	}
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		SkipDownloadsOfExistingBlobs: true,
+	})
+
+	t.Run("PresentAccordingToHead", func(t *testing.T) {
+		headCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			require.Equal(t, http.MethodHead, req.Method)
+			return &http.Response{
+				Status:        "200 Success",
+				StatusCode:    200,
+				Body:          io.NopCloser(bytes.NewBuffer(nil)),
+				ContentLength: 5,
+			}, nil
+		})
+		casBlobAccess.EXPECT().FindMissing(ctx, helloDigest.ToSingletonSet()).Return(digest.EmptySet, nil).After(headCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+		require.Equal(t, "www.example.com", response.Uri)
+	})
+
+	t.Run("PresentAccordingToRange", func(t *testing.T) {
+		headCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "405 Method Not Allowed",
+			StatusCode:    405,
+			Body:          io.NopCloser(bytes.NewBuffer(nil)),
+			ContentLength: 0,
+		}, nil)
+		rangeCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			require.Equal(t, "bytes=0-0", req.Header.Get("Range"))
+			return &http.Response{
+				Status:        "206 Partial Content",
+				StatusCode:    206,
+				Header:        http.Header{"Content-Range": []string{"bytes 0-0/5"}},
+				Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData[:1]))),
+				ContentLength: 1,
+			}, nil
+		}).After(headCall)
+		casBlobAccess.EXPECT().FindMissing(ctx, helloDigest.ToSingletonSet()).Return(digest.EmptySet, nil).After(rangeCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		tempDir := t.TempDir()
+		t.Setenv("TMPDIR", tempDir)
+		headCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer(nil)),
+			ContentLength: 5,
+		}, nil)
+		findMissingCall := casBlobAccess.EXPECT().FindMissing(ctx, helloDigest.ToSingletonSet()).Return(helloDigest.ToSingletonSet(), nil).After(headCall)
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil).After(findMissingCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+		requireNoTemporaryFiles(t, tempDir)
+	})
+}
+
+func TestHTTPFetcherFetchBlobCredentials(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName: InstanceName,
+		Uris:         []string{"https://example.com/file"},
+		Qualifiers: []*remoteasset.Qualifier{
+			{Name: "http_header:Authorization", Value: "Bearer client"},
+			{Name: "http_header:X-Client", Value: "client"},
+		},
+	}
+	credentials := fetch.NewPatternCredentialStore(
+		[]fetch.URLPattern{"example.com"},
+		fetch.NewStaticCredentialSource(http.Header{"Authorization": []string{"Bearer server"}}))
+
+	for _, tc := range []struct {
+		name       string
+		precedence fetch.CredentialPrecedence
+		headers    map[string]string
+		absent     string
+	}{
+		{"Client", fetch.ClientCredentialPrecedence, map[string]string{"Authorization": "Bearer client", "X-Client": "client"}, ""},
+		{"Server", fetch.ServerCredentialPrecedence, map[string]string{"Authorization": "Bearer server", "X-Client": "client"}, ""},
+		{"ServerOnly", fetch.ServerOnlyCredentialPrecedence, map[string]string{"Authorization": "Bearer server"}, "X-Client"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			casBlobAccess := mock.NewMockBlobAccess(ctrl)
+			roundTripper := mock.NewMockRoundTripper(ctrl)
+			HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+				Credentials:          credentials,
+				CredentialPrecedence: tc.precedence,
+			})
+
+			httpDoCall := roundTripper.EXPECT().RoundTrip(&headerMatcher{headers: tc.headers}).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+				if tc.absent != "" {
+					require.Empty(t, req.Header.Get(tc.absent))
+				}
+				return &http.Response{
+					Status:        "200 Success",
+					StatusCode:    200,
+					Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+					ContentLength: 5,
+				}, nil
+			})
+			expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
+
+			_, err := HTTPFetcher.FetchBlob(ctx, request)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestHTTPFetcherFetchBlobScratchStorage(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	scratchDirectory := t.TempDir()
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		ScratchStorage: scratch.NewStorage(scratchDirectory, 4, 2),
+	})
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName: InstanceName,
+		Uris:         []string{"http://www.example.com/file"},
+	}
+
+	t.Run("InMemory", func(t *testing.T) {
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte("Hi"))),
+			ContentLength: 2,
+		}, nil)
+		casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ digest.Digest, blobBuffer buffer.Buffer) error {
+				requireNoTemporaryFiles(t, scratchDirectory)
+				data, err := blobBuffer.ToByteSlice(100)
+				require.NoError(t, err)
+				require.Equal(t, "Hi", string(data))
+				return nil
+			}).After(httpDoCall)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+	})
+
+	t.Run("QuotaExceeded", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		testutil.RequireEqualStatus(t, status.Error(codes.ResourceExhausted, "File has a size of 5 bytes, which exceeds the scratch directory quota of 4 bytes"), err)
+		requireNoTemporaryFiles(t, scratchDirectory)
+	})
+
+	t.Run("QuotaUsedUp", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: -1,
+		}, nil)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		testutil.RequireEqualStatus(t, status.Error(codes.ResourceExhausted, "Scratch directory quota of 4 bytes has been used up"), err)
+		requireNoTemporaryFiles(t, scratchDirectory)
+	})
+
+	t.Run("Streamed", func(t *testing.T) {
+		// Blobs whose digest is known up front don't consume
+		// any scratch storage.
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil)
+		expectBlobPut(t, casBlobAccess, helloDigest)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         request.Uris,
+			Qualifiers: []*remoteasset.Qualifier{
+				{
+					Name:  "checksum.sri",
+					Value: digestToChecksumSri(remoteexecution.DigestFunction_SHA256, helloDigest),
+				},
+			},
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestHTTPFetcherFetchBlobSizeLimits(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		DownloadSizeLimits: &fetch.DownloadSizeLimits{
+			DefaultMaximumSizeBytes: 4,
+			Overrides: []fetch.DownloadSizeLimit{
+				{
+					InstanceNamePrefix: instance,
+					ResourceType:       "application/x-tar",
+					MaximumSizeBytes:   5,
+				},
+			},
+		},
+	})
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName: InstanceName,
+		Uris:         []string{"http://www.example.com/file", "http://www.another.com/file"},
+	}
+
+	t.Run("ContentLengthExceeded", func(t *testing.T) {
+		// The download must be rejected without reading the
+		// response body. Other URIs are not attempted, as they are
+		// expected to provide the same content.
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(&interruptedReader{}),
+			ContentLength: 5,
+		}, nil)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		testutil.RequireEqualStatus(t, status.Error(codes.ResourceExhausted, "Blob has a size of 5 bytes, which exceeds the maximum size of 4 bytes"), err)
+	})
+
+	t.Run("StreamingExceeded", func(t *testing.T) {
+		tempDir := t.TempDir()
+		t.Setenv("TMPDIR", tempDir)
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: -1,
+		}, nil)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		testutil.RequireEqualStatus(t, status.Error(codes.ResourceExhausted, "Blob exceeds the maximum size of 4 bytes"), err)
+		requireNoTemporaryFiles(t, tempDir)
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: -1,
+		}, nil)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         request.Uris,
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "resource_type", Value: "application/x-tar"},
+			},
+		})
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+	})
+}
+
+func TestHTTPFetcherFetchBlobRetry(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	HTTPFetcher := fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{
+		RetryPolicy: &fetch.RetryPolicy{
+			MaximumAttempts:      3,
+			InitialBackoff:       time.Millisecond,
+			MaximumBackoff:       time.Millisecond,
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: fetch.DefaultRetryableStatusCodes,
+			RetryNetworkErrors:   true,
+		},
+	})
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName: InstanceName,
+		Uris:         []string{"http://www.example.com/file"},
+	}
+	unavailableResponse := func(retryAfter string) *http.Response {
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: 503,
+			Header:     http.Header{"Retry-After": []string{retryAfter}},
+			Body:       io.NopCloser(bytes.NewBuffer(nil)),
+		}
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		unavailableCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(unavailableResponse("0"), nil)
+		networkErrorCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(nil, errors.New("connection reset by peer")).After(unavailableCall)
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil).After(networkErrorCall)
+		expectBlobPut(t, casBlobAccess, helloDigest).After(httpDoCall)
+
+		response, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(response.BlobDigest, helloDigest.GetProto()))
+	})
+
+	t.Run("AttemptsExhausted", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(unavailableResponse(""), nil).Times(3)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download blob from any provided URI: HTTP request failed with status \"503 Service Unavailable\""), err)
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:     "404 Not Found",
+			StatusCode: 404,
+			Body:       io.NopCloser(bytes.NewBuffer(nil)),
+		}, nil)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, request)
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("RetryAfterExceedsDeadline", func(t *testing.T) {
+		// The server asks to retry after an hour, which is beyond
+		// the timeout of the request.
+		roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(unavailableResponse("3600"), nil)
+
+		_, err := HTTPFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			InstanceName: InstanceName,
+			Uris:         request.Uris,
+			Timeout:      durationpb.New(time.Minute),
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download blob from any provided URI: Not retrying, as waiting 1h0m0s would exceed the deadline: HTTP request failed with status \"503 Service Unavailable\""), err)
+	})
+}
+
+func TestHTTPFetcherFetchBlobRevalidation(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	instance := util.Must(digest.NewInstanceName(InstanceName))
+	digestFunction, err := instance.GetDigestFunction(remoteexecution.DigestFunction_SHA256, 0)
+	require.NoError(t, err)
+	digestGenerator := digestFunction.NewGenerator(int64(len(TestData)))
+	digestGenerator.Write([]byte(TestData))
+	helloDigest := digestGenerator.Sum()
+
+	uri := "http://www.example.com/file"
+	request := &remoteasset.FetchBlobRequest{
+		InstanceName:          InstanceName,
+		Uris:                  []string{uri},
+		OldestContentAccepted: timestamppb.Now(),
+	}
+	_, refDigest, err := storage.ProtoSerialise(storage.NewAssetReference([]string{uri}, nil), digestFunction)
+	require.NoError(t, err)
+
+	assetBackend := mock.NewMockBlobAccess(ctrl)
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	fetcher := fetch.NewCachingFetcher(
+		fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{}),
+		storage.NewBlobAccessAssetStore(assetBackend, 16*1024*1024))
+
+	// The asset store contains an asset that is older than the
+	// request permits, along with the validators of the resource.
+	expectStaleAsset := func() *gomock.Call {
+		return assetBackend.EXPECT().Get(ctx, refDigest).Return(buffer.NewProtoBufferFromProto(&asset.Asset{
+			Digest:      helloDigest.GetProto(),
+			LastUpdated: timestamppb.New(time.Unix(1000, 0)),
+			UpstreamValidators: &asset.UpstreamValidators{
+				Etag:         `"v1"`,
+				LastModified: "Wed, 21 Oct 2015 07:28:00 GMT",
+			},
+		}, buffer.UserProvided))
+	}
+	expectAssetPut := func(etag string) *gomock.Call {
+		return assetBackend.EXPECT().Put(ctx, refDigest, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, digest digest.Digest, b buffer.Buffer) error {
+				m, err := b.ToProto(&asset.Asset{}, 16*1024*1024)
+				require.NoError(t, err)
+				assetData := m.(*asset.Asset)
+				require.True(t, proto.Equal(helloDigest.GetProto(), assetData.Digest))
+				require.False(t, assetData.LastUpdated.AsTime().Before(request.OldestContentAccepted.AsTime()))
+				require.Equal(t, etag, assetData.UpstreamValidators.GetEtag())
+				return nil
+			})
+	}
+
+	t.Run("NotModified", func(t *testing.T) {
+		expectStaleAsset()
+		casBlobAccess.EXPECT().FindMissing(gomock.Any(), helloDigest.ToSingletonSet()).Return(digest.EmptySet, nil)
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			require.Equal(t, `"v1"`, req.Header.Get("If-None-Match"))
+			require.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", req.Header.Get("If-Modified-Since"))
+			return &http.Response{
+				Status:     "304 Not Modified",
+				StatusCode: 304,
+				Header:     http.Header{"Etag": []string{`"v1"`}},
+				Body:       io.NopCloser(bytes.NewBuffer(nil)),
+			}, nil
+		})
+		expectAssetPut(`"v1"`).After(httpDoCall)
+
+		response, err := fetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(helloDigest.GetProto(), response.BlobDigest))
+	})
+
+	t.Run("Modified", func(t *testing.T) {
+		expectStaleAsset()
+		casBlobAccess.EXPECT().FindMissing(gomock.Any(), helloDigest.ToSingletonSet()).Return(digest.EmptySet, nil)
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Header:        http.Header{"Etag": []string{`"v2"`}},
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: 5,
+		}, nil)
+		casPutCall := casBlobAccess.EXPECT().Put(gomock.Any(), helloDigest, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ digest.Digest, blobBuffer buffer.Buffer) error {
+				requireBlobBufferContentsFromChunkReader(t, blobBuffer)
+				return nil
+			}).After(httpDoCall)
+		expectAssetPut(`"v2"`).After(casPutCall)
+
+		response, err := fetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(helloDigest.GetProto(), response.BlobDigest))
+	})
+
+	t.Run("ContentMissing", func(t *testing.T) {
+		// The stale asset may not be reused if its contents are no
+		// longer present in the CAS.
+		expectStaleAsset()
+		casBlobAccess.EXPECT().FindMissing(gomock.Any(), helloDigest.ToSingletonSet()).Return(helloDigest.ToSingletonSet(), nil)
+		httpDoCall := roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			require.Empty(t, req.Header.Get("If-None-Match"))
+			return &http.Response{
+				Status:        "200 Success",
+				StatusCode:    200,
+				Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+				ContentLength: 5,
+			}, nil
+		})
+		casPutCall := casBlobAccess.EXPECT().Put(gomock.Any(), helloDigest, gomock.Any()).Return(nil).After(httpDoCall)
+		expectAssetPut("").After(casPutCall)
+
+		_, err := fetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+	})
+}
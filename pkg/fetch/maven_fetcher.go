@@ -0,0 +1,308 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Pattern that the components of Maven coordinates need to match.
+var mavenCoordinatePattern = regexp.MustCompile(`^[A-Za-z0-9_.+\-]+$`)
+
+// MavenRepository contains the settings of a Maven repository from
+// which artifacts may be downloaded.
+type MavenRepository struct {
+	// Base URL of the repository (e.g.,
+	// "https://repo.maven.apache.org/maven2").
+	URL string
+}
+
+// MavenFetcherOptions contains settings that alter the behaviour of the
+// Maven fetcher.
+type MavenFetcherOptions struct {
+	// Repositories from which artifacts are downloaded, in the order
+	// in which they are attempted.
+	Repositories []MavenRepository
+
+	// Credentials of the server for authenticating against
+	// repositories.
+	Credentials CredentialStore
+
+	// Storage for holding the contents of downloads, until they have
+	// been verified and written into the CAS. When nil, small files
+	// are held in memory, while larger files are written to the
+	// system's temporary directory.
+	ScratchStorage *scratch.Storage
+}
+
+type mavenFetcher struct {
+	httpClient                *http.Client
+	contentAddressableStorage blobstore.BlobAccess
+	repositories              []MavenRepository
+	credentials               CredentialStore
+	scratchStorage            *scratch.Storage
+}
+
+// NewMavenFetcher creates a Fetcher that downloads artifacts from Maven
+// repositories, using URIs of the form
+// maven://group:artifact:version[:classifier][@extension]. The
+// extension defaults to "jar". Repositories are attempted in order,
+// until one of them provides the artifact.
+//
+// Artifacts are verified against the checksum.sri qualifier. If no such
+// qualifier is provided, they are verified against the .sha256 or .sha1
+// file stored next to them in the repository instead. Repositories that
+// provide neither, or whose checksum file does not match the artifact,
+// are skipped. Only blobs are supported.
+func NewMavenFetcher(httpClient *http.Client, contentAddressableStorage blobstore.BlobAccess, options MavenFetcherOptions) (Fetcher, error) {
+	if len(options.Repositories) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No repositories provided")
+	}
+	repositories := make([]MavenRepository, 0, len(options.Repositories))
+	for i, repository := range options.Repositories {
+		repositoryURL, err := url.Parse(repository.URL)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URL for repository at index %d", i)
+		}
+		if repositoryURL.Scheme != "http" && repositoryURL.Scheme != "https" {
+			return nil, status.Errorf(codes.InvalidArgument, "URL of repository at index %d does not use scheme http or https", i)
+		}
+		repository.URL = strings.TrimSuffix(repository.URL, "/")
+		repositories = append(repositories, repository)
+	}
+	scratchStorage := options.ScratchStorage
+	if scratchStorage == nil {
+		scratchStorage = scratch.NewDefaultStorage()
+	}
+	return &mavenFetcher{
+		httpClient:                httpClient,
+		contentAddressableStorage: contentAddressableStorage,
+		repositories:              repositories,
+		credentials:               options.Credentials,
+		scratchStorage:            scratchStorage,
+	}, nil
+}
+
+// getMavenArtifactPath converts a maven:// URI to the path of the
+// artifact within a repository, using the standard repository layout.
+func getMavenArtifactPath(uri string) (string, error) {
+	coordinates, ok := strings.CutPrefix(uri, "maven://")
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "URI %#v does not use scheme maven", uri)
+	}
+	extension := "jar"
+	if i := strings.LastIndexByte(coordinates, '@'); i >= 0 {
+		coordinates, extension = coordinates[:i], coordinates[i+1:]
+	}
+	fields := strings.Split(coordinates, ":")
+	if len(fields) != 3 && len(fields) != 4 {
+		return "", status.Errorf(codes.InvalidArgument, "Invalid URI %#v, as it is not of the form \"maven://group:artifact:version[:classifier][@extension]\"", uri)
+	}
+	for _, component := range append(fields, extension) {
+		if !mavenCoordinatePattern.MatchString(component) || component == "." || component == ".." {
+			return "", status.Errorf(codes.InvalidArgument, "Invalid URI %#v, as it contains invalid component %#v", uri, component)
+		}
+	}
+	groupPath := strings.Split(fields[0], ".")
+	for _, component := range groupPath {
+		if component == "" {
+			return "", status.Errorf(codes.InvalidArgument, "Invalid URI %#v, as it contains invalid group %#v", uri, fields[0])
+		}
+	}
+
+	artifact, version := fields[1], fields[2]
+	filename := artifact + "-" + version
+	if len(fields) == 4 {
+		filename += "-" + fields[3]
+	}
+	return strings.Join(groupPath, "/") + "/" + artifact + "/" + version + "/" + filename + "." + extension, nil
+}
+
+func (mf *mavenFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	checksum, err := getChecksumSri(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		blobDigest, checksumMismatch, err := mf.fetchBlob(ctx, uri, digestFunction, checksum)
+		if err != nil {
+			log.Printf("Error downloading blob with URI %s: %v", uri, err)
+			if checksumMismatch || ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		return &remoteasset.FetchBlobResponse{
+			Status:     status.New(codes.OK, "Blob fetched successfully!").Proto(),
+			Uri:        uri,
+			Qualifiers: req.Qualifiers,
+			BlobDigest: blobDigest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to download blob from any provided URI")
+}
+
+// fetchBlob downloads the artifact referenced by a URI from the first
+// repository that provides it, and writes it into the CAS. It is
+// reported whether the contents did not match the checksum.sri
+// qualifier, as there is no point in attempting other URIs in that
+// case.
+func (mf *mavenFetcher) fetchBlob(ctx context.Context, uri string, digestFunction bb_digest.Function, checksum *checksumSRI) (bb_digest.Digest, bool, error) {
+	artifactPath, err := getMavenArtifactPath(uri)
+	if err != nil {
+		return bb_digest.BadDigest, false, err
+	}
+	var lastErr error
+	for _, repository := range mf.repositories {
+		blobDigest, checksumMismatch, err := mf.fetchBlobFromRepository(ctx, &repository, artifactPath, digestFunction, checksum)
+		if err == nil {
+			return blobDigest, false, nil
+		}
+		err = util.StatusWrapf(err, "Repository %s", repository.URL)
+		if checksumMismatch || ctx.Err() != nil {
+			return bb_digest.BadDigest, checksumMismatch, err
+		}
+		lastErr = err
+	}
+	return bb_digest.BadDigest, false, lastErr
+}
+
+// Checksum files stored next to artifacts that are consulted if no
+// checksum.sri qualifier is provided, in order of preference.
+var mavenChecksumFiles = []ChecksumFile{
+	{Suffix: ".sha256"},
+	{Suffix: ".sha1"},
+}
+
+func (mf *mavenFetcher) fetchBlobFromRepository(ctx context.Context, repository *MavenRepository, artifactPath string, digestFunction bb_digest.Function, checksum *checksumSRI) (bb_digest.Digest, bool, error) {
+	artifactURL := repository.URL + "/" + artifactPath
+	expectedChecksum := checksum
+	if expectedChecksum == nil {
+		// Obtain the checksum file prior to downloading the
+		// artifact, so that no time is spent downloading
+		// artifacts that cannot be verified.
+		var err error
+		if expectedChecksum, err = mf.getChecksumFromFiles(ctx, artifactURL); err != nil {
+			return bb_digest.BadDigest, false, err
+		}
+	}
+
+	resp, err := mf.get(ctx, artifactURL)
+	if err != nil {
+		return bb_digest.BadDigest, false, err
+	}
+	defer resp.Body.Close()
+	content, err := mf.scratchStorage.NewFile(ctx, resp.ContentLength)
+	if err != nil {
+		return bb_digest.BadDigest, false, err
+	}
+	hasher := digestFunction.NewGenerator(resp.ContentLength)
+	verifier := expectedChecksum.newVerifier(resp.ContentLength)
+	if _, err := io.Copy(io.MultiWriter(content, hasher, verifier), resp.Body); err != nil {
+		closeDownloadedContent(content)
+		if status.Code(err) == codes.ResourceExhausted {
+			return bb_digest.BadDigest, false, err
+		}
+		return bb_digest.BadDigest, false, wrapDownloadError(ctx, err, "Failed to read response body")
+	}
+	if err := verifier.verify(); err != nil {
+		// Only mismatches against the checksum.sri qualifier
+		// are fatal. Other repositories may provide an artifact
+		// that matches its checksum file.
+		closeDownloadedContent(content)
+		return bb_digest.BadDigest, checksum != nil, err
+	}
+
+	blobDigest := hasher.Sum()
+	if err := mf.contentAddressableStorage.Put(ctx, blobDigest, buffer.NewValidatedBufferFromReaderAt(content, blobDigest.GetSizeBytes())); err != nil {
+		return bb_digest.BadDigest, false, util.StatusWrapWithCode(err, codes.Internal, "Failed to place blob into CAS")
+	}
+	return blobDigest, false, nil
+}
+
+// getChecksumFromFiles obtains the hash contained in the strongest
+// checksum file that is stored next to an artifact.
+func (mf *mavenFetcher) getChecksumFromFiles(ctx context.Context, artifactURL string) (*checksumSRI, error) {
+	parsedURL, err := url.Parse(artifactURL)
+	if err != nil {
+		return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URL %#v", artifactURL)
+	}
+	for _, checksumFile := range mavenChecksumFiles {
+		checksumFileURI := checksumFile.getURL(parsedURL).String()
+		resp, err := mf.get(ctx, checksumFileURI)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			return nil, util.StatusWrapf(err, "Failed to obtain %s file", checksumFile.Suffix)
+		}
+		checksum, err := checksumFile.parse(ctx, resp.Body, parsedURL, checksumFileURI)
+		resp.Body.Close()
+		return checksum, err
+	}
+	return nil, status.Error(codes.NotFound, "Repository does not provide a checksum file for the artifact, and no checksum.sri qualifier is provided")
+}
+
+// get performs an HTTP GET request against a repository, attaching the
+// credentials of the server.
+func (mf *mavenFetcher) get(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to create HTTP request")
+	}
+	if mf.credentials != nil {
+		headers, err := mf.credentials.GetCredentials(ctx, req.URL)
+		if err != nil {
+			return nil, util.StatusWrap(err, "Failed to obtain credentials")
+		}
+		for header, values := range headers {
+			req.Header[header] = values
+		}
+	}
+	resp, err := mf.httpClient.Do(req)
+	if err != nil {
+		return nil, wrapDownloadError(ctx, err, "HTTP request failed")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, newHTTPStatusError(uri, resp)
+	}
+	return resp, nil
+}
+
+func (mf *mavenFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	return nil, status.Error(codes.PermissionDenied, "Fetching of directories from Maven repositories is not supported")
+}
+
+func (mf *mavenFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return qualifier.Difference(qualifiers, qualifier.NewSet([]string{"checksum.sri", "bazel.canonical_id"}))
+}
@@ -0,0 +1,154 @@
+package fetch_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMavenFetcherFetchBlob(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	// The public repository only contains some artifacts, while the
+	// private repository requires credentials.
+	artifact := "Contents of artifact"
+	sha1Hash := sha1.Sum([]byte(artifact))
+	sha256Hash := sha256.Sum256([]byte(artifact))
+	files := map[string]string{
+		"/public/com/example/only-sha1/1.0/only-sha1-1.0.jar":             artifact,
+		"/public/com/example/only-sha1/1.0/only-sha1-1.0.jar.sha1":        hex.EncodeToString(sha1Hash[:]),
+		"/public/com/example/corrupted/1.0/corrupted-1.0.jar":             "Corrupted artifact",
+		"/public/com/example/corrupted/1.0/corrupted-1.0.jar.sha1":        hex.EncodeToString(sha1Hash[:]),
+		"/public/com/example/unverified/1.0/unverified-1.0.jar":           artifact,
+		"/private/com/example/library/1.0/library-1.0-sources.zip":        artifact,
+		"/private/com/example/library/1.0/library-1.0-sources.zip.sha256": hex.EncodeToString(sha256Hash[:]) + "  library-1.0-sources.zip\n",
+		"/private/com/example/library/1.0/library-1.0-sources.zip.sha1":   "0000000000000000000000000000000000000000",
+		"/private/com/example/corrupted/1.0/corrupted-1.0.jar":            artifact,
+		"/private/com/example/corrupted/1.0/corrupted-1.0.jar.sha256":     hex.EncodeToString(sha256Hash[:]),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); strings.HasPrefix(r.URL.Path, "/private/") && (!ok || username != "user" || password != "secret") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		contents, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(contents))
+	}))
+	defer server.Close()
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	mavenFetcher, err := fetch.NewMavenFetcher(http.DefaultClient, casBlobAccess, fetch.MavenFetcherOptions{
+		Repositories: []fetch.MavenRepository{
+			{URL: server.URL + "/public/"},
+			{URL: server.URL + "/private"},
+		},
+		Credentials: fetch.NewPatternCredentialStore(
+			[]fetch.URLPattern{fetch.URLPattern(server.URL + "/private/")},
+			fetch.NewBasicAuthCredentialSource("user", "secret")),
+	})
+	require.NoError(t, err)
+	expectArtifact := func() {
+		casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, blobDigest bb_digest.Digest, b buffer.Buffer) error {
+				data, err := b.ToByteSlice(1 << 20)
+				require.NoError(t, err)
+				require.Equal(t, artifact, string(data))
+				return nil
+			})
+	}
+
+	t.Run("SHA256", func(t *testing.T) {
+		// The .sha256 file takes precedence over the .sha1 file,
+		// which contains an incorrect hash.
+		expectArtifact()
+		response, err := mavenFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"maven://com.example:library:1.0:sources@zip"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+		require.Equal(t, "maven://com.example:library:1.0:sources@zip", response.Uri)
+		require.Equal(t, hex.EncodeToString(sha256Hash[:]), response.BlobDigest.Hash)
+	})
+
+	t.Run("SHA1", func(t *testing.T) {
+		expectArtifact()
+		response, err := mavenFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"maven://com.example:only-sha1:1.0"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, hex.EncodeToString(sha256Hash[:]), response.BlobDigest.Hash)
+	})
+
+	t.Run("ChecksumFileMismatch", func(t *testing.T) {
+		// Repositories containing an artifact that does not match
+		// its checksum file are skipped.
+		expectArtifact()
+		response, err := mavenFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"maven://com.example:corrupted:1.0"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, hex.EncodeToString(sha256Hash[:]), response.BlobDigest.Hash)
+	})
+
+	t.Run("NoChecksumFile", func(t *testing.T) {
+		_, err := mavenFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"maven://com.example:unverified:1.0"},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: Repository %s/private: Repository does not provide a checksum file for the artifact, and no checksum.sri qualifier is provided", server.URL), err)
+	})
+
+	t.Run("ChecksumSRI", func(t *testing.T) {
+		// Checksum files are not needed when checksum.sri is
+		// provided.
+		expectArtifact()
+		response, err := mavenFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"maven://com.example:unverified:1.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "checksum.sri", Value: "sha256-" + base64.StdEncoding.EncodeToString(sha256Hash[:])},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, hex.EncodeToString(sha256Hash[:]), response.BlobDigest.Hash)
+	})
+
+	t.Run("ChecksumSRIMismatch", func(t *testing.T) {
+		// Mismatches against checksum.sri are fatal.
+		_, err := mavenFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"maven://com.example:corrupted:1.0", "maven://com.example:unverified:1.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "checksum.sri", Value: "sha256-" + base64.StdEncoding.EncodeToString(sha256Hash[:])},
+			},
+		})
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.ErrorContains(t, err, "Fetched content did not match sha256 hash of checksum.sri qualifier")
+	})
+
+	t.Run("InvalidURI", func(t *testing.T) {
+		_, err := mavenFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"maven://com.example:library:../../../etc/passwd"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download blob from any provided URI: Invalid URI \"maven://com.example:library:../../../etc/passwd\", as it contains invalid component \"../../../etc/passwd\""), err)
+	})
+}
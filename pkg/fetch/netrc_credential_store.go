@@ -0,0 +1,111 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// netrcEntry is a single machine or default entry of a netrc file.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// parseNetrc parses the contents of a netrc file. Macro definitions
+// are skipped, as they are not relevant for obtaining credentials.
+func parseNetrc(contents string) ([]netrcEntry, error) {
+	var entries []netrcEntry
+	var current *netrcEntry
+	lines := strings.Split(contents, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			field := fields[j]
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+			switch field {
+			case "machine", "login", "password", "account", "macdef":
+				if j+1 >= len(fields) {
+					return nil, status.Errorf(codes.InvalidArgument, "Line %d: Keyword %#v is not followed by a value", i+1, field)
+				}
+				value := fields[j+1]
+				j++
+				switch field {
+				case "machine":
+					entries = append(entries, netrcEntry{machine: strings.ToLower(value)})
+					current = &entries[len(entries)-1]
+				case "login", "password":
+					if current == nil {
+						return nil, status.Errorf(codes.InvalidArgument, "Line %d: Keyword %#v is not part of a machine entry", i+1, field)
+					}
+					if field == "login" {
+						current.login = value
+					} else {
+						current.password = value
+					}
+				case "macdef":
+					// Macro definitions are terminated
+					// by an empty line.
+					for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+						i++
+					}
+					j = len(fields)
+				}
+			case "default":
+				entries = append(entries, netrcEntry{})
+				current = &entries[len(entries)-1]
+			default:
+				return nil, status.Errorf(codes.InvalidArgument, "Line %d: Unknown keyword %#v", i+1, field)
+			}
+		}
+	}
+	return entries, nil
+}
+
+type netrcCredentialStore struct {
+	file reloadingFile
+}
+
+// NewNetrcCredentialStore creates a CredentialStore that yields HTTP
+// basic authentication credentials stored in a netrc file. The file is
+// read again when it changes.
+//
+// Unlike curl, default entries are ignored. Clients may request
+// arbitrary URIs, meaning these would send credentials to hosts chosen
+// by clients.
+func NewNetrcCredentialStore(path string) CredentialStore {
+	return &netrcCredentialStore{
+		file: reloadingFile{path: path},
+	}
+}
+
+func (cs *netrcCredentialStore) GetCredentials(ctx context.Context, uri *url.URL) (http.Header, error) {
+	contents, err := cs.file.get()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseNetrc(string(contents))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to parse netrc file %#v: %s", cs.file.path, status.Convert(err).Message())
+	}
+
+	host := strings.ToLower(uri.Hostname())
+	var match *netrcEntry
+	for i, entry := range entries {
+		if entry.machine == host {
+			match = &entries[i]
+			break
+		}
+	}
+	if match == nil || match.password == "" {
+		return nil, nil
+	}
+	return NewBasicAuthCredentialSource(match.login, match.password).GetHeaders()
+}
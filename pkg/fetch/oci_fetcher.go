@@ -0,0 +1,524 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	"github.com/buildbarn/bb-storage/pkg/clock"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// QualifierOCIPlatform is a qualifier to select a manifest from
+	// an image index (manifest list), of the form
+	// "os/architecture[/variant]" (e.g., "linux/arm64/v8").
+	QualifierOCIPlatform = "oci.platform"
+	// QualifierOCIDigest is a qualifier to pin the content referenced
+	// by a URI containing a tag to a digest. It is added to responses,
+	// containing the digest of the manifest or blob to which the URI
+	// was resolved.
+	QualifierOCIDigest = "oci.digest"
+)
+
+// OCIFetcherOptions contains optional settings that alter the behaviour
+// of the OCI fetcher. The zero value corresponds to the default
+// behaviour.
+type OCIFetcherOptions struct {
+	// Credentials of the server for authenticating against
+	// registries requiring basic authentication, and against the
+	// token services of registries using bearer tokens. When no
+	// credentials are known, anonymous tokens are requested.
+	Credentials CredentialStore
+
+	// Host names and optional ports of registries that are accessed
+	// over plain HTTP instead of HTTPS.
+	PlainHTTPRegistries []string
+
+	// Storage for holding the contents of downloads and files
+	// extracted from layers, until they have been written into the
+	// CAS. When nil, small files are held in memory, while larger
+	// files are written to the system's temporary directory.
+	ScratchStorage *scratch.Storage
+
+	// When set, FetchDirectory is supported by applying the layers
+	// of an image, subject to the limits provided. The limits apply
+	// to all layers of the image combined.
+	ImageExtractionLimits *archive.Limits
+}
+
+type ociFetcher struct {
+	client                    *ociRegistryClient
+	contentAddressableStorage blobstore.BlobAccess
+	scratchStorage            *scratch.Storage
+	imageExtractionLimits     *archive.Limits
+}
+
+// NewOCIFetcher creates a Fetcher that downloads manifests and blobs
+// from container registries implementing the OCI distribution
+// specification, using URIs of the form
+// oci://registry/repository:tag or oci://registry/repository@digest.
+// docker:// URIs are accepted as well.
+//
+// Tags are resolved to manifests at the time of the request, unless
+// the request contains the oci.digest qualifier. The digest to which a
+// URI was resolved is returned through the oci.digest qualifier. This
+// qualifier is not part of the key under which CachingFetcher stores
+// the asset, meaning that a tag remains resolved to the same manifest
+// for as long as the asset is cached, and that responses served from
+// the asset store lack it. Clients that need tags to be followed
+// should therefore pin them, either by providing oci.digest or by
+// using URIs containing a digest.
+// If the request contains the oci.platform qualifier and the manifest
+// is an image index, the manifest for that platform is returned
+// instead.
+// URIs containing a digest may also refer to blobs, such as layers,
+// which are downloaded if no manifest with that digest exists. All
+// content requested by digest is verified.
+//
+// If enabled, FetchDirectory yields the root file system of an image,
+// obtained by applying its layers in order. As Directory messages can
+// only represent regular files, directories and symbolic links, other
+// types of files and permissions other than the executable bit are
+// discarded.
+func NewOCIFetcher(httpClient *http.Client, contentAddressableStorage blobstore.BlobAccess, clock clock.Clock, options OCIFetcherOptions) Fetcher {
+	scratchStorage := options.ScratchStorage
+	if scratchStorage == nil {
+		scratchStorage = scratch.NewDefaultStorage()
+	}
+	return &ociFetcher{
+		client:                    newOCIRegistryClient(httpClient, options.Credentials, options.PlainHTTPRegistries, clock),
+		contentAddressableStorage: contentAddressableStorage,
+		scratchStorage:            scratchStorage,
+		imageExtractionLimits:     options.ImageExtractionLimits,
+	}
+}
+
+// getOCIPlatform parses the oci.platform qualifier. If no such
+// qualifier is provided, nil is returned.
+func getOCIPlatform(qualifiers []*remoteasset.Qualifier) (*ociPlatform, error) {
+	var platform *ociPlatform
+	for _, q := range qualifiers {
+		if q.Name != QualifierOCIPlatform {
+			continue
+		}
+		if platform != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Multiple %s provided", QualifierOCIPlatform)
+		}
+		fields := strings.Split(q.Value, "/")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" || fields[1] == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid %s qualifier %#v, as it is not of the form \"os/architecture[/variant]\"", QualifierOCIPlatform, q.Value)
+		}
+		platform = &ociPlatform{OS: fields[0], Architecture: fields[1]}
+		if len(fields) == 3 {
+			platform.Variant = fields[2]
+		}
+	}
+	return platform, nil
+}
+
+// getOCIDigest parses the oci.digest qualifier. If no such qualifier
+// is provided, the empty string is returned.
+func getOCIDigest(qualifiers []*remoteasset.Qualifier) (string, error) {
+	digest := ""
+	for _, q := range qualifiers {
+		if q.Name != QualifierOCIDigest {
+			continue
+		}
+		if digest != "" {
+			return "", status.Errorf(codes.InvalidArgument, "Multiple %s provided", QualifierOCIDigest)
+		}
+		if !ociDigestPattern.MatchString(q.Value) {
+			return "", status.Errorf(codes.InvalidArgument, "Invalid %s qualifier %#v, as it is not of the form \"<algorithm>:<hex>\"", QualifierOCIDigest, q.Value)
+		}
+		digest = q.Value
+	}
+	return digest, nil
+}
+
+// parsePinnedOCIReference parses a URI, replacing its tag with the
+// digest provided through the oci.digest qualifier, if any.
+func parsePinnedOCIReference(uri, pinnedDigest string) (ociReference, error) {
+	ref, err := parseOCIReference(uri)
+	if err != nil || pinnedDigest == "" {
+		return ref, err
+	}
+	if ref.isDigest() && ref.reference != pinnedDigest {
+		return ociReference{}, status.Errorf(codes.InvalidArgument, "URI %#v contains digest %s, while %s qualifier %s was provided", uri, ref.reference, QualifierOCIDigest, pinnedDigest)
+	}
+	ref.reference = pinnedDigest
+	return ref, nil
+}
+
+// getManifestDigest returns the digest of a manifest obtained through
+// a reference. Registries compute the digests of manifests using
+// SHA-256, which is used if the manifest was obtained through a tag.
+func getManifestDigest(ref *ociReference, manifest []byte) string {
+	if ref.isDigest() {
+		return ref.reference
+	}
+	hash := sha256.Sum256(manifest)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// withOCIDigestQualifier returns the qualifiers of a request, extended
+// with the oci.digest qualifier if it was not provided.
+func withOCIDigestQualifier(qualifiers []*remoteasset.Qualifier, digest string) []*remoteasset.Qualifier {
+	for _, q := range qualifiers {
+		if q.Name == QualifierOCIDigest {
+			return qualifiers
+		}
+	}
+	return append(slices.Clone(qualifiers), &remoteasset.Qualifier{
+		Name:  QualifierOCIDigest,
+		Value: digest,
+	})
+}
+
+// matches returns whether a platform requested by the client matches
+// the platform of a manifest. If no variant is requested, any variant
+// is accepted.
+func (p *ociPlatform) matches(other *ociPlatform) bool {
+	return other != nil && p.OS == other.OS && p.Architecture == other.Architecture && (p.Variant == "" || p.Variant == other.Variant)
+}
+
+func (of *ociFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	checksum, err := getChecksumSri(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := getOCIPlatform(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	pinnedDigest, err := getOCIDigest(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		blobDigest, ociDigest, checksumMismatch, err := of.fetchBlob(ctx, uri, pinnedDigest, digestFunction, checksum, platform)
+		if err != nil {
+			log.Printf("Error downloading blob with URI %s: %v", uri, err)
+			if checksumMismatch || ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		return &remoteasset.FetchBlobResponse{
+			Status:     status.New(codes.OK, "Blob fetched successfully!").Proto(),
+			Uri:        uri,
+			Qualifiers: withOCIDigestQualifier(req.Qualifiers, ociDigest),
+			BlobDigest: blobDigest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to download blob from any provided URI")
+}
+
+// fetchBlob downloads the manifest or blob referenced by a URI and
+// writes it into the CAS. The digest of the manifest or blob in the
+// registry is returned as well. It is reported whether the contents
+// did not match the checksum.sri qualifier, as there is no point in
+// attempting other URIs in that case.
+func (of *ociFetcher) fetchBlob(ctx context.Context, uri, pinnedDigest string, digestFunction bb_digest.Function, checksum *checksumSRI, platform *ociPlatform) (bb_digest.Digest, string, bool, error) {
+	ref, err := parsePinnedOCIReference(uri, pinnedDigest)
+	if err != nil {
+		return bb_digest.BadDigest, "", false, err
+	}
+
+	hasher := digestFunction.NewGenerator(-1)
+	verifier := checksum.newVerifier(-1)
+	writers := []io.Writer{hasher, verifier}
+
+	var content *scratch.File
+	ociDigest := ref.reference
+	manifest, mediaType, err := of.client.getManifest(ctx, &ref)
+	if err == nil {
+		ociDigest = getManifestDigest(&ref, manifest)
+		if manifest, _, err = of.selectPlatformManifest(ctx, &ref, manifest, mediaType, platform); err == nil {
+			content, err = of.storeContent(ctx, bytes.NewReader(manifest), int64(len(manifest)), writers)
+		}
+	} else if status.Code(err) == codes.NotFound && ref.isDigest() {
+		// The digest may refer to a blob instead.
+		content, err = of.downloadBlob(ctx, &ref, writers)
+	}
+	if err != nil {
+		return bb_digest.BadDigest, "", false, err
+	}
+
+	if err := verifier.verify(); err != nil {
+		closeDownloadedContent(content)
+		return bb_digest.BadDigest, "", true, err
+	}
+	blobDigest := hasher.Sum()
+	if err := of.contentAddressableStorage.Put(ctx, blobDigest, buffer.NewValidatedBufferFromReaderAt(content, blobDigest.GetSizeBytes())); err != nil {
+		return bb_digest.BadDigest, "", false, util.StatusWrapWithCode(err, codes.Internal, "Failed to place blob into CAS")
+	}
+	return blobDigest, ociDigest, false, nil
+}
+
+// selectPlatformManifest returns the manifest for a platform if a
+// manifest is an image index. If no platform is provided or the
+// manifest is not an image index, it is returned as is. The media type
+// of the resulting manifest is returned as well.
+func (of *ociFetcher) selectPlatformManifest(ctx context.Context, ref *ociReference, manifest []byte, mediaType string, platform *ociPlatform) ([]byte, string, error) {
+	if platform == nil {
+		return manifest, mediaType, nil
+	}
+	var index ociManifest
+	if err := json.Unmarshal(manifest, &index); err != nil {
+		return nil, "", util.StatusWrapWithCode(err, codes.Internal, "Failed to parse manifest")
+	}
+	if !index.isIndex(mediaType) {
+		return manifest, mediaType, nil
+	}
+	for _, descriptor := range index.Manifests {
+		if platform.matches(descriptor.Platform) {
+			if !ociDigestPattern.MatchString(descriptor.Digest) {
+				return nil, "", status.Errorf(codes.Internal, "Image index contains invalid digest %#v", descriptor.Digest)
+			}
+			platformRef := *ref
+			platformRef.reference = descriptor.Digest
+			platformManifest, platformMediaType, err := of.client.getManifest(ctx, &platformRef)
+			if err != nil {
+				return nil, "", util.StatusWrapf(err, "Failed to obtain manifest %s", descriptor.Digest)
+			}
+			return platformManifest, platformMediaType, nil
+		}
+	}
+	return nil, "", status.Errorf(codes.NotFound, "Image index does not contain a manifest for platform %s/%s", platform.OS, platform.Architecture)
+}
+
+// downloadBlob downloads a blob, verifying its contents against the
+// digest under which it was requested.
+func (of *ociFetcher) downloadBlob(ctx context.Context, ref *ociReference, writers []io.Writer) (*scratch.File, error) {
+	ociHasher, err := newOCIDigestHasher(ref.reference)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := of.client.getBlob(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := of.storeContent(ctx, resp.Body, resp.ContentLength, append([]io.Writer{ociHasher}, writers...))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOCIDigest(ociHasher, ref.reference); err != nil {
+		closeDownloadedContent(content)
+		return nil, util.StatusWrap(err, "Invalid blob")
+	}
+	return content, nil
+}
+
+// storeContent copies content into scratch storage, while feeding it
+// into the provided writers.
+func (of *ociFetcher) storeContent(ctx context.Context, r io.Reader, sizeBytes int64, writers []io.Writer) (*scratch.File, error) {
+	content, err := of.scratchStorage.NewFile(ctx, sizeBytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.MultiWriter(append([]io.Writer{content}, writers...)...), r); err != nil {
+		closeDownloadedContent(content)
+		if status.Code(err) == codes.ResourceExhausted {
+			return nil, err
+		}
+		return nil, wrapDownloadError(ctx, err, "Failed to read response body")
+	}
+	return content, nil
+}
+
+func (of *ociFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	if of.imageExtractionLimits == nil {
+		return nil, status.Error(codes.PermissionDenied, "Fetching of directories from OCI registries is not supported")
+	}
+
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	checksum, err := getChecksumSri(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := getOCIPlatform(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	pinnedDigest, err := getOCIDigest(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		rootDirectoryDigest, ociDigest, checksumMismatch, err := of.fetchDirectory(ctx, uri, pinnedDigest, digestFunction, checksum, platform)
+		if err != nil {
+			log.Printf("Error downloading directory with URI %s: %v", uri, err)
+			if checksumMismatch || ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		return &remoteasset.FetchDirectoryResponse{
+			Status:              status.New(codes.OK, "Directory fetched successfully!").Proto(),
+			Uri:                 uri,
+			Qualifiers:          withOCIDigestQualifier(req.Qualifiers, ociDigest),
+			RootDirectoryDigest: rootDirectoryDigest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to download directory from any provided URI")
+}
+
+// fetchDirectory writes the root file system of the image referenced
+// by a URI into the CAS, returning the digest of its manifest in the
+// registry as well. The checksum.sri qualifier is checked against
+// the image manifest, as its digest uniquely identifies the image. It
+// is reported whether the manifest did not match the checksum.sri
+// qualifier, as there is no point in attempting other URIs in that
+// case.
+func (of *ociFetcher) fetchDirectory(ctx context.Context, uri, pinnedDigest string, digestFunction bb_digest.Function, checksum *checksumSRI, platform *ociPlatform) (bb_digest.Digest, string, bool, error) {
+	ref, err := parsePinnedOCIReference(uri, pinnedDigest)
+	if err != nil {
+		return bb_digest.BadDigest, "", false, err
+	}
+	manifest, mediaType, err := of.client.getManifest(ctx, &ref)
+	if err != nil {
+		return bb_digest.BadDigest, "", false, err
+	}
+	ociDigest := getManifestDigest(&ref, manifest)
+	manifest, mediaType, err = of.selectPlatformManifest(ctx, &ref, manifest, mediaType, platform)
+	if err != nil {
+		return bb_digest.BadDigest, "", false, err
+	}
+	verifier := checksum.newVerifier(int64(len(manifest)))
+	verifier.Write(manifest)
+	if err := verifier.verify(); err != nil {
+		return bb_digest.BadDigest, "", true, err
+	}
+
+	var image ociManifest
+	if err := json.Unmarshal(manifest, &image); err != nil {
+		return bb_digest.BadDigest, "", false, util.StatusWrapWithCode(err, codes.Internal, "Failed to parse manifest")
+	}
+	if image.isIndex(mediaType) {
+		return bb_digest.BadDigest, "", false, status.Errorf(codes.InvalidArgument, "Manifest is an image index, meaning the %s qualifier needs to be provided to select an image", QualifierOCIPlatform)
+	}
+
+	builder := directory.NewBuilder(of.contentAddressableStorage, digestFunction, of.scratchStorage)
+	layerExtractor := archive.NewLayerExtractor(builder, *of.imageExtractionLimits)
+	for _, layer := range image.Layers {
+		if err := of.extractLayer(ctx, &ref, layer, layerExtractor); err != nil {
+			return bb_digest.BadDigest, "", false, util.StatusWrapf(err, "Failed to extract layer %s", layer.Digest)
+		}
+	}
+	rootDirectoryDigest, err := builder.Finalize(ctx)
+	if err != nil {
+		return bb_digest.BadDigest, "", false, util.StatusWrapWithCode(err, codes.Internal, "Failed to place directory into CAS")
+	}
+	return rootDirectoryDigest, ociDigest, false, nil
+}
+
+// getLayerFormat returns the archive format of a layer, based on its
+// media type.
+func getLayerFormat(mediaType string) (archive.Format, error) {
+	switch mediaType {
+	case "application/vnd.oci.image.layer.v1.tar",
+		"application/vnd.oci.image.layer.nondistributable.v1.tar",
+		"application/vnd.docker.image.rootfs.diff.tar":
+		return archive.Tar, nil
+	case "application/vnd.oci.image.layer.v1.tar+gzip",
+		"application/vnd.oci.image.layer.nondistributable.v1.tar+gzip",
+		"application/vnd.docker.image.rootfs.diff.tar.gzip",
+		"application/vnd.docker.image.rootfs.foreign.diff.tar.gzip":
+		return archive.TarGzip, nil
+	case "application/vnd.oci.image.layer.v1.tar+zstd",
+		"application/vnd.oci.image.layer.nondistributable.v1.tar+zstd":
+		return archive.TarZstd, nil
+	default:
+		return 0, status.Errorf(codes.InvalidArgument, "Layer has unsupported media type %#v", mediaType)
+	}
+}
+
+// extractLayer applies a single layer of an image. The layer is
+// extracted while it is being downloaded, and its digest is verified
+// afterwards. A mismatch causes the entire image to be rejected.
+func (of *ociFetcher) extractLayer(ctx context.Context, ref *ociReference, layer ociDescriptor, layerExtractor *archive.LayerExtractor) error {
+	format, err := getLayerFormat(layer.MediaType)
+	if err != nil {
+		return err
+	}
+	if !ociDigestPattern.MatchString(layer.Digest) {
+		return status.Errorf(codes.Internal, "Manifest contains invalid digest %#v", layer.Digest)
+	}
+	ociHasher, err := newOCIDigestHasher(layer.Digest)
+	if err != nil {
+		return err
+	}
+	layerRef := *ref
+	layerRef.reference = layer.Digest
+	resp, err := of.client.getBlob(ctx, &layerRef)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := io.TeeReader(resp.Body, ociHasher)
+	if err := layerExtractor.Extract(ctx, body, format); err != nil {
+		return err
+	}
+	// Decompressors may not consume trailing data, which needs to
+	// be hashed nonetheless.
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return wrapDownloadError(ctx, err, "Failed to read response body")
+	}
+	if err := checkOCIDigest(ociHasher, layer.Digest); err != nil {
+		return util.StatusWrap(err, "Invalid layer")
+	}
+	return nil
+}
+
+func (of *ociFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return qualifier.Difference(qualifiers, qualifier.NewSet([]string{"checksum.sri", "bazel.canonical_id", QualifierOCIPlatform, QualifierOCIDigest}))
+}
@@ -0,0 +1,486 @@
+package fetch_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	"github.com/buildbarn/bb-storage/pkg/clock"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func ociDigest(contents string) string {
+	hash := sha256.Sum256([]byte(contents))
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// fakeOCIRegistry is an in-process stand-in for a container registry.
+// It serves manifests and blobs from a single repository, and requires
+// clients to obtain a bearer token from its token service.
+type fakeOCIRegistry struct {
+	server        *httptest.Server
+	manifests     map[string]string
+	mediaTypes    map[string]string
+	blobs         map[string]string
+	tokenRequests atomic.Int32
+	// When set, the token service requires these credentials.
+	basicAuth string
+}
+
+func newFakeOCIRegistry(t *testing.T) *fakeOCIRegistry {
+	r := &fakeOCIRegistry{
+		manifests:  map[string]string{},
+		mediaTypes: map[string]string{},
+		blobs:      map[string]string{},
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *fakeOCIRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeOCIRegistry) addManifest(tag, mediaType, contents string) string {
+	digest := ociDigest(contents)
+	r.manifests[digest] = contents
+	r.mediaTypes[digest] = mediaType
+	if tag != "" {
+		r.manifests[tag] = contents
+		r.mediaTypes[tag] = mediaType
+	}
+	return digest
+}
+
+func (r *fakeOCIRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.tokenRequests.Add(1)
+		if r.basicAuth != "" && req.Header.Get("Authorization") != r.basicAuth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != "repository:foo/bar:pull" || req.URL.Query().Get("service") != "registry.test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token": "secret-token", "expires_in": 300}`)
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer secret-token" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.test",scope="repository:foo/bar:pull"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if reference, ok := strings.CutPrefix(req.URL.Path, "/v2/foo/bar/manifests/"); ok {
+		if contents, ok := r.manifests[reference]; ok {
+			w.Header().Set("Content-Type", r.mediaTypes[reference])
+			fmt.Fprint(w, contents)
+			return
+		}
+	}
+	if digest, ok := strings.CutPrefix(req.URL.Path, "/v2/foo/bar/blobs/"); ok {
+		if contents, ok := r.blobs[digest]; ok {
+			fmt.Fprint(w, contents)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func expectOCIBlobPut(t *testing.T, cas *mock.MockBlobAccess, contents string) bb_digest.Digest {
+	hash := sha256.Sum256([]byte(contents))
+	blobDigest := bb_digest.MustNewDigest("", remoteexecution.DigestFunction_SHA256, hex.EncodeToString(hash[:]), int64(len(contents)))
+	cas.EXPECT().Put(gomock.Any(), blobDigest, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, digest bb_digest.Digest, b buffer.Buffer) error {
+			data, err := b.ToByteSlice(1 << 20)
+			require.NoError(t, err)
+			require.Equal(t, contents, string(data))
+			return nil
+		})
+	return blobDigest
+}
+
+func TestOCIFetcherFetchBlob(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	registry := newFakeOCIRegistry(t)
+	layer := "Layer contents"
+	registry.blobs[ociDigest(layer)] = layer
+	registry.blobs[ociDigest("Expected layer contents")] = "Corrupted layer contents"
+	amd64Manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"%s","size":%d}]}`, ociDigest(layer), len(layer))
+	amd64ManifestDigest := registry.addManifest("", "application/vnd.oci.image.manifest.v1+json", amd64Manifest)
+	arm64Manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`
+	arm64ManifestDigest := registry.addManifest("", "application/vnd.oci.image.manifest.v1+json", arm64Manifest)
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":%d,"platform":{"architecture":"amd64","os":"linux"}},{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":%d,"platform":{"architecture":"arm64","os":"linux","variant":"v8"}}]}`, amd64ManifestDigest, len(amd64Manifest), arm64ManifestDigest, len(arm64Manifest))
+	indexDigest := registry.addManifest("1.0", "application/vnd.oci.image.index.v1+json", index)
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	ociFetcher := fetch.NewOCIFetcher(http.DefaultClient, casBlobAccess, clock.SystemClock, fetch.OCIFetcherOptions{
+		PlainHTTPRegistries: []string{registry.host()},
+	})
+
+	t.Run("Tag", func(t *testing.T) {
+		// Without a platform, the image index is returned as is.
+		blobDigest := expectOCIBlobPut(t, casBlobAccess, index)
+
+		response, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:1.0"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+		testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+		// The digest to which the tag was resolved should be
+		// returned, so that clients can pin it.
+		testutil.RequireEqualProto(t, &remoteasset.Qualifier{Name: "oci.digest", Value: indexDigest}, response.Qualifiers[0])
+	})
+
+	t.Run("PinnedDigest", func(t *testing.T) {
+		// The oci.digest qualifier takes precedence over the tag.
+		blobDigest := expectOCIBlobPut(t, casBlobAccess, amd64Manifest)
+
+		qualifiers := []*remoteasset.Qualifier{
+			{Name: "oci.digest", Value: amd64ManifestDigest},
+		}
+		response, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris:       []string{"oci://" + registry.host() + "/foo/bar:1.0"},
+			Qualifiers: qualifiers,
+		})
+		require.NoError(t, err)
+		testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+		require.Len(t, response.Qualifiers, 1)
+		testutil.RequireEqualProto(t, qualifiers[0], response.Qualifiers[0])
+	})
+
+	t.Run("PinnedDigestConflict", func(t *testing.T) {
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar@" + arm64ManifestDigest},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "oci.digest", Value: amd64ManifestDigest},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: URI \"oci://%s/foo/bar@%s\" contains digest %s, while oci.digest qualifier %s was provided", registry.host(), arm64ManifestDigest, arm64ManifestDigest, amd64ManifestDigest), err)
+	})
+
+	t.Run("InvalidPinnedDigest", func(t *testing.T) {
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:1.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "oci.digest", Value: "1.0"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Invalid oci.digest qualifier \"1.0\", as it is not of the form \"<algorithm>:<hex>\""), err)
+	})
+
+	t.Run("Platform", func(t *testing.T) {
+		blobDigest := expectOCIBlobPut(t, casBlobAccess, arm64Manifest)
+
+		response, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"docker://" + registry.host() + "/foo/bar:1.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "oci.platform", Value: "linux/arm64"},
+			},
+		})
+		require.NoError(t, err)
+		testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+	})
+
+	t.Run("PlatformNotFound", func(t *testing.T) {
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:1.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "oci.platform", Value: "windows/amd64"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download blob from any provided URI: Image index does not contain a manifest for platform windows/amd64"), err)
+	})
+
+	t.Run("ManifestByDigest", func(t *testing.T) {
+		blobDigest := expectOCIBlobPut(t, casBlobAccess, amd64Manifest)
+
+		response, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar@" + amd64ManifestDigest},
+		})
+		require.NoError(t, err)
+		testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+	})
+
+	t.Run("Layer", func(t *testing.T) {
+		// Digests for which no manifest exists are requested as
+		// blobs.
+		blobDigest := expectOCIBlobPut(t, casBlobAccess, layer)
+
+		response, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:1.0@" + ociDigest(layer)},
+		})
+		require.NoError(t, err)
+		testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+	})
+
+	t.Run("CorruptedLayer", func(t *testing.T) {
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar@" + ociDigest("Expected layer contents")},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: Invalid blob: Content has digest %s, while %s was expected", ociDigest("Corrupted layer contents"), ociDigest("Expected layer contents")), err)
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{
+				"oci://" + registry.host() + "/foo/bar@" + ociDigest(layer),
+				"oci://" + registry.host() + "/foo/bar@" + amd64ManifestDigest,
+			},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "checksum.sri", Value: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.Internal, "Fetched content did not match sha256 hash of checksum.sri qualifier: Expected e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855, Got %s", strings.TrimPrefix(ociDigest(layer), "sha256:")), err)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:2.0"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download blob from any provided URI: HTTP request failed with status \"404 Not Found\""), err)
+	})
+
+	t.Run("InvalidURI", func(t *testing.T) {
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/Foo/bar:1.0"},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: URI \"oci://%s/Foo/bar:1.0\" contains invalid repository \"Foo/bar\"", registry.host()), err)
+	})
+
+	// The bearer token should have been cached across requests.
+	require.Equal(t, int32(1), registry.tokenRequests.Load())
+}
+
+func TestOCIFetcherTokenCredentials(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	registry := newFakeOCIRegistry(t)
+	registry.basicAuth = "Basic dXNlcjpwYXNz"
+	manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`
+	registry.addManifest("latest", "application/vnd.oci.image.manifest.v1+json", manifest)
+
+	registryURL, err := url.Parse(registry.server.URL)
+	require.NoError(t, err)
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+
+	t.Run("Anonymous", func(t *testing.T) {
+		ociFetcher := fetch.NewOCIFetcher(http.DefaultClient, casBlobAccess, clock.SystemClock, fetch.OCIFetcherOptions{
+			PlainHTTPRegistries: []string{registry.host()},
+		})
+		_, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar"},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download blob from any provided URI: Failed to authenticate against registry %#v: Token request failed with status \"401 Unauthorized\"", registry.host()), err)
+	})
+
+	t.Run("Credentials", func(t *testing.T) {
+		// Credentials of the server are provided to the token
+		// service when requesting a token.
+		ociFetcher := fetch.NewOCIFetcher(http.DefaultClient, casBlobAccess, clock.SystemClock, fetch.OCIFetcherOptions{
+			Credentials: fetch.NewPatternCredentialStore(
+				[]fetch.URLPattern{fetch.URLPattern(registryURL.Hostname())},
+				fetch.NewBasicAuthCredentialSource("user", "pass")),
+			PlainHTTPRegistries: []string{registry.host()},
+		})
+		blobDigest := expectOCIBlobPut(t, casBlobAccess, manifest)
+
+		response, err := ociFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar"},
+		})
+		require.NoError(t, err)
+		testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+	})
+}
+
+// createOCILayer creates a gzip compressed tarball containing regular
+// files with the provided contents.
+func createOCILayer(t *testing.T, files map[string]string) string {
+	var b bytes.Buffer
+	gzipWriter := gzip.NewWriter(&b)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		contents := files[name]
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(contents))}))
+		_, err := tarWriter.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return b.String()
+}
+
+func TestOCIFetcherCaching(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	// The oci.digest qualifier that is added to responses must not
+	// prevent subsequent requests from being served from the asset
+	// store.
+	registry := newFakeOCIRegistry(t)
+	manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`
+	manifestDigest := registry.addManifest("1.0", "application/vnd.oci.image.manifest.v1+json", manifest)
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	fetcher := fetch.NewCachingFetcher(
+		fetch.NewOCIFetcher(http.DefaultClient, casBlobAccess, clock.SystemClock, fetch.OCIFetcherOptions{
+			PlainHTTPRegistries: []string{registry.host()},
+		}),
+		newInMemoryAssetStore(t, ctrl))
+
+	for _, uri := range []string{
+		"oci://" + registry.host() + "/foo/bar:1.0",
+		"oci://" + registry.host() + "/foo/bar@" + manifestDigest,
+	} {
+		t.Run(uri, func(t *testing.T) {
+			blobDigest := expectOCIBlobPut(t, casBlobAccess, manifest)
+			request := &remoteasset.FetchBlobRequest{
+				Uris: []string{uri},
+			}
+			response, err := fetcher.FetchBlob(ctx, request)
+			require.NoError(t, err)
+			testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+			testutil.RequireEqualProto(t, &remoteasset.Qualifier{Name: "oci.digest", Value: manifestDigest}, response.Qualifiers[0])
+
+			response, err = fetcher.FetchBlob(ctx, request)
+			require.NoError(t, err)
+			require.Equal(t, "Blob fetched successfully from asset cache", response.Status.Message)
+			testutil.RequireEqualProto(t, blobDigest.GetProto(), response.BlobDigest)
+		})
+	}
+}
+
+func TestOCIFetcherFetchDirectory(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	digestFunction := bb_digest.MustNewFunction("", remoteexecution.DigestFunction_SHA256)
+
+	registry := newFakeOCIRegistry(t)
+	baseLayer := createOCILayer(t, map[string]string{"etc/config": "Old", "etc/removed": "Removed"})
+	registry.blobs[ociDigest(baseLayer)] = baseLayer
+	upperLayer := createOCILayer(t, map[string]string{"bin/tool": "#!/bin/sh", "etc/config": "New", "etc/.wh.removed": ""})
+	registry.blobs[ociDigest(upperLayer)] = upperLayer
+	corruptedLayer := createOCILayer(t, map[string]string{"etc/config": "Corrupted"})
+	registry.blobs[ociDigest("Expected layer contents")] = corruptedLayer
+
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"%s","size":%d},{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","digest":"%s","size":%d}]}`, ociDigest(baseLayer), len(baseLayer), ociDigest(upperLayer), len(upperLayer))
+	manifestDigest := registry.addManifest("1.0", "application/vnd.oci.image.manifest.v1+json", manifest)
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":%d,"platform":{"architecture":"amd64","os":"linux"}}]}`, manifestDigest, len(manifest))
+	indexDigest := registry.addManifest("multiarch", "application/vnd.oci.image.index.v1+json", index)
+	registry.addManifest("corrupted", "application/vnd.oci.image.manifest.v1+json", fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"%s","size":%d}]}`, ociDigest("Expected layer contents"), len(corruptedLayer)))
+
+	contents := map[bb_digest.Digest][]byte{}
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, blobDigest bb_digest.Digest, b buffer.Buffer) error {
+			data, err := b.ToByteSlice(1 << 20)
+			if err != nil {
+				return err
+			}
+			contents[blobDigest] = data
+			return nil
+		}).AnyTimes()
+	getDirectory := func(d *remoteexecution.Digest) *remoteexecution.Directory {
+		directoryDigest, err := digestFunction.NewDigestFromProto(d)
+		require.NoError(t, err)
+		var directory remoteexecution.Directory
+		require.NoError(t, proto.Unmarshal(contents[directoryDigest], &directory))
+		return &directory
+	}
+
+	ociFetcher := fetch.NewOCIFetcher(http.DefaultClient, casBlobAccess, clock.SystemClock, fetch.OCIFetcherOptions{
+		PlainHTTPRegistries: []string{registry.host()},
+		ImageExtractionLimits: &archive.Limits{
+			MaximumExtractedSizeBytes: 1 << 20,
+			MaximumEntries:            100,
+		},
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		response, err := ociFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:multiarch"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "oci.platform", Value: "linux/amd64"},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.Status.Code)
+		testutil.RequireEqualProto(t, &remoteasset.Qualifier{Name: "oci.digest", Value: indexDigest}, response.Qualifiers[1])
+
+		root := getDirectory(response.RootDirectoryDigest)
+		require.Len(t, root.Directories, 2)
+		require.Equal(t, "bin", root.Directories[0].Name)
+		require.Equal(t, "etc", root.Directories[1].Name)
+
+		bin := getDirectory(root.Directories[0].Digest)
+		require.Len(t, bin.Files, 1)
+		require.Equal(t, "tool", bin.Files[0].Name)
+		require.True(t, bin.Files[0].IsExecutable)
+
+		etc := getDirectory(root.Directories[1].Digest)
+		require.Len(t, etc.Files, 1)
+		require.Equal(t, "config", etc.Files[0].Name)
+		configDigest, err := digestFunction.NewDigestFromProto(etc.Files[0].Digest)
+		require.NoError(t, err)
+		require.Equal(t, []byte("New"), contents[configDigest])
+	})
+
+	t.Run("ImageIndexWithoutPlatform", func(t *testing.T) {
+		_, err := ociFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:multiarch"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Unable to download directory from any provided URI: Manifest is an image index, meaning the oci.platform qualifier needs to be provided to select an image"), err)
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		// The checksum.sri qualifier applies to the manifest of
+		// the image.
+		_, err := ociFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:1.0"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "checksum.sri", Value: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.Internal, "Fetched content did not match sha256 hash of checksum.sri qualifier: Expected e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855, Got %s", strings.TrimPrefix(manifestDigest, "sha256:")), err)
+	})
+
+	t.Run("CorruptedLayer", func(t *testing.T) {
+		_, err := ociFetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:corrupted"},
+		})
+		testutil.RequireEqualStatus(t, status.Errorf(codes.NotFound, "Unable to download directory from any provided URI: Failed to extract layer %s: Invalid layer: Content has digest %s, while %s was expected", ociDigest("Expected layer contents"), ociDigest(corruptedLayer), ociDigest("Expected layer contents")), err)
+	})
+
+	t.Run("NotSupported", func(t *testing.T) {
+		_, err := fetch.NewOCIFetcher(http.DefaultClient, casBlobAccess, clock.SystemClock, fetch.OCIFetcherOptions{}).FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"oci://" + registry.host() + "/foo/bar:1.0"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.PermissionDenied, "Fetching of directories from OCI registries is not supported"), err)
+	})
+}
@@ -0,0 +1,81 @@
+package fetch
+
+import (
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ociRepositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*)*$`)
+	ociTagPattern        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	ociDigestPattern     = regexp.MustCompile(`^(sha256:[a-f0-9]{64}|sha512:[a-f0-9]{128})$`)
+)
+
+// ociReference identifies a manifest or blob stored in an OCI registry,
+// as specified in an oci:// or docker:// URI.
+type ociReference struct {
+	// Host name and optional port of the registry.
+	registry   string
+	repository string
+	// Either a tag or a digest of the form "<algorithm>:<hex>".
+	reference string
+}
+
+// isDigest returns whether the reference refers to content by digest,
+// as opposed to by tag.
+func (r *ociReference) isDigest() bool {
+	return strings.Contains(r.reference, ":")
+}
+
+// parseOCIReference parses URIs of the form
+// oci://registry/repository[:tag][@digest]. docker:// URIs are accepted
+// as well. Similar to the Docker CLI, the registry may be omitted, in
+// which case Docker Hub is used. If both a tag and a digest are
+// provided, the tag is ignored.
+func parseOCIReference(uri string) (ociReference, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok || (!strings.EqualFold(scheme, "oci") && !strings.EqualFold(scheme, "docker")) {
+		return ociReference{}, status.Errorf(codes.InvalidArgument, "URI %#v does not have scheme \"oci\" or \"docker\"", uri)
+	}
+
+	registry := "docker.io"
+	if first, remainder, ok := strings.Cut(rest, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		registry, rest = first, remainder
+	}
+
+	var reference string
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		if !ociDigestPattern.MatchString(digest) {
+			return ociReference{}, status.Errorf(codes.InvalidArgument, "URI %#v contains invalid digest %#v", uri, digest)
+		}
+		rest, reference = name, digest
+	}
+	repository := rest
+	if i := strings.LastIndexByte(rest, ':'); i > strings.LastIndexByte(rest, '/') {
+		repository = rest[:i]
+		if tag := rest[i+1:]; !ociTagPattern.MatchString(tag) {
+			return ociReference{}, status.Errorf(codes.InvalidArgument, "URI %#v contains invalid tag %#v", uri, tag)
+		} else if reference == "" {
+			reference = tag
+		}
+	}
+	if reference == "" {
+		reference = "latest"
+	}
+
+	// Official images on Docker Hub live in the "library" namespace.
+	if registry == "docker.io" && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	if !ociRepositoryPattern.MatchString(repository) {
+		return ociReference{}, status.Errorf(codes.InvalidArgument, "URI %#v contains invalid repository %#v", uri, repository)
+	}
+	return ociReference{
+		registry:   registry,
+		repository: repository,
+		reference:  reference,
+	}, nil
+}
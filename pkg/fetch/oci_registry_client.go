@@ -0,0 +1,409 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buildbarn/bb-storage/pkg/clock"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ociImageIndexMediaType      = "application/vnd.oci.image.index.v1+json"
+	ociImageManifestMediaType   = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// Registries are not required to accept manifests larger than
+	// 4 MiB, meaning larger manifests are most likely bogus.
+	ociMaximumManifestSizeBytes = 4 << 20
+
+	// Bearer tokens are valid for 60 seconds if the token service
+	// does not announce otherwise.
+	ociDefaultTokenExpiration = 60 * time.Second
+)
+
+// ociManifestMediaTypes contains the media types of manifests that are
+// accepted when requesting them from a registry.
+var ociManifestMediaTypes = []string{
+	ociImageIndexMediaType,
+	ociImageManifestMediaType,
+	dockerManifestListMediaType,
+	dockerManifestMediaType,
+}
+
+// ociDescriptor refers to a manifest or blob stored in a registry.
+type ociDescriptor struct {
+	MediaType string       `json:"mediaType"`
+	Digest    string       `json:"digest"`
+	Size      int64        `json:"size"`
+	Platform  *ociPlatform `json:"platform,omitempty"`
+}
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ociManifest contains the fields of image manifests and image indexes
+// (manifest lists) that are of interest to the OCI fetcher.
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    *ociDescriptor  `json:"config,omitempty"`
+	Layers    []ociDescriptor `json:"layers,omitempty"`
+	Manifests []ociDescriptor `json:"manifests,omitempty"`
+}
+
+// isIndex returns whether the manifest refers to other manifests, as
+// opposed to layers.
+func (m *ociManifest) isIndex(mediaType string) bool {
+	if m.MediaType != "" {
+		mediaType = m.MediaType
+	}
+	switch mediaType {
+	case ociImageIndexMediaType, dockerManifestListMediaType:
+		return true
+	case ociImageManifestMediaType, dockerManifestMediaType:
+		return false
+	default:
+		return len(m.Manifests) > 0 && len(m.Layers) == 0
+	}
+}
+
+// newOCIDigestHasher returns a hash function that can be used to verify
+// content against a digest of the form "<algorithm>:<hex>".
+func newOCIDigestHasher(digest string) (hash.Hash, error) {
+	switch algorithm, _, _ := strings.Cut(digest, ":"); algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Digest %#v uses an unsupported algorithm", digest)
+	}
+}
+
+// checkOCIDigest returns an error if the hash of content does not
+// match the digest under which it was requested.
+func checkOCIDigest(hasher hash.Hash, expectedDigest string) error {
+	algorithm, _, _ := strings.Cut(expectedDigest, ":")
+	if actualDigest := algorithm + ":" + hex.EncodeToString(hasher.Sum(nil)); actualDigest != expectedDigest {
+		return status.Errorf(codes.Internal, "Content has digest %s, while %s was expected", actualDigest, expectedDigest)
+	}
+	return nil
+}
+
+// ociAuthorization is the value of an Authorization header that is
+// sent to a registry, obtained by responding to its challenge.
+type ociAuthorization struct {
+	header string
+	// When non-zero, the time at which the token expires.
+	expiration time.Time
+}
+
+// ociRegistryClient performs requests against registries implementing
+// the OCI distribution specification. Registries requiring
+// authentication respond with a WWW-Authenticate challenge, which is
+// answered either by obtaining a bearer token from the token service
+// of the registry, or by providing the credentials of the server
+// directly.
+type ociRegistryClient struct {
+	httpClient          *http.Client
+	credentials         CredentialStore
+	plainHTTPRegistries map[string]struct{}
+	clock               clock.Clock
+
+	lock           sync.Mutex
+	authorizations map[string]ociAuthorization
+}
+
+func newOCIRegistryClient(httpClient *http.Client, credentials CredentialStore, plainHTTPRegistries []string, clock clock.Clock) *ociRegistryClient {
+	c := &ociRegistryClient{
+		httpClient:          httpClient,
+		credentials:         credentials,
+		plainHTTPRegistries: map[string]struct{}{},
+		clock:               clock,
+		authorizations:      map[string]ociAuthorization{},
+	}
+	for _, registry := range plainHTTPRegistries {
+		c.plainHTTPRegistries[strings.ToLower(registry)] = struct{}{}
+	}
+	return c
+}
+
+// getURL returns the URL of a resource stored in the repository of a
+// reference.
+func (c *ociRegistryClient) getURL(ref *ociReference, resource string) string {
+	scheme := "https"
+	if _, ok := c.plainHTTPRegistries[strings.ToLower(ref.registry)]; ok {
+		scheme = "http"
+	}
+	host := ref.registry
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	return scheme + "://" + host + "/v2/" + ref.repository + "/" + resource
+}
+
+func (c *ociRegistryClient) getAuthorization(key string) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	authorization, ok := c.authorizations[key]
+	if !ok || (!authorization.expiration.IsZero() && !c.clock.Now().Before(authorization.expiration)) {
+		return ""
+	}
+	return authorization.header
+}
+
+func (c *ociRegistryClient) setAuthorization(key string, authorization ociAuthorization) {
+	c.lock.Lock()
+	c.authorizations[key] = authorization
+	c.lock.Unlock()
+}
+
+// get requests a resource from the repository of a reference. If the
+// registry rejects the request due to missing or expired
+// authorization, its challenge is answered and the request is retried.
+func (c *ociRegistryClient) get(ctx context.Context, ref *ociReference, resource string, accept []string) (*http.Response, error) {
+	uri := c.getURL(ref, resource)
+	authorizationKey := ref.registry + "/" + ref.repository
+	for authenticated := false; ; authenticated = true {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to create HTTP request")
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		if authorization := c.getAuthorization(authorizationKey); authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, wrapDownloadError(ctx, err, "HTTP request failed")
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || authenticated {
+			return nil, newOCIStatusError(resp)
+		}
+
+		authorization, err := c.authenticate(ctx, ref, uri, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return nil, util.StatusWrapf(err, "Failed to authenticate against registry %#v", ref.registry)
+		}
+		c.setAuthorization(authorizationKey, authorization)
+	}
+}
+
+// newOCIStatusError converts the status of an unsuccessful response of
+// a registry to a gRPC status.
+func newOCIStatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return status.Errorf(codes.NotFound, "HTTP request failed with status %#v", resp.Status)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return status.Errorf(codes.PermissionDenied, "HTTP request failed with status %#v", resp.Status)
+	default:
+		return status.Errorf(codes.Internal, "HTTP request failed with status %#v", resp.Status)
+	}
+}
+
+// authenticate answers the challenge provided by a registry in its
+// WWW-Authenticate header.
+func (c *ociRegistryClient) authenticate(ctx context.Context, ref *ociReference, uri, challenge string) (ociAuthorization, error) {
+	scheme, parameters := parseAuthenticationChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		realm := parameters["realm"]
+		if realm == "" {
+			return ociAuthorization{}, status.Error(codes.Internal, "Bearer challenge does not contain a realm")
+		}
+		scope := parameters["scope"]
+		if scope == "" {
+			scope = "repository:" + ref.repository + ":pull"
+		}
+		return c.requestToken(ctx, realm, parameters["service"], scope)
+	case "basic":
+		parsedURI, err := url.Parse(uri)
+		if err != nil {
+			return ociAuthorization{}, util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid registry URL")
+		}
+		credentials, err := c.getCredentials(ctx, parsedURI)
+		if err != nil {
+			return ociAuthorization{}, err
+		}
+		if credentials.Get("Authorization") == "" {
+			return ociAuthorization{}, status.Error(codes.PermissionDenied, "Registry requires basic authentication, but no credentials are configured")
+		}
+		return ociAuthorization{header: credentials.Get("Authorization")}, nil
+	default:
+		return ociAuthorization{}, status.Errorf(codes.PermissionDenied, "Registry requested unsupported authentication scheme %#v", scheme)
+	}
+}
+
+func (c *ociRegistryClient) getCredentials(ctx context.Context, uri *url.URL) (http.Header, error) {
+	if c.credentials == nil {
+		return nil, nil
+	}
+	credentials, err := c.credentials.GetCredentials(ctx, uri)
+	if err != nil {
+		return nil, util.StatusWrap(err, "Failed to obtain credentials")
+	}
+	return credentials, nil
+}
+
+// requestToken obtains a bearer token from the token service of a
+// registry. If the server has credentials for the token service, they
+// are provided. Otherwise an anonymous token is requested.
+func (c *ociRegistryClient) requestToken(ctx context.Context, realm, service, scope string) (ociAuthorization, error) {
+	tokenURL, err := url.Parse(realm)
+	if err != nil || (tokenURL.Scheme != "http" && tokenURL.Scheme != "https") {
+		return ociAuthorization{}, status.Errorf(codes.Internal, "Bearer challenge contains invalid realm %#v", realm)
+	}
+	query := tokenURL.Query()
+	if service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return ociAuthorization{}, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to create HTTP request")
+	}
+	credentials, err := c.getCredentials(ctx, tokenURL)
+	if err != nil {
+		return ociAuthorization{}, err
+	}
+	for header, values := range credentials {
+		for _, value := range values {
+			req.Header.Add(header, value)
+		}
+	}
+	requestTime := c.clock.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ociAuthorization{}, wrapDownloadError(ctx, err, "Token request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ociAuthorization{}, status.Errorf(codes.PermissionDenied, "Token request failed with status %#v", resp.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResponse); err != nil {
+		return ociAuthorization{}, wrapDownloadError(ctx, err, "Failed to parse token response")
+	}
+	token := tokenResponse.Token
+	if token == "" {
+		token = tokenResponse.AccessToken
+	}
+	if token == "" {
+		return ociAuthorization{}, status.Error(codes.Internal, "Token response does not contain a token")
+	}
+	expiration := ociDefaultTokenExpiration
+	if tokenResponse.ExpiresIn > 0 {
+		expiration = time.Duration(tokenResponse.ExpiresIn) * time.Second
+	}
+	return ociAuthorization{
+		header:     "Bearer " + token,
+		expiration: requestTime.Add(expiration),
+	}, nil
+}
+
+// parseAuthenticationChallenge parses the value of a WWW-Authenticate
+// header containing a single challenge, such as:
+//
+//	Bearer realm="https://auth.example.com/token",service="example.com"
+//
+// Parameter names are converted to lowercase.
+func parseAuthenticationChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	parameters := map[string]string{}
+	for rest = strings.TrimLeft(rest, ", "); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if quoted, ok := strings.CutPrefix(value, "\""); ok {
+			// Quoted values may contain commas and escaped
+			// characters.
+			var b strings.Builder
+			i := 0
+			for ; i < len(quoted) && quoted[i] != '"'; i++ {
+				if quoted[i] == '\\' && i+1 < len(quoted) {
+					i++
+				}
+				b.WriteByte(quoted[i])
+			}
+			parameters[name] = b.String()
+			rest = quoted[min(i+1, len(quoted)):]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			parameters[name] = strings.TrimSpace(value)
+		}
+	}
+	return scheme, parameters
+}
+
+// getManifest requests a manifest from a registry. If the manifest is
+// requested by digest, its contents are verified. The contents and
+// media type of the manifest are returned.
+func (c *ociRegistryClient) getManifest(ctx context.Context, ref *ociReference) ([]byte, string, error) {
+	resp, err := c.get(ctx, ref, "manifests/"+ref.reference, ociManifestMediaTypes)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > ociMaximumManifestSizeBytes {
+		return nil, "", status.Errorf(codes.ResourceExhausted, "Manifest has a size of %d bytes, which exceeds the maximum size of %d bytes", resp.ContentLength, ociMaximumManifestSizeBytes)
+	}
+	manifest, err := io.ReadAll(io.LimitReader(resp.Body, ociMaximumManifestSizeBytes+1))
+	if err != nil {
+		return nil, "", wrapDownloadError(ctx, err, "Failed to read response body")
+	}
+	if len(manifest) > ociMaximumManifestSizeBytes {
+		return nil, "", status.Errorf(codes.ResourceExhausted, "Manifest exceeds the maximum size of %d bytes", ociMaximumManifestSizeBytes)
+	}
+	if ref.isDigest() {
+		hasher, err := newOCIDigestHasher(ref.reference)
+		if err != nil {
+			return nil, "", err
+		}
+		hasher.Write(manifest)
+		if err := checkOCIDigest(hasher, ref.reference); err != nil {
+			return nil, "", util.StatusWrap(err, "Invalid manifest")
+		}
+	}
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return manifest, strings.TrimSpace(mediaType), nil
+}
+
+// getBlob requests a blob, such as a layer or an image configuration,
+// from a registry. The caller is responsible for verifying the contents
+// of the response body against the digest.
+func (c *ociRegistryClient) getBlob(ctx context.Context, ref *ociReference) (*http.Response, error) {
+	return c.get(ctx, ref, "blobs/"+ref.reference, nil)
+}
@@ -0,0 +1,73 @@
+package fetch
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Maximum number of redirects that are followed, matching the default
+// policy of http.Client.
+const maximumRedirects = 10
+
+// Headers that are retained when a request is redirected to another
+// host. They are needed by the protocols spoken by the fetchers, and
+// cannot contain credentials.
+var redirectPreservedHeaders = map[string]struct{}{
+	"Accept":            {},
+	"Accept-Encoding":   {},
+	"Content-Type":      {},
+	"Git-Protocol":      {},
+	"If-Modified-Since": {},
+	"If-None-Match":     {},
+	"If-Range":          {},
+	"Range":             {},
+	"User-Agent":        {},
+}
+
+// NewCredentialRedirectPolicy creates a function that may be used as
+// http.Client.CheckRedirect, preventing credentials from being sent to
+// hosts to which requests are redirected.
+//
+// http.Client only removes the Authorization and Cookie headers when
+// redirecting to another domain. Credentials of the server and headers
+// provided by the client may be stored in arbitrary headers (e.g.,
+// Private-Token), meaning that all headers other than the ones needed
+// by the protocol are removed when the scheme or host changes. The
+// credentials of the server for the URL to which the request is
+// redirected are provided instead.
+func NewCredentialRedirectPolicy(credentials CredentialStore) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maximumRedirects {
+			return status.Errorf(codes.Unavailable, "Stopped after %d redirects", maximumRedirects)
+		}
+		// http.Client copies the headers of the initial request
+		// to every subsequent request.
+		initialURL := via[0].URL
+		if req.URL.Scheme == initialURL.Scheme && strings.EqualFold(req.URL.Host, initialURL.Host) {
+			return nil
+		}
+		for header := range req.Header {
+			if _, ok := redirectPreservedHeaders[header]; !ok {
+				req.Header.Del(header)
+			}
+		}
+		if credentials != nil {
+			headers, err := credentials.GetCredentials(req.Context(), req.URL)
+			if err != nil {
+				return util.StatusWrapf(err, "Failed to obtain credentials for URI %#v", req.URL.String())
+			}
+			for header, values := range headers {
+				req.Header.Del(header)
+				for _, value := range values {
+					req.Header.Add(header, value)
+				}
+			}
+		}
+		return nil
+	}
+}
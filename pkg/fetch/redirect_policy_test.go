@@ -0,0 +1,79 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialRedirectPolicy(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	// The server to which requests are redirected should only
+	// receive its own credentials, as opposed to the ones of the
+	// server to which the request was sent initially.
+	var redirectedHeaders http.Header
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectedHeaders = r.Header.Clone()
+		w.Write([]byte("Hello"))
+	}))
+	defer mirror.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Private-Token") != "origin-secret" || r.Header.Get("X-Client") != "client-secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/same-host":
+			http.Redirect(w, r, "/file", http.StatusFound)
+		case "/file":
+			w.Write([]byte("Hello"))
+		default:
+			http.Redirect(w, r, mirror.URL+"/file", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	credentials := fetch.NewMultiCredentialStore([]fetch.CredentialStore{
+		fetch.NewPatternCredentialStore(
+			[]fetch.URLPattern{fetch.URLPattern(origin.URL + "/")},
+			fetch.NewStaticCredentialSource(http.Header{"Private-Token": []string{"origin-secret"}})),
+		fetch.NewPatternCredentialStore(
+			[]fetch.URLPattern{fetch.URLPattern(mirror.URL + "/")},
+			fetch.NewStaticCredentialSource(http.Header{"Authorization": []string{"Bearer mirror-secret"}})),
+	})
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	httpFetcher := fetch.NewHTTPFetcher(
+		&http.Client{CheckRedirect: fetch.NewCredentialRedirectPolicy(credentials)},
+		casBlobAccess,
+		fetch.HTTPFetcherOptions{Credentials: credentials})
+	fetchBlob := func(uri string) error {
+		_, err := httpFetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{uri},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "http_header:X-Client", Value: "client-secret"},
+			},
+		})
+		return err
+	}
+
+	t.Run("SameHost", func(t *testing.T) {
+		casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		require.NoError(t, fetchBlob(origin.URL+"/same-host"))
+	})
+
+	t.Run("OtherHost", func(t *testing.T) {
+		casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		require.NoError(t, fetchBlob(origin.URL+"/redirect"))
+		require.Empty(t, redirectedHeaders.Get("Private-Token"))
+		require.Empty(t, redirectedHeaders.Get("X-Client"))
+		require.Equal(t, "Bearer mirror-secret", redirectedHeaders.Get("Authorization"))
+	})
+}
@@ -0,0 +1,96 @@
+package fetch
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type resourceTypeDemultiplexingFetcher struct {
+	backends       map[string]Fetcher
+	defaultBackend Fetcher
+}
+
+// NewResourceTypeDemultiplexingFetcher creates a Fetcher that forwards
+// requests to backends based on the value of their resource_type
+// qualifier (e.g., "application/x-git"). Requests without a
+// resource_type qualifier, or with a resource type for which no
+// backend exists, are forwarded to the default backend. If no default
+// backend is provided, such requests are rejected.
+//
+// The resource_type qualifier is considered to be supported by all
+// backends, as it is consumed by this Fetcher. It is still forwarded
+// to the backends, so that they may interpret it.
+func NewResourceTypeDemultiplexingFetcher(backends map[string]Fetcher, defaultBackend Fetcher) Fetcher {
+	return &resourceTypeDemultiplexingFetcher{
+		backends:       backends,
+		defaultBackend: defaultBackend,
+	}
+}
+
+func (rf *resourceTypeDemultiplexingFetcher) getBackend(qualifiers []*remoteasset.Qualifier) (Fetcher, error) {
+	resourceType := ""
+	for _, q := range qualifiers {
+		if q.Name == "resource_type" {
+			resourceType = q.Value
+		}
+	}
+	backend, ok := rf.backends[resourceType]
+	if !ok {
+		if rf.defaultBackend == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "No backend is configured for resource type %#v", resourceType)
+		}
+		backend = rf.defaultBackend
+	}
+
+	// Only the qualifiers unsupported by all backends are rejected
+	// up front, meaning the selected backend may not support all
+	// qualifiers of the request.
+	set := qualifier.Difference(qualifier.QualifiersToSet(qualifiers), qualifier.NewSet([]string{"resource_type"}))
+	if unsupported := backend.CheckQualifiers(set); !unsupported.IsEmpty() {
+		names := make([]string, 0, len(unsupported))
+		for name := range unsupported {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, status.Errorf(codes.InvalidArgument, "Backend for resource type %#v does not support qualifiers %s", resourceType, strings.Join(names, ", "))
+	}
+	return backend, nil
+}
+
+func (rf *resourceTypeDemultiplexingFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	backend, err := rf.getBackend(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	return backend.FetchBlob(ctx, req)
+}
+
+func (rf *resourceTypeDemultiplexingFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	backend, err := rf.getBackend(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	return backend.FetchDirectory(ctx, req)
+}
+
+// CheckQualifiers returns the qualifiers that are not supported by any
+// of the backends. Whether the backend handling a given resource type
+// supports the qualifiers is checked when the request is processed.
+func (rf *resourceTypeDemultiplexingFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	qualifiers = qualifier.Difference(qualifiers, qualifier.NewSet([]string{"resource_type"}))
+	unsupported := qualifiers
+	for _, backend := range rf.backends {
+		unsupported = qualifier.Intersection(unsupported, backend.CheckQualifiers(qualifiers))
+	}
+	if rf.defaultBackend != nil {
+		unsupported = qualifier.Intersection(unsupported, rf.defaultBackend.CheckQualifiers(qualifiers))
+	}
+	return unsupported
+}
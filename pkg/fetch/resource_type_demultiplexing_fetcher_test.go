@@ -0,0 +1,104 @@
+package fetch_test
+
+import (
+	"context"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestResourceTypeDemultiplexingFetcherFetchDirectory(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	gitFetcher := mock.NewMockFetcher(ctrl)
+	defaultFetcher := mock.NewMockFetcher(ctrl)
+	fetcher := fetch.NewResourceTypeDemultiplexingFetcher(map[string]fetch.Fetcher{
+		"application/x-git": gitFetcher,
+	}, defaultFetcher)
+	response := &remoteasset.FetchDirectoryResponse{
+		Status: status.New(codes.OK, "Directory fetched successfully!").Proto(),
+		Uri:    "https://example.com/repository.git",
+	}
+
+	t.Run("MatchingBackend", func(t *testing.T) {
+		// The resource_type qualifier is not passed to
+		// CheckQualifiers, but it is part of the request.
+		request := &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/repository.git"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "resource_type", Value: "application/x-git"},
+				{Name: "vcs.branch", Value: "main"},
+			},
+		}
+		gitFetcher.EXPECT().CheckQualifiers(qualifier.NewSet([]string{"vcs.branch"})).Return(qualifier.NewSet(nil))
+		gitFetcher.EXPECT().FetchDirectory(ctx, testutil.EqProto(t, request)).Return(response, nil)
+
+		actualResponse, err := fetcher.FetchDirectory(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("DefaultBackend", func(t *testing.T) {
+		request := &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/archive.tar.gz"},
+		}
+		defaultFetcher.EXPECT().CheckQualifiers(qualifier.NewSet(nil)).Return(qualifier.NewSet(nil))
+		defaultFetcher.EXPECT().FetchDirectory(ctx, testutil.EqProto(t, request)).Return(response, nil)
+
+		actualResponse, err := fetcher.FetchDirectory(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("UnsupportedQualifier", func(t *testing.T) {
+		gitFetcher.EXPECT().CheckQualifiers(qualifier.NewSet([]string{"archive.type"})).Return(qualifier.NewSet([]string{"archive.type"}))
+
+		_, err := fetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/repository.git"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "resource_type", Value: "application/x-git"},
+				{Name: "archive.type", Value: "zip"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Backend for resource type \"application/x-git\" does not support qualifiers archive.type"), err)
+	})
+
+	t.Run("NoDefaultBackend", func(t *testing.T) {
+		fetcher := fetch.NewResourceTypeDemultiplexingFetcher(map[string]fetch.Fetcher{
+			"application/x-git": gitFetcher,
+		}, nil)
+
+		_, err := fetcher.FetchDirectory(ctx, &remoteasset.FetchDirectoryRequest{
+			Uris: []string{"https://example.com/archive.tar.gz"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "resource_type", Value: "application/zip"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "No backend is configured for resource type \"application/zip\""), err)
+	})
+}
+
+func TestResourceTypeDemultiplexingFetcherCheckQualifiers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	gitFetcher := mock.NewMockFetcher(ctrl)
+	defaultFetcher := mock.NewMockFetcher(ctrl)
+	fetcher := fetch.NewResourceTypeDemultiplexingFetcher(map[string]fetch.Fetcher{
+		"application/x-git": gitFetcher,
+	}, defaultFetcher)
+
+	// Only qualifiers that aren't supported by any backend are
+	// reported. resource_type is always supported.
+	qualifiers := qualifier.NewSet([]string{"archive.type", "resource_type", "unknown", "vcs.branch"})
+	gitFetcher.EXPECT().CheckQualifiers(qualifier.NewSet([]string{"archive.type", "unknown", "vcs.branch"})).Return(qualifier.NewSet([]string{"archive.type", "unknown"}))
+	defaultFetcher.EXPECT().CheckQualifiers(qualifier.NewSet([]string{"archive.type", "unknown", "vcs.branch"})).Return(qualifier.NewSet([]string{"unknown", "vcs.branch"}))
+	require.Equal(t, qualifier.NewSet([]string{"unknown"}), fetcher.CheckQualifiers(qualifiers))
+}
@@ -0,0 +1,80 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+)
+
+// resumingReader reads the body of an HTTP response. If reading the
+// body fails and the server permits it, the download is continued
+// where it left off by issuing a range request, so that transient
+// network failures don't cause the entire download to be restarted.
+type resumingReader struct {
+	hf        *httpFetcher
+	ctx       context.Context
+	uri       string
+	auth      *AuthHeaders
+	validator string
+
+	body           io.ReadCloser
+	offsetBytes    int64
+	resumeAttempts int
+	// Error that caused the last response body to be abandoned. Set
+	// until the download has been resumed successfully.
+	err error
+}
+
+func (hf *httpFetcher) newResumingReader(ctx context.Context, uri string, auth *AuthHeaders, resp *http.Response) *resumingReader {
+	return &resumingReader{
+		hf:        hf,
+		ctx:       ctx,
+		uri:       uri,
+		auth:      auth,
+		validator: getResumeValidator(resp),
+		body:      resp.Body,
+	}
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	for {
+		if r.err == nil {
+			n, err := r.body.Read(p)
+			r.offsetBytes += int64(n)
+			if err == nil || err == io.EOF {
+				return n, err
+			}
+			r.err = err
+			if n > 0 {
+				return n, nil
+			}
+		}
+
+		if r.validator == "" || r.ctx.Err() != nil || r.resumeAttempts >= r.hf.options.MaximumResumeAttempts {
+			return 0, r.err
+		}
+		r.resumeAttempts++
+		log.Printf("Resuming download of blob with URI %s at offset %d (attempt %d): %v", r.uri, r.offsetBytes, r.resumeAttempts, r.err)
+		if r.body != nil {
+			_ = r.body.Close()
+			r.body = nil
+		}
+		resp, err := r.hf.resumeDownload(r.ctx, r.uri, r.auth, r.validator, r.offsetBytes)
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.body = resp.Body
+		r.err = nil
+	}
+}
+
+func (r *resumingReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,105 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/buildbarn/bb-storage/pkg/random"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultRetryableStatusCodes are the HTTP status codes that indicate
+// that an upstream server is temporarily unable to process a request.
+var DefaultRetryableStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy determines whether and when the HTTP fetcher retries
+// requests to an upstream server that failed.
+type RetryPolicy struct {
+	// Maximum number of requests made per URI, including the first.
+	MaximumAttempts int
+
+	// Amount of time to wait before the first retry, which is
+	// multiplied by BackoffMultiplier for every subsequent retry, up
+	// to MaximumBackoff. A random jitter of up to half the backoff is
+	// subtracted, so that clients do not retry in lockstep.
+	InitialBackoff    time.Duration
+	MaximumBackoff    time.Duration
+	BackoffMultiplier float64
+
+	// HTTP status codes for which requests are retried.
+	RetryableStatusCodes []int
+
+	// Whether to retry requests that failed due to network errors,
+	// such as connections that were refused or reset.
+	RetryNetworkErrors bool
+}
+
+func (rp *RetryPolicy) isRetryableStatusCode(statusCode int) bool {
+	for _, retryableStatusCode := range rp.RetryableStatusCodes {
+		if statusCode == retryableStatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableNetworkError returns whether an error returned by
+// http.Client.Do() is transient. Errors caused by the context being
+// done, connections being denied by the DialPolicy and invalid
+// certificates persist when retried.
+func (rp *RetryPolicy) isRetryableNetworkError(ctx context.Context, err error) bool {
+	if !rp.RetryNetworkErrors || ctx.Err() != nil || status.Code(err) != codes.Unknown {
+		return false
+	}
+	var certificateVerificationError *tls.CertificateVerificationError
+	return !errors.As(err, &certificateVerificationError)
+}
+
+// getBackoff returns the amount of time to wait before performing a
+// given retry, starting at one.
+func (rp *RetryPolicy) getBackoff(retry int) time.Duration {
+	backoff := float64(rp.InitialBackoff)
+	for i := 1; i < retry && backoff < float64(rp.MaximumBackoff); i++ {
+		backoff *= rp.BackoffMultiplier
+	}
+	if backoff > float64(rp.MaximumBackoff) {
+		backoff = float64(rp.MaximumBackoff)
+	}
+	if backoff < 2 {
+		return time.Duration(backoff)
+	}
+	return time.Duration(backoff) - time.Duration(random.FastThreadSafeGenerator.Int64N(int64(backoff)/2))
+}
+
+// getRetryAfter returns the amount of time the server asked the client
+// to wait through the Retry-After header of a response, which may
+// either contain a number of seconds or a date.
+func getRetryAfter(resp *http.Response, now time.Time) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package fetch
+
+import (
+	"context"
+	"log"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/proto/asset"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+)
+
+type revalidationKey struct{}
+
+// revalidation is attached to the context of requests forwarded by the
+// caching fetcher. It allows the fetcher performing the download to
+// reuse assets that are present in the asset store, but are older than
+// the request permits, if the upstream server indicates that the
+// resource has not changed since. It also allows the fetcher to report
+// the validators of the upstream resource, so that they can be stored
+// as part of the asset.
+type revalidation struct {
+	// Assets present in the asset store that are older than the
+	// request permits, keyed by URI. Only assets having validators
+	// are included.
+	staleAssets map[string]*asset.Asset
+
+	// Validators of the upstream resource from which the content of
+	// the response was obtained. Set by the fetcher performing the
+	// download, if the upstream server provided any.
+	upstreamValidators *asset.UpstreamValidators
+}
+
+func newContextWithRevalidation(ctx context.Context, r *revalidation) context.Context {
+	return context.WithValue(ctx, revalidationKey{}, r)
+}
+
+// getRevalidation returns the revalidation state attached to a context
+// by the caching fetcher, or nil if the request is not cached.
+func getRevalidation(ctx context.Context) *revalidation {
+	r, _ := ctx.Value(revalidationKey{}).(*revalidation)
+	return r
+}
+
+// getStaleAssets returns the assets attached to the context by the
+// caching fetcher that are older than the request permits. Only assets
+// whose contents are still present in the CAS can be reused.
+func getStaleAssets(ctx context.Context, contentAddressableStorage blobstore.BlobAccess, digestFunction bb_digest.Function, assetType asset.Asset_AssetType) map[string]staleAsset {
+	r := getRevalidation(ctx)
+	if r == nil {
+		return nil
+	}
+	staleAssets := map[string]staleAsset{}
+	digests := bb_digest.NewSetBuilder()
+	for uri, assetData := range r.staleAssets {
+		if assetData.Type != assetType {
+			continue
+		}
+		assetDigest, err := digestFunction.NewDigestFromProto(assetData.Digest)
+		if err != nil {
+			continue
+		}
+		staleAssets[uri] = staleAsset{
+			digest:             assetDigest,
+			upstreamValidators: assetData.UpstreamValidators,
+		}
+		digests.Add(assetDigest)
+	}
+	if len(staleAssets) == 0 {
+		return nil
+	}
+
+	missing, err := contentAddressableStorage.FindMissing(ctx, digests.Build())
+	if err != nil {
+		log.Printf("Failed to check for existence of stale assets: %v", err)
+		return nil
+	}
+	missingDigests := map[bb_digest.Digest]bool{}
+	for _, missingDigest := range missing.Items() {
+		missingDigests[missingDigest] = true
+	}
+	for uri, staleAsset := range staleAssets {
+		if missingDigests[staleAsset.digest] {
+			delete(staleAssets, uri)
+		}
+	}
+	return staleAssets
+}
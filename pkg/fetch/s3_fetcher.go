@@ -0,0 +1,346 @@
+package fetch
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/proto/asset"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/blobstore"
+	"github.com/buildbarn/bb-storage/pkg/blobstore/buffer"
+	"github.com/buildbarn/bb-storage/pkg/clock"
+	bb_digest "github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var s3BucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// S3Bucket contains the settings used to access one or more buckets
+// stored in an S3-compatible object store.
+type S3Bucket struct {
+	// Names of the buckets to which these settings apply. When
+	// empty, they apply to all buckets.
+	BucketNames []string
+
+	// URL of the object store (e.g., "https://minio.example.com").
+	// When empty, the AWS endpoint of the region is used.
+	Endpoint string
+
+	// Region of the buckets. Defaults to "us-east-1".
+	Region string
+
+	// Use path-style requests of the form
+	// https://endpoint/bucket/key, as opposed to requests of the
+	// form https://bucket.endpoint/key. Most S3-compatible object
+	// stores other than AWS require this.
+	PathStyle bool
+
+	// Credentials with which requests are signed. When nil, requests
+	// are sent anonymously, which only permits access to public
+	// buckets.
+	Credentials *S3Credentials
+}
+
+// S3FetcherOptions contains optional settings that alter the behaviour
+// of the S3 fetcher.
+type S3FetcherOptions struct {
+	// Settings of the buckets that may be accessed. For each
+	// request, the first entry matching the bucket is used. Requests
+	// for buckets not matching any entry are rejected.
+	Buckets []S3Bucket
+
+	// Storage for holding the contents of downloads, until they have
+	// been written into the CAS. When nil, small files are held in
+	// memory, while larger files are written to the system's
+	// temporary directory.
+	ScratchStorage *scratch.Storage
+}
+
+// s3Bucket is the processed form of S3Bucket.
+type s3Bucket struct {
+	bucketNames []string
+	endpoint    *url.URL
+	region      string
+	pathStyle   bool
+	credentials *S3Credentials
+}
+
+type s3Fetcher struct {
+	httpClient                *http.Client
+	contentAddressableStorage blobstore.BlobAccess
+	clock                     clock.Clock
+	buckets                   []s3Bucket
+	scratchStorage            *scratch.Storage
+}
+
+// NewS3Fetcher creates a Fetcher that downloads objects from
+// S3-compatible object stores, using URIs of the form s3://bucket/key.
+// Requests are signed with credentials of the server, meaning clients
+// don't need to provide pre-signed URLs. As the URIs remain the same
+// across requests, the resulting assets can be cached.
+//
+// The ETag of an object is stored as part of the asset. Requests for
+// assets that are older than the client permits are made conditional,
+// so that the object is only downloaded again if it has changed.
+func NewS3Fetcher(httpClient *http.Client, contentAddressableStorage blobstore.BlobAccess, clock clock.Clock, options S3FetcherOptions) (Fetcher, error) {
+	buckets := make([]s3Bucket, 0, len(options.Buckets))
+	for i, bucket := range options.Buckets {
+		region := bucket.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint := bucket.Endpoint
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid endpoint of bucket settings at index %d", i)
+		}
+		if (endpointURL.Scheme != "http" && endpointURL.Scheme != "https") || endpointURL.Host == "" || endpointURL.RawQuery != "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Endpoint %#v of bucket settings at index %d is not an HTTP or HTTPS URL without a query", endpoint, i)
+		}
+		buckets = append(buckets, s3Bucket{
+			bucketNames: bucket.BucketNames,
+			endpoint:    endpointURL,
+			region:      region,
+			pathStyle:   bucket.PathStyle,
+			credentials: bucket.Credentials,
+		})
+	}
+	scratchStorage := options.ScratchStorage
+	if scratchStorage == nil {
+		scratchStorage = scratch.NewDefaultStorage()
+	}
+	return &s3Fetcher{
+		httpClient:                httpClient,
+		contentAddressableStorage: contentAddressableStorage,
+		clock:                     clock,
+		buckets:                   buckets,
+		scratchStorage:            scratchStorage,
+	}, nil
+}
+
+// parseS3URI splits an s3:// URI into the name of the bucket and the
+// key of the object.
+func parseS3URI(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid URI")
+	}
+	if u.Scheme != "s3" {
+		return "", "", status.Errorf(codes.InvalidArgument, "URI has scheme %#v, while only \"s3\" is supported", u.Scheme)
+	}
+	if !s3BucketNamePattern.MatchString(u.Host) {
+		return "", "", status.Errorf(codes.InvalidArgument, "URI contains invalid bucket name %#v", u.Host)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", status.Error(codes.InvalidArgument, "URI may only contain a bucket name and a key")
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" {
+		return "", "", status.Error(codes.InvalidArgument, "URI does not contain a key")
+	}
+	return u.Host, key, nil
+}
+
+// getBucket returns the settings to use for a bucket.
+func (sf *s3Fetcher) getBucket(bucketName string) (*s3Bucket, error) {
+	for i := range sf.buckets {
+		bucket := &sf.buckets[i]
+		if len(bucket.bucketNames) == 0 || slices.Contains(bucket.bucketNames, bucketName) {
+			return bucket, nil
+		}
+	}
+	return nil, status.Errorf(codes.PermissionDenied, "Bucket %#v is not configured", bucketName)
+}
+
+// getObjectURL returns the URL of an object. Buckets whose names
+// contain dots are always accessed using path-style requests, as their
+// names cannot be used as part of host names covered by TLS
+// certificates of the object store.
+func (b *s3Bucket) getObjectURL(bucketName, key string) *url.URL {
+	u := *b.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if b.pathStyle || strings.Contains(bucketName, ".") {
+		p += "/" + bucketName
+	} else {
+		u.Host = bucketName + "." + u.Host
+	}
+	u.Path = p + "/" + key
+	u.RawPath = escapeS3Path(u.Path)
+	return &u
+}
+
+// s3Error is the body of error responses returned by S3.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// newS3StatusError converts an error response returned by S3 to a
+// gRPC status, including the error code and message provided by S3.
+func newS3StatusError(resp *http.Response) error {
+	code := codes.Internal
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		code = codes.PermissionDenied
+	}
+	var s3Err s3Error
+	if xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&s3Err) == nil && s3Err.Code != "" {
+		return status.Errorf(code, "HTTP request failed with status %#v: %s: %s", resp.Status, s3Err.Code, s3Err.Message)
+	}
+	return status.Errorf(code, "HTTP request failed with status %#v", resp.Status)
+}
+
+// getObject requests the contents of an object. If validators of a
+// previous download of the object are provided, the request is made
+// conditional.
+func (sf *s3Fetcher) getObject(ctx context.Context, uri string, upstreamValidators *asset.UpstreamValidators) (*http.Response, error) {
+	bucketName, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := sf.getBucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bucket.getObjectURL(bucketName, key).String(), nil)
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to create HTTP request")
+	}
+	if etag := upstreamValidators.GetEtag(); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if bucket.credentials != nil {
+		signS3Request(req, bucket.credentials, bucket.region, sf.clock.Now())
+	}
+	resp, err := sf.httpClient.Do(req)
+	if err != nil {
+		return nil, wrapDownloadError(ctx, err, "HTTP request failed")
+	}
+	if resp.StatusCode == http.StatusOK || (resp.StatusCode == http.StatusNotModified && upstreamValidators != nil) {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, newS3StatusError(resp)
+}
+
+func (sf *s3Fetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	digestFunction, err := getDigestFunction(req.DigestFunction, req.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := applyRequestTimeout(ctx, req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	checksum, err := getChecksumSri(req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	staleAssets := getStaleAssets(ctx, sf.contentAddressableStorage, digestFunction, asset.Asset_BLOB)
+
+	var lastErr error
+	for _, uri := range req.Uris {
+		result, err := sf.fetchBlob(ctx, uri, digestFunction, checksum, staleAssets)
+		if err != nil {
+			log.Printf("Error downloading blob with URI %s: %v", uri, err)
+			if result.checksumMismatch || ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		if r := getRevalidation(ctx); r != nil {
+			r.upstreamValidators = result.upstreamValidators
+		}
+		message := "Blob fetched successfully!"
+		if result.notModified {
+			message = "Blob has not been modified since it was last fetched"
+		}
+		return &remoteasset.FetchBlobResponse{
+			Status:     status.New(codes.OK, message).Proto(),
+			Uri:        uri,
+			Qualifiers: req.Qualifiers,
+			BlobDigest: result.digest.GetProto(),
+		}, nil
+	}
+	return nil, util.StatusWrapWithCode(lastErr, codes.NotFound, "Unable to download blob from any provided URI")
+}
+
+// fetchBlob downloads an object and writes it into the CAS. If the
+// object has not changed since it was last fetched, the stale asset is
+// returned instead.
+func (sf *s3Fetcher) fetchBlob(ctx context.Context, uri string, digestFunction bb_digest.Function, checksum *checksumSRI, staleAssets map[string]staleAsset) (downloadResult, error) {
+	staleAsset, hasStaleAsset := staleAssets[uri]
+	resp, err := sf.getObject(ctx, uri, staleAsset.upstreamValidators)
+	if err != nil {
+		return downloadResult{}, err
+	}
+	defer resp.Body.Close()
+	upstreamValidators := getUpstreamValidators(resp)
+	if resp.StatusCode == http.StatusNotModified && hasStaleAsset {
+		if upstreamValidators == nil {
+			upstreamValidators = staleAsset.upstreamValidators
+		}
+		return downloadResult{
+			digest:             staleAsset.digest,
+			upstreamValidators: upstreamValidators,
+			notModified:        true,
+		}, nil
+	}
+
+	content, err := sf.scratchStorage.NewFile(ctx, resp.ContentLength)
+	if err != nil {
+		return downloadResult{}, err
+	}
+	hasher := digestFunction.NewGenerator(resp.ContentLength)
+	verifier := checksum.newVerifier(resp.ContentLength)
+	if _, err := io.Copy(io.MultiWriter(content, hasher, verifier), resp.Body); err != nil {
+		closeDownloadedContent(content)
+		if status.Code(err) == codes.ResourceExhausted {
+			return downloadResult{}, err
+		}
+		return downloadResult{}, wrapDownloadError(ctx, err, "Failed to read response body")
+	}
+	if err := verifier.verify(); err != nil {
+		closeDownloadedContent(content)
+		return downloadResult{checksumMismatch: true}, err
+	}
+
+	blobDigest := hasher.Sum()
+	if err := sf.contentAddressableStorage.Put(ctx, blobDigest, buffer.NewValidatedBufferFromReaderAt(content, blobDigest.GetSizeBytes())); err != nil {
+		return downloadResult{}, util.StatusWrapWithCode(err, codes.Internal, "Failed to place blob into CAS")
+	}
+	return downloadResult{
+		digest:             blobDigest,
+		upstreamValidators: upstreamValidators,
+	}, nil
+}
+
+func (sf *s3Fetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	return nil, status.Error(codes.PermissionDenied, "Fetching of directories from S3 buckets is not supported")
+}
+
+func (sf *s3Fetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return qualifier.Difference(qualifiers, qualifier.NewSet([]string{"checksum.sri", "bazel.canonical_id"}))
+}
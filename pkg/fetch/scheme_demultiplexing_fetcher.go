@@ -0,0 +1,202 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type schemeDemultiplexingFetcher struct {
+	backends map[string]Fetcher
+}
+
+// NewSchemeDemultiplexingFetcher creates a Fetcher that forwards
+// requests to backends based on the scheme of their URIs (e.g., "https"
+// or "file"). If a request contains URIs having schemes that are
+// handled by different backends, the backends are attempted in the
+// order in which their URIs first appear in the request. Every backend
+// only receives the URIs it handles. URIs having a scheme for which no
+// backend exists are ignored.
+func NewSchemeDemultiplexingFetcher(backends map[string]Fetcher) Fetcher {
+	lowercaseBackends := make(map[string]Fetcher, len(backends))
+	for scheme, backend := range backends {
+		lowercaseBackends[strings.ToLower(scheme)] = backend
+	}
+	return &schemeDemultiplexingFetcher{
+		backends: lowercaseBackends,
+	}
+}
+
+// uriGroup contains the URIs of a request that are handled by a single
+// backend.
+type uriGroup struct {
+	backend Fetcher
+	uris    []string
+	// Indices of the URIs in the original request.
+	indices []int
+}
+
+func (sf *schemeDemultiplexingFetcher) groupURIs(uris []string) ([]*uriGroup, error) {
+	var groups []*uriGroup
+	groupsByBackend := map[Fetcher]*uriGroup{}
+	unsupportedSchemes := map[string]struct{}{}
+	for i, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URI %#v", uri)
+		}
+		scheme := strings.ToLower(u.Scheme)
+		backend, ok := sf.backends[scheme]
+		if !ok {
+			unsupportedSchemes[scheme] = struct{}{}
+			continue
+		}
+		group, ok := groupsByBackend[backend]
+		if !ok {
+			group = &uriGroup{backend: backend}
+			groupsByBackend[backend] = group
+			groups = append(groups, group)
+		}
+		group.uris = append(group.uris, uri)
+		group.indices = append(group.indices, i)
+	}
+	if len(groups) == 0 {
+		schemes := make([]string, 0, len(unsupportedSchemes))
+		for scheme := range unsupportedSchemes {
+			schemes = append(schemes, scheme)
+		}
+		sort.Strings(schemes)
+		return nil, status.Errorf(codes.InvalidArgument, "No backend is configured for URIs with scheme %s", strings.Join(schemes, ", "))
+	}
+	return groups, nil
+}
+
+// getGroupQualifiers returns the qualifiers of a request to forward to
+// the backend of a group of URIs. Per-URI headers refer to URIs by
+// their index in the request, meaning they need to be renumbered.
+// Headers for URIs that are not part of the group are dropped.
+func getGroupQualifiers(group *uriGroup, uriCount int, qualifiers []*remoteasset.Qualifier) ([]*remoteasset.Qualifier, error) {
+	groupIndices := make(map[int]int, len(group.indices))
+	for j, i := range group.indices {
+		groupIndices[i] = j
+	}
+	groupQualifiers := make([]*remoteasset.Qualifier, 0, len(qualifiers))
+	for _, q := range qualifiers {
+		if !strings.HasPrefix(q.Name, QualifierHTTPHeaderURLPrefix) {
+			groupQualifiers = append(groupQualifiers, q)
+			continue
+		}
+		uriIdx, header, err := parseHTTPHeaderURLQualifier(q.Name, uriCount)
+		if err != nil {
+			return nil, err
+		}
+		if j, ok := groupIndices[uriIdx]; ok {
+			groupQualifiers = append(groupQualifiers, &remoteasset.Qualifier{
+				Name:  fmt.Sprintf("%s%d:%s", QualifierHTTPHeaderURLPrefix, j, header),
+				Value: q.Value,
+			})
+		}
+	}
+	return groupQualifiers, nil
+}
+
+// checkGroupQualifiers returns an error if the backend of a group of
+// URIs does not support all qualifiers of a request, as only the
+// qualifiers unsupported by all backends are rejected up front.
+func checkGroupQualifiers(group *uriGroup, qualifiers []*remoteasset.Qualifier) error {
+	if unsupported := group.backend.CheckQualifiers(qualifier.QualifiersToSet(qualifiers)); !unsupported.IsEmpty() {
+		names := make([]string, 0, len(unsupported))
+		for name := range unsupported {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return status.Errorf(codes.InvalidArgument, "Backend for URIs %s does not support qualifiers %s", strings.Join(group.uris, ", "), strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func (sf *schemeDemultiplexingFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	groups, err := sf.groupURIs(req.Uris)
+	if err != nil {
+		return nil, err
+	}
+	groupQualifiers := make([][]*remoteasset.Qualifier, 0, len(groups))
+	for _, group := range groups {
+		qualifiers, err := getGroupQualifiers(group, len(req.Uris), req.Qualifiers)
+		if err != nil {
+			return nil, err
+		}
+		groupQualifiers = append(groupQualifiers, qualifiers)
+	}
+	for i, group := range groups {
+		if err = checkGroupQualifiers(group, groupQualifiers[i]); err == nil {
+			groupReq := proto.Clone(req).(*remoteasset.FetchBlobRequest)
+			groupReq.Uris = group.uris
+			groupReq.Qualifiers = groupQualifiers[i]
+			var resp *remoteasset.FetchBlobResponse
+			if resp, err = group.backend.FetchBlob(ctx, groupReq); err == nil {
+				resp.Qualifiers = restoreQualifiers(req.Qualifiers, groupQualifiers[i], resp.Qualifiers)
+				return resp, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Error fetching blob with URIs %s: %v", strings.Join(group.uris, ", "), err)
+	}
+	return nil, err
+}
+
+func (sf *schemeDemultiplexingFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	groups, err := sf.groupURIs(req.Uris)
+	if err != nil {
+		return nil, err
+	}
+	groupQualifiers := make([][]*remoteasset.Qualifier, 0, len(groups))
+	for _, group := range groups {
+		qualifiers, err := getGroupQualifiers(group, len(req.Uris), req.Qualifiers)
+		if err != nil {
+			return nil, err
+		}
+		groupQualifiers = append(groupQualifiers, qualifiers)
+	}
+	for i, group := range groups {
+		if err = checkGroupQualifiers(group, groupQualifiers[i]); err == nil {
+			groupReq := proto.Clone(req).(*remoteasset.FetchDirectoryRequest)
+			groupReq.Uris = group.uris
+			groupReq.Qualifiers = groupQualifiers[i]
+			var resp *remoteasset.FetchDirectoryResponse
+			if resp, err = group.backend.FetchDirectory(ctx, groupReq); err == nil {
+				resp.Qualifiers = restoreQualifiers(req.Qualifiers, groupQualifiers[i], resp.Qualifiers)
+				return resp, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Error fetching directory with URIs %s: %v", strings.Join(group.uris, ", "), err)
+	}
+	return nil, err
+}
+
+// CheckQualifiers returns the qualifiers that are not supported by any
+// of the backends. Whether the backend handling a given URI supports
+// the qualifiers is checked when the request is processed.
+func (sf *schemeDemultiplexingFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	unsupported := qualifiers
+	for _, backend := range sf.backends {
+		unsupported = qualifier.Intersection(unsupported, backend.CheckQualifiers(qualifiers))
+	}
+	return unsupported
+}
@@ -0,0 +1,165 @@
+package fetch_test
+
+import (
+	"context"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSchemeDemultiplexingFetcherFetchBlob(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	httpFetcher := mock.NewMockFetcher(ctrl)
+	fileFetcher := mock.NewMockFetcher(ctrl)
+	fetcher := fetch.NewSchemeDemultiplexingFetcher(map[string]fetch.Fetcher{
+		"http":  httpFetcher,
+		"HTTPS": httpFetcher,
+		"file":  fileFetcher,
+	})
+	response := &remoteasset.FetchBlobResponse{
+		Status: status.New(codes.OK, "Blob fetched successfully!").Proto(),
+		Uri:    "file:///mirror/foo.tar.gz",
+	}
+
+	t.Run("SingleBackend", func(t *testing.T) {
+		fileFetcher.EXPECT().CheckQualifiers(qualifier.NewSet(nil)).Return(qualifier.NewSet(nil))
+		fileFetcher.EXPECT().FetchBlob(ctx, testutil.EqProto(t, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file:///mirror/foo.tar.gz"},
+		})).Return(response, nil)
+
+		actualResponse, err := fetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file:///mirror/foo.tar.gz"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("FallbackToNextBackend", func(t *testing.T) {
+		// URIs are grouped by backend, where backends are
+		// attempted in the order in which their URIs first appear.
+		qualifiers := []*remoteasset.Qualifier{{Name: "checksum.sri", Value: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}}
+		httpFetcher.EXPECT().CheckQualifiers(qualifier.QualifiersToSet(qualifiers)).Return(qualifier.NewSet(nil))
+		httpCall := httpFetcher.EXPECT().FetchBlob(ctx, testutil.EqProto(t, &remoteasset.FetchBlobRequest{
+			Uris:       []string{"https://example.com/foo.tar.gz", "http://example.com/foo.tar.gz"},
+			Qualifiers: qualifiers,
+		})).Return(nil, status.Error(codes.NotFound, "Unable to download blob from any provided URI"))
+		fileFetcher.EXPECT().CheckQualifiers(qualifier.QualifiersToSet(qualifiers)).Return(qualifier.NewSet(nil))
+		fileFetcher.EXPECT().FetchBlob(ctx, testutil.EqProto(t, &remoteasset.FetchBlobRequest{
+			Uris:       []string{"file:///mirror/foo.tar.gz"},
+			Qualifiers: qualifiers,
+		})).Return(response, nil).After(httpCall)
+
+		actualResponse, err := fetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{
+				"https://example.com/foo.tar.gz",
+				"file:///mirror/foo.tar.gz",
+				"http://example.com/foo.tar.gz",
+				"ftp://example.com/foo.tar.gz",
+			},
+			Qualifiers: qualifiers,
+		})
+		require.NoError(t, err)
+		require.Equal(t, response, actualResponse)
+	})
+
+	t.Run("PerURIHeaders", func(t *testing.T) {
+		// Per-URI headers refer to URIs by their index, meaning
+		// they must be renumbered for the URIs of each backend.
+		fileQualifiers := []*remoteasset.Qualifier{
+			{Name: "http_header_url:0:X-File", Value: "file"},
+		}
+		fileFetcher.EXPECT().CheckQualifiers(qualifier.QualifiersToSet(fileQualifiers)).Return(qualifier.NewSet(nil))
+		fileCall := fileFetcher.EXPECT().FetchBlob(ctx, testutil.EqProto(t, &remoteasset.FetchBlobRequest{
+			Uris:       []string{"file:///mirror/foo.tar.gz"},
+			Qualifiers: fileQualifiers,
+		})).Return(nil, status.Error(codes.NotFound, "File not found"))
+		httpQualifiers := []*remoteasset.Qualifier{
+			{Name: "http_header_url:0:Authorization", Value: "Bearer x"},
+			{Name: "http_header_url:1:Authorization", Value: "Bearer y"},
+		}
+		httpFetcher.EXPECT().CheckQualifiers(qualifier.QualifiersToSet(httpQualifiers)).Return(qualifier.NewSet(nil))
+		httpFetcher.EXPECT().FetchBlob(ctx, testutil.EqProto(t, &remoteasset.FetchBlobRequest{
+			Uris:       []string{"https://x.example.com/foo.tar.gz", "https://y.example.com/foo.tar.gz"},
+			Qualifiers: httpQualifiers,
+		})).Return(&remoteasset.FetchBlobResponse{
+			Status:     status.New(codes.OK, "Blob fetched successfully!").Proto(),
+			Uri:        "https://y.example.com/foo.tar.gz",
+			Qualifiers: httpQualifiers,
+		}, nil).After(fileCall)
+
+		request := &remoteasset.FetchBlobRequest{
+			Uris: []string{
+				"file:///mirror/foo.tar.gz",
+				"https://x.example.com/foo.tar.gz",
+				"https://y.example.com/foo.tar.gz",
+			},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "http_header_url:1:Authorization", Value: "Bearer x"},
+				{Name: "http_header_url:2:Authorization", Value: "Bearer y"},
+				{Name: "http_header_url:0:X-File", Value: "file"},
+			},
+		}
+		actualResponse, err := fetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		// The response should contain the qualifiers of the
+		// original request.
+		require.Equal(t, request.Qualifiers, actualResponse.Qualifiers)
+	})
+
+	t.Run("PerURIHeaderOutOfRange", func(t *testing.T) {
+		_, err := fetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"file:///mirror/foo.tar.gz"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "http_header_url:1:Authorization", Value: "Bearer x"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Invalid http_header_url qualifier: http_header_url:1:Authorization: URL index out of range: 1"), err)
+	})
+
+	t.Run("UnsupportedQualifier", func(t *testing.T) {
+		// Backends that don't support all qualifiers of the
+		// request are skipped.
+		qualifiers := []*remoteasset.Qualifier{{Name: "http_header:Accept", Value: "application/gzip"}}
+		fileFetcher.EXPECT().CheckQualifiers(qualifier.QualifiersToSet(qualifiers)).Return(qualifier.NewSet([]string{"http_header:Accept"}))
+
+		_, err := fetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris:       []string{"file:///mirror/foo.tar.gz"},
+			Qualifiers: qualifiers,
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Backend for URIs file:///mirror/foo.tar.gz does not support qualifiers http_header:Accept"), err)
+	})
+
+	t.Run("UnsupportedScheme", func(t *testing.T) {
+		_, err := fetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"ftp://example.com/foo.tar.gz", "s3://bucket/foo.tar.gz"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "No backend is configured for URIs with scheme ftp, s3"), err)
+	})
+}
+
+func TestSchemeDemultiplexingFetcherCheckQualifiers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	httpFetcher := mock.NewMockFetcher(ctrl)
+	fileFetcher := mock.NewMockFetcher(ctrl)
+	fetcher := fetch.NewSchemeDemultiplexingFetcher(map[string]fetch.Fetcher{
+		"https": httpFetcher,
+		"file":  fileFetcher,
+	})
+
+	// Only qualifiers that are unsupported by all backends are
+	// rejected.
+	qualifiers := qualifier.NewSet([]string{"checksum.sri", "http_header:Accept", "unknown"})
+	httpFetcher.EXPECT().CheckQualifiers(qualifiers).Return(qualifier.NewSet([]string{"unknown"}))
+	fileFetcher.EXPECT().CheckQualifiers(qualifiers).Return(qualifier.NewSet([]string{"http_header:Accept", "unknown"}))
+	require.Equal(t, qualifier.NewSet([]string{"unknown"}), fetcher.CheckQualifiers(qualifiers))
+}
@@ -0,0 +1,185 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-remote-asset/pkg/storage"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// inflightFetch is a fetch that is being performed on behalf of one or
+// more callers.
+type inflightFetch[T proto.Message] struct {
+	done     chan struct{}
+	response T
+	err      error
+	waiters  int
+	cancel   context.CancelFunc
+	// Revalidation state of the fetch, if the caller that started it
+	// provided one. The validators reported by the backend are
+	// shared with all callers, so that each of them stores them as
+	// part of the asset.
+	revalidation *revalidation
+}
+
+// singleflightGroup keeps track of the fetches that are in flight for a
+// single type of response, indexed by a key describing the request.
+type singleflightGroup[T proto.Message] struct {
+	lock    sync.Mutex
+	fetches map[string]*inflightFetch[T]
+}
+
+// do calls fn, unless a call with the same key is already in flight, in
+// which case its result is awaited instead. fn is called with a context
+// that is only cancelled once all callers have given up waiting, so that
+// a single caller going away does not affect the others.
+//
+// Stale assets provided by the caching fetcher of the caller that
+// starts the fetch are used. As all callers use the same key, these
+// are obtained from the same entries in the asset store.
+func (g *singleflightGroup[T]) do(ctx context.Context, key string, fn func(context.Context) (T, error)) (T, error) {
+	g.lock.Lock()
+	fetch, ok := g.fetches[key]
+	if !ok {
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		fetch = &inflightFetch[T]{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		if r := getRevalidation(ctx); r != nil {
+			fetch.revalidation = &revalidation{staleAssets: r.staleAssets}
+			fetchCtx = newContextWithRevalidation(fetchCtx, fetch.revalidation)
+		}
+		g.fetches[key] = fetch
+		go func() {
+			fetch.response, fetch.err = fn(fetchCtx)
+			g.lock.Lock()
+			if g.fetches[key] == fetch {
+				delete(g.fetches, key)
+			}
+			g.lock.Unlock()
+			cancel()
+			close(fetch.done)
+		}()
+	}
+	fetch.waiters++
+	g.lock.Unlock()
+
+	select {
+	case <-fetch.done:
+		if r := getRevalidation(ctx); r != nil && fetch.revalidation != nil {
+			r.upstreamValidators = fetch.revalidation.upstreamValidators
+		}
+		return fetch.response, fetch.err
+	case <-ctx.Done():
+		g.lock.Lock()
+		fetch.waiters--
+		if fetch.waiters == 0 {
+			// Nobody is interested in the result anymore.
+			// Prevent new callers from joining a fetch that is
+			// being cancelled.
+			fetch.cancel()
+			if g.fetches[key] == fetch {
+				delete(g.fetches, key)
+			}
+		}
+		g.lock.Unlock()
+		var zero T
+		return zero, util.StatusFromContext(ctx)
+	}
+}
+
+type singleflightFetcher struct {
+	fetcher     Fetcher
+	blobs       singleflightGroup[*remoteasset.FetchBlobResponse]
+	directories singleflightGroup[*remoteasset.FetchDirectoryResponse]
+}
+
+// NewSingleflightFetcher creates a decorator for Fetcher implementations
+// that collapses concurrent identical requests into a single fetch,
+// whose result is shared by all callers. Requests are considered
+// identical if they refer to the same set of URIs and stable
+// qualifiers, using the same instance name and digest function.
+func NewSingleflightFetcher(fetcher Fetcher) Fetcher {
+	return &singleflightFetcher{
+		fetcher: fetcher,
+		blobs: singleflightGroup[*remoteasset.FetchBlobResponse]{
+			fetches: map[string]*inflightFetch[*remoteasset.FetchBlobResponse]{},
+		},
+		directories: singleflightGroup[*remoteasset.FetchDirectoryResponse]{
+			fetches: map[string]*inflightFetch[*remoteasset.FetchDirectoryResponse]{},
+		},
+	}
+}
+
+// getSingleflightKey computes the key under which identical requests
+// are collapsed, based on the normalized asset reference of the request.
+func getSingleflightKey(instanceName string, digestFunction fmt.Stringer, uris []string, qualifiers []*remoteasset.Qualifier) (string, error) {
+	// NewAssetReference sorts its arguments in place, so provide
+	// it with a copy to leave the request untouched.
+	ref := storage.NewAssetReference(append([]string(nil), uris...), removeVolatileQualifiers(qualifiers))
+	marshaled, err := proto.MarshalOptions{Deterministic: true}.Marshal(ref)
+	if err != nil {
+		return "", util.StatusWrapWithCode(err, codes.Internal, "Failed to marshal asset reference")
+	}
+	return fmt.Sprintf("%#v %s %s", instanceName, digestFunction, marshaled), nil
+}
+
+func (sf *singleflightFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	key, err := getSingleflightKey(req.InstanceName, req.DigestFunction, req.Uris, req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	response, err := sf.blobs.do(ctx, key, func(ctx context.Context) (*remoteasset.FetchBlobResponse, error) {
+		response, err := sf.fetcher.FetchBlob(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		// Only retain the qualifiers added by the backend, as
+		// the qualifiers of the request differ between callers.
+		response.Qualifiers = restoreQualifiers(nil, req.Qualifiers, response.Qualifiers)
+		return response, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The response is shared with other callers, whose volatile
+	// qualifiers may differ.
+	response = proto.Clone(response).(*remoteasset.FetchBlobResponse)
+	response.Qualifiers = restoreQualifiers(req.Qualifiers, nil, response.Qualifiers)
+	return response, nil
+}
+
+func (sf *singleflightFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	key, err := getSingleflightKey(req.InstanceName, req.DigestFunction, req.Uris, req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	response, err := sf.directories.do(ctx, key, func(ctx context.Context) (*remoteasset.FetchDirectoryResponse, error) {
+		response, err := sf.fetcher.FetchDirectory(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		// Only retain the qualifiers added by the backend, as
+		// the qualifiers of the request differ between callers.
+		response.Qualifiers = restoreQualifiers(nil, req.Qualifiers, response.Qualifiers)
+		return response, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	response = proto.Clone(response).(*remoteasset.FetchDirectoryResponse)
+	response.Qualifiers = restoreQualifiers(req.Qualifiers, nil, response.Qualifiers)
+	return response, nil
+}
+
+func (sf *singleflightFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return sf.fetcher.CheckQualifiers(qualifiers)
+}
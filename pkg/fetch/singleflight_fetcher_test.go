@@ -0,0 +1,262 @@
+package fetch_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-remote-asset/pkg/proto/asset"
+	"github.com/buildbarn/bb-storage/pkg/digest"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSingleflightFetcherFetchBlob(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	baseFetcher := mock.NewMockFetcher(ctrl)
+	singleflightFetcher := fetch.NewSingleflightFetcher(baseFetcher)
+
+	blobDigest := &remoteexecution.Digest{Hash: "d0d829c4c0ce64787cb1c998a9c29a109f8ed005633132fda4f29982487b04db", SizeBytes: 123}
+	response := &remoteasset.FetchBlobResponse{
+		Status:     status.New(codes.OK, "Success!").Proto(),
+		Uri:        "https://example.com/a",
+		BlobDigest: blobDigest,
+	}
+
+	t.Run("Collapsed", func(t *testing.T) {
+		// Requests with the URIs in a different order and with
+		// different volatile qualifiers should be collapsed.
+		requests := []*remoteasset.FetchBlobRequest{
+			{
+				Uris: []string{"https://example.com/a", "https://example.com/b"},
+				Qualifiers: []*remoteasset.Qualifier{
+					{Name: "bazel.auth_headers", Value: "{}"},
+				},
+			},
+			{
+				Uris: []string{"https://example.com/b", "https://example.com/a"},
+			},
+		}
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		baseFetcher.EXPECT().FetchBlob(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+				close(started)
+				<-release
+				return response, nil
+			})
+
+		var wg sync.WaitGroup
+		responses := make([]*remoteasset.FetchBlobResponse, len(requests))
+		errs := make([]error, len(requests))
+		for i, request := range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				responses[i], errs[i] = singleflightFetcher.FetchBlob(ctx, request)
+			}()
+			if i == 0 {
+				<-started
+			}
+		}
+		// Give the second caller the opportunity to join the
+		// fetch that is in flight.
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		for i, request := range requests {
+			require.NoError(t, errs[i])
+			require.True(t, proto.Equal(blobDigest, responses[i].BlobDigest))
+			require.Equal(t, request.Qualifiers, responses[i].Qualifiers)
+		}
+		// The request's URIs must not be reordered.
+		require.Equal(t, []string{"https://example.com/b", "https://example.com/a"}, requests[1].Uris)
+	})
+
+	t.Run("CallerCancelled", func(t *testing.T) {
+		request := &remoteasset.FetchBlobRequest{
+			Uris: []string{"https://example.com/a"},
+		}
+		started := make(chan struct{})
+		release := make(chan struct{})
+		baseFetcher.EXPECT().FetchBlob(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+				close(started)
+				<-release
+				// The fetch must not have been cancelled by the
+				// first caller going away.
+				require.NoError(t, ctx.Err())
+				return response, nil
+			})
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		errs := make(chan error, 1)
+		go func() {
+			_, err := singleflightFetcher.FetchBlob(cancelledCtx, request)
+			errs <- err
+		}()
+		<-started
+
+		done := make(chan struct{})
+		var secondResponse *remoteasset.FetchBlobResponse
+		var secondErr error
+		go func() {
+			defer close(done)
+			secondResponse, secondErr = singleflightFetcher.FetchBlob(ctx, request)
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		cancel()
+		testutil.RequireEqualStatus(t, status.Error(codes.Canceled, "context canceled"), <-errs)
+		close(release)
+		<-done
+		require.NoError(t, secondErr)
+		require.True(t, proto.Equal(blobDigest, secondResponse.BlobDigest))
+	})
+
+	t.Run("AllCallersCancelled", func(t *testing.T) {
+		request := &remoteasset.FetchBlobRequest{
+			Uris: []string{"https://example.com/a"},
+		}
+		fetchCancelled := make(chan struct{})
+		baseFetcher.EXPECT().FetchBlob(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+				<-ctx.Done()
+				close(fetchCancelled)
+				return nil, status.Error(codes.Canceled, "context canceled")
+			})
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		errs := make(chan error, 1)
+		go func() {
+			_, err := singleflightFetcher.FetchBlob(cancelledCtx, request)
+			errs <- err
+		}()
+		cancel()
+		testutil.RequireEqualStatus(t, status.Error(codes.Canceled, "context canceled"), <-errs)
+		<-fetchCancelled
+	})
+}
+
+func TestSingleflightFetcherFetchBlobRevalidation(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	// Callers that join a fetch in flight must store the validators
+	// of the upstream resource as part of the asset as well, instead
+	// of overwriting the asset stored by the first caller.
+	assetStore := mock.NewMockAssetStore(ctrl)
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	roundTripper := mock.NewMockRoundTripper(ctrl)
+	fetcher := fetch.NewCachingFetcher(
+		fetch.NewSingleflightFetcher(
+			fetch.NewHTTPFetcher(&http.Client{Transport: roundTripper}, casBlobAccess, fetch.HTTPFetcherOptions{})),
+		assetStore)
+
+	request := &remoteasset.FetchBlobRequest{
+		Uris: []string{"https://example.com/file"},
+	}
+	assetStore.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, status.Error(codes.NotFound, "Asset not found")).
+		Times(2)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		close(started)
+		<-release
+		return &http.Response{
+			Status:        "200 Success",
+			StatusCode:    200,
+			Header:        http.Header{"Etag": []string{`"v1"`}},
+			Body:          io.NopCloser(bytes.NewBuffer([]byte(TestData))),
+			ContentLength: int64(len(TestData)),
+		}, nil
+	})
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	assetStore.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, ref *asset.AssetReference, data *asset.Asset, digestFunction digest.Function) error {
+			require.Equal(t, `"v1"`, data.UpstreamValidators.GetEtag())
+			return nil
+		}).Times(2)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = fetcher.FetchBlob(ctx, request)
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	// Give the second caller the opportunity to join the fetch
+	// that is in flight.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestSingleflightFetcherFetchDirectoryBackendQualifiers(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	// Qualifiers added to the response by the backend, such as the
+	// commit to which the git fetcher resolved HEAD, must be
+	// returned to the client. They must not become part of the key
+	// under which the asset is stored, as subsequent requests would
+	// otherwise not be served from the asset store.
+	repositories := newGitRepositories(t)
+	project := repositories.newWorkTree()
+	commitID := repositories.commit(project, map[string]string{"README": "Hello"})
+	projectURL := repositories.publish(project, "project.git")
+
+	casBlobAccess := mock.NewMockBlobAccess(ctrl)
+	fetcher := fetch.NewCachingFetcher(
+		fetch.NewSingleflightFetcher(
+			fetch.NewGitFetcher(http.DefaultClient, casBlobAccess, fetch.GitFetcherOptions{
+				CheckoutLimits: archive.Limits{
+					MaximumExtractedSizeBytes: 1 << 20,
+					MaximumEntries:            100,
+				},
+			})),
+		newInMemoryAssetStore(t, ctrl))
+	casBlobAccess.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	request := &remoteasset.FetchDirectoryRequest{
+		Uris: []string{projectURL},
+		Qualifiers: []*remoteasset.Qualifier{
+			{Name: "resource_type", Value: "application/x-git"},
+			{Name: "http_header:Accept", Value: "*/*"},
+		},
+	}
+	response, err := fetcher.FetchDirectory(ctx, request)
+	require.NoError(t, err)
+	require.Len(t, response.Qualifiers, 3)
+	testutil.RequireEqualProto(t, &remoteasset.Qualifier{Name: "resource_type", Value: "application/x-git"}, response.Qualifiers[0])
+	testutil.RequireEqualProto(t, &remoteasset.Qualifier{Name: "http_header:Accept", Value: "*/*"}, response.Qualifiers[1])
+	testutil.RequireEqualProto(t, &remoteasset.Qualifier{Name: "vcs.commit", Value: commitID}, response.Qualifiers[2])
+
+	cachedResponse, err := fetcher.FetchDirectory(ctx, request)
+	require.NoError(t, err)
+	require.Equal(t, "Directory fetched successfully from asset cache", cachedResponse.Status.Message)
+	testutil.RequireEqualProto(t, response.RootDirectoryDigest, cachedResponse.RootDirectoryDigest)
+}
@@ -0,0 +1,160 @@
+package fetch
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// URLRewrite is a rule that rewrites URLs matching a regular expression
+// to zero or more replacement URLs, similar to the 'rewrite' directive
+// of Bazel's --downloader_config.
+type URLRewrite struct {
+	// Regular expression that must match the entire URL, excluding
+	// its scheme (e.g., "github.com/(.*)").
+	Pattern string
+	// Replacement URLs, which may refer to capture groups of the
+	// pattern (e.g., "mirror.example.com/github/${1}"). Replacements
+	// without a scheme use the scheme of the original URL.
+	Replacements []string
+}
+
+type compiledURLRewrite struct {
+	pattern      *regexp.Regexp
+	replacements []string
+}
+
+// URLRewriter applies rules similar to the ones supported by Bazel's
+// --downloader_config to the URIs of fetch requests. URIs may be
+// rewritten to point to internal mirrors, and hosts may be blocked.
+type URLRewriter struct {
+	rewrites          []compiledURLRewrite
+	allowedHosts      map[string]bool
+	blockedHosts      map[string]bool
+	allBlockedMessage string
+}
+
+// NewURLRewriter creates a URLRewriter. Like Bazel, a URL is replaced
+// by the replacements of all rules whose pattern matches, in the order
+// in which the rules are provided. URLs not matching any rule are left
+// intact. Afterwards, URLs of blocked hosts are removed. Allowed and
+// blocked hosts also match their subdomains. The host "*" may be used
+// to block all hosts, except the ones that are explicitly allowed.
+func NewURLRewriter(rewrites []URLRewrite, allowedHosts, blockedHosts []string, allBlockedMessage string) (*URLRewriter, error) {
+	ur := &URLRewriter{
+		allowedHosts:      map[string]bool{},
+		blockedHosts:      map[string]bool{},
+		allBlockedMessage: allBlockedMessage,
+	}
+	for _, rewrite := range rewrites {
+		pattern, err := regexp.Compile("^(?:" + rewrite.Pattern + ")$")
+		if err != nil {
+			return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid rewrite pattern %#v", rewrite.Pattern)
+		}
+		ur.rewrites = append(ur.rewrites, compiledURLRewrite{
+			pattern:      pattern,
+			replacements: rewrite.Replacements,
+		})
+	}
+	for _, host := range allowedHosts {
+		ur.allowedHosts[strings.ToLower(host)] = true
+	}
+	for _, host := range blockedHosts {
+		ur.blockedHosts[strings.ToLower(host)] = true
+	}
+	return ur, nil
+}
+
+// RewrittenURI is a URI produced by the URLRewriter, together with the
+// index of the URI in the original request from which it was derived.
+type RewrittenURI struct {
+	URI         string
+	SourceIndex int
+}
+
+// containsHost returns whether a set of hosts contains a host or any of
+// its parent domains. Like Bazel, entries of the allow and block lists
+// apply to subdomains as well.
+func containsHost(hosts map[string]bool, host string) bool {
+	for {
+		if hosts[host] {
+			return true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			return false
+		}
+		host = parent
+	}
+}
+
+// isBlocked returns whether a URL is blocked. Allowed hosts take
+// precedence over blocked hosts.
+func (ur *URLRewriter) isBlocked(uri *url.URL) bool {
+	host := strings.ToLower(uri.Hostname())
+	if containsHost(ur.allowedHosts, host) {
+		return false
+	}
+	return containsHost(ur.blockedHosts, host) || ur.blockedHosts["*"]
+}
+
+// Rewrite applies the rewrite rules to a list of URIs, removing URIs of
+// blocked hosts and duplicates.
+func (ur *URLRewriter) Rewrite(uris []string) ([]RewrittenURI, error) {
+	var rewritten []RewrittenURI
+	seen := map[string]bool{}
+	for i, uri := range uris {
+		for _, candidate := range ur.rewriteURI(uri) {
+			parsed, err := url.Parse(candidate)
+			if err != nil {
+				return nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid URI %#v", candidate)
+			}
+			if ur.isBlocked(parsed) {
+				continue
+			}
+			if !seen[candidate] {
+				seen[candidate] = true
+				rewritten = append(rewritten, RewrittenURI{URI: candidate, SourceIndex: i})
+			}
+		}
+	}
+	if len(rewritten) == 0 {
+		if ur.allBlockedMessage != "" {
+			return nil, status.Error(codes.PermissionDenied, ur.allBlockedMessage)
+		}
+		return nil, status.Errorf(codes.PermissionDenied, "All URIs are blocked: %s", strings.Join(uris, ", "))
+	}
+	return rewritten, nil
+}
+
+// rewriteURI applies all rewrite rules matching a URI.
+func (ur *URLRewriter) rewriteURI(uri string) []string {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return []string{uri}
+	}
+	var results []string
+	matched := false
+	for _, rewrite := range ur.rewrites {
+		if !rewrite.pattern.MatchString(rest) {
+			continue
+		}
+		matched = true
+		for _, replacement := range rewrite.replacements {
+			result := rewrite.pattern.ReplaceAllString(rest, replacement)
+			if !strings.Contains(result, "://") {
+				result = scheme + "://" + result
+			}
+			results = append(results, result)
+		}
+	}
+	if !matched {
+		return []string{uri}
+	}
+	return results
+}
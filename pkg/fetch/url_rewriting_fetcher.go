@@ -0,0 +1,205 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type urlRewritingFetcher struct {
+	fetcher  Fetcher
+	rewriter *URLRewriter
+}
+
+// NewURLRewritingFetcher creates a decorator for Fetcher implementations
+// that applies a URLRewriter to the URIs of requests before they are
+// forwarded. Headers provided by the client are only retained for
+// rewritten URIs that refer to the same host, so that credentials are
+// not sent to mirrors.
+func NewURLRewritingFetcher(fetcher Fetcher, rewriter *URLRewriter) Fetcher {
+	return &urlRewritingFetcher{
+		fetcher:  fetcher,
+		rewriter: rewriter,
+	}
+}
+
+func (rf *urlRewritingFetcher) rewrite(uris []string, qualifiers []*remoteasset.Qualifier) ([]string, []*remoteasset.Qualifier, error) {
+	rewritten, err := rf.rewriter.Rewrite(uris)
+	if err != nil {
+		return nil, nil, err
+	}
+	newURIs := make([]string, 0, len(rewritten))
+	for _, r := range rewritten {
+		newURIs = append(newURIs, r.URI)
+	}
+
+	// Determine which of the rewritten URIs may inherit the per-URI
+	// headers of the URI from which they were derived.
+	inherits := make([]bool, len(rewritten))
+	for j, r := range rewritten {
+		inherits[j] = r.URI == uris[r.SourceIndex] || sameHost(r.URI, uris[r.SourceIndex])
+	}
+
+	// Per-URI headers take precedence over global headers. Record
+	// which ones are provided, so that global headers converted to
+	// per-URI headers do not override them.
+	type perURIHeader struct {
+		sourceIndex int
+		header      string
+	}
+	perURIHeaders := map[perURIHeader]struct{}{}
+	for _, q := range qualifiers {
+		if strings.HasPrefix(q.Name, QualifierHTTPHeaderURLPrefix) {
+			sourceIndex, header, err := parseHTTPHeaderURLQualifier(q.Name, len(uris))
+			if err != nil {
+				return nil, nil, err
+			}
+			perURIHeaders[perURIHeader{sourceIndex: sourceIndex, header: header}] = struct{}{}
+		}
+	}
+
+	newQualifiers := make([]*remoteasset.Qualifier, 0, len(qualifiers))
+	for _, q := range qualifiers {
+		switch {
+		case strings.HasPrefix(q.Name, QualifierHTTPHeaderURLPrefix):
+			sourceIndex, header, err := parseHTTPHeaderURLQualifier(q.Name, len(uris))
+			if err != nil {
+				return nil, nil, err
+			}
+			for j, r := range rewritten {
+				if r.SourceIndex == sourceIndex && inherits[j] {
+					newQualifiers = append(newQualifiers, &remoteasset.Qualifier{
+						Name:  fmt.Sprintf("%s%d:%s", QualifierHTTPHeaderURLPrefix, j, header),
+						Value: q.Value,
+					})
+				}
+			}
+		case strings.HasPrefix(q.Name, QualifierHTTPHeaderPrefix):
+			// Global headers apply to all URIs, including
+			// mirrors. Convert them to per-URI headers for
+			// URIs that may inherit them.
+			header := strings.TrimPrefix(q.Name, QualifierHTTPHeaderPrefix)
+			for j, r := range rewritten {
+				if _, ok := perURIHeaders[perURIHeader{sourceIndex: r.SourceIndex, header: header}]; !ok && inherits[j] {
+					newQualifiers = append(newQualifiers, &remoteasset.Qualifier{
+						Name:  fmt.Sprintf("%s%d:%s", QualifierHTTPHeaderURLPrefix, j, header),
+						Value: q.Value,
+					})
+				}
+			}
+		case q.Name == QualifierLegacyBazelHTTPHeaders:
+			authHeaders, err := NewAuthHeadersFromQualifier(q.Value)
+			if err != nil {
+				return nil, nil, util.StatusWrapfWithCode(err, codes.InvalidArgument, "Invalid %s qualifier", QualifierLegacyBazelHTTPHeaders)
+			}
+			newAuthHeaders := AuthHeaders{}
+			for j, r := range rewritten {
+				if headers, ok := (*authHeaders)[uris[r.SourceIndex]]; ok && inherits[j] {
+					newAuthHeaders[r.URI] = headers
+				}
+			}
+			value, err := json.Marshal(newAuthHeaders)
+			if err != nil {
+				return nil, nil, util.StatusWrapfWithCode(err, codes.Internal, "Failed to marshal %s qualifier", QualifierLegacyBazelHTTPHeaders)
+			}
+			newQualifiers = append(newQualifiers, &remoteasset.Qualifier{
+				Name:  q.Name,
+				Value: string(value),
+			})
+		default:
+			newQualifiers = append(newQualifiers, q)
+		}
+	}
+	return newURIs, newQualifiers, nil
+}
+
+// parseHTTPHeaderURLQualifier parses the name of an http_header_url
+// qualifier, returning the index of the URI to which it applies and the
+// name of the header.
+func parseHTTPHeaderURLQualifier(name string, uriCount int) (int, string, error) {
+	parts := strings.SplitN(name, ":", 3)
+	if len(parts) != 3 {
+		return 0, "", status.Errorf(codes.InvalidArgument, "Invalid http_header_url qualifier: %s", name)
+	}
+	uriIdx, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, "", status.Errorf(codes.InvalidArgument, "Invalid http_header_url qualifier: %s: Bad URL index: %v: %v", name, parts[1], err)
+	}
+	if uriIdx < 0 || uriIdx >= uriCount {
+		return 0, "", status.Errorf(codes.InvalidArgument, "Invalid http_header_url qualifier: %s: URL index out of range: %v", name, uriIdx)
+	}
+	return uriIdx, parts[2], nil
+}
+
+func sameHost(a, b string) bool {
+	aURL, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	bURL, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return aURL.Scheme == bURL.Scheme && strings.EqualFold(aURL.Host, bURL.Host)
+}
+
+// restoreQualifiers returns the qualifiers of the original request,
+// followed by qualifiers that were added to the response by the
+// backend, such as the commit to which a branch was resolved.
+func restoreQualifiers(original, forwarded, returned []*remoteasset.Qualifier) []*remoteasset.Qualifier {
+	forwardedNames := qualifier.QualifiersToSet(forwarded)
+	restored := original
+	for _, q := range returned {
+		if !forwardedNames.Contains(q.Name) {
+			restored = append(restored[:len(restored):len(restored)], q)
+		}
+	}
+	return restored
+}
+
+func (rf *urlRewritingFetcher) FetchBlob(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+	uris, qualifiers, err := rf.rewrite(req.Uris, req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	rewrittenReq := proto.Clone(req).(*remoteasset.FetchBlobRequest)
+	rewrittenReq.Uris = uris
+	rewrittenReq.Qualifiers = qualifiers
+	response, err := rf.fetcher.FetchBlob(ctx, rewrittenReq)
+	if err != nil {
+		return nil, err
+	}
+	response.Qualifiers = restoreQualifiers(req.Qualifiers, qualifiers, response.Qualifiers)
+	return response, nil
+}
+
+func (rf *urlRewritingFetcher) FetchDirectory(ctx context.Context, req *remoteasset.FetchDirectoryRequest) (*remoteasset.FetchDirectoryResponse, error) {
+	uris, qualifiers, err := rf.rewrite(req.Uris, req.Qualifiers)
+	if err != nil {
+		return nil, err
+	}
+	rewrittenReq := proto.Clone(req).(*remoteasset.FetchDirectoryRequest)
+	rewrittenReq.Uris = uris
+	rewrittenReq.Qualifiers = qualifiers
+	response, err := rf.fetcher.FetchDirectory(ctx, rewrittenReq)
+	if err != nil {
+		return nil, err
+	}
+	response.Qualifiers = restoreQualifiers(req.Qualifiers, qualifiers, response.Qualifiers)
+	return response, nil
+}
+
+func (rf *urlRewritingFetcher) CheckQualifiers(qualifiers qualifier.Set) qualifier.Set {
+	return rf.fetcher.CheckQualifiers(qualifiers)
+}
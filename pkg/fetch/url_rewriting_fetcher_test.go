@@ -0,0 +1,166 @@
+package fetch_test
+
+import (
+	"context"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	"github.com/buildbarn/bb-remote-asset/internal/mock"
+	"github.com/buildbarn/bb-remote-asset/pkg/fetch"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestURLRewriterRewrite(t *testing.T) {
+	rewriter, err := fetch.NewURLRewriter(
+		[]fetch.URLRewrite{
+			{
+				Pattern:      "github.com/(.*)",
+				Replacements: []string{"mirror.example.com/github/${1}", "${0}"},
+			},
+			{
+				Pattern:      "internal.example.com/(.*)",
+				Replacements: []string{"https://artifacts.example.com/${1}"},
+			},
+		},
+		[]string{"mirror.example.com", "artifacts.example.com"},
+		[]string{"*"},
+		"")
+	require.NoError(t, err)
+
+	t.Run("Mirror", func(t *testing.T) {
+		rewritten, err := rewriter.Rewrite([]string{
+			"https://github.com/foo/bar.tar.gz",
+			"http://internal.example.com/foo/bar.tar.gz",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []fetch.RewrittenURI{
+			{URI: "https://mirror.example.com/github/foo/bar.tar.gz", SourceIndex: 0},
+			{URI: "https://artifacts.example.com/foo/bar.tar.gz", SourceIndex: 1},
+		}, rewritten)
+	})
+
+	t.Run("AllBlocked", func(t *testing.T) {
+		_, err := rewriter.Rewrite([]string{"https://example.com/foo.tar.gz"})
+		testutil.RequireEqualStatus(t, status.Error(codes.PermissionDenied, "All URIs are blocked: https://example.com/foo.tar.gz"), err)
+	})
+
+	t.Run("Subdomains", func(t *testing.T) {
+		// Allowed and blocked hosts also apply to subdomains,
+		// while allowed hosts take precedence over blocked ones.
+		rewriter, err := fetch.NewURLRewriter(
+			nil,
+			[]string{"releases.github.com"},
+			[]string{"github.com", "githubusercontent.com"},
+			"")
+		require.NoError(t, err)
+		rewritten, err := rewriter.Rewrite([]string{
+			"https://github.com/foo/bar.tar.gz",
+			"https://codeload.github.com/foo/bar.tar.gz",
+			"https://objects.githubusercontent.com/foo/bar.tar.gz",
+			"https://notgithub.com/foo/bar.tar.gz",
+			"https://releases.github.com/foo/bar.tar.gz",
+			"https://cdn.releases.GitHub.com/foo/bar.tar.gz",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []fetch.RewrittenURI{
+			{URI: "https://notgithub.com/foo/bar.tar.gz", SourceIndex: 3},
+			{URI: "https://releases.github.com/foo/bar.tar.gz", SourceIndex: 4},
+			{URI: "https://cdn.releases.GitHub.com/foo/bar.tar.gz", SourceIndex: 5},
+		}, rewritten)
+	})
+
+	t.Run("AllowedSubdomainOfBlockAll", func(t *testing.T) {
+		rewritten, err := rewriter.Rewrite([]string{
+			"https://eu.artifacts.example.com/foo.tar.gz",
+			"https://example.com/foo.tar.gz",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []fetch.RewrittenURI{
+			{URI: "https://eu.artifacts.example.com/foo.tar.gz", SourceIndex: 0},
+		}, rewritten)
+	})
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		_, err := fetch.NewURLRewriter([]fetch.URLRewrite{{Pattern: "("}}, nil, nil, "")
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestURLRewritingFetcherFetchBlob(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+
+	rewriter, err := fetch.NewURLRewriter(
+		[]fetch.URLRewrite{
+			{
+				Pattern:      "example.com/(.*)",
+				Replacements: []string{"mirror.example.com/${1}", "${0}"},
+			},
+		},
+		nil,
+		[]string{"blocked.com"},
+		"Please use the internal mirror")
+	require.NoError(t, err)
+	baseFetcher := mock.NewMockFetcher(ctrl)
+	fetcher := fetch.NewURLRewritingFetcher(baseFetcher, rewriter)
+
+	t.Run("Success", func(t *testing.T) {
+		request := &remoteasset.FetchBlobRequest{
+			Uris: []string{"https://blocked.com/foo", "https://example.com/foo"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "http_header_url:1:Authorization", Value: "Bearer secret"},
+				{Name: "http_header:Authorization", Value: "Bearer global"},
+				{Name: "http_header:X-Global", Value: "global"},
+				{Name: "bazel.auth_headers", Value: `{"https://example.com/foo":{"X-Token":"secret"}}`},
+				{Name: "checksum.sri", Value: "sha256-abc"},
+			},
+		}
+		baseFetcher.EXPECT().FetchBlob(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, req *remoteasset.FetchBlobRequest) (*remoteasset.FetchBlobResponse, error) {
+				// Headers for the original URI must not be
+				// sent to the mirror. Global headers are
+				// converted to per-URI headers, without
+				// overriding the ones provided explicitly.
+				require.Equal(t, []string{"https://mirror.example.com/foo", "https://example.com/foo"}, req.Uris)
+				testutil.RequireEqualProto(t, &remoteasset.FetchBlobRequest{
+					Uris: req.Uris,
+					Qualifiers: []*remoteasset.Qualifier{
+						{Name: "http_header_url:1:Authorization", Value: "Bearer secret"},
+						{Name: "http_header_url:1:X-Global", Value: "global"},
+						{Name: "bazel.auth_headers", Value: `{"https://example.com/foo":{"X-Token":"secret"}}`},
+						{Name: "checksum.sri", Value: "sha256-abc"},
+					},
+				}, req)
+				return &remoteasset.FetchBlobResponse{
+					Status:     status.New(codes.OK, "Success!").Proto(),
+					Uri:        "https://mirror.example.com/foo",
+					Qualifiers: req.Qualifiers,
+				}, nil
+			})
+
+		response, err := fetcher.FetchBlob(ctx, request)
+		require.NoError(t, err)
+		require.Equal(t, "https://mirror.example.com/foo", response.Uri)
+		require.Equal(t, request.Qualifiers, response.Qualifiers)
+	})
+
+	t.Run("HeaderURLIndexOutOfRange", func(t *testing.T) {
+		_, err := fetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"https://example.com/foo"},
+			Qualifiers: []*remoteasset.Qualifier{
+				{Name: "http_header_url:1:Authorization", Value: "Bearer secret"},
+			},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Invalid http_header_url qualifier: http_header_url:1:Authorization: URL index out of range: 1"), err)
+	})
+
+	t.Run("AllBlocked", func(t *testing.T) {
+		_, err := fetcher.FetchBlob(ctx, &remoteasset.FetchBlobRequest{
+			Uris: []string{"https://blocked.com/foo"},
+		})
+		testutil.RequireEqualStatus(t, status.Error(codes.PermissionDenied, "Please use the internal mirror"), err)
+	})
+}
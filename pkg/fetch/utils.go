@@ -1,10 +1,14 @@
 package fetch
 
 import (
+	"net/http"
+
 	"github.com/buildbarn/bb-storage/pkg/digest"
 	"github.com/buildbarn/bb-storage/pkg/util"
 
 	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // getDigestFunction gets the digest function specified by a request or uses SHA 256 by default
@@ -24,3 +28,18 @@ func getDigestFunction(digestFunction remoteexecution.DigestFunction_Value, inst
 	// any actual value
 	return instance.GetDigestFunction(digestFunction, 0)
 }
+
+// newHTTPStatusError converts the status of an unsuccessful HTTP
+// response to a gRPC status. Responses indicating that a file does not
+// exist are reported as NotFound, so that callers can fall back to
+// other locations.
+func newHTTPStatusError(uri string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return status.Errorf(codes.NotFound, "HTTP request to %s failed with status %#v", uri, resp.Status)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return status.Errorf(codes.PermissionDenied, "HTTP request to %s failed with status %#v", uri, resp.Status)
+	default:
+		return status.Errorf(codes.Internal, "HTTP request to %s failed with status %#v", uri, resp.Status)
+	}
+}
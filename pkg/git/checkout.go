@@ -0,0 +1,266 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/archive"
+	"github.com/buildbarn/bb-remote-asset/pkg/directory"
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Modes of entries contained in tree objects.
+const (
+	treeEntryModeDirectory  = "40000"
+	treeEntryModeFile       = "100644"
+	treeEntryModeExecutable = "100755"
+	treeEntryModeSymlink    = "120000"
+	treeEntryModeGitlink    = "160000"
+)
+
+// Submodule is a commit of another repository that is referenced by a
+// tree, as listed in the superproject's .gitmodules file.
+type Submodule struct {
+	// Path of the submodule, relative to the root of the checkout.
+	Path string
+	// URL of the submodule's repository, as written in .gitmodules.
+	// This may be relative to the URL of the superproject. The URL is
+	// empty if .gitmodules does not contain an entry for the
+	// submodule.
+	URL string
+	// Commit of the submodule that is referenced by the tree.
+	CommitID ObjectID
+}
+
+// Checkout writes the trees of commits into a directory.Builder. The
+// .git directory is never created. Submodules are left as empty
+// directories, which may be filled by adding their commits separately.
+type Checkout struct {
+	builder *directory.Builder
+	limits  archive.Limits
+
+	extractedSizeBytes int64
+	entries            int64
+}
+
+// NewCheckout creates a Checkout that writes files into a
+// directory.Builder. The limits are shared by all commits that are
+// added, so that they also apply to a repository and its submodules as
+// a whole.
+func NewCheckout(builder *directory.Builder, limits archive.Limits) *Checkout {
+	return &Checkout{
+		builder: builder,
+		limits:  limits,
+	}
+}
+
+// treeEntry is an entry contained in a tree object.
+type treeEntry struct {
+	mode string
+	name string
+	id   ObjectID
+}
+
+// parseTree parses the contents of a tree object. Entries have the
+// form "<mode> <name>\x00<binary object ID>".
+func parseTree(data []byte) ([]treeEntry, error) {
+	var entries []treeEntry
+	for len(data) > 0 {
+		header, remainder, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(remainder) < len(ObjectID{}) {
+			return nil, status.Error(codes.InvalidArgument, "Tree entry is truncated")
+		}
+		mode, name, ok := strings.Cut(string(header), " ")
+		if !ok || name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return nil, status.Errorf(codes.InvalidArgument, "Tree entry %#v is invalid", string(header))
+		}
+		entry := treeEntry{mode: mode, name: name}
+		copy(entry.id[:], remainder)
+		entries = append(entries, entry)
+		data = remainder[len(entry.id):]
+	}
+	return entries, nil
+}
+
+// getCommitTree returns the ID of the tree of a commit, which is
+// listed in the first line of the commit object.
+func getCommitTree(pack *Pack, commitID ObjectID) (ObjectID, error) {
+	objectType, data, err := pack.ReadObject(commitID)
+	if err != nil {
+		return ObjectID{}, util.StatusWrapf(err, "Failed to read commit %s", commitID)
+	}
+	if objectType != ObjectTypeCommit {
+		return ObjectID{}, status.Errorf(codes.InvalidArgument, "Object %s is a %s, not a commit", commitID, objectType)
+	}
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	treeID, ok := bytes.CutPrefix(firstLine, []byte("tree "))
+	if !ok {
+		return ObjectID{}, status.Errorf(codes.InvalidArgument, "Commit %s does not reference a tree", commitID)
+	}
+	return NewObjectIDFromString(string(treeID))
+}
+
+// countEntry accounts for an entry of the tree, returning an error if
+// the checkout contains too many of them.
+func (c *Checkout) countEntry() error {
+	c.entries++
+	if c.entries > c.limits.MaximumEntries {
+		return status.Errorf(codes.ResourceExhausted, "Checkout exceeds the maximum number of %d entries", c.limits.MaximumEntries)
+	}
+	return nil
+}
+
+// countSize accounts for the size of a file or symbolic link.
+func (c *Checkout) countSize(sizeBytes int64) error {
+	c.extractedSizeBytes += sizeBytes
+	if c.extractedSizeBytes > c.limits.MaximumExtractedSizeBytes {
+		return status.Errorf(codes.ResourceExhausted, "Checkout exceeds the maximum extracted size of %d bytes", c.limits.MaximumExtractedSizeBytes)
+	}
+	return nil
+}
+
+// Add the tree of a commit contained in a pack to the directory at the
+// provided path. Submodules referenced by the tree are returned, with
+// paths relative to the root of the builder.
+func (c *Checkout) Add(ctx context.Context, pack *Pack, commitID ObjectID, p string) ([]Submodule, error) {
+	treeID, err := getCommitTree(pack, commitID)
+	if err != nil {
+		return nil, err
+	}
+	a := adder{
+		checkout: c,
+		pack:     pack,
+	}
+	if err := a.addTree(ctx, treeID, p, true); err != nil {
+		return nil, err
+	}
+	if len(a.submodules) == 0 {
+		return nil, nil
+	}
+
+	// Look up the URLs of submodules.
+	urls := map[string]string{}
+	if a.gitmodules != nil {
+		objectType, data, err := pack.ReadObject(*a.gitmodules)
+		if err != nil {
+			return nil, util.StatusWrap(err, "Failed to read .gitmodules")
+		}
+		if objectType != ObjectTypeBlob {
+			return nil, status.Errorf(codes.InvalidArgument, ".gitmodules is a %s, not a blob", objectType)
+		}
+		if urls, err = parseGitmodules(data); err != nil {
+			return nil, util.StatusWrap(err, "Failed to parse .gitmodules")
+		}
+	}
+	for i, submodule := range a.submodules {
+		relativePath := strings.TrimPrefix(strings.TrimPrefix(submodule.Path, p), "/")
+		a.submodules[i].URL = urls[relativePath]
+	}
+	return a.submodules, nil
+}
+
+// adder keeps track of the state of a single commit that is being
+// added to a Checkout.
+type adder struct {
+	checkout   *Checkout
+	pack       *Pack
+	gitmodules *ObjectID
+	submodules []Submodule
+}
+
+func (a *adder) addTree(ctx context.Context, treeID ObjectID, p string, isRoot bool) error {
+	objectType, data, err := a.pack.ReadObject(treeID)
+	if err != nil {
+		return util.StatusWrapf(err, "Failed to read tree %s", treeID)
+	}
+	if objectType != ObjectTypeTree {
+		return status.Errorf(codes.InvalidArgument, "Object %s is a %s, not a tree", treeID, objectType)
+	}
+	entries, err := parseTree(data)
+	if err != nil {
+		return util.StatusWrapf(err, "Failed to parse tree %s", treeID)
+	}
+	if err := a.checkout.builder.AddDirectory(p); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// Repositories may not contain .git directories, as they
+		// would be interpreted as metadata by git itself.
+		if strings.EqualFold(entry.name, ".git") {
+			continue
+		}
+		if err := a.checkout.countEntry(); err != nil {
+			return err
+		}
+		entryPath := path.Join(p, entry.name)
+		switch entry.mode {
+		case treeEntryModeDirectory:
+			if err := a.addTree(ctx, entry.id, entryPath, false); err != nil {
+				return err
+			}
+		case treeEntryModeFile, treeEntryModeExecutable:
+			if isRoot && entry.name == ".gitmodules" {
+				a.gitmodules = &entry.id
+			}
+			if err := a.addFile(ctx, entry.id, entryPath, entry.mode == treeEntryModeExecutable); err != nil {
+				return err
+			}
+		case treeEntryModeSymlink:
+			target, err := a.readBlob(entry.id)
+			if err != nil {
+				return util.StatusWrapf(err, "Failed to read symbolic link %#v", entryPath)
+			}
+			if err := a.checkout.builder.AddSymlink(entryPath, string(target)); err != nil {
+				return err
+			}
+		case treeEntryModeGitlink:
+			if err := a.checkout.builder.AddDirectory(entryPath); err != nil {
+				return err
+			}
+			a.submodules = append(a.submodules, Submodule{
+				Path:     entryPath,
+				CommitID: entry.id,
+			})
+		default:
+			return status.Errorf(codes.InvalidArgument, "Tree entry %#v has unsupported mode %s", entryPath, entry.mode)
+		}
+	}
+	return nil
+}
+
+func (a *adder) readBlob(id ObjectID) ([]byte, error) {
+	objectType, data, err := a.pack.ReadObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != ObjectTypeBlob {
+		return nil, status.Errorf(codes.InvalidArgument, "Object %s is a %s, not a blob", id, objectType)
+	}
+	if err := a.checkout.countSize(int64(len(data))); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (a *adder) addFile(ctx context.Context, id ObjectID, p string, isExecutable bool) error {
+	objectType, sizeBytes, r, err := a.pack.OpenObject(id)
+	if err != nil {
+		return util.StatusWrapf(err, "Failed to read file %#v", p)
+	}
+	if objectType != ObjectTypeBlob {
+		return status.Errorf(codes.InvalidArgument, "Object %s is a %s, not a blob", id, objectType)
+	}
+	if err := a.checkout.countSize(sizeBytes); err != nil {
+		return err
+	}
+	if err := a.checkout.builder.AddFile(ctx, p, r, sizeBytes, isExecutable); err != nil {
+		return util.StatusWrapf(err, "Failed to add file %#v", p)
+	}
+	return nil
+}
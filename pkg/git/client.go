@@ -0,0 +1,274 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ref is a branch, tag or other reference advertised by a repository.
+type Ref struct {
+	Name string
+	ID   ObjectID
+}
+
+// HeaderProvider returns the headers to send as part of requests to a
+// URL, such as credentials of the server.
+type HeaderProvider func(ctx context.Context, req *http.Request) error
+
+// Client is a client for git's smart HTTP protocol, using protocol
+// version 2. It is capable of listing the refs of a repository and of
+// fetching the objects of a single commit.
+type Client struct {
+	httpClient     *http.Client
+	headerProvider HeaderProvider
+}
+
+// NewClient creates a client for git's smart HTTP protocol. If
+// provided, the header provider is invoked for every request.
+func NewClient(httpClient *http.Client, headerProvider HeaderProvider) *Client {
+	return &Client{
+		httpClient:     httpClient,
+		headerProvider: headerProvider,
+	}
+}
+
+// newStatusError converts a response with an unexpected HTTP status to
+// a gRPC status.
+func newStatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return status.Errorf(codes.NotFound, "HTTP request failed with status %#v", resp.Status)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return status.Errorf(codes.PermissionDenied, "HTTP request failed with status %#v", resp.Status)
+	default:
+		return status.Errorf(codes.Internal, "HTTP request failed with status %#v", resp.Status)
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, url, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to create HTTP request")
+	}
+	req.Header.Set("Git-Protocol", "version=2")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	}
+	if c.headerProvider != nil {
+		if err := c.headerProvider(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.Unavailable, "HTTP request failed")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, newStatusError(resp)
+	}
+	return resp, nil
+}
+
+// capabilities contains the capabilities advertised by a server, such
+// as the features supported by the fetch command.
+type capabilities map[string]string
+
+// discover requests the capabilities of the server, ensuring that it
+// supports protocol version 2.
+func (c *Client) discover(ctx context.Context, repositoryURL string) (capabilities, error) {
+	resp, err := c.do(ctx, http.MethodGet, repositoryURL+"/info/refs?service=git-upload-pack", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	r := newPktLineReader(resp.Body)
+	kind, line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	// Servers may precede the capability advertisement with the
+	// name of the service.
+	if kind == pktLineData && strings.HasPrefix(line, "# service=") {
+		if kind, _, err = r.readLine(); err != nil {
+			return nil, err
+		}
+		if kind != pktLineFlush {
+			return nil, status.Error(codes.Internal, "Service announcement is not followed by a flush packet")
+		}
+		if kind, line, err = r.readLine(); err != nil {
+			return nil, err
+		}
+	}
+	if kind != pktLineData || line != "version 2" {
+		return nil, status.Error(codes.Unimplemented, "Server does not support git protocol version 2")
+	}
+	caps := capabilities{}
+	for {
+		kind, line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if kind == pktLineFlush {
+			return caps, nil
+		}
+		key, value, _ := strings.Cut(line, "=")
+		caps[key] = value
+	}
+}
+
+// command runs a protocol version 2 command, returning a reader for
+// the response.
+func (c *Client) command(ctx context.Context, repositoryURL, command string, arguments []string) (io.ReadCloser, *pktLineReader, error) {
+	var body bytes.Buffer
+	appendPktLine(&body, "command="+command+"\n")
+	body.WriteString("0001")
+	for _, argument := range arguments {
+		appendPktLine(&body, argument+"\n")
+	}
+	body.WriteString("0000")
+	resp, err := c.do(ctx, http.MethodPost, repositoryURL+"/git-upload-pack", "application/x-git-upload-pack-request", body.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, newPktLineReader(resp.Body), nil
+}
+
+// LsRefs lists the refs of a repository whose names start with one of
+// the provided prefixes. Symbolic refs, such as HEAD, are reported
+// with the ID of the object they point to. Annotated tags are peeled,
+// meaning the ID of the tagged object is reported.
+func (c *Client) LsRefs(ctx context.Context, repositoryURL string, refPrefixes []string) ([]Ref, error) {
+	caps, err := c.discover(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := caps["ls-refs"]; !ok {
+		return nil, status.Error(codes.Unimplemented, "Server does not support the ls-refs command")
+	}
+
+	arguments := []string{"peel"}
+	for _, refPrefix := range refPrefixes {
+		arguments = append(arguments, "ref-prefix "+refPrefix)
+	}
+	body, r, err := c.command(ctx, repositoryURL, "ls-refs", arguments)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var refs []Ref
+	for {
+		kind, line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if kind == pktLineFlush {
+			return refs, nil
+		}
+		// Lines have the form "<oid> <refname> [attributes]".
+		fields := strings.Fields(line)
+		if kind != pktLineData || len(fields) < 2 {
+			return nil, status.Errorf(codes.Internal, "Invalid ref advertisement %#v", line)
+		}
+		id, err := NewObjectIDFromString(fields[0])
+		if err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.Internal, "Invalid ref advertisement")
+		}
+		for _, attribute := range fields[2:] {
+			if peeled, ok := strings.CutPrefix(attribute, "peeled:"); ok {
+				if id, err = NewObjectIDFromString(peeled); err != nil {
+					return nil, util.StatusWrapWithCode(err, codes.Internal, "Invalid ref advertisement")
+				}
+			}
+		}
+		refs = append(refs, Ref{Name: fields[1], ID: id})
+	}
+}
+
+// Fetch requests a pack containing a commit and all objects reachable
+// from its tree, writing it to the provided writer. If supported by
+// the server, the history of the commit is omitted. The server needs to
+// permit fetching commits that are not at the tip of a ref, which is
+// the default for most hosting services using protocol version 2.
+func (c *Client) Fetch(ctx context.Context, repositoryURL string, commitID ObjectID, w io.Writer) error {
+	caps, err := c.discover(ctx, repositoryURL)
+	if err != nil {
+		return err
+	}
+	fetchFeatures, ok := caps["fetch"]
+	if !ok {
+		return status.Error(codes.Unimplemented, "Server does not support the fetch command")
+	}
+
+	arguments := []string{"no-progress", "ofs-delta"}
+	for _, feature := range strings.Fields(fetchFeatures) {
+		if feature == "shallow" {
+			arguments = append(arguments, "deepen 1")
+		}
+	}
+	arguments = append(arguments, "want "+commitID.String(), "done")
+	body, r, err := c.command(ctx, repositoryURL, "fetch", arguments)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Skip sections preceding the packfile, such as the list of
+	// shallow commits.
+	for {
+		kind, line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		if kind != pktLineData {
+			return status.Error(codes.Internal, "Response does not contain a packfile")
+		}
+		if line == "packfile" {
+			break
+		}
+		for kind != pktLineDelimiter {
+			if kind, _, err = r.readLine(); err != nil {
+				return err
+			}
+			if kind == pktLineFlush {
+				return status.Errorf(codes.Internal, "Response does not contain a packfile after section %#v", line)
+			}
+		}
+	}
+
+	// The packfile is multiplexed with progress and error messages.
+	for {
+		kind, data, err := r.read()
+		if err != nil {
+			return util.StatusWrap(err, "Failed to read packfile")
+		}
+		if kind == pktLineFlush {
+			return nil
+		}
+		if kind != pktLineData || len(data) == 0 {
+			return status.Error(codes.Internal, "Invalid packet in packfile section")
+		}
+		switch data[0] {
+		case 1:
+			if _, err := w.Write(data[1:]); err != nil {
+				return err
+			}
+		case 2:
+		case 3:
+			return status.Errorf(codes.Internal, "Server reported error: %s", strings.TrimSpace(string(data[1:])))
+		default:
+			return status.Errorf(codes.Internal, "Packet in packfile section has invalid band %d", data[0])
+		}
+	}
+}
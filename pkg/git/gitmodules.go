@@ -0,0 +1,71 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// parseGitmodules extracts the URLs of submodules from the contents of
+// a .gitmodules file, returning them keyed by the path of the
+// submodule. Only the subset of git's configuration file syntax that
+// is used in practice is supported.
+func parseGitmodules(data []byte) (map[string]string, error) {
+	type submodule struct {
+		path string
+		url  string
+	}
+	var submodules []*submodule
+	var current *submodule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if section, ok := strings.CutPrefix(line, "["); ok {
+			section, ok = strings.CutSuffix(section, "]")
+			if !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "Line %d: Unterminated section header", lineNumber)
+			}
+			current = nil
+			if kind, _, _ := strings.Cut(section, " "); strings.EqualFold(kind, "submodule") {
+				current = &submodule{}
+				submodules = append(submodules, current)
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if strings.HasPrefix(value, "\"") {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Line %d: Invalid quoted value", lineNumber)
+			}
+			value = unquoted
+		}
+		if current != nil {
+			switch strings.ToLower(key) {
+			case "path":
+				current.path = value
+			case "url":
+				current.url = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Failed to read .gitmodules: %s", err)
+	}
+
+	urls := map[string]string{}
+	for _, s := range submodules {
+		if s.path != "" {
+			urls[strings.Trim(s.path, "/")] = s.url
+		}
+	}
+	return urls, nil
+}
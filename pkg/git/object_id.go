@@ -0,0 +1,41 @@
+package git
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ObjectID is the SHA-1 hash identifying an object stored in a
+// repository. Repositories using SHA-256 object names are not
+// supported.
+type ObjectID [sha1.Size]byte
+
+// NewObjectIDFromString parses a hexadecimal object ID, such as the
+// name of a commit.
+func NewObjectIDFromString(s string) (ObjectID, error) {
+	var id ObjectID
+	if len(s) != hex.EncodedLen(len(id)) {
+		return ObjectID{}, status.Errorf(codes.InvalidArgument, "Object ID %#v is not %d hexadecimal characters long", s, hex.EncodedLen(len(id)))
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return ObjectID{}, status.Errorf(codes.InvalidArgument, "Object ID %#v is not hexadecimal", s)
+	}
+	return id, nil
+}
+
+func (id ObjectID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// newObjectHasher returns a hash that computes the ID of an object,
+// given its contents.
+func newObjectHasher(objectType ObjectType, sizeBytes int64) hash.Hash {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", objectType, sizeBytes)
+	return h
+}
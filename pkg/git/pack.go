@@ -0,0 +1,495 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ObjectType is the type of an object stored in a repository.
+type ObjectType int
+
+const (
+	// ObjectTypeCommit is the type of commit objects.
+	ObjectTypeCommit ObjectType = 1
+	// ObjectTypeTree is the type of tree objects, which list the
+	// contents of a directory.
+	ObjectTypeTree ObjectType = 2
+	// ObjectTypeBlob is the type of blob objects, which hold the
+	// contents of files and the targets of symbolic links.
+	ObjectTypeBlob ObjectType = 3
+	// ObjectTypeTag is the type of annotated tag objects.
+	ObjectTypeTag ObjectType = 4
+
+	// Types of pack entries that store an object as a delta against
+	// another object, identified by offset or by object ID.
+	objectTypeOffsetDelta    = 6
+	objectTypeReferenceDelta = 7
+)
+
+func (t ObjectType) String() string {
+	switch t {
+	case ObjectTypeCommit:
+		return "commit"
+	case ObjectTypeTree:
+		return "tree"
+	case ObjectTypeBlob:
+		return "blob"
+	case ObjectTypeTag:
+		return "tag"
+	default:
+		return fmt.Sprintf("type %d", int(t))
+	}
+}
+
+// Maximum total size of objects that are cached after being read, so
+// that objects serving as the base of multiple deltas don't need to be
+// reconstructed repeatedly.
+const maximumDeltaBaseCacheSizeBytes = 64 << 20
+
+// packEntry is an object stored in a pack.
+type packEntry struct {
+	objectType ObjectType
+	sizeBytes  int64
+	// Offset of the zlib compressed data of the entry.
+	dataOffset int64
+
+	// Set for entries storing a delta. The type and size of the
+	// object are only known once the delta has been resolved.
+	isDelta      bool
+	deltaSize    int64
+	baseOffset   int64
+	baseObjectID *ObjectID
+
+	resolved bool
+	id       ObjectID
+}
+
+// Pack provides access to the objects contained in a packfile, as
+// returned by servers in response to fetch requests. The contents of
+// the packfile are verified against its trailing checksum, while the
+// IDs of all objects are computed from their contents. Objects can
+// therefore be trusted to match the IDs through which they are
+// looked up.
+type Pack struct {
+	r                      io.ReaderAt
+	maximumObjectSizeBytes int64
+	entriesByOffset        map[int64]*packEntry
+	entriesByID            map[ObjectID]*packEntry
+
+	cache          map[*packEntry][]byte
+	cacheSizeBytes int64
+}
+
+// countingReader tracks the offset within the packfile while scanning
+// it. As it implements io.ByteReader, zlib decompressors don't read
+// past the end of the compressed data of an entry.
+type countingReader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err == nil {
+		r.offset++
+	}
+	return c, err
+}
+
+// inflate decompresses the data of a pack entry, requiring it to have
+// the size announced in the entry header.
+func inflate(w io.Writer, r io.Reader, sizeBytes int64) error {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to decompress pack entry")
+	}
+	if n, err := io.Copy(w, io.LimitReader(zr, sizeBytes)); err != nil {
+		return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to decompress pack entry")
+	} else if n != sizeBytes {
+		return status.Errorf(codes.InvalidArgument, "Pack entry has size %d, while %d bytes were expected", n, sizeBytes)
+	}
+	// Consume the end of the compressed stream, including its
+	// checksum.
+	if n, err := io.CopyN(io.Discard, zr, 1); n != 0 {
+		return status.Errorf(codes.InvalidArgument, "Pack entry is larger than %d bytes", sizeBytes)
+	} else if err != io.EOF {
+		return util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to decompress pack entry")
+	}
+	return nil
+}
+
+// NewPack indexes a packfile, computing the IDs of all objects
+// contained in it. Objects stored as deltas must refer to base objects
+// contained in the same packfile, meaning thin packs are not
+// supported. Objects larger than the maximum size are rejected.
+func NewPack(r io.ReaderAt, sizeBytes, maximumObjectSizeBytes int64) (*Pack, error) {
+	if sizeBytes < 12+sha1.Size {
+		return nil, status.Error(codes.InvalidArgument, "Pack is too small to contain a header and a checksum")
+	}
+	checksum := sha1.New()
+	if _, err := io.Copy(checksum, io.NewSectionReader(r, 0, sizeBytes-sha1.Size)); err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to read pack")
+	}
+	var expectedChecksum [sha1.Size]byte
+	if _, err := r.ReadAt(expectedChecksum[:], sizeBytes-sha1.Size); err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to read pack")
+	}
+	if !bytes.Equal(checksum.Sum(nil), expectedChecksum[:]) {
+		return nil, status.Error(codes.InvalidArgument, "Pack does not match its checksum")
+	}
+
+	var header [12]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to read pack")
+	}
+	if !bytes.Equal(header[:4], []byte("PACK")) {
+		return nil, status.Error(codes.InvalidArgument, "Pack does not start with a pack signature")
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != 2 && version != 3 {
+		return nil, status.Errorf(codes.InvalidArgument, "Pack has unsupported version %d", version)
+	}
+	count := binary.BigEndian.Uint32(header[8:])
+
+	p := &Pack{
+		r:                      r,
+		maximumObjectSizeBytes: maximumObjectSizeBytes,
+		entriesByOffset:        map[int64]*packEntry{},
+		entriesByID:            map[ObjectID]*packEntry{},
+		cache:                  map[*packEntry][]byte{},
+	}
+	scanner := &countingReader{
+		r:      bufio.NewReader(io.NewSectionReader(r, 12, sizeBytes-12-sha1.Size)),
+		offset: 12,
+	}
+	var deltas []*packEntry
+	for i := uint32(0); i < count; i++ {
+		entryOffset := scanner.offset
+		entry, err := p.scanEntry(scanner, entryOffset)
+		if err != nil {
+			return nil, util.StatusWrapf(err, "Invalid pack entry at offset %d", entryOffset)
+		}
+		p.entriesByOffset[entryOffset] = entry
+		if entry.isDelta {
+			deltas = append(deltas, entry)
+		} else {
+			p.entriesByID[entry.id] = entry
+		}
+	}
+	if scanner.offset != sizeBytes-sha1.Size {
+		return nil, status.Error(codes.InvalidArgument, "Pack contains trailing data")
+	}
+	if err := p.resolveDeltas(deltas); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// scanEntry parses the header of a pack entry and decompresses its
+// data. For entries that are not deltas, the ID of the object is
+// computed.
+func (p *Pack) scanEntry(scanner *countingReader, entryOffset int64) (*packEntry, error) {
+	c, err := scanner.ReadByte()
+	if err != nil {
+		return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read entry header")
+	}
+	entryType := ObjectType((c >> 4) & 0x7)
+	sizeBytes := int64(c & 0xf)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if shift > 56 {
+			return nil, status.Error(codes.InvalidArgument, "Entry size is too large")
+		}
+		if c, err = scanner.ReadByte(); err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read entry header")
+		}
+		sizeBytes |= int64(c&0x7f) << shift
+	}
+	if sizeBytes > p.maximumObjectSizeBytes {
+		return nil, status.Errorf(codes.ResourceExhausted, "Entry has a size of %d bytes, which exceeds the maximum object size of %d bytes", sizeBytes, p.maximumObjectSizeBytes)
+	}
+
+	entry := &packEntry{objectType: entryType, sizeBytes: sizeBytes}
+	switch entryType {
+	case ObjectTypeCommit, ObjectTypeTree, ObjectTypeBlob, ObjectTypeTag:
+		entry.dataOffset = scanner.offset
+		hasher := newObjectHasher(entryType, sizeBytes)
+		if err := inflate(hasher, scanner, sizeBytes); err != nil {
+			return nil, err
+		}
+		copy(entry.id[:], hasher.Sum(nil))
+		entry.resolved = true
+		return entry, nil
+	case objectTypeOffsetDelta:
+		c, err := scanner.ReadByte()
+		if err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read base offset")
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if distance >= 1<<48 {
+				return nil, status.Error(codes.InvalidArgument, "Base offset is too large")
+			}
+			if c, err = scanner.ReadByte(); err != nil {
+				return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read base offset")
+			}
+			distance = ((distance + 1) << 7) | int64(c&0x7f)
+		}
+		entry.baseOffset = entryOffset - distance
+		if _, ok := p.entriesByOffset[entry.baseOffset]; !ok || distance == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Base offset %d does not refer to a preceding entry", entry.baseOffset)
+		}
+	case objectTypeReferenceDelta:
+		var baseObjectID ObjectID
+		if _, err := io.ReadFull(scanner, baseObjectID[:]); err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.InvalidArgument, "Failed to read base object ID")
+		}
+		entry.baseObjectID = &baseObjectID
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Entry has invalid type %d", entryType)
+	}
+
+	entry.isDelta = true
+	entry.deltaSize = sizeBytes
+	entry.dataOffset = scanner.offset
+	if err := inflate(io.Discard, scanner, sizeBytes); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// getDeltaBase returns the entry of the base object of a delta, if it
+// has been resolved.
+func (p *Pack) getDeltaBase(entry *packEntry) *packEntry {
+	var base *packEntry
+	if entry.baseObjectID != nil {
+		base = p.entriesByID[*entry.baseObjectID]
+	} else {
+		base = p.entriesByOffset[entry.baseOffset]
+	}
+	if base == nil || !base.resolved {
+		return nil
+	}
+	return base
+}
+
+// resolveDeltas computes the types, sizes and IDs of all objects
+// stored as deltas. As deltas may refer to base objects that are
+// deltas themselves, possibly stored further into the packfile,
+// resolution is repeated until no further progress can be made.
+func (p *Pack) resolveDeltas(deltas []*packEntry) error {
+	for len(deltas) > 0 {
+		var remaining []*packEntry
+		for _, entry := range deltas {
+			if p.getDeltaBase(entry) == nil {
+				remaining = append(remaining, entry)
+				continue
+			}
+			objectType, data, err := p.readEntry(entry)
+			if err != nil {
+				return err
+			}
+			hasher := newObjectHasher(objectType, int64(len(data)))
+			hasher.Write(data)
+			copy(entry.id[:], hasher.Sum(nil))
+			entry.objectType = objectType
+			entry.sizeBytes = int64(len(data))
+			entry.resolved = true
+			p.entriesByID[entry.id] = entry
+		}
+		if len(remaining) == len(deltas) {
+			return status.Errorf(codes.InvalidArgument, "Pack contains %d deltas whose base objects are missing", len(remaining))
+		}
+		deltas = remaining
+	}
+	return nil
+}
+
+// readEntry returns the type and contents of the object stored in a
+// pack entry, applying deltas if needed. Results are cached, as delta
+// chains tend to share base objects.
+func (p *Pack) readEntry(entry *packEntry) (ObjectType, []byte, error) {
+	if data, ok := p.cache[entry]; ok {
+		return entry.objectType, data, nil
+	}
+	objectType, data, err := p.reconstructEntry(entry)
+	if err != nil {
+		return 0, nil, err
+	}
+	if p.cacheSizeBytes+int64(len(data)) > maximumDeltaBaseCacheSizeBytes {
+		clear(p.cache)
+		p.cacheSizeBytes = 0
+	}
+	p.cache[entry] = data
+	p.cacheSizeBytes += int64(len(data))
+	return objectType, data, nil
+}
+
+func (p *Pack) reconstructEntry(entry *packEntry) (ObjectType, []byte, error) {
+	if !entry.isDelta {
+		var b bytes.Buffer
+		b.Grow(int(entry.sizeBytes))
+		if err := inflate(&b, p.openEntryData(entry), entry.sizeBytes); err != nil {
+			return 0, nil, err
+		}
+		return entry.objectType, b.Bytes(), nil
+	}
+
+	base := p.getDeltaBase(entry)
+	if base == nil {
+		return 0, nil, status.Error(codes.Internal, "Base object of delta has not been resolved")
+	}
+	baseType, baseData, err := p.readEntry(base)
+	if err != nil {
+		return 0, nil, err
+	}
+	var delta bytes.Buffer
+	delta.Grow(int(entry.deltaSize))
+	if err := inflate(&delta, p.openEntryData(entry), entry.deltaSize); err != nil {
+		return 0, nil, err
+	}
+	data, err := applyDelta(baseData, delta.Bytes(), p.maximumObjectSizeBytes)
+	if err != nil {
+		return 0, nil, err
+	}
+	return baseType, data, nil
+}
+
+func (p *Pack) openEntryData(entry *packEntry) io.Reader {
+	return bufio.NewReader(io.NewSectionReader(p.r, entry.dataOffset, 1<<62))
+}
+
+// readDeltaSize reads one of the sizes at the start of a delta.
+func readDeltaSize(delta []byte) (int64, []byte, error) {
+	var sizeBytes int64
+	for shift := 0; ; shift += 7 {
+		if len(delta) == 0 || shift > 56 {
+			return 0, nil, status.Error(codes.InvalidArgument, "Delta has an invalid header")
+		}
+		c := delta[0]
+		delta = delta[1:]
+		sizeBytes |= int64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return sizeBytes, delta, nil
+		}
+	}
+}
+
+// applyDelta reconstructs an object from the contents of its base
+// object and a delta, consisting of instructions to copy data from the
+// base object and to insert new data.
+func applyDelta(base, delta []byte, maximumSizeBytes int64) ([]byte, error) {
+	baseSizeBytes, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSizeBytes != int64(len(base)) {
+		return nil, status.Errorf(codes.InvalidArgument, "Delta applies to a base object of %d bytes, while the base object is %d bytes in size", baseSizeBytes, len(base))
+	}
+	sizeBytes, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if sizeBytes > maximumSizeBytes {
+		return nil, status.Errorf(codes.ResourceExhausted, "Object has a size of %d bytes, which exceeds the maximum object size of %d bytes", sizeBytes, maximumSizeBytes)
+	}
+
+	result := make([]byte, 0, sizeBytes)
+	for len(delta) > 0 {
+		instruction := delta[0]
+		delta = delta[1:]
+		if instruction&0x80 != 0 {
+			// Copy data from the base object. The instruction
+			// indicates which bytes of the offset and size
+			// are present.
+			var offset, length int64
+			for i := 0; i < 7; i++ {
+				if instruction&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, status.Error(codes.InvalidArgument, "Delta contains a truncated copy instruction")
+				}
+				if i < 4 {
+					offset |= int64(delta[0]) << (8 * i)
+				} else {
+					length |= int64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if length == 0 {
+				length = 0x10000
+			}
+			if offset+length > int64(len(base)) {
+				return nil, status.Error(codes.InvalidArgument, "Delta copies data beyond the end of the base object")
+			}
+			if int64(len(result))+length > sizeBytes {
+				return nil, status.Error(codes.InvalidArgument, "Delta yields more data than announced")
+			}
+			result = append(result, base[offset:offset+length]...)
+		} else if instruction != 0 {
+			// Insert data contained in the delta.
+			length := int(instruction)
+			if length > len(delta) {
+				return nil, status.Error(codes.InvalidArgument, "Delta contains a truncated insert instruction")
+			}
+			if int64(len(result)+length) > sizeBytes {
+				return nil, status.Error(codes.InvalidArgument, "Delta yields more data than announced")
+			}
+			result = append(result, delta[:length]...)
+			delta = delta[length:]
+		} else {
+			return nil, status.Error(codes.InvalidArgument, "Delta contains a reserved instruction")
+		}
+	}
+	if int64(len(result)) != sizeBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "Delta yields %d bytes, while %d bytes were announced", len(result), sizeBytes)
+	}
+	return result, nil
+}
+
+// ReadObject returns the type and contents of an object.
+func (p *Pack) ReadObject(id ObjectID) (ObjectType, []byte, error) {
+	entry, ok := p.entriesByID[id]
+	if !ok {
+		return 0, nil, status.Errorf(codes.NotFound, "Pack does not contain object %s", id)
+	}
+	return p.readEntry(entry)
+}
+
+// OpenObject returns the type, size and contents of an object as a
+// stream. Unlike ReadObject, this permits processing large blobs
+// without holding them in memory, as long as they are not stored as
+// deltas.
+func (p *Pack) OpenObject(id ObjectID) (ObjectType, int64, io.Reader, error) {
+	entry, ok := p.entriesByID[id]
+	if !ok {
+		return 0, 0, nil, status.Errorf(codes.NotFound, "Pack does not contain object %s", id)
+	}
+	if entry.isDelta {
+		objectType, data, err := p.readEntry(entry)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		return objectType, int64(len(data)), bytes.NewReader(data), nil
+	}
+	zr, err := zlib.NewReader(p.openEntryData(entry))
+	if err != nil {
+		return 0, 0, nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to decompress pack entry")
+	}
+	return entry.objectType, entry.sizeBytes, io.LimitReader(zr, entry.sizeBytes), nil
+}
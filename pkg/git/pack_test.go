@@ -0,0 +1,123 @@
+package git_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/git"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runGit runs a git command in a directory, returning its output.
+func runGit(t *testing.T, dir string, stdin io.Reader, args ...string) []byte {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Author",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_COMMITTER_NAME=Committer",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"HOME="+dir,
+	)
+	output, err := cmd.Output()
+	require.NoError(t, err, "git %s", strings.Join(args, " "))
+	return output
+}
+
+// createPack creates a repository containing multiple revisions of a
+// file, so that objects are stored as deltas, and returns a pack
+// containing all of its objects.
+func createPack(t *testing.T) (string, []byte) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, nil, "init", "--quiet")
+	var content strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&content, "Line %d\n", i)
+	}
+	for i := 0; i < 3; i++ {
+		content.WriteString("Appended line\n")
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte(content.String()), 0o644))
+		runGit(t, dir, nil, "add", "file.txt")
+		runGit(t, dir, nil, "commit", "--quiet", "-m", fmt.Sprintf("Revision %d", i))
+	}
+	objects := runGit(t, dir, nil, "rev-list", "--objects", "--all")
+	return dir, runGit(t, dir, bytes.NewReader(objects), "pack-objects", "--stdout", "--delta-base-offset")
+}
+
+func TestPack(t *testing.T) {
+	dir, packData := createPack(t)
+
+	t.Run("ReadObjects", func(t *testing.T) {
+		pack, err := git.NewPack(bytes.NewReader(packData), int64(len(packData)), 1<<20)
+		require.NoError(t, err)
+
+		// Every object must be identical to the one stored in
+		// the repository.
+		for _, line := range strings.Split(strings.TrimSpace(string(runGit(t, dir, nil, "rev-list", "--objects", "--all"))), "\n") {
+			objectIDString, _, _ := strings.Cut(line, " ")
+			objectID, err := git.NewObjectIDFromString(objectIDString)
+			require.NoError(t, err)
+			expectedType := strings.TrimSpace(string(runGit(t, dir, nil, "cat-file", "-t", objectIDString)))
+			expectedContents := runGit(t, dir, nil, "cat-file", expectedType, objectIDString)
+
+			objectType, contents, err := pack.ReadObject(objectID)
+			require.NoError(t, err)
+			require.Equal(t, expectedType, objectType.String())
+			require.Equal(t, expectedContents, contents)
+
+			objectType, sizeBytes, r, err := pack.OpenObject(objectID)
+			require.NoError(t, err)
+			require.Equal(t, expectedType, objectType.String())
+			require.Equal(t, int64(len(expectedContents)), sizeBytes)
+			contents, err = io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, expectedContents, contents)
+		}
+	})
+
+	t.Run("MissingObject", func(t *testing.T) {
+		pack, err := git.NewPack(bytes.NewReader(packData), int64(len(packData)), 1<<20)
+		require.NoError(t, err)
+
+		_, _, err = pack.ReadObject(git.ObjectID{})
+		testutil.RequireEqualStatus(t, status.Error(codes.NotFound, "Pack does not contain object 0000000000000000000000000000000000000000"), err)
+	})
+
+	t.Run("ObjectTooLarge", func(t *testing.T) {
+		_, err := git.NewPack(bytes.NewReader(packData), int64(len(packData)), 1000)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.ErrorContains(t, err, "which exceeds the maximum object size of 1000 bytes")
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		corruptedPackData := bytes.Clone(packData)
+		corruptedPackData[len(corruptedPackData)/2] ^= 1
+		_, err := git.NewPack(bytes.NewReader(corruptedPackData), int64(len(corruptedPackData)), 1<<20)
+		testutil.RequireEqualStatus(t, status.Error(codes.InvalidArgument, "Pack does not match its checksum"), err)
+	})
+}
+
+func TestNewObjectIDFromString(t *testing.T) {
+	objectID, err := git.NewObjectIDFromString("e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+	require.NoError(t, err)
+	require.Equal(t, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", objectID.String())
+
+	_, err = git.NewObjectIDFromString("e69de29b")
+	require.ErrorContains(t, err, "is not 40 hexadecimal characters long")
+	_, err = git.NewObjectIDFromString("zzzde29bb2d1d6434b8b29ae775ad8c2e48c5391")
+	require.ErrorContains(t, err, "is not hexadecimal")
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Maximum size of a pkt-line, including its four byte length prefix.
+const maximumPktLineSizeBytes = 65520
+
+// Kinds of packets that may be read using pktLineReader. Special
+// packets have a length of zero, one or two and carry no data.
+type pktLineKind int
+
+const (
+	pktLineData pktLineKind = iota
+	pktLineFlush
+	pktLineDelimiter
+	pktLineResponseEnd
+)
+
+// appendPktLine appends a data packet to a request body.
+func appendPktLine(b *bytes.Buffer, data string) {
+	fmt.Fprintf(b, "%04x%s", len(data)+4, data)
+}
+
+// pktLineReader reads packets in git's pkt-line format, as used by the
+// smart HTTP protocol.
+type pktLineReader struct {
+	r      *bufio.Reader
+	buffer [maximumPktLineSizeBytes]byte
+}
+
+func newPktLineReader(r io.Reader) *pktLineReader {
+	return &pktLineReader{r: bufio.NewReader(r)}
+}
+
+// read returns the next packet. The data returned remains valid until
+// the next call. Data packets sent by the server to report errors are
+// converted to errors.
+func (r *pktLineReader) read() (pktLineKind, []byte, error) {
+	var lengthBytes [4]byte
+	if _, err := io.ReadFull(r.r, lengthBytes[:]); err != nil {
+		return 0, nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to read packet length")
+	}
+	length, err := strconv.ParseUint(string(lengthBytes[:]), 16, 16)
+	if err != nil {
+		return 0, nil, status.Errorf(codes.Internal, "Invalid packet length %#v", string(lengthBytes[:]))
+	}
+	switch length {
+	case 0:
+		return pktLineFlush, nil, nil
+	case 1:
+		return pktLineDelimiter, nil, nil
+	case 2:
+		return pktLineResponseEnd, nil, nil
+	case 3:
+		return 0, nil, status.Error(codes.Internal, "Invalid packet length 3")
+	}
+	if length > maximumPktLineSizeBytes {
+		return 0, nil, status.Errorf(codes.Internal, "Packet length %d exceeds the maximum of %d", length, maximumPktLineSizeBytes)
+	}
+	data := r.buffer[:length-4]
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return 0, nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to read packet")
+	}
+	if message, ok := bytes.CutPrefix(data, []byte("ERR ")); ok {
+		return 0, nil, status.Errorf(codes.Internal, "Server reported error: %s", bytes.TrimSuffix(message, []byte("\n")))
+	}
+	return pktLineData, data, nil
+}
+
+// readLine reads a data packet, removing the trailing newline.
+// Special packets are reported through the returned kind.
+func (r *pktLineReader) readLine() (pktLineKind, string, error) {
+	kind, data, err := r.read()
+	if err != nil {
+		return 0, "", err
+	}
+	return kind, string(bytes.TrimSuffix(data, []byte("\n"))), nil
+}
@@ -123,13 +123,14 @@ func (x *AssetReference) GetQualifiers() []*v1.Qualifier {
 }
 
 type Asset struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Digest        *v2.Digest             `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"`
-	ExpireAt      *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"`
-	LastUpdated   *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=last_updated,json=lastUpdated,proto3" json:"last_updated,omitempty"`
-	Type          Asset_AssetType        `protobuf:"varint,4,opt,name=type,proto3,enum=buildbarn.asset.Asset_AssetType" json:"type,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Digest             *v2.Digest             `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"`
+	ExpireAt           *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"`
+	LastUpdated        *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=last_updated,json=lastUpdated,proto3" json:"last_updated,omitempty"`
+	Type               Asset_AssetType        `protobuf:"varint,4,opt,name=type,proto3,enum=buildbarn.asset.Asset_AssetType" json:"type,omitempty"`
+	UpstreamValidators *UpstreamValidators    `protobuf:"bytes,5,opt,name=upstream_validators,json=upstreamValidators,proto3" json:"upstream_validators,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *Asset) Reset() {
@@ -190,6 +191,65 @@ func (x *Asset) GetType() Asset_AssetType {
 	return Asset_BLOB
 }
 
+func (x *Asset) GetUpstreamValidators() *UpstreamValidators {
+	if x != nil {
+		return x.UpstreamValidators
+	}
+	return nil
+}
+
+type UpstreamValidators struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Etag          string                 `protobuf:"bytes,1,opt,name=etag,proto3" json:"etag,omitempty"`
+	LastModified  string                 `protobuf:"bytes,2,opt,name=last_modified,json=lastModified,proto3" json:"last_modified,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpstreamValidators) Reset() {
+	*x = UpstreamValidators{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpstreamValidators) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpstreamValidators) ProtoMessage() {}
+
+func (x *UpstreamValidators) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpstreamValidators.ProtoReflect.Descriptor instead.
+func (*UpstreamValidators) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UpstreamValidators) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *UpstreamValidators) GetLastModified() string {
+	if x != nil {
+		return x.LastModified
+	}
+	return ""
+}
+
 var File_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto protoreflect.FileDescriptor
 
 const file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_rawDesc = "" +
@@ -199,15 +259,19 @@ const file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_rawD
 	"\x04uris\x18\x01 \x03(\tR\x04uris\x12F\n" +
 	"\n" +
 	"qualifiers\x18\x02 \x03(\v2&.build.bazel.remote.asset.v1.QualifierR\n" +
-	"qualifiers\"\x9c\x02\n" +
+	"qualifiers\"\xf2\x02\n" +
 	"\x05Asset\x12?\n" +
 	"\x06digest\x18\x01 \x01(\v2'.build.bazel.remote.execution.v2.DigestR\x06digest\x127\n" +
 	"\texpire_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\bexpireAt\x12=\n" +
 	"\flast_updated\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\vlastUpdated\x124\n" +
-	"\x04type\x18\x04 \x01(\x0e2 .buildbarn.asset.Asset.AssetTypeR\x04type\"$\n" +
+	"\x04type\x18\x04 \x01(\x0e2 .buildbarn.asset.Asset.AssetTypeR\x04type\x12T\n" +
+	"\x13upstream_validators\x18\x05 \x01(\v2#.buildbarn.asset.UpstreamValidatorsR\x12upstreamValidators\"$\n" +
 	"\tAssetType\x12\b\n" +
 	"\x04BLOB\x10\x00\x12\r\n" +
-	"\tDIRECTORY\x10\x01B6Z4github.com/buildbarn/bb-remote-asset/pkg/proto/assetb\x06proto3"
+	"\tDIRECTORY\x10\x01\"M\n" +
+	"\x12UpstreamValidators\x12\x12\n" +
+	"\x04etag\x18\x01 \x01(\tR\x04etag\x12#\n" +
+	"\rlast_modified\x18\x02 \x01(\tR\flastModifiedB6Z4github.com/buildbarn/bb-remote-asset/pkg/proto/assetb\x06proto3"
 
 var (
 	file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_rawDescOnce sync.Once
@@ -222,26 +286,28 @@ func file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_rawDe
 }
 
 var file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_goTypes = []any{
 	(Asset_AssetType)(0),          // 0: buildbarn.asset.Asset.AssetType
 	(*AssetReference)(nil),        // 1: buildbarn.asset.AssetReference
 	(*Asset)(nil),                 // 2: buildbarn.asset.Asset
-	(*v1.Qualifier)(nil),          // 3: build.bazel.remote.asset.v1.Qualifier
-	(*v2.Digest)(nil),             // 4: build.bazel.remote.execution.v2.Digest
-	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+	(*UpstreamValidators)(nil),    // 3: buildbarn.asset.UpstreamValidators
+	(*v1.Qualifier)(nil),          // 4: build.bazel.remote.asset.v1.Qualifier
+	(*v2.Digest)(nil),             // 5: build.bazel.remote.execution.v2.Digest
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
 }
 var file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_depIdxs = []int32{
-	3, // 0: buildbarn.asset.AssetReference.qualifiers:type_name -> build.bazel.remote.asset.v1.Qualifier
-	4, // 1: buildbarn.asset.Asset.digest:type_name -> build.bazel.remote.execution.v2.Digest
-	5, // 2: buildbarn.asset.Asset.expire_at:type_name -> google.protobuf.Timestamp
-	5, // 3: buildbarn.asset.Asset.last_updated:type_name -> google.protobuf.Timestamp
+	4, // 0: buildbarn.asset.AssetReference.qualifiers:type_name -> build.bazel.remote.asset.v1.Qualifier
+	5, // 1: buildbarn.asset.Asset.digest:type_name -> build.bazel.remote.execution.v2.Digest
+	6, // 2: buildbarn.asset.Asset.expire_at:type_name -> google.protobuf.Timestamp
+	6, // 3: buildbarn.asset.Asset.last_updated:type_name -> google.protobuf.Timestamp
 	0, // 4: buildbarn.asset.Asset.type:type_name -> buildbarn.asset.Asset.AssetType
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	3, // 5: buildbarn.asset.Asset.upstream_validators:type_name -> buildbarn.asset.UpstreamValidators
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_init() }
@@ -255,7 +321,7 @@ func file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_init(
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_rawDesc), len(file_github_com_buildbarn_bb_remote_asset_pkg_proto_asset_asset_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   2,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
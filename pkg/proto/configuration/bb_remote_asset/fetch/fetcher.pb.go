@@ -12,6 +12,7 @@ import (
 	status "google.golang.org/genproto/googleapis/rpc/status"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -24,6 +25,55 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type FetcherConfiguration_HttpCredentialsConfiguration_Precedence int32
+
+const (
+	FetcherConfiguration_HttpCredentialsConfiguration_CLIENT      FetcherConfiguration_HttpCredentialsConfiguration_Precedence = 0
+	FetcherConfiguration_HttpCredentialsConfiguration_SERVER      FetcherConfiguration_HttpCredentialsConfiguration_Precedence = 1
+	FetcherConfiguration_HttpCredentialsConfiguration_SERVER_ONLY FetcherConfiguration_HttpCredentialsConfiguration_Precedence = 2
+)
+
+// Enum value maps for FetcherConfiguration_HttpCredentialsConfiguration_Precedence.
+var (
+	FetcherConfiguration_HttpCredentialsConfiguration_Precedence_name = map[int32]string{
+		0: "CLIENT",
+		1: "SERVER",
+		2: "SERVER_ONLY",
+	}
+	FetcherConfiguration_HttpCredentialsConfiguration_Precedence_value = map[string]int32{
+		"CLIENT":      0,
+		"SERVER":      1,
+		"SERVER_ONLY": 2,
+	}
+)
+
+func (x FetcherConfiguration_HttpCredentialsConfiguration_Precedence) Enum() *FetcherConfiguration_HttpCredentialsConfiguration_Precedence {
+	p := new(FetcherConfiguration_HttpCredentialsConfiguration_Precedence)
+	*p = x
+	return p
+}
+
+func (x FetcherConfiguration_HttpCredentialsConfiguration_Precedence) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FetcherConfiguration_HttpCredentialsConfiguration_Precedence) Descriptor() protoreflect.EnumDescriptor {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_enumTypes[0].Descriptor()
+}
+
+func (FetcherConfiguration_HttpCredentialsConfiguration_Precedence) Type() protoreflect.EnumType {
+	return &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_enumTypes[0]
+}
+
+func (x FetcherConfiguration_HttpCredentialsConfiguration_Precedence) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FetcherConfiguration_HttpCredentialsConfiguration_Precedence.Descriptor instead.
+func (FetcherConfiguration_HttpCredentialsConfiguration_Precedence) EnumDescriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 17, 0}
+}
+
 type FetcherConfiguration struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// Types that are valid to be assigned to Backend:
@@ -31,9 +81,19 @@ type FetcherConfiguration struct {
 	//	*FetcherConfiguration_Http
 	//	*FetcherConfiguration_Error
 	//	*FetcherConfiguration_RemoteExecution
-	Backend       isFetcherConfiguration_Backend `protobuf_oneof:"backend"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	//	*FetcherConfiguration_File
+	//	*FetcherConfiguration_SchemeDemultiplexing
+	//	*FetcherConfiguration_Oci
+	//	*FetcherConfiguration_S3
+	//	*FetcherConfiguration_Git
+	//	*FetcherConfiguration_ResourceTypeDemultiplexing
+	//	*FetcherConfiguration_GoModule
+	//	*FetcherConfiguration_Maven
+	Backend          isFetcherConfiguration_Backend                      `protobuf_oneof:"backend"`
+	UrlRewriter      *FetcherConfiguration_UrlRewriterConfiguration      `protobuf:"bytes,5,opt,name=url_rewriter,json=urlRewriter,proto3" json:"url_rewriter,omitempty"`
+	GitRefResolution *FetcherConfiguration_GitRefResolutionConfiguration `protobuf:"bytes,12,opt,name=git_ref_resolution,json=gitRefResolution,proto3" json:"git_ref_resolution,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *FetcherConfiguration) Reset() {
@@ -100,6 +160,92 @@ func (x *FetcherConfiguration) GetRemoteExecution() *FetcherConfiguration_Remote
 	return nil
 }
 
+func (x *FetcherConfiguration) GetFile() *FetcherConfiguration_FileFetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_File); ok {
+			return x.File
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetSchemeDemultiplexing() *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_SchemeDemultiplexing); ok {
+			return x.SchemeDemultiplexing
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetOci() *FetcherConfiguration_OciFetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_Oci); ok {
+			return x.Oci
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetS3() *FetcherConfiguration_S3FetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_S3); ok {
+			return x.S3
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetGit() *FetcherConfiguration_GitFetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_Git); ok {
+			return x.Git
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetResourceTypeDemultiplexing() *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_ResourceTypeDemultiplexing); ok {
+			return x.ResourceTypeDemultiplexing
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetGoModule() *FetcherConfiguration_GoModuleFetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_GoModule); ok {
+			return x.GoModule
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetMaven() *FetcherConfiguration_MavenFetcherConfiguration {
+	if x != nil {
+		if x, ok := x.Backend.(*FetcherConfiguration_Maven); ok {
+			return x.Maven
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetUrlRewriter() *FetcherConfiguration_UrlRewriterConfiguration {
+	if x != nil {
+		return x.UrlRewriter
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration) GetGitRefResolution() *FetcherConfiguration_GitRefResolutionConfiguration {
+	if x != nil {
+		return x.GitRefResolution
+	}
+	return nil
+}
+
 type isFetcherConfiguration_Backend interface {
 	isFetcherConfiguration_Backend()
 }
@@ -116,33 +262,86 @@ type FetcherConfiguration_RemoteExecution struct {
 	RemoteExecution *FetcherConfiguration_RemoteExecutionFetcherConfiguration `protobuf:"bytes,4,opt,name=remote_execution,json=remoteExecution,proto3,oneof"`
 }
 
+type FetcherConfiguration_File struct {
+	File *FetcherConfiguration_FileFetcherConfiguration `protobuf:"bytes,6,opt,name=file,proto3,oneof"`
+}
+
+type FetcherConfiguration_SchemeDemultiplexing struct {
+	SchemeDemultiplexing *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration `protobuf:"bytes,7,opt,name=scheme_demultiplexing,json=schemeDemultiplexing,proto3,oneof"`
+}
+
+type FetcherConfiguration_Oci struct {
+	Oci *FetcherConfiguration_OciFetcherConfiguration `protobuf:"bytes,8,opt,name=oci,proto3,oneof"`
+}
+
+type FetcherConfiguration_S3 struct {
+	S3 *FetcherConfiguration_S3FetcherConfiguration `protobuf:"bytes,9,opt,name=s3,proto3,oneof"`
+}
+
+type FetcherConfiguration_Git struct {
+	Git *FetcherConfiguration_GitFetcherConfiguration `protobuf:"bytes,10,opt,name=git,proto3,oneof"`
+}
+
+type FetcherConfiguration_ResourceTypeDemultiplexing struct {
+	ResourceTypeDemultiplexing *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration `protobuf:"bytes,11,opt,name=resource_type_demultiplexing,json=resourceTypeDemultiplexing,proto3,oneof"`
+}
+
+type FetcherConfiguration_GoModule struct {
+	GoModule *FetcherConfiguration_GoModuleFetcherConfiguration `protobuf:"bytes,13,opt,name=go_module,json=goModule,proto3,oneof"`
+}
+
+type FetcherConfiguration_Maven struct {
+	Maven *FetcherConfiguration_MavenFetcherConfiguration `protobuf:"bytes,14,opt,name=maven,proto3,oneof"`
+}
+
 func (*FetcherConfiguration_Http) isFetcherConfiguration_Backend() {}
 
 func (*FetcherConfiguration_Error) isFetcherConfiguration_Backend() {}
 
 func (*FetcherConfiguration_RemoteExecution) isFetcherConfiguration_Backend() {}
 
-type FetcherConfiguration_HttpFetcherConfiguration struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Client        *client.Configuration  `protobuf:"bytes,3,opt,name=client,proto3" json:"client,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (*FetcherConfiguration_File) isFetcherConfiguration_Backend() {}
+
+func (*FetcherConfiguration_SchemeDemultiplexing) isFetcherConfiguration_Backend() {}
+
+func (*FetcherConfiguration_Oci) isFetcherConfiguration_Backend() {}
+
+func (*FetcherConfiguration_S3) isFetcherConfiguration_Backend() {}
+
+func (*FetcherConfiguration_Git) isFetcherConfiguration_Backend() {}
+
+func (*FetcherConfiguration_ResourceTypeDemultiplexing) isFetcherConfiguration_Backend() {}
+
+func (*FetcherConfiguration_GoModule) isFetcherConfiguration_Backend() {}
+
+func (*FetcherConfiguration_Maven) isFetcherConfiguration_Backend() {}
+
+type FetcherConfiguration_OciFetcherConfiguration struct {
+	state               protoimpl.MessageState                               `protogen:"open.v1"`
+	Client              *client.Configuration                                `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	SsrfProtection      *FetcherConfiguration_SsrfProtectionConfiguration    `protobuf:"bytes,2,opt,name=ssrf_protection,json=ssrfProtection,proto3" json:"ssrf_protection,omitempty"`
+	Credentials         *FetcherConfiguration_HttpCredentialsConfiguration   `protobuf:"bytes,3,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	PlainHttpRegistries []string                                             `protobuf:"bytes,4,rep,name=plain_http_registries,json=plainHttpRegistries,proto3" json:"plain_http_registries,omitempty"`
+	ScratchStorage      *FetcherConfiguration_ScratchStorageConfiguration    `protobuf:"bytes,5,opt,name=scratch_storage,json=scratchStorage,proto3" json:"scratch_storage,omitempty"`
+	ImageExtraction     *FetcherConfiguration_ArchiveExtractionConfiguration `protobuf:"bytes,6,opt,name=image_extraction,json=imageExtraction,proto3" json:"image_extraction,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
-func (x *FetcherConfiguration_HttpFetcherConfiguration) Reset() {
-	*x = FetcherConfiguration_HttpFetcherConfiguration{}
+func (x *FetcherConfiguration_OciFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_OciFetcherConfiguration{}
 	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[1]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *FetcherConfiguration_HttpFetcherConfiguration) String() string {
+func (x *FetcherConfiguration_OciFetcherConfiguration) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FetcherConfiguration_HttpFetcherConfiguration) ProtoMessage() {}
+func (*FetcherConfiguration_OciFetcherConfiguration) ProtoMessage() {}
 
-func (x *FetcherConfiguration_HttpFetcherConfiguration) ProtoReflect() protoreflect.Message {
+func (x *FetcherConfiguration_OciFetcherConfiguration) ProtoReflect() protoreflect.Message {
 	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[1]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -154,39 +353,77 @@ func (x *FetcherConfiguration_HttpFetcherConfiguration) ProtoReflect() protorefl
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FetcherConfiguration_HttpFetcherConfiguration.ProtoReflect.Descriptor instead.
-func (*FetcherConfiguration_HttpFetcherConfiguration) Descriptor() ([]byte, []int) {
+// Deprecated: Use FetcherConfiguration_OciFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_OciFetcherConfiguration) Descriptor() ([]byte, []int) {
 	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 0}
 }
 
-func (x *FetcherConfiguration_HttpFetcherConfiguration) GetClient() *client.Configuration {
+func (x *FetcherConfiguration_OciFetcherConfiguration) GetClient() *client.Configuration {
 	if x != nil {
 		return x.Client
 	}
 	return nil
 }
 
-type FetcherConfiguration_RemoteExecutionFetcherConfiguration struct {
-	state           protoimpl.MessageState    `protogen:"open.v1"`
-	ExecutionClient *grpc.ClientConfiguration `protobuf:"bytes,2,opt,name=execution_client,json=executionClient,proto3" json:"execution_client,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+func (x *FetcherConfiguration_OciFetcherConfiguration) GetSsrfProtection() *FetcherConfiguration_SsrfProtectionConfiguration {
+	if x != nil {
+		return x.SsrfProtection
+	}
+	return nil
 }
 
-func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) Reset() {
-	*x = FetcherConfiguration_RemoteExecutionFetcherConfiguration{}
+func (x *FetcherConfiguration_OciFetcherConfiguration) GetCredentials() *FetcherConfiguration_HttpCredentialsConfiguration {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_OciFetcherConfiguration) GetPlainHttpRegistries() []string {
+	if x != nil {
+		return x.PlainHttpRegistries
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_OciFetcherConfiguration) GetScratchStorage() *FetcherConfiguration_ScratchStorageConfiguration {
+	if x != nil {
+		return x.ScratchStorage
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_OciFetcherConfiguration) GetImageExtraction() *FetcherConfiguration_ArchiveExtractionConfiguration {
+	if x != nil {
+		return x.ImageExtraction
+	}
+	return nil
+}
+
+type FetcherConfiguration_S3FetcherConfiguration struct {
+	state          protoimpl.MessageState                                `protogen:"open.v1"`
+	Client         *client.Configuration                                 `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	SsrfProtection *FetcherConfiguration_SsrfProtectionConfiguration     `protobuf:"bytes,2,opt,name=ssrf_protection,json=ssrfProtection,proto3" json:"ssrf_protection,omitempty"`
+	Buckets        []*FetcherConfiguration_S3FetcherConfiguration_Bucket `protobuf:"bytes,3,rep,name=buckets,proto3" json:"buckets,omitempty"`
+	ScratchStorage *FetcherConfiguration_ScratchStorageConfiguration     `protobuf:"bytes,4,opt,name=scratch_storage,json=scratchStorage,proto3" json:"scratch_storage,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_S3FetcherConfiguration{}
 	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) String() string {
+func (x *FetcherConfiguration_S3FetcherConfiguration) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FetcherConfiguration_RemoteExecutionFetcherConfiguration) ProtoMessage() {}
+func (*FetcherConfiguration_S3FetcherConfiguration) ProtoMessage() {}
 
-func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) ProtoReflect() protoreflect.Message {
+func (x *FetcherConfiguration_S3FetcherConfiguration) ProtoReflect() protoreflect.Message {
 	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -198,91 +435,2355 @@ func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) ProtoReflect(
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FetcherConfiguration_RemoteExecutionFetcherConfiguration.ProtoReflect.Descriptor instead.
-func (*FetcherConfiguration_RemoteExecutionFetcherConfiguration) Descriptor() ([]byte, []int) {
+// Deprecated: Use FetcherConfiguration_S3FetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_S3FetcherConfiguration) Descriptor() ([]byte, []int) {
 	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 1}
 }
 
-func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) GetExecutionClient() *grpc.ClientConfiguration {
+func (x *FetcherConfiguration_S3FetcherConfiguration) GetClient() *client.Configuration {
 	if x != nil {
-		return x.ExecutionClient
+		return x.Client
 	}
 	return nil
 }
 
-var File_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto protoreflect.FileDescriptor
+func (x *FetcherConfiguration_S3FetcherConfiguration) GetSsrfProtection() *FetcherConfiguration_SsrfProtectionConfiguration {
+	if x != nil {
+		return x.SsrfProtection
+	}
+	return nil
+}
 
-const file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc = "" +
-	"\n" +
-	"`github.com/buildbarn/bb-remote-asset/pkg/proto/configuration/bb_remote_asset/fetch/fetcher.proto\x12-buildbarn.configuration.bb_remote_asset.fetch\x1a\x17google/rpc/status.proto\x1aGgithub.com/buildbarn/bb-storage/pkg/proto/configuration/grpc/grpc.proto\x1aPgithub.com/buildbarn/bb-storage/pkg/proto/configuration/http/client/client.proto\"\xd8\x04\n" +
-	"\x14FetcherConfiguration\x12r\n" +
-	"\x04http\x18\x02 \x01(\v2\\.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfigurationH\x00R\x04http\x12*\n" +
-	"\x05error\x18\x03 \x01(\v2\x12.google.rpc.StatusH\x00R\x05error\x12\x94\x01\n" +
-	"\x10remote_execution\x18\x04 \x01(\v2g.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfigurationH\x00R\x0fremoteExecution\x1ar\n" +
-	"\x18HttpFetcherConfiguration\x12J\n" +
-	"\x06client\x18\x03 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06clientJ\x04\b\x01\x10\x02J\x04\b\x02\x10\x03\x1a\x83\x01\n" +
-	"#RemoteExecutionFetcherConfiguration\x12\\\n" +
-	"\x10execution_client\x18\x02 \x01(\v21.buildbarn.configuration.grpc.ClientConfigurationR\x0fexecutionClientB\t\n" +
-	"\abackendJ\x04\b\x01\x10\x02BTZRgithub.com/buildbarn/bb-remote-asset/pkg/proto/configuration/bb_remote_asset/fetchb\x06proto3"
+func (x *FetcherConfiguration_S3FetcherConfiguration) GetBuckets() []*FetcherConfiguration_S3FetcherConfiguration_Bucket {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
 
-var (
-	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescOnce sync.Once
-	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescData []byte
-)
+func (x *FetcherConfiguration_S3FetcherConfiguration) GetScratchStorage() *FetcherConfiguration_ScratchStorageConfiguration {
+	if x != nil {
+		return x.ScratchStorage
+	}
+	return nil
+}
 
-func file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP() []byte {
-	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescOnce.Do(func() {
-		file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc), len(file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc)))
-	})
-	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescData
+type FetcherConfiguration_GitFetcherConfiguration struct {
+	state          protoimpl.MessageState                               `protogen:"open.v1"`
+	Client         *client.Configuration                                `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	SsrfProtection *FetcherConfiguration_SsrfProtectionConfiguration    `protobuf:"bytes,2,opt,name=ssrf_protection,json=ssrfProtection,proto3" json:"ssrf_protection,omitempty"`
+	Credentials    *FetcherConfiguration_HttpCredentialsConfiguration   `protobuf:"bytes,3,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	ScratchStorage *FetcherConfiguration_ScratchStorageConfiguration    `protobuf:"bytes,4,opt,name=scratch_storage,json=scratchStorage,proto3" json:"scratch_storage,omitempty"`
+	CheckoutLimits *FetcherConfiguration_ArchiveExtractionConfiguration `protobuf:"bytes,5,opt,name=checkout_limits,json=checkoutLimits,proto3" json:"checkout_limits,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
-var file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
-var file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_goTypes = []any{
-	(*FetcherConfiguration)(nil),                                     // 0: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration
-	(*FetcherConfiguration_HttpFetcherConfiguration)(nil),            // 1: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration
-	(*FetcherConfiguration_RemoteExecutionFetcherConfiguration)(nil), // 2: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfiguration
-	(*status.Status)(nil),                                            // 3: google.rpc.Status
-	(*client.Configuration)(nil),                                     // 4: buildbarn.configuration.http.client.Configuration
-	(*grpc.ClientConfiguration)(nil),                                 // 5: buildbarn.configuration.grpc.ClientConfiguration
+func (x *FetcherConfiguration_GitFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_GitFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
-var file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_depIdxs = []int32{
-	1, // 0: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.http:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration
-	3, // 1: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.error:type_name -> google.rpc.Status
-	2, // 2: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.remote_execution:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfiguration
-	4, // 3: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
-	5, // 4: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfiguration.execution_client:type_name -> buildbarn.configuration.grpc.ClientConfiguration
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+
+func (x *FetcherConfiguration_GitFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func init() {
-	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_init()
+func (*FetcherConfiguration_GitFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_GitFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
-func file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_init() {
-	if File_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto != nil {
-		return
+
+// Deprecated: Use FetcherConfiguration_GitFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_GitFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 2}
+}
+
+func (x *FetcherConfiguration_GitFetcherConfiguration) GetClient() *client.Configuration {
+	if x != nil {
+		return x.Client
 	}
-	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[0].OneofWrappers = []any{
-		(*FetcherConfiguration_Http)(nil),
-		(*FetcherConfiguration_Error)(nil),
-		(*FetcherConfiguration_RemoteExecution)(nil),
+	return nil
+}
+
+func (x *FetcherConfiguration_GitFetcherConfiguration) GetSsrfProtection() *FetcherConfiguration_SsrfProtectionConfiguration {
+	if x != nil {
+		return x.SsrfProtection
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GitFetcherConfiguration) GetCredentials() *FetcherConfiguration_HttpCredentialsConfiguration {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GitFetcherConfiguration) GetScratchStorage() *FetcherConfiguration_ScratchStorageConfiguration {
+	if x != nil {
+		return x.ScratchStorage
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GitFetcherConfiguration) GetCheckoutLimits() *FetcherConfiguration_ArchiveExtractionConfiguration {
+	if x != nil {
+		return x.CheckoutLimits
+	}
+	return nil
+}
+
+type FetcherConfiguration_GoModuleFetcherConfiguration struct {
+	state            protoimpl.MessageState                                `protogen:"open.v1"`
+	Client           *client.Configuration                                 `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	SsrfProtection   *FetcherConfiguration_SsrfProtectionConfiguration     `protobuf:"bytes,2,opt,name=ssrf_protection,json=ssrfProtection,proto3" json:"ssrf_protection,omitempty"`
+	Credentials      *FetcherConfiguration_HttpCredentialsConfiguration    `protobuf:"bytes,3,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	ScratchStorage   *FetcherConfiguration_ScratchStorageConfiguration     `protobuf:"bytes,4,opt,name=scratch_storage,json=scratchStorage,proto3" json:"scratch_storage,omitempty"`
+	Proxy            string                                                `protobuf:"bytes,5,opt,name=proxy,proto3" json:"proxy,omitempty"`
+	ChecksumDatabase *FetcherConfiguration_GoChecksumDatabaseConfiguration `protobuf:"bytes,6,opt,name=checksum_database,json=checksumDatabase,proto3" json:"checksum_database,omitempty"`
+	ExtractionLimits *FetcherConfiguration_ArchiveExtractionConfiguration  `protobuf:"bytes,7,opt,name=extraction_limits,json=extractionLimits,proto3" json:"extraction_limits,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_GoModuleFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_GoModuleFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_GoModuleFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_GoModuleFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 3}
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) GetClient() *client.Configuration {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) GetSsrfProtection() *FetcherConfiguration_SsrfProtectionConfiguration {
+	if x != nil {
+		return x.SsrfProtection
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) GetCredentials() *FetcherConfiguration_HttpCredentialsConfiguration {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) GetScratchStorage() *FetcherConfiguration_ScratchStorageConfiguration {
+	if x != nil {
+		return x.ScratchStorage
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) GetProxy() string {
+	if x != nil {
+		return x.Proxy
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) GetChecksumDatabase() *FetcherConfiguration_GoChecksumDatabaseConfiguration {
+	if x != nil {
+		return x.ChecksumDatabase
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GoModuleFetcherConfiguration) GetExtractionLimits() *FetcherConfiguration_ArchiveExtractionConfiguration {
+	if x != nil {
+		return x.ExtractionLimits
+	}
+	return nil
+}
+
+type FetcherConfiguration_GoChecksumDatabaseConfiguration struct {
+	state                  protoimpl.MessageState `protogen:"open.v1"`
+	VerifierKey            string                 `protobuf:"bytes,1,opt,name=verifier_key,json=verifierKey,proto3" json:"verifier_key,omitempty"`
+	Url                    string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	ExcludedModulePatterns []string               `protobuf:"bytes,3,rep,name=excluded_module_patterns,json=excludedModulePatterns,proto3" json:"excluded_module_patterns,omitempty"`
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_GoChecksumDatabaseConfiguration) Reset() {
+	*x = FetcherConfiguration_GoChecksumDatabaseConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_GoChecksumDatabaseConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_GoChecksumDatabaseConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_GoChecksumDatabaseConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_GoChecksumDatabaseConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_GoChecksumDatabaseConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 4}
+}
+
+func (x *FetcherConfiguration_GoChecksumDatabaseConfiguration) GetVerifierKey() string {
+	if x != nil {
+		return x.VerifierKey
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_GoChecksumDatabaseConfiguration) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_GoChecksumDatabaseConfiguration) GetExcludedModulePatterns() []string {
+	if x != nil {
+		return x.ExcludedModulePatterns
+	}
+	return nil
+}
+
+type FetcherConfiguration_MavenFetcherConfiguration struct {
+	state          protoimpl.MessageState                                       `protogen:"open.v1"`
+	Client         *client.Configuration                                        `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	SsrfProtection *FetcherConfiguration_SsrfProtectionConfiguration            `protobuf:"bytes,2,opt,name=ssrf_protection,json=ssrfProtection,proto3" json:"ssrf_protection,omitempty"`
+	Repositories   []*FetcherConfiguration_MavenFetcherConfiguration_Repository `protobuf:"bytes,3,rep,name=repositories,proto3" json:"repositories,omitempty"`
+	ScratchStorage *FetcherConfiguration_ScratchStorageConfiguration            `protobuf:"bytes,4,opt,name=scratch_storage,json=scratchStorage,proto3" json:"scratch_storage,omitempty"`
+	Credentials    *FetcherConfiguration_HttpCredentialsConfiguration           `protobuf:"bytes,5,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_MavenFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_MavenFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_MavenFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_MavenFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 5}
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) GetClient() *client.Configuration {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) GetSsrfProtection() *FetcherConfiguration_SsrfProtectionConfiguration {
+	if x != nil {
+		return x.SsrfProtection
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) GetRepositories() []*FetcherConfiguration_MavenFetcherConfiguration_Repository {
+	if x != nil {
+		return x.Repositories
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) GetScratchStorage() *FetcherConfiguration_ScratchStorageConfiguration {
+	if x != nil {
+		return x.ScratchStorage
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration) GetCredentials() *FetcherConfiguration_HttpCredentialsConfiguration {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+type FetcherConfiguration_FileFetcherConfiguration struct {
+	state                  protoimpl.MessageState                            `protogen:"open.v1"`
+	AllowedRootDirectories []string                                          `protobuf:"bytes,1,rep,name=allowed_root_directories,json=allowedRootDirectories,proto3" json:"allowed_root_directories,omitempty"`
+	ScratchStorage         *FetcherConfiguration_ScratchStorageConfiguration `protobuf:"bytes,2,opt,name=scratch_storage,json=scratchStorage,proto3" json:"scratch_storage,omitempty"`
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_FileFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_FileFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_FileFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_FileFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_FileFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_FileFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_FileFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 6}
+}
+
+func (x *FetcherConfiguration_FileFetcherConfiguration) GetAllowedRootDirectories() []string {
+	if x != nil {
+		return x.AllowedRootDirectories
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_FileFetcherConfiguration) GetScratchStorage() *FetcherConfiguration_ScratchStorageConfiguration {
+	if x != nil {
+		return x.ScratchStorage
+	}
+	return nil
+}
+
+type FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration struct {
+	state         protoimpl.MessageState                                                   `protogen:"open.v1"`
+	Backends      []*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend `protobuf:"bytes,1,rep,name=backends,proto3" json:"backends,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 7}
+}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration) GetBackends() []*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend {
+	if x != nil {
+		return x.Backends
+	}
+	return nil
+}
+
+type FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration struct {
+	state          protoimpl.MessageState                                                         `protogen:"open.v1"`
+	Backends       []*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend `protobuf:"bytes,1,rep,name=backends,proto3" json:"backends,omitempty"`
+	DefaultFetcher *FetcherConfiguration                                                          `protobuf:"bytes,2,opt,name=default_fetcher,json=defaultFetcher,proto3" json:"default_fetcher,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 8}
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration) GetBackends() []*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend {
+	if x != nil {
+		return x.Backends
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration) GetDefaultFetcher() *FetcherConfiguration {
+	if x != nil {
+		return x.DefaultFetcher
+	}
+	return nil
+}
+
+type FetcherConfiguration_GitRefResolutionConfiguration struct {
+	state          protoimpl.MessageState                             `protogen:"open.v1"`
+	Client         *client.Configuration                              `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	SsrfProtection *FetcherConfiguration_SsrfProtectionConfiguration  `protobuf:"bytes,2,opt,name=ssrf_protection,json=ssrfProtection,proto3" json:"ssrf_protection,omitempty"`
+	Credentials    *FetcherConfiguration_HttpCredentialsConfiguration `protobuf:"bytes,3,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_GitRefResolutionConfiguration) Reset() {
+	*x = FetcherConfiguration_GitRefResolutionConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_GitRefResolutionConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_GitRefResolutionConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_GitRefResolutionConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_GitRefResolutionConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_GitRefResolutionConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 9}
+}
+
+func (x *FetcherConfiguration_GitRefResolutionConfiguration) GetClient() *client.Configuration {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GitRefResolutionConfiguration) GetSsrfProtection() *FetcherConfiguration_SsrfProtectionConfiguration {
+	if x != nil {
+		return x.SsrfProtection
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_GitRefResolutionConfiguration) GetCredentials() *FetcherConfiguration_HttpCredentialsConfiguration {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+type FetcherConfiguration_UrlRewriterConfiguration struct {
+	state             protoimpl.MessageState                                   `protogen:"open.v1"`
+	Rewrites          []*FetcherConfiguration_UrlRewriterConfiguration_Rewrite `protobuf:"bytes,1,rep,name=rewrites,proto3" json:"rewrites,omitempty"`
+	AllowedHosts      []string                                                 `protobuf:"bytes,2,rep,name=allowed_hosts,json=allowedHosts,proto3" json:"allowed_hosts,omitempty"`
+	BlockedHosts      []string                                                 `protobuf:"bytes,3,rep,name=blocked_hosts,json=blockedHosts,proto3" json:"blocked_hosts,omitempty"`
+	AllBlockedMessage string                                                   `protobuf:"bytes,4,opt,name=all_blocked_message,json=allBlockedMessage,proto3" json:"all_blocked_message,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration) Reset() {
+	*x = FetcherConfiguration_UrlRewriterConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_UrlRewriterConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_UrlRewriterConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_UrlRewriterConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 10}
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration) GetRewrites() []*FetcherConfiguration_UrlRewriterConfiguration_Rewrite {
+	if x != nil {
+		return x.Rewrites
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration) GetAllowedHosts() []string {
+	if x != nil {
+		return x.AllowedHosts
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration) GetBlockedHosts() []string {
+	if x != nil {
+		return x.BlockedHosts
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration) GetAllBlockedMessage() string {
+	if x != nil {
+		return x.AllBlockedMessage
+	}
+	return ""
+}
+
+type FetcherConfiguration_HttpFetcherConfiguration struct {
+	state                        protoimpl.MessageState                                  `protogen:"open.v1"`
+	Client                       *client.Configuration                                   `protobuf:"bytes,3,opt,name=client,proto3" json:"client,omitempty"`
+	PerUriTimeout                *durationpb.Duration                                    `protobuf:"bytes,4,opt,name=per_uri_timeout,json=perUriTimeout,proto3" json:"per_uri_timeout,omitempty"`
+	HedgingDelay                 *durationpb.Duration                                    `protobuf:"bytes,5,opt,name=hedging_delay,json=hedgingDelay,proto3" json:"hedging_delay,omitempty"`
+	MaximumResumeAttempts        uint32                                                  `protobuf:"varint,6,opt,name=maximum_resume_attempts,json=maximumResumeAttempts,proto3" json:"maximum_resume_attempts,omitempty"`
+	ArchiveExtraction            *FetcherConfiguration_ArchiveExtractionConfiguration    `protobuf:"bytes,7,opt,name=archive_extraction,json=archiveExtraction,proto3" json:"archive_extraction,omitempty"`
+	SkipDownloadsOfExistingBlobs bool                                                    `protobuf:"varint,8,opt,name=skip_downloads_of_existing_blobs,json=skipDownloadsOfExistingBlobs,proto3" json:"skip_downloads_of_existing_blobs,omitempty"`
+	Credentials                  *FetcherConfiguration_HttpCredentialsConfiguration      `protobuf:"bytes,9,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	SsrfProtection               *FetcherConfiguration_SsrfProtectionConfiguration       `protobuf:"bytes,10,opt,name=ssrf_protection,json=ssrfProtection,proto3" json:"ssrf_protection,omitempty"`
+	DownloadSizeLimits           *FetcherConfiguration_DownloadSizeLimitsConfiguration   `protobuf:"bytes,11,opt,name=download_size_limits,json=downloadSizeLimits,proto3" json:"download_size_limits,omitempty"`
+	RetryPolicy                  *FetcherConfiguration_RetryPolicyConfiguration          `protobuf:"bytes,12,opt,name=retry_policy,json=retryPolicy,proto3" json:"retry_policy,omitempty"`
+	ScratchStorage               *FetcherConfiguration_ScratchStorageConfiguration       `protobuf:"bytes,13,opt,name=scratch_storage,json=scratchStorage,proto3" json:"scratch_storage,omitempty"`
+	ChecksumFilePolicies         []*FetcherConfiguration_ChecksumFilePolicyConfiguration `protobuf:"bytes,14,rep,name=checksum_file_policies,json=checksumFilePolicies,proto3" json:"checksum_file_policies,omitempty"`
+	unknownFields                protoimpl.UnknownFields
+	sizeCache                    protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_HttpFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_HttpFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_HttpFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_HttpFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 11}
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetClient() *client.Configuration {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetPerUriTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.PerUriTimeout
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetHedgingDelay() *durationpb.Duration {
+	if x != nil {
+		return x.HedgingDelay
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetMaximumResumeAttempts() uint32 {
+	if x != nil {
+		return x.MaximumResumeAttempts
+	}
+	return 0
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetArchiveExtraction() *FetcherConfiguration_ArchiveExtractionConfiguration {
+	if x != nil {
+		return x.ArchiveExtraction
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetSkipDownloadsOfExistingBlobs() bool {
+	if x != nil {
+		return x.SkipDownloadsOfExistingBlobs
+	}
+	return false
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetCredentials() *FetcherConfiguration_HttpCredentialsConfiguration {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetSsrfProtection() *FetcherConfiguration_SsrfProtectionConfiguration {
+	if x != nil {
+		return x.SsrfProtection
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetDownloadSizeLimits() *FetcherConfiguration_DownloadSizeLimitsConfiguration {
+	if x != nil {
+		return x.DownloadSizeLimits
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetRetryPolicy() *FetcherConfiguration_RetryPolicyConfiguration {
+	if x != nil {
+		return x.RetryPolicy
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetScratchStorage() *FetcherConfiguration_ScratchStorageConfiguration {
+	if x != nil {
+		return x.ScratchStorage
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpFetcherConfiguration) GetChecksumFilePolicies() []*FetcherConfiguration_ChecksumFilePolicyConfiguration {
+	if x != nil {
+		return x.ChecksumFilePolicies
+	}
+	return nil
+}
+
+type FetcherConfiguration_ChecksumFilePolicyConfiguration struct {
+	state         protoimpl.MessageState                                               `protogen:"open.v1"`
+	UrlPatterns   []string                                                             `protobuf:"bytes,1,rep,name=url_patterns,json=urlPatterns,proto3" json:"url_patterns,omitempty"`
+	ChecksumFiles []*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile `protobuf:"bytes,2,rep,name=checksum_files,json=checksumFiles,proto3" json:"checksum_files,omitempty"`
+	Required      bool                                                                 `protobuf:"varint,3,opt,name=required,proto3" json:"required,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration) Reset() {
+	*x = FetcherConfiguration_ChecksumFilePolicyConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_ChecksumFilePolicyConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_ChecksumFilePolicyConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_ChecksumFilePolicyConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 12}
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration) GetUrlPatterns() []string {
+	if x != nil {
+		return x.UrlPatterns
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration) GetChecksumFiles() []*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile {
+	if x != nil {
+		return x.ChecksumFiles
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration) GetRequired() bool {
+	if x != nil {
+		return x.Required
+	}
+	return false
+}
+
+type FetcherConfiguration_ScratchStorageConfiguration struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	Directory                string                 `protobuf:"bytes,1,opt,name=directory,proto3" json:"directory,omitempty"`
+	MaximumSizeBytes         int64                  `protobuf:"varint,2,opt,name=maximum_size_bytes,json=maximumSizeBytes,proto3" json:"maximum_size_bytes,omitempty"`
+	MaximumInMemorySizeBytes int64                  `protobuf:"varint,3,opt,name=maximum_in_memory_size_bytes,json=maximumInMemorySizeBytes,proto3" json:"maximum_in_memory_size_bytes,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_ScratchStorageConfiguration) Reset() {
+	*x = FetcherConfiguration_ScratchStorageConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_ScratchStorageConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_ScratchStorageConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_ScratchStorageConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_ScratchStorageConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_ScratchStorageConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 13}
+}
+
+func (x *FetcherConfiguration_ScratchStorageConfiguration) GetDirectory() string {
+	if x != nil {
+		return x.Directory
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_ScratchStorageConfiguration) GetMaximumSizeBytes() int64 {
+	if x != nil {
+		return x.MaximumSizeBytes
+	}
+	return 0
+}
+
+func (x *FetcherConfiguration_ScratchStorageConfiguration) GetMaximumInMemorySizeBytes() int64 {
+	if x != nil {
+		return x.MaximumInMemorySizeBytes
+	}
+	return 0
+}
+
+type FetcherConfiguration_RetryPolicyConfiguration struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	MaximumAttempts      uint32                 `protobuf:"varint,1,opt,name=maximum_attempts,json=maximumAttempts,proto3" json:"maximum_attempts,omitempty"`
+	InitialBackoff       *durationpb.Duration   `protobuf:"bytes,2,opt,name=initial_backoff,json=initialBackoff,proto3" json:"initial_backoff,omitempty"`
+	MaximumBackoff       *durationpb.Duration   `protobuf:"bytes,3,opt,name=maximum_backoff,json=maximumBackoff,proto3" json:"maximum_backoff,omitempty"`
+	BackoffMultiplier    float64                `protobuf:"fixed64,4,opt,name=backoff_multiplier,json=backoffMultiplier,proto3" json:"backoff_multiplier,omitempty"`
+	RetryableStatusCodes []uint32               `protobuf:"varint,5,rep,packed,name=retryable_status_codes,json=retryableStatusCodes,proto3" json:"retryable_status_codes,omitempty"`
+	RetryNetworkErrors   bool                   `protobuf:"varint,6,opt,name=retry_network_errors,json=retryNetworkErrors,proto3" json:"retry_network_errors,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) Reset() {
+	*x = FetcherConfiguration_RetryPolicyConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_RetryPolicyConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_RetryPolicyConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_RetryPolicyConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 14}
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) GetMaximumAttempts() uint32 {
+	if x != nil {
+		return x.MaximumAttempts
+	}
+	return 0
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) GetInitialBackoff() *durationpb.Duration {
+	if x != nil {
+		return x.InitialBackoff
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) GetMaximumBackoff() *durationpb.Duration {
+	if x != nil {
+		return x.MaximumBackoff
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) GetBackoffMultiplier() float64 {
+	if x != nil {
+		return x.BackoffMultiplier
+	}
+	return 0
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) GetRetryableStatusCodes() []uint32 {
+	if x != nil {
+		return x.RetryableStatusCodes
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_RetryPolicyConfiguration) GetRetryNetworkErrors() bool {
+	if x != nil {
+		return x.RetryNetworkErrors
+	}
+	return false
+}
+
+type FetcherConfiguration_DownloadSizeLimitsConfiguration struct {
+	state                   protoimpl.MessageState                                           `protogen:"open.v1"`
+	DefaultMaximumSizeBytes int64                                                            `protobuf:"varint,1,opt,name=default_maximum_size_bytes,json=defaultMaximumSizeBytes,proto3" json:"default_maximum_size_bytes,omitempty"`
+	Overrides               []*FetcherConfiguration_DownloadSizeLimitsConfiguration_Override `protobuf:"bytes,2,rep,name=overrides,proto3" json:"overrides,omitempty"`
+	unknownFields           protoimpl.UnknownFields
+	sizeCache               protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration) Reset() {
+	*x = FetcherConfiguration_DownloadSizeLimitsConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_DownloadSizeLimitsConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_DownloadSizeLimitsConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_DownloadSizeLimitsConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 15}
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration) GetDefaultMaximumSizeBytes() int64 {
+	if x != nil {
+		return x.DefaultMaximumSizeBytes
+	}
+	return 0
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration) GetOverrides() []*FetcherConfiguration_DownloadSizeLimitsConfiguration_Override {
+	if x != nil {
+		return x.Overrides
+	}
+	return nil
+}
+
+type FetcherConfiguration_SsrfProtectionConfiguration struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Disabled        bool                   `protobuf:"varint,1,opt,name=disabled,proto3" json:"disabled,omitempty"`
+	DeniedNetworks  []string               `protobuf:"bytes,2,rep,name=denied_networks,json=deniedNetworks,proto3" json:"denied_networks,omitempty"`
+	AllowedNetworks []string               `protobuf:"bytes,3,rep,name=allowed_networks,json=allowedNetworks,proto3" json:"allowed_networks,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_SsrfProtectionConfiguration) Reset() {
+	*x = FetcherConfiguration_SsrfProtectionConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_SsrfProtectionConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_SsrfProtectionConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_SsrfProtectionConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_SsrfProtectionConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_SsrfProtectionConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 16}
+}
+
+func (x *FetcherConfiguration_SsrfProtectionConfiguration) GetDisabled() bool {
+	if x != nil {
+		return x.Disabled
+	}
+	return false
+}
+
+func (x *FetcherConfiguration_SsrfProtectionConfiguration) GetDeniedNetworks() []string {
+	if x != nil {
+		return x.DeniedNetworks
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_SsrfProtectionConfiguration) GetAllowedNetworks() []string {
+	if x != nil {
+		return x.AllowedNetworks
+	}
+	return nil
+}
+
+type FetcherConfiguration_HttpCredentialsConfiguration struct {
+	state             protoimpl.MessageState                                       `protogen:"open.v1"`
+	Credentials       []*FetcherConfiguration_HttpCredential                       `protobuf:"bytes,1,rep,name=credentials,proto3" json:"credentials,omitempty"`
+	NetrcPaths        []string                                                     `protobuf:"bytes,2,rep,name=netrc_paths,json=netrcPaths,proto3" json:"netrc_paths,omitempty"`
+	Precedence        FetcherConfiguration_HttpCredentialsConfiguration_Precedence `protobuf:"varint,3,opt,name=precedence,proto3,enum=buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration_HttpCredentialsConfiguration_Precedence" json:"precedence,omitempty"`
+	CredentialHelpers []*FetcherConfiguration_CredentialHelper                     `protobuf:"bytes,4,rep,name=credential_helpers,json=credentialHelpers,proto3" json:"credential_helpers,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_HttpCredentialsConfiguration) Reset() {
+	*x = FetcherConfiguration_HttpCredentialsConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_HttpCredentialsConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_HttpCredentialsConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_HttpCredentialsConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_HttpCredentialsConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_HttpCredentialsConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 17}
+}
+
+func (x *FetcherConfiguration_HttpCredentialsConfiguration) GetCredentials() []*FetcherConfiguration_HttpCredential {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpCredentialsConfiguration) GetNetrcPaths() []string {
+	if x != nil {
+		return x.NetrcPaths
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpCredentialsConfiguration) GetPrecedence() FetcherConfiguration_HttpCredentialsConfiguration_Precedence {
+	if x != nil {
+		return x.Precedence
+	}
+	return FetcherConfiguration_HttpCredentialsConfiguration_CLIENT
+}
+
+func (x *FetcherConfiguration_HttpCredentialsConfiguration) GetCredentialHelpers() []*FetcherConfiguration_CredentialHelper {
+	if x != nil {
+		return x.CredentialHelpers
+	}
+	return nil
+}
+
+type FetcherConfiguration_CredentialHelper struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	Path                 string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Arguments            []string               `protobuf:"bytes,2,rep,name=arguments,proto3" json:"arguments,omitempty"`
+	UrlPatterns          []string               `protobuf:"bytes,3,rep,name=url_patterns,json=urlPatterns,proto3" json:"url_patterns,omitempty"`
+	Timeout              *durationpb.Duration   `protobuf:"bytes,4,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	DefaultCacheDuration *durationpb.Duration   `protobuf:"bytes,5,opt,name=default_cache_duration,json=defaultCacheDuration,proto3" json:"default_cache_duration,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_CredentialHelper) Reset() {
+	*x = FetcherConfiguration_CredentialHelper{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_CredentialHelper) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_CredentialHelper) ProtoMessage() {}
+
+func (x *FetcherConfiguration_CredentialHelper) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_CredentialHelper.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_CredentialHelper) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 18}
+}
+
+func (x *FetcherConfiguration_CredentialHelper) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_CredentialHelper) GetArguments() []string {
+	if x != nil {
+		return x.Arguments
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_CredentialHelper) GetUrlPatterns() []string {
+	if x != nil {
+		return x.UrlPatterns
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_CredentialHelper) GetTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.Timeout
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_CredentialHelper) GetDefaultCacheDuration() *durationpb.Duration {
+	if x != nil {
+		return x.DefaultCacheDuration
+	}
+	return nil
+}
+
+type FetcherConfiguration_HttpCredential struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	UrlPatterns []string               `protobuf:"bytes,1,rep,name=url_patterns,json=urlPatterns,proto3" json:"url_patterns,omitempty"`
+	// Types that are valid to be assigned to Credential:
+	//
+	//	*FetcherConfiguration_HttpCredential_Headers_
+	//	*FetcherConfiguration_HttpCredential_BasicAuth_
+	//	*FetcherConfiguration_HttpCredential_BearerTokenPath
+	Credential    isFetcherConfiguration_HttpCredential_Credential `protobuf_oneof:"credential"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_HttpCredential) Reset() {
+	*x = FetcherConfiguration_HttpCredential{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_HttpCredential) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_HttpCredential) ProtoMessage() {}
+
+func (x *FetcherConfiguration_HttpCredential) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_HttpCredential.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_HttpCredential) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 19}
+}
+
+func (x *FetcherConfiguration_HttpCredential) GetUrlPatterns() []string {
+	if x != nil {
+		return x.UrlPatterns
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpCredential) GetCredential() isFetcherConfiguration_HttpCredential_Credential {
+	if x != nil {
+		return x.Credential
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpCredential) GetHeaders() *FetcherConfiguration_HttpCredential_Headers {
+	if x != nil {
+		if x, ok := x.Credential.(*FetcherConfiguration_HttpCredential_Headers_); ok {
+			return x.Headers
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpCredential) GetBasicAuth() *FetcherConfiguration_HttpCredential_BasicAuth {
+	if x != nil {
+		if x, ok := x.Credential.(*FetcherConfiguration_HttpCredential_BasicAuth_); ok {
+			return x.BasicAuth
+		}
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_HttpCredential) GetBearerTokenPath() string {
+	if x != nil {
+		if x, ok := x.Credential.(*FetcherConfiguration_HttpCredential_BearerTokenPath); ok {
+			return x.BearerTokenPath
+		}
+	}
+	return ""
+}
+
+type isFetcherConfiguration_HttpCredential_Credential interface {
+	isFetcherConfiguration_HttpCredential_Credential()
+}
+
+type FetcherConfiguration_HttpCredential_Headers_ struct {
+	Headers *FetcherConfiguration_HttpCredential_Headers `protobuf:"bytes,2,opt,name=headers,proto3,oneof"`
+}
+
+type FetcherConfiguration_HttpCredential_BasicAuth_ struct {
+	BasicAuth *FetcherConfiguration_HttpCredential_BasicAuth `protobuf:"bytes,3,opt,name=basic_auth,json=basicAuth,proto3,oneof"`
+}
+
+type FetcherConfiguration_HttpCredential_BearerTokenPath struct {
+	BearerTokenPath string `protobuf:"bytes,4,opt,name=bearer_token_path,json=bearerTokenPath,proto3,oneof"`
+}
+
+func (*FetcherConfiguration_HttpCredential_Headers_) isFetcherConfiguration_HttpCredential_Credential() {
+}
+
+func (*FetcherConfiguration_HttpCredential_BasicAuth_) isFetcherConfiguration_HttpCredential_Credential() {
+}
+
+func (*FetcherConfiguration_HttpCredential_BearerTokenPath) isFetcherConfiguration_HttpCredential_Credential() {
+}
+
+type FetcherConfiguration_ArchiveExtractionConfiguration struct {
+	state                     protoimpl.MessageState `protogen:"open.v1"`
+	MaximumExtractedSizeBytes int64                  `protobuf:"varint,1,opt,name=maximum_extracted_size_bytes,json=maximumExtractedSizeBytes,proto3" json:"maximum_extracted_size_bytes,omitempty"`
+	MaximumEntries            int64                  `protobuf:"varint,2,opt,name=maximum_entries,json=maximumEntries,proto3" json:"maximum_entries,omitempty"`
+	unknownFields             protoimpl.UnknownFields
+	sizeCache                 protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_ArchiveExtractionConfiguration) Reset() {
+	*x = FetcherConfiguration_ArchiveExtractionConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_ArchiveExtractionConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_ArchiveExtractionConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_ArchiveExtractionConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_ArchiveExtractionConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_ArchiveExtractionConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 20}
+}
+
+func (x *FetcherConfiguration_ArchiveExtractionConfiguration) GetMaximumExtractedSizeBytes() int64 {
+	if x != nil {
+		return x.MaximumExtractedSizeBytes
+	}
+	return 0
+}
+
+func (x *FetcherConfiguration_ArchiveExtractionConfiguration) GetMaximumEntries() int64 {
+	if x != nil {
+		return x.MaximumEntries
+	}
+	return 0
+}
+
+type FetcherConfiguration_RemoteExecutionFetcherConfiguration struct {
+	state           protoimpl.MessageState    `protogen:"open.v1"`
+	ExecutionClient *grpc.ClientConfiguration `protobuf:"bytes,2,opt,name=execution_client,json=executionClient,proto3" json:"execution_client,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) Reset() {
+	*x = FetcherConfiguration_RemoteExecutionFetcherConfiguration{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_RemoteExecutionFetcherConfiguration) ProtoMessage() {}
+
+func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_RemoteExecutionFetcherConfiguration.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_RemoteExecutionFetcherConfiguration) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 21}
+}
+
+func (x *FetcherConfiguration_RemoteExecutionFetcherConfiguration) GetExecutionClient() *grpc.ClientConfiguration {
+	if x != nil {
+		return x.ExecutionClient
+	}
+	return nil
+}
+
+type FetcherConfiguration_S3FetcherConfiguration_Bucket struct {
+	state         protoimpl.MessageState                                          `protogen:"open.v1"`
+	BucketNames   []string                                                        `protobuf:"bytes,1,rep,name=bucket_names,json=bucketNames,proto3" json:"bucket_names,omitempty"`
+	Endpoint      string                                                          `protobuf:"bytes,2,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	Region        string                                                          `protobuf:"bytes,3,opt,name=region,proto3" json:"region,omitempty"`
+	PathStyle     bool                                                            `protobuf:"varint,4,opt,name=path_style,json=pathStyle,proto3" json:"path_style,omitempty"`
+	Credentials   *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials `protobuf:"bytes,5,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) Reset() {
+	*x = FetcherConfiguration_S3FetcherConfiguration_Bucket{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_S3FetcherConfiguration_Bucket) ProtoMessage() {}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_S3FetcherConfiguration_Bucket.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_S3FetcherConfiguration_Bucket) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 1, 0}
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) GetBucketNames() []string {
+	if x != nil {
+		return x.BucketNames
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) GetEndpoint() string {
+	if x != nil {
+		return x.Endpoint
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) GetPathStyle() bool {
+	if x != nil {
+		return x.PathStyle
+	}
+	return false
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket) GetCredentials() *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+type FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	AccessKeyId     string                 `protobuf:"bytes,1,opt,name=access_key_id,json=accessKeyId,proto3" json:"access_key_id,omitempty"`
+	SecretAccessKey string                 `protobuf:"bytes,2,opt,name=secret_access_key,json=secretAccessKey,proto3" json:"secret_access_key,omitempty"`
+	SessionToken    string                 `protobuf:"bytes,3,opt,name=session_token,json=sessionToken,proto3" json:"session_token,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) Reset() {
+	*x = FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) ProtoMessage() {}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 1, 0, 0}
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) GetAccessKeyId() string {
+	if x != nil {
+		return x.AccessKeyId
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) GetSecretAccessKey() string {
+	if x != nil {
+		return x.SecretAccessKey
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials) GetSessionToken() string {
+	if x != nil {
+		return x.SessionToken
+	}
+	return ""
+}
+
+type FetcherConfiguration_MavenFetcherConfiguration_Repository struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration_Repository) Reset() {
+	*x = FetcherConfiguration_MavenFetcherConfiguration_Repository{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration_Repository) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_MavenFetcherConfiguration_Repository) ProtoMessage() {}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration_Repository) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_MavenFetcherConfiguration_Repository.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_MavenFetcherConfiguration_Repository) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 5, 0}
+}
+
+func (x *FetcherConfiguration_MavenFetcherConfiguration_Repository) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Schemes       []string               `protobuf:"bytes,1,rep,name=schemes,proto3" json:"schemes,omitempty"`
+	Fetcher       *FetcherConfiguration  `protobuf:"bytes,2,opt,name=fetcher,proto3" json:"fetcher,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend) Reset() {
+	*x = FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend) ProtoMessage() {}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 7, 0}
+}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend) GetSchemes() []string {
+	if x != nil {
+		return x.Schemes
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend) GetFetcher() *FetcherConfiguration {
+	if x != nil {
+		return x.Fetcher
+	}
+	return nil
+}
+
+type FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ResourceTypes []string               `protobuf:"bytes,1,rep,name=resource_types,json=resourceTypes,proto3" json:"resource_types,omitempty"`
+	Fetcher       *FetcherConfiguration  `protobuf:"bytes,2,opt,name=fetcher,proto3" json:"fetcher,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend) Reset() {
+	*x = FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend) ProtoMessage() {}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 8, 0}
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend) GetResourceTypes() []string {
+	if x != nil {
+		return x.ResourceTypes
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend) GetFetcher() *FetcherConfiguration {
+	if x != nil {
+		return x.Fetcher
+	}
+	return nil
+}
+
+type FetcherConfiguration_UrlRewriterConfiguration_Rewrite struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pattern       string                 `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	Replacements  []string               `protobuf:"bytes,2,rep,name=replacements,proto3" json:"replacements,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration_Rewrite) Reset() {
+	*x = FetcherConfiguration_UrlRewriterConfiguration_Rewrite{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration_Rewrite) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_UrlRewriterConfiguration_Rewrite) ProtoMessage() {}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration_Rewrite) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_UrlRewriterConfiguration_Rewrite.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_UrlRewriterConfiguration_Rewrite) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 10, 0}
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration_Rewrite) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_UrlRewriterConfiguration_Rewrite) GetReplacements() []string {
+	if x != nil {
+		return x.Replacements
+	}
+	return nil
+}
+
+type FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Location:
+	//
+	//	*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Suffix
+	//	*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_ManifestName
+	Location      isFetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Location `protobuf_oneof:"location"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) Reset() {
+	*x = FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) ProtoMessage() {}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 12, 0}
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) GetLocation() isFetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Location {
+	if x != nil {
+		return x.Location
+	}
+	return nil
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) GetSuffix() string {
+	if x != nil {
+		if x, ok := x.Location.(*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Suffix); ok {
+			return x.Suffix
+		}
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile) GetManifestName() string {
+	if x != nil {
+		if x, ok := x.Location.(*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_ManifestName); ok {
+			return x.ManifestName
+		}
+	}
+	return ""
+}
+
+type isFetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Location interface {
+	isFetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Location()
+}
+
+type FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Suffix struct {
+	Suffix string `protobuf:"bytes,1,opt,name=suffix,proto3,oneof"`
+}
+
+type FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_ManifestName struct {
+	ManifestName string `protobuf:"bytes,2,opt,name=manifest_name,json=manifestName,proto3,oneof"`
+}
+
+func (*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Suffix) isFetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Location() {
+}
+
+func (*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_ManifestName) isFetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Location() {
+}
+
+type FetcherConfiguration_DownloadSizeLimitsConfiguration_Override struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	InstanceNamePrefix string                 `protobuf:"bytes,1,opt,name=instance_name_prefix,json=instanceNamePrefix,proto3" json:"instance_name_prefix,omitempty"`
+	ResourceType       string                 `protobuf:"bytes,2,opt,name=resource_type,json=resourceType,proto3" json:"resource_type,omitempty"`
+	MaximumSizeBytes   int64                  `protobuf:"varint,3,opt,name=maximum_size_bytes,json=maximumSizeBytes,proto3" json:"maximum_size_bytes,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) Reset() {
+	*x = FetcherConfiguration_DownloadSizeLimitsConfiguration_Override{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) ProtoMessage() {}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_DownloadSizeLimitsConfiguration_Override.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 15, 0}
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) GetInstanceNamePrefix() string {
+	if x != nil {
+		return x.InstanceNamePrefix
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) GetResourceType() string {
+	if x != nil {
+		return x.ResourceType
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_DownloadSizeLimitsConfiguration_Override) GetMaximumSizeBytes() int64 {
+	if x != nil {
+		return x.MaximumSizeBytes
+	}
+	return 0
+}
+
+type FetcherConfiguration_HttpCredential_Headers struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Headers       map[string]string      `protobuf:"bytes,1,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_HttpCredential_Headers) Reset() {
+	*x = FetcherConfiguration_HttpCredential_Headers{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_HttpCredential_Headers) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_HttpCredential_Headers) ProtoMessage() {}
+
+func (x *FetcherConfiguration_HttpCredential_Headers) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_HttpCredential_Headers.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_HttpCredential_Headers) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 19, 0}
+}
+
+func (x *FetcherConfiguration_HttpCredential_Headers) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+type FetcherConfiguration_HttpCredential_BasicAuth struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetcherConfiguration_HttpCredential_BasicAuth) Reset() {
+	*x = FetcherConfiguration_HttpCredential_BasicAuth{}
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetcherConfiguration_HttpCredential_BasicAuth) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetcherConfiguration_HttpCredential_BasicAuth) ProtoMessage() {}
+
+func (x *FetcherConfiguration_HttpCredential_BasicAuth) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetcherConfiguration_HttpCredential_BasicAuth.ProtoReflect.Descriptor instead.
+func (*FetcherConfiguration_HttpCredential_BasicAuth) Descriptor() ([]byte, []int) {
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP(), []int{0, 19, 1}
+}
+
+func (x *FetcherConfiguration_HttpCredential_BasicAuth) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *FetcherConfiguration_HttpCredential_BasicAuth) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+var File_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto protoreflect.FileDescriptor
+
+const file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc = "" +
+	"\n" +
+	"`github.com/buildbarn/bb-remote-asset/pkg/proto/configuration/bb_remote_asset/fetch/fetcher.proto\x12-buildbarn.configuration.bb_remote_asset.fetch\x1a\x1egoogle/protobuf/duration.proto\x1a\x17google/rpc/status.proto\x1aGgithub.com/buildbarn/bb-storage/pkg/proto/configuration/grpc/grpc.proto\x1aPgithub.com/buildbarn/bb-storage/pkg/proto/configuration/http/client/client.proto\"\xad\\\n" +
+	"\x14FetcherConfiguration\x12r\n" +
+	"\x04http\x18\x02 \x01(\v2\\.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfigurationH\x00R\x04http\x12*\n" +
+	"\x05error\x18\x03 \x01(\v2\x12.google.rpc.StatusH\x00R\x05error\x12\x94\x01\n" +
+	"\x10remote_execution\x18\x04 \x01(\v2g.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfigurationH\x00R\x0fremoteExecution\x12r\n" +
+	"\x04file\x18\x06 \x01(\v2\\.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.FileFetcherConfigurationH\x00R\x04file\x12\xa3\x01\n" +
+	"\x15scheme_demultiplexing\x18\a \x01(\v2l.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfigurationH\x00R\x14schemeDemultiplexing\x12o\n" +
+	"\x03oci\x18\b \x01(\v2[.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfigurationH\x00R\x03oci\x12l\n" +
+	"\x02s3\x18\t \x01(\v2Z.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfigurationH\x00R\x02s3\x12o\n" +
+	"\x03git\x18\n" +
+	" \x01(\v2[.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfigurationH\x00R\x03git\x12\xb6\x01\n" +
+	"\x1cresource_type_demultiplexing\x18\v \x01(\v2r.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfigurationH\x00R\x1aresourceTypeDemultiplexing\x12\x7f\n" +
+	"\tgo_module\x18\r \x01(\v2`.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfigurationH\x00R\bgoModule\x12u\n" +
+	"\x05maven\x18\x0e \x01(\v2].buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfigurationH\x00R\x05maven\x12\x7f\n" +
+	"\furl_rewriter\x18\x05 \x01(\v2\\.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.UrlRewriterConfigurationR\vurlRewriter\x12\x8f\x01\n" +
+	"\x12git_ref_resolution\x18\f \x01(\v2a.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitRefResolutionConfigurationR\x10gitRefResolution\x1a\xc4\x05\n" +
+	"\x17OciFetcherConfiguration\x12J\n" +
+	"\x06client\x18\x01 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06client\x12\x88\x01\n" +
+	"\x0fssrf_protection\x18\x02 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfigurationR\x0essrfProtection\x12\x82\x01\n" +
+	"\vcredentials\x18\x03 \x01(\v2`.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfigurationR\vcredentials\x122\n" +
+	"\x15plain_http_registries\x18\x04 \x03(\tR\x13plainHttpRegistries\x12\x88\x01\n" +
+	"\x0fscratch_storage\x18\x05 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfigurationR\x0escratchStorage\x12\x8d\x01\n" +
+	"\x10image_extraction\x18\x06 \x01(\v2b.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfigurationR\x0fimageExtraction\x1a\x8f\a\n" +
+	"\x16S3FetcherConfiguration\x12J\n" +
+	"\x06client\x18\x01 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06client\x12\x88\x01\n" +
+	"\x0fssrf_protection\x18\x02 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfigurationR\x0essrfProtection\x12{\n" +
+	"\abuckets\x18\x03 \x03(\v2a.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.BucketR\abuckets\x12\x88\x01\n" +
+	"\x0fscratch_storage\x18\x04 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfigurationR\x0escratchStorage\x1a\x95\x03\n" +
+	"\x06Bucket\x12!\n" +
+	"\fbucket_names\x18\x01 \x03(\tR\vbucketNames\x12\x1a\n" +
+	"\bendpoint\x18\x02 \x01(\tR\bendpoint\x12\x16\n" +
+	"\x06region\x18\x03 \x01(\tR\x06region\x12\x1d\n" +
+	"\n" +
+	"path_style\x18\x04 \x01(\bR\tpathStyle\x12\x8f\x01\n" +
+	"\vcredentials\x18\x05 \x01(\v2m.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.Bucket.CredentialsR\vcredentials\x1a\x82\x01\n" +
+	"\vCredentials\x12\"\n" +
+	"\raccess_key_id\x18\x01 \x01(\tR\vaccessKeyId\x12*\n" +
+	"\x11secret_access_key\x18\x02 \x01(\tR\x0fsecretAccessKey\x12#\n" +
+	"\rsession_token\x18\x03 \x01(\tR\fsessionToken\x1a\x8e\x05\n" +
+	"\x17GitFetcherConfiguration\x12J\n" +
+	"\x06client\x18\x01 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06client\x12\x88\x01\n" +
+	"\x0fssrf_protection\x18\x02 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfigurationR\x0essrfProtection\x12\x82\x01\n" +
+	"\vcredentials\x18\x03 \x01(\v2`.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfigurationR\vcredentials\x12\x88\x01\n" +
+	"\x0fscratch_storage\x18\x04 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfigurationR\x0escratchStorage\x12\x8b\x01\n" +
+	"\x0fcheckout_limits\x18\x05 \x01(\v2b.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfigurationR\x0echeckoutLimits\x1a\xc0\x06\n" +
+	"\x1cGoModuleFetcherConfiguration\x12J\n" +
+	"\x06client\x18\x01 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06client\x12\x88\x01\n" +
+	"\x0fssrf_protection\x18\x02 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfigurationR\x0essrfProtection\x12\x82\x01\n" +
+	"\vcredentials\x18\x03 \x01(\v2`.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfigurationR\vcredentials\x12\x88\x01\n" +
+	"\x0fscratch_storage\x18\x04 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfigurationR\x0escratchStorage\x12\x14\n" +
+	"\x05proxy\x18\x05 \x01(\tR\x05proxy\x12\x90\x01\n" +
+	"\x11checksum_database\x18\x06 \x01(\v2c.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoChecksumDatabaseConfigurationR\x10checksumDatabase\x12\x8f\x01\n" +
+	"\x11extraction_limits\x18\a \x01(\v2b.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfigurationR\x10extractionLimits\x1a\x90\x01\n" +
+	"\x1fGoChecksumDatabaseConfiguration\x12!\n" +
+	"\fverifier_key\x18\x01 \x01(\tR\vverifierKey\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x128\n" +
+	"\x18excluded_module_patterns\x18\x03 \x03(\tR\x16excludedModulePatterns\x1a\xb1\x05\n" +
+	"\x19MavenFetcherConfiguration\x12J\n" +
+	"\x06client\x18\x01 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06client\x12\x88\x01\n" +
+	"\x0fssrf_protection\x18\x02 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfigurationR\x0essrfProtection\x12\x8c\x01\n" +
+	"\frepositories\x18\x03 \x03(\v2h.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.RepositoryR\frepositories\x12\x88\x01\n" +
+	"\x0fscratch_storage\x18\x04 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfigurationR\x0escratchStorage\x12\x82\x01\n" +
+	"\vcredentials\x18\x05 \x01(\v2`.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfigurationR\vcredentials\x1a\x1e\n" +
+	"\n" +
+	"Repository\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x1a\xdf\x01\n" +
+	"\x18FileFetcherConfiguration\x128\n" +
+	"\x18allowed_root_directories\x18\x01 \x03(\tR\x16allowedRootDirectories\x12\x88\x01\n" +
+	"\x0fscratch_storage\x18\x02 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfigurationR\x0escratchStorage\x1a\xc2\x02\n" +
+	"(SchemeDemultiplexingFetcherConfiguration\x12\x90\x01\n" +
+	"\bbackends\x18\x01 \x03(\v2t.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfiguration.BackendR\bbackends\x1a\x82\x01\n" +
+	"\aBackend\x12\x18\n" +
+	"\aschemes\x18\x01 \x03(\tR\aschemes\x12]\n" +
+	"\afetcher\x18\x02 \x01(\v2C.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfigurationR\afetcher\x1a\xc9\x03\n" +
+	".ResourceTypeDemultiplexingFetcherConfiguration\x12\x96\x01\n" +
+	"\bbackends\x18\x01 \x03(\v2z.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration.BackendR\bbackends\x12l\n" +
+	"\x0fdefault_fetcher\x18\x02 \x01(\v2C.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfigurationR\x0edefaultFetcher\x1a\x8f\x01\n" +
+	"\aBackend\x12%\n" +
+	"\x0eresource_types\x18\x01 \x03(\tR\rresourceTypes\x12]\n" +
+	"\afetcher\x18\x02 \x01(\v2C.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfigurationR\afetcher\x1a\xfb\x02\n" +
+	"\x1dGitRefResolutionConfiguration\x12J\n" +
+	"\x06client\x18\x01 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06client\x12\x88\x01\n" +
+	"\x0fssrf_protection\x18\x02 \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfigurationR\x0essrfProtection\x12\x82\x01\n" +
+	"\vcredentials\x18\x03 \x01(\v2`.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfigurationR\vcredentials\x1a\xe0\x02\n" +
+	"\x18UrlRewriterConfiguration\x12\x80\x01\n" +
+	"\brewrites\x18\x01 \x03(\v2d.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.UrlRewriterConfiguration.RewriteR\brewrites\x12#\n" +
+	"\rallowed_hosts\x18\x02 \x03(\tR\fallowedHosts\x12#\n" +
+	"\rblocked_hosts\x18\x03 \x03(\tR\fblockedHosts\x12.\n" +
+	"\x13all_blocked_message\x18\x04 \x01(\tR\x11allBlockedMessage\x1aG\n" +
+	"\aRewrite\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\x12\"\n" +
+	"\freplacements\x18\x02 \x03(\tR\freplacements\x1a\xd9\n" +
+	"\n" +
+	"\x18HttpFetcherConfiguration\x12J\n" +
+	"\x06client\x18\x03 \x01(\v22.buildbarn.configuration.http.client.ConfigurationR\x06client\x12A\n" +
+	"\x0fper_uri_timeout\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\rperUriTimeout\x12>\n" +
+	"\rhedging_delay\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\fhedgingDelay\x126\n" +
+	"\x17maximum_resume_attempts\x18\x06 \x01(\rR\x15maximumResumeAttempts\x12\x91\x01\n" +
+	"\x12archive_extraction\x18\a \x01(\v2b.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfigurationR\x11archiveExtraction\x12F\n" +
+	" skip_downloads_of_existing_blobs\x18\b \x01(\bR\x1cskipDownloadsOfExistingBlobs\x12\x82\x01\n" +
+	"\vcredentials\x18\t \x01(\v2`.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfigurationR\vcredentials\x12\x88\x01\n" +
+	"\x0fssrf_protection\x18\n" +
+	" \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfigurationR\x0essrfProtection\x12\x95\x01\n" +
+	"\x14download_size_limits\x18\v \x01(\v2c.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.DownloadSizeLimitsConfigurationR\x12downloadSizeLimits\x12\x7f\n" +
+	"\fretry_policy\x18\f \x01(\v2\\.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RetryPolicyConfigurationR\vretryPolicy\x12\x88\x01\n" +
+	"\x0fscratch_storage\x18\r \x01(\v2_.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfigurationR\x0escratchStorage\x12\x99\x01\n" +
+	"\x16checksum_file_policies\x18\x0e \x03(\v2c.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ChecksumFilePolicyConfigurationR\x14checksumFilePoliciesJ\x04\b\x01\x10\x02J\x04\b\x02\x10\x03\x1a\xd7\x02\n" +
+	"\x1fChecksumFilePolicyConfiguration\x12!\n" +
+	"\furl_patterns\x18\x01 \x03(\tR\vurlPatterns\x12\x97\x01\n" +
+	"\x0echecksum_files\x18\x02 \x03(\v2p.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ChecksumFilePolicyConfiguration.ChecksumFileR\rchecksumFiles\x12\x1a\n" +
+	"\brequired\x18\x03 \x01(\bR\brequired\x1a[\n" +
+	"\fChecksumFile\x12\x18\n" +
+	"\x06suffix\x18\x01 \x01(\tH\x00R\x06suffix\x12%\n" +
+	"\rmanifest_name\x18\x02 \x01(\tH\x00R\fmanifestNameB\n" +
+	"\n" +
+	"\blocation\x1a\xa9\x01\n" +
+	"\x1bScratchStorageConfiguration\x12\x1c\n" +
+	"\tdirectory\x18\x01 \x01(\tR\tdirectory\x12,\n" +
+	"\x12maximum_size_bytes\x18\x02 \x01(\x03R\x10maximumSizeBytes\x12>\n" +
+	"\x1cmaximum_in_memory_size_bytes\x18\x03 \x01(\x03R\x18maximumInMemorySizeBytes\x1a\xe4\x02\n" +
+	"\x18RetryPolicyConfiguration\x12)\n" +
+	"\x10maximum_attempts\x18\x01 \x01(\rR\x0fmaximumAttempts\x12B\n" +
+	"\x0finitial_backoff\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\x0einitialBackoff\x12B\n" +
+	"\x0fmaximum_backoff\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x0emaximumBackoff\x12-\n" +
+	"\x12backoff_multiplier\x18\x04 \x01(\x01R\x11backoffMultiplier\x124\n" +
+	"\x16retryable_status_codes\x18\x05 \x03(\rR\x14retryableStatusCodes\x120\n" +
+	"\x14retry_network_errors\x18\x06 \x01(\bR\x12retryNetworkErrors\x1a\xfd\x02\n" +
+	"\x1fDownloadSizeLimitsConfiguration\x12;\n" +
+	"\x1adefault_maximum_size_bytes\x18\x01 \x01(\x03R\x17defaultMaximumSizeBytes\x12\x8a\x01\n" +
+	"\toverrides\x18\x02 \x03(\v2l.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.DownloadSizeLimitsConfiguration.OverrideR\toverrides\x1a\x8f\x01\n" +
+	"\bOverride\x120\n" +
+	"\x14instance_name_prefix\x18\x01 \x01(\tR\x12instanceNamePrefix\x12#\n" +
+	"\rresource_type\x18\x02 \x01(\tR\fresourceType\x12,\n" +
+	"\x12maximum_size_bytes\x18\x03 \x01(\x03R\x10maximumSizeBytes\x1a\x8d\x01\n" +
+	"\x1bSsrfProtectionConfiguration\x12\x1a\n" +
+	"\bdisabled\x18\x01 \x01(\bR\bdisabled\x12'\n" +
+	"\x0fdenied_networks\x18\x02 \x03(\tR\x0edeniedNetworks\x12)\n" +
+	"\x10allowed_networks\x18\x03 \x03(\tR\x0fallowedNetworks\x1a\x80\x04\n" +
+	"\x1cHttpCredentialsConfiguration\x12t\n" +
+	"\vcredentials\x18\x01 \x03(\v2R.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialR\vcredentials\x12\x1f\n" +
+	"\vnetrc_paths\x18\x02 \x03(\tR\n" +
+	"netrcPaths\x12\x8b\x01\n" +
+	"\n" +
+	"precedence\x18\x03 \x01(\x0e2k.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration.PrecedenceR\n" +
+	"precedence\x12\x83\x01\n" +
+	"\x12credential_helpers\x18\x04 \x03(\v2T.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.CredentialHelperR\x11credentialHelpers\"5\n" +
+	"\n" +
+	"Precedence\x12\n" +
+	"\n" +
+	"\x06CLIENT\x10\x00\x12\n" +
+	"\n" +
+	"\x06SERVER\x10\x01\x12\x0f\n" +
+	"\vSERVER_ONLY\x10\x02\x1a\xed\x01\n" +
+	"\x10CredentialHelper\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1c\n" +
+	"\targuments\x18\x02 \x03(\tR\targuments\x12!\n" +
+	"\furl_patterns\x18\x03 \x03(\tR\vurlPatterns\x123\n" +
+	"\atimeout\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\atimeout\x12O\n" +
+	"\x16default_cache_duration\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\x14defaultCacheDuration\x1a\xf7\x04\n" +
+	"\x0eHttpCredential\x12!\n" +
+	"\furl_patterns\x18\x01 \x03(\tR\vurlPatterns\x12v\n" +
+	"\aheaders\x18\x02 \x01(\v2Z.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.HeadersH\x00R\aheaders\x12}\n" +
+	"\n" +
+	"basic_auth\x18\x03 \x01(\v2\\.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.BasicAuthH\x00R\tbasicAuth\x12,\n" +
+	"\x11bearer_token_path\x18\x04 \x01(\tH\x00R\x0fbearerTokenPath\x1a\xc9\x01\n" +
+	"\aHeaders\x12\x81\x01\n" +
+	"\aheaders\x18\x01 \x03(\v2g.buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.Headers.HeadersEntryR\aheaders\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1aC\n" +
+	"\tBasicAuth\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpasswordB\f\n" +
+	"\n" +
+	"credential\x1a\x8a\x01\n" +
+	"\x1eArchiveExtractionConfiguration\x12?\n" +
+	"\x1cmaximum_extracted_size_bytes\x18\x01 \x01(\x03R\x19maximumExtractedSizeBytes\x12'\n" +
+	"\x0fmaximum_entries\x18\x02 \x01(\x03R\x0emaximumEntries\x1a\x83\x01\n" +
+	"#RemoteExecutionFetcherConfiguration\x12\\\n" +
+	"\x10execution_client\x18\x02 \x01(\v21.buildbarn.configuration.grpc.ClientConfigurationR\x0fexecutionClientB\t\n" +
+	"\abackendJ\x04\b\x01\x10\x02BTZRgithub.com/buildbarn/bb-remote-asset/pkg/proto/configuration/bb_remote_asset/fetchb\x06proto3"
+
+var (
+	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescOnce sync.Once
+	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescData []byte
+)
+
+func file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescGZIP() []byte {
+	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescOnce.Do(func() {
+		file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc), len(file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc)))
+	})
+	return file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDescData
+}
+
+var file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes = make([]protoimpl.MessageInfo, 34)
+var file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_goTypes = []any{
+	(FetcherConfiguration_HttpCredentialsConfiguration_Precedence)(0),                   // 0: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration.Precedence
+	(*FetcherConfiguration)(nil),                                                        // 1: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration
+	(*FetcherConfiguration_OciFetcherConfiguration)(nil),                                // 2: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfiguration
+	(*FetcherConfiguration_S3FetcherConfiguration)(nil),                                 // 3: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration
+	(*FetcherConfiguration_GitFetcherConfiguration)(nil),                                // 4: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfiguration
+	(*FetcherConfiguration_GoModuleFetcherConfiguration)(nil),                           // 5: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration
+	(*FetcherConfiguration_GoChecksumDatabaseConfiguration)(nil),                        // 6: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoChecksumDatabaseConfiguration
+	(*FetcherConfiguration_MavenFetcherConfiguration)(nil),                              // 7: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration
+	(*FetcherConfiguration_FileFetcherConfiguration)(nil),                               // 8: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.FileFetcherConfiguration
+	(*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration)(nil),               // 9: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfiguration
+	(*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration)(nil),         // 10: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration
+	(*FetcherConfiguration_GitRefResolutionConfiguration)(nil),                          // 11: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitRefResolutionConfiguration
+	(*FetcherConfiguration_UrlRewriterConfiguration)(nil),                               // 12: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.UrlRewriterConfiguration
+	(*FetcherConfiguration_HttpFetcherConfiguration)(nil),                               // 13: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration
+	(*FetcherConfiguration_ChecksumFilePolicyConfiguration)(nil),                        // 14: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ChecksumFilePolicyConfiguration
+	(*FetcherConfiguration_ScratchStorageConfiguration)(nil),                            // 15: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	(*FetcherConfiguration_RetryPolicyConfiguration)(nil),                               // 16: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RetryPolicyConfiguration
+	(*FetcherConfiguration_DownloadSizeLimitsConfiguration)(nil),                        // 17: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.DownloadSizeLimitsConfiguration
+	(*FetcherConfiguration_SsrfProtectionConfiguration)(nil),                            // 18: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	(*FetcherConfiguration_HttpCredentialsConfiguration)(nil),                           // 19: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration
+	(*FetcherConfiguration_CredentialHelper)(nil),                                       // 20: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.CredentialHelper
+	(*FetcherConfiguration_HttpCredential)(nil),                                         // 21: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential
+	(*FetcherConfiguration_ArchiveExtractionConfiguration)(nil),                         // 22: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfiguration
+	(*FetcherConfiguration_RemoteExecutionFetcherConfiguration)(nil),                    // 23: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfiguration
+	(*FetcherConfiguration_S3FetcherConfiguration_Bucket)(nil),                          // 24: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.Bucket
+	(*FetcherConfiguration_S3FetcherConfiguration_Bucket_Credentials)(nil),              // 25: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.Bucket.Credentials
+	(*FetcherConfiguration_MavenFetcherConfiguration_Repository)(nil),                   // 26: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.Repository
+	(*FetcherConfiguration_SchemeDemultiplexingFetcherConfiguration_Backend)(nil),       // 27: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfiguration.Backend
+	(*FetcherConfiguration_ResourceTypeDemultiplexingFetcherConfiguration_Backend)(nil), // 28: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration.Backend
+	(*FetcherConfiguration_UrlRewriterConfiguration_Rewrite)(nil),                       // 29: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.UrlRewriterConfiguration.Rewrite
+	(*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile)(nil),           // 30: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ChecksumFilePolicyConfiguration.ChecksumFile
+	(*FetcherConfiguration_DownloadSizeLimitsConfiguration_Override)(nil),               // 31: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.DownloadSizeLimitsConfiguration.Override
+	(*FetcherConfiguration_HttpCredential_Headers)(nil),                                 // 32: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.Headers
+	(*FetcherConfiguration_HttpCredential_BasicAuth)(nil),                               // 33: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.BasicAuth
+	nil,                              // 34: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.Headers.HeadersEntry
+	(*status.Status)(nil),            // 35: google.rpc.Status
+	(*client.Configuration)(nil),     // 36: buildbarn.configuration.http.client.Configuration
+	(*durationpb.Duration)(nil),      // 37: google.protobuf.Duration
+	(*grpc.ClientConfiguration)(nil), // 38: buildbarn.configuration.grpc.ClientConfiguration
+}
+var file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_depIdxs = []int32{
+	13, // 0: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.http:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration
+	35, // 1: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.error:type_name -> google.rpc.Status
+	23, // 2: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.remote_execution:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfiguration
+	8,  // 3: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.file:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.FileFetcherConfiguration
+	9,  // 4: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.scheme_demultiplexing:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfiguration
+	2,  // 5: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.oci:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfiguration
+	3,  // 6: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.s3:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration
+	4,  // 7: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.git:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfiguration
+	10, // 8: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.resource_type_demultiplexing:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration
+	5,  // 9: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.go_module:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration
+	7,  // 10: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.maven:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration
+	12, // 11: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.url_rewriter:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.UrlRewriterConfiguration
+	11, // 12: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.git_ref_resolution:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitRefResolutionConfiguration
+	36, // 13: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
+	18, // 14: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfiguration.ssrf_protection:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	19, // 15: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfiguration.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration
+	15, // 16: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfiguration.scratch_storage:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	22, // 17: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.OciFetcherConfiguration.image_extraction:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfiguration
+	36, // 18: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
+	18, // 19: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.ssrf_protection:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	24, // 20: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.buckets:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.Bucket
+	15, // 21: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.scratch_storage:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	36, // 22: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
+	18, // 23: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfiguration.ssrf_protection:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	19, // 24: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfiguration.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration
+	15, // 25: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfiguration.scratch_storage:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	22, // 26: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitFetcherConfiguration.checkout_limits:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfiguration
+	36, // 27: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
+	18, // 28: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration.ssrf_protection:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	19, // 29: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration
+	15, // 30: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration.scratch_storage:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	6,  // 31: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration.checksum_database:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoChecksumDatabaseConfiguration
+	22, // 32: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GoModuleFetcherConfiguration.extraction_limits:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfiguration
+	36, // 33: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
+	18, // 34: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.ssrf_protection:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	26, // 35: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.repositories:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.Repository
+	15, // 36: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.scratch_storage:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	19, // 37: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.MavenFetcherConfiguration.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration
+	15, // 38: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.FileFetcherConfiguration.scratch_storage:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	27, // 39: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfiguration.backends:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfiguration.Backend
+	28, // 40: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration.backends:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration.Backend
+	1,  // 41: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration.default_fetcher:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration
+	36, // 42: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitRefResolutionConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
+	18, // 43: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitRefResolutionConfiguration.ssrf_protection:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	19, // 44: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.GitRefResolutionConfiguration.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration
+	29, // 45: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.UrlRewriterConfiguration.rewrites:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.UrlRewriterConfiguration.Rewrite
+	36, // 46: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.client:type_name -> buildbarn.configuration.http.client.Configuration
+	37, // 47: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.per_uri_timeout:type_name -> google.protobuf.Duration
+	37, // 48: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.hedging_delay:type_name -> google.protobuf.Duration
+	22, // 49: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.archive_extraction:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ArchiveExtractionConfiguration
+	19, // 50: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration
+	18, // 51: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.ssrf_protection:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SsrfProtectionConfiguration
+	17, // 52: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.download_size_limits:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.DownloadSizeLimitsConfiguration
+	16, // 53: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.retry_policy:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RetryPolicyConfiguration
+	15, // 54: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.scratch_storage:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ScratchStorageConfiguration
+	14, // 55: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpFetcherConfiguration.checksum_file_policies:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ChecksumFilePolicyConfiguration
+	30, // 56: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ChecksumFilePolicyConfiguration.checksum_files:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ChecksumFilePolicyConfiguration.ChecksumFile
+	37, // 57: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RetryPolicyConfiguration.initial_backoff:type_name -> google.protobuf.Duration
+	37, // 58: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RetryPolicyConfiguration.maximum_backoff:type_name -> google.protobuf.Duration
+	31, // 59: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.DownloadSizeLimitsConfiguration.overrides:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.DownloadSizeLimitsConfiguration.Override
+	21, // 60: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential
+	0,  // 61: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration.precedence:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration.Precedence
+	20, // 62: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredentialsConfiguration.credential_helpers:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.CredentialHelper
+	37, // 63: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.CredentialHelper.timeout:type_name -> google.protobuf.Duration
+	37, // 64: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.CredentialHelper.default_cache_duration:type_name -> google.protobuf.Duration
+	32, // 65: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.headers:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.Headers
+	33, // 66: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.basic_auth:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.BasicAuth
+	38, // 67: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.RemoteExecutionFetcherConfiguration.execution_client:type_name -> buildbarn.configuration.grpc.ClientConfiguration
+	25, // 68: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.Bucket.credentials:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.S3FetcherConfiguration.Bucket.Credentials
+	1,  // 69: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.SchemeDemultiplexingFetcherConfiguration.Backend.fetcher:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration
+	1,  // 70: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.ResourceTypeDemultiplexingFetcherConfiguration.Backend.fetcher:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration
+	34, // 71: buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.Headers.headers:type_name -> buildbarn.configuration.bb_remote_asset.fetch.FetcherConfiguration.HttpCredential.Headers.HeadersEntry
+	72, // [72:72] is the sub-list for method output_type
+	72, // [72:72] is the sub-list for method input_type
+	72, // [72:72] is the sub-list for extension type_name
+	72, // [72:72] is the sub-list for extension extendee
+	0,  // [0:72] is the sub-list for field type_name
+}
+
+func init() {
+	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_init()
+}
+func file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_init() {
+	if File_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto != nil {
+		return
+	}
+	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[0].OneofWrappers = []any{
+		(*FetcherConfiguration_Http)(nil),
+		(*FetcherConfiguration_Error)(nil),
+		(*FetcherConfiguration_RemoteExecution)(nil),
+		(*FetcherConfiguration_File)(nil),
+		(*FetcherConfiguration_SchemeDemultiplexing)(nil),
+		(*FetcherConfiguration_Oci)(nil),
+		(*FetcherConfiguration_S3)(nil),
+		(*FetcherConfiguration_Git)(nil),
+		(*FetcherConfiguration_ResourceTypeDemultiplexing)(nil),
+		(*FetcherConfiguration_GoModule)(nil),
+		(*FetcherConfiguration_Maven)(nil),
+	}
+	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[20].OneofWrappers = []any{
+		(*FetcherConfiguration_HttpCredential_Headers_)(nil),
+		(*FetcherConfiguration_HttpCredential_BasicAuth_)(nil),
+		(*FetcherConfiguration_HttpCredential_BearerTokenPath)(nil),
+	}
+	file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes[29].OneofWrappers = []any{
+		(*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_Suffix)(nil),
+		(*FetcherConfiguration_ChecksumFilePolicyConfiguration_ChecksumFile_ManifestName)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc), len(file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      1,
+			NumMessages:   34,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_goTypes,
 		DependencyIndexes: file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_depIdxs,
+		EnumInfos:         file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_enumTypes,
 		MessageInfos:      file_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto_msgTypes,
 	}.Build()
 	File_github_com_buildbarn_bb_remote_asset_pkg_proto_configuration_bb_remote_asset_fetch_fetcher_proto = out.File
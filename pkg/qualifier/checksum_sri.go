@@ -0,0 +1,100 @@
+package qualifier
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+type checksumAlgorithm struct {
+	digestFunction remoteexecution.DigestFunction_Value
+	sizeBytes      int
+	// Algorithms with a higher strength take precedence when a
+	// string contains hashes for multiple algorithms.
+	strength int
+}
+
+var checksumAlgorithms = map[string]checksumAlgorithm{
+	"md5":        {remoteexecution.DigestFunction_MD5, 16, 0},
+	"sha1":       {remoteexecution.DigestFunction_SHA1, 20, 1},
+	"sha256tree": {remoteexecution.DigestFunction_SHA256TREE, 32, 2},
+	"sha256":     {remoteexecution.DigestFunction_SHA256, 32, 3},
+	"sha384":     {remoteexecution.DigestFunction_SHA384, 48, 4},
+	"sha512":     {remoteexecution.DigestFunction_SHA512, 64, 5},
+}
+
+// ChecksumSRI is the parsed value of a checksum.sri qualifier.
+type ChecksumSRI struct {
+	// Name of the hash algorithm against which content is verified
+	// (e.g., "sha512").
+	Algorithm string
+	// REv2 digest function corresponding to the hash algorithm.
+	DigestFunction remoteexecution.DigestFunction_Value
+	// Hashes of the algorithm contained in the string. Content is
+	// valid if it matches any of them.
+	Hashes [][]byte
+}
+
+// ParseChecksumSRI parses a W3C Subresource Integrity (SRI) string,
+// consisting of a whitespace separated list of hash expressions of the
+// form <algorithm>-<base64 value>, optionally followed by options
+// starting with '?'.
+//
+// As required by the specification, only hashes using the strongest
+// algorithm contained in the string are used for verification. Hashes
+// using unsupported algorithms are ignored, as long as at least one
+// hash uses a supported algorithm.
+func ParseChecksumSRI(value string) (ChecksumSRI, error) {
+	var result ChecksumSRI
+	var unsupportedAlgorithm string
+	bestStrength := -1
+	for _, hashWithOptions := range strings.Fields(value) {
+		hashExpression, _, _ := strings.Cut(hashWithOptions, "?")
+		algorithmName, encodedHash, ok := strings.Cut(hashExpression, "-")
+		if !ok {
+			return ChecksumSRI{}, fmt.Errorf("Bad checksum.sri hash expression: %s", hashWithOptions)
+		}
+		algorithm, ok := checksumAlgorithms[algorithmName]
+		if !ok {
+			if unsupportedAlgorithm == "" {
+				unsupportedAlgorithm = algorithmName
+			}
+			continue
+		}
+
+		hash, err := decodeSRIBase64(encodedHash)
+		if err != nil {
+			return ChecksumSRI{}, fmt.Errorf("Failed to decode checksum as base64 encoded %s sum: %w", algorithmName, err)
+		}
+		if len(hash) != algorithm.sizeBytes {
+			return ChecksumSRI{}, fmt.Errorf("Checksum of %s sum has length %d, while %d bytes were expected", algorithmName, len(hash), algorithm.sizeBytes)
+		}
+
+		if algorithm.strength > bestStrength {
+			bestStrength = algorithm.strength
+			result = ChecksumSRI{
+				Algorithm:      algorithmName,
+				DigestFunction: algorithm.digestFunction,
+			}
+		}
+		if algorithm.strength == bestStrength {
+			result.Hashes = append(result.Hashes, hash)
+		}
+	}
+
+	if bestStrength < 0 {
+		if unsupportedAlgorithm != "" {
+			return ChecksumSRI{}, fmt.Errorf("Unsupported checksum algorithm %s", unsupportedAlgorithm)
+		}
+		return ChecksumSRI{}, fmt.Errorf("Bad checksum.sri hash expression: %s", value)
+	}
+	return result, nil
+}
+
+// decodeSRIBase64 decodes the hash of an SRI hash expression, for
+// which padding is optional.
+func decodeSRIBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,94 @@
+package qualifier_test
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"testing"
+
+	remoteasset "github.com/bazelbuild/remote-apis/build/bazel/remote/asset/v1"
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/buildbarn/bb-remote-asset/pkg/qualifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecksumSRI(t *testing.T) {
+	sha256Hash := sha256.Sum256([]byte("Hello"))
+	sha512Hash := sha512.Sum512([]byte("Hello"))
+	otherSHA512Hash := sha512.Sum512([]byte("Goodbye"))
+	sha256Value := "sha256-" + base64.StdEncoding.EncodeToString(sha256Hash[:])
+	sha512Value := "sha512-" + base64.StdEncoding.EncodeToString(sha512Hash[:])
+	otherSHA512Value := "sha512-" + base64.StdEncoding.EncodeToString(otherSHA512Hash[:])
+
+	t.Run("Single", func(t *testing.T) {
+		sri, err := qualifier.ParseChecksumSRI(sha256Value)
+		require.NoError(t, err)
+		require.Equal(t, qualifier.ChecksumSRI{
+			Algorithm:      "sha256",
+			DigestFunction: remoteexecution.DigestFunction_SHA256,
+			Hashes:         [][]byte{sha256Hash[:]},
+		}, sri)
+	})
+
+	t.Run("StrongestAlgorithm", func(t *testing.T) {
+		// Only the hashes of the strongest algorithm are used,
+		// regardless of the order in which they are listed. Options
+		// and unknown algorithms are ignored.
+		sri, err := qualifier.ParseChecksumSRI("  " + sha512Value + "?foo=bar\t" + sha256Value + "\n sha999-AAAA " + otherSHA512Value + " ")
+		require.NoError(t, err)
+		require.Equal(t, qualifier.ChecksumSRI{
+			Algorithm:      "sha512",
+			DigestFunction: remoteexecution.DigestFunction_SHA512,
+			Hashes:         [][]byte{sha512Hash[:], otherSHA512Hash[:]},
+		}, sri)
+	})
+
+	t.Run("UnpaddedBase64", func(t *testing.T) {
+		sri, err := qualifier.ParseChecksumSRI("sha256-" + base64.RawStdEncoding.EncodeToString(sha256Hash[:]))
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{sha256Hash[:]}, sri.Hashes)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		_, err := qualifier.ParseChecksumSRI(" ")
+		require.EqualError(t, err, "Bad checksum.sri hash expression:  ")
+	})
+
+	t.Run("NoDash", func(t *testing.T) {
+		_, err := qualifier.ParseChecksumSRI(sha256Value + " no_dash")
+		require.EqualError(t, err, "Bad checksum.sri hash expression: no_dash")
+	})
+
+	t.Run("OnlyUnsupportedAlgorithms", func(t *testing.T) {
+		_, err := qualifier.ParseChecksumSRI("sha0-AAAA sha999-AAAA")
+		require.EqualError(t, err, "Unsupported checksum algorithm sha0")
+	})
+
+	t.Run("BadLength", func(t *testing.T) {
+		_, err := qualifier.ParseChecksumSRI("sha512-" + base64.StdEncoding.EncodeToString(sha256Hash[:]))
+		require.EqualError(t, err, "Checksum of sha512 sum has length 32, while 64 bytes were expected")
+	})
+}
+
+func TestOctetStreamCommandChecksum(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		command, err := qualifier.QualifiersToCommand([]*remoteasset.Qualifier{
+			{Name: "resource_type", Value: "application/octet-stream"},
+			{Name: "checksum.sri", Value: "sha256-LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ= md5-ixqZU8RhEpaoJ6v4xHgE1w=="},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"sh", "-c",
+			"wget -O out https://example.com/file && openssl dgst -sha256 -binary out | openssl base64 -A | grep LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=",
+		}, command("https://example.com/file").Arguments)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		// This used to cause a panic.
+		_, err := qualifier.QualifiersToCommand([]*remoteasset.Qualifier{
+			{Name: "resource_type", Value: "application/octet-stream"},
+			{Name: "checksum.sri", Value: "no_dash"},
+		})
+		require.EqualError(t, err, "Bad checksum.sri hash expression: no_dash")
+	})
+}
@@ -45,6 +45,17 @@ func Difference(a, b Set) Set {
 	return diff
 }
 
+// Intersection calculates the Set intersection of a and b.
+func Intersection(a, b Set) Set {
+	intersection := Set{}
+	for k := range a {
+		if b.Contains(k) {
+			intersection.Add(k)
+		}
+	}
+	return intersection
+}
+
 // QualifiersToSet converts an array of qualifiers into a Set of names
 func QualifiersToSet(qualifiers []*remoteasset.Qualifier) Set {
 	s := Set{}
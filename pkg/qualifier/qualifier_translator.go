@@ -1,6 +1,7 @@
 package qualifier
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
 
@@ -31,7 +32,7 @@ func QualifiersToCommand(qArr []*remoteasset.Qualifier) (func(string) *remoteexe
 	case "application/x-git":
 		return gitCommand(qualifiers), nil
 	case "application/octet-stream":
-		return octetStreamCommand(qualifiers), nil
+		return octetStreamCommand(qualifiers)
 	}
 
 	return nil, fmt.Errorf("unhandled resource_type")
@@ -64,7 +65,15 @@ func gitCommand(qualifiers map[string]string) func(string) *remoteexecution.Comm
 // - auth.basic.username: authentication with a basic username
 // - auth.basic.password: authentication with a basic password
 // - checksum.sri: verify the checksum after downloading
-func octetStreamCommand(qualifiers map[string]string) func(string) *remoteexecution.Command {
+func octetStreamCommand(qualifiers map[string]string) (func(string) *remoteexecution.Command, error) {
+	var checksumScript string
+	if checksum, ok := qualifiers["checksum.sri"]; ok {
+		var err error
+		if checksumScript, err = checksumCommand(checksum); err != nil {
+			return nil, err
+		}
+	}
+
 	return func(url string) *remoteexecution.Command {
 		script := fmt.Sprintf("wget -O out %s", url)
 		if username, ok := qualifiers["auth.basic.username"]; ok {
@@ -73,9 +82,8 @@ func octetStreamCommand(qualifiers map[string]string) func(string) *remoteexecut
 		if password, ok := qualifiers["auth.basic.password"]; ok {
 			script = fmt.Sprintf("%s --http-password=%s", script, password)
 		}
-		if checksum, ok := qualifiers["checksum.sri"]; ok {
-			protocol, base64 := parseChecksum(checksum)
-			script = fmt.Sprintf("%s && openssl dgst -%s -binary out | openssl base64 -A | grep %s", script, protocol, base64)
+		if checksumScript != "" {
+			script = fmt.Sprintf("%s && %s", script, checksumScript)
 		}
 
 		return &remoteexecution.Command{
@@ -83,10 +91,25 @@ func octetStreamCommand(qualifiers map[string]string) func(string) *remoteexecut
 			OutputPaths:           []string{"out"},
 			OutputDirectoryFormat: remoteexecution.Command_TREE_AND_DIRECTORY,
 		}
-	}
+	}, nil
 }
 
-func parseChecksum(c string) (string, string) {
-	parts := strings.Split(c, "-")
-	return parts[0], parts[1]
+// checksumCommand returns a shell command that fails if the checksum
+// of the downloaded file does not match the checksum.sri qualifier.
+func checksumCommand(checksum string) (string, error) {
+	sri, err := ParseChecksumSRI(checksum)
+	if err != nil {
+		return "", err
+	}
+	if sri.DigestFunction == remoteexecution.DigestFunction_SHA256TREE {
+		return "", fmt.Errorf("Checksum algorithm %s cannot be verified using openssl", sri.Algorithm)
+	}
+	patterns := make([]string, 0, len(sri.Hashes))
+	for _, hash := range sri.Hashes {
+		patterns = append(patterns, base64.StdEncoding.EncodeToString(hash))
+	}
+	if len(patterns) == 1 {
+		return fmt.Sprintf("openssl dgst -%s -binary out | openssl base64 -A | grep %s", sri.Algorithm, patterns[0]), nil
+	}
+	return fmt.Sprintf("openssl dgst -%s -binary out | openssl base64 -A | grep -e %s", sri.Algorithm, strings.Join(patterns, " -e ")), nil
 }
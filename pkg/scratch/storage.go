@@ -0,0 +1,221 @@
+package scratch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/buildbarn/bb-storage/pkg/util"
+
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMaximumInMemorySizeBytes is the size up to which the contents
+// of files are held in memory, if not configured otherwise.
+const DefaultMaximumInMemorySizeBytes = 1 << 20
+
+// filePattern is the pattern of the names of files created in the
+// scratch directory, which is used to identify leftover files.
+const filePattern = "bb-remote-asset-*"
+
+// Storage hands out space for holding the contents of downloads and
+// extracted files temporarily, until they have been hashed and written
+// into the Content Addressable Storage. Small files are held in memory,
+// while larger files are written to a scratch directory. The total
+// size of the files in the scratch directory may be bounded by a quota.
+type Storage struct {
+	directory                string
+	maximumSizeBytes         int64
+	maximumInMemorySizeBytes int64
+	quota                    *semaphore.Weighted
+}
+
+// NewStorage creates a Storage that writes files to a given directory.
+// An empty directory means the system's temporary directory is used. A
+// maximum size of zero means that the size of the scratch directory is
+// unbounded.
+func NewStorage(directory string, maximumSizeBytes, maximumInMemorySizeBytes int64) *Storage {
+	s := &Storage{
+		directory:                directory,
+		maximumSizeBytes:         maximumSizeBytes,
+		maximumInMemorySizeBytes: maximumInMemorySizeBytes,
+	}
+	if maximumSizeBytes > 0 {
+		s.quota = semaphore.NewWeighted(maximumSizeBytes)
+	}
+	return s
+}
+
+// NewDefaultStorage creates a Storage that writes files to the
+// system's temporary directory, without any quota.
+func NewDefaultStorage() *Storage {
+	return NewStorage("", 0, DefaultMaximumInMemorySizeBytes)
+}
+
+// RemoveLeftoverFiles removes files from the scratch directory that
+// were left behind by previous instances of the process, for example
+// because it crashed. It should only be called at startup, and only if
+// the scratch directory is not shared with other processes.
+func (s *Storage) RemoveLeftoverFiles() error {
+	if s.directory == "" {
+		return status.Error(codes.FailedPrecondition, "Leftover files can only be removed from dedicated scratch directories")
+	}
+	paths, err := filepath.Glob(filepath.Join(s.directory, filePattern))
+	if err != nil {
+		return util.StatusWrapWithCode(err, codes.InvalidArgument, "Invalid scratch directory")
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return util.StatusWrapfWithCode(err, codes.Internal, "Failed to remove leftover file %#v", path)
+		}
+	}
+	if len(paths) > 0 {
+		log.Printf("Removed %d leftover files from scratch directory %#v", len(paths), s.directory)
+	}
+	return nil
+}
+
+// NewFile creates an empty file. If the size of the contents to be
+// written is known up front, it should be provided, so that space can
+// be reserved. If the quota of the scratch directory does not permit
+// this, the call blocks until other files are closed. A negative size
+// indicates that the size is unknown, in which case writes to the file
+// fail once the quota is used up.
+func (s *Storage) NewFile(ctx context.Context, sizeBytes int64) (*File, error) {
+	return s.newFile(ctx, sizeBytes, true)
+}
+
+// TryNewFile is identical to NewFile, except that it fails with
+// RESOURCE_EXHAUSTED instead of waiting if the quota does not permit
+// reserving space. It should be used by callers that may already hold
+// space in the scratch directory, such as the file of an archive that
+// is being extracted. Waiting for space while holding space may cause
+// requests to deadlock.
+func (s *Storage) TryNewFile(sizeBytes int64) (*File, error) {
+	return s.newFile(context.Background(), sizeBytes, false)
+}
+
+func (s *Storage) newFile(ctx context.Context, sizeBytes int64, wait bool) (*File, error) {
+	f := &File{storage: s}
+	if sizeBytes <= s.maximumInMemorySizeBytes {
+		if sizeBytes > 0 {
+			f.data = make([]byte, 0, sizeBytes)
+		}
+		return f, nil
+	}
+
+	if s.quota != nil {
+		if sizeBytes > s.maximumSizeBytes {
+			return nil, status.Errorf(codes.ResourceExhausted, "File has a size of %d bytes, which exceeds the scratch directory quota of %d bytes", sizeBytes, s.maximumSizeBytes)
+		}
+		if !wait {
+			if !s.quota.TryAcquire(sizeBytes) {
+				return nil, status.Errorf(codes.ResourceExhausted, "Scratch directory quota of %d bytes has been used up", s.maximumSizeBytes)
+			}
+		} else if err := s.quota.Acquire(ctx, sizeBytes); err != nil {
+			return nil, util.StatusWrap(util.StatusFromContext(ctx), "Failed to reserve space in scratch directory")
+		}
+		f.reservedBytes = sizeBytes
+	}
+	if err := f.createFile(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// File whose contents are held in memory or in the scratch directory.
+// Once all contents have been written, the file may be read back.
+// Closing the file releases the resources associated with it.
+type File struct {
+	storage       *Storage
+	data          []byte
+	file          *os.File
+	sizeBytes     int64
+	reservedBytes int64
+}
+
+func (f *File) createFile() error {
+	file, err := os.CreateTemp(f.storage.directory, filePattern)
+	if err != nil {
+		return util.StatusWrapWithCode(err, codes.Internal, "Failed to create temporary file")
+	}
+	f.file = file
+	return nil
+}
+
+// reserve ensures that space is reserved for a file of a given size in
+// the scratch directory, failing if the quota is used up.
+func (f *File) reserve(sizeBytes int64) error {
+	if f.storage.quota == nil || sizeBytes <= f.reservedBytes {
+		return nil
+	}
+	if !f.storage.quota.TryAcquire(sizeBytes - f.reservedBytes) {
+		return status.Errorf(codes.ResourceExhausted, "Scratch directory quota of %d bytes has been used up", f.storage.maximumSizeBytes)
+	}
+	f.reservedBytes = sizeBytes
+	return nil
+}
+
+// Write data to the end of the file. Contents are held in memory until
+// they exceed the configured threshold, after which they are moved to
+// the scratch directory.
+func (f *File) Write(p []byte) (int, error) {
+	if f.file == nil {
+		if f.sizeBytes+int64(len(p)) <= f.storage.maximumInMemorySizeBytes {
+			f.data = append(f.data, p...)
+			f.sizeBytes += int64(len(p))
+			return len(p), nil
+		}
+		if err := f.reserve(f.sizeBytes); err != nil {
+			return 0, err
+		}
+		if err := f.createFile(); err != nil {
+			return 0, err
+		}
+		if _, err := f.file.Write(f.data); err != nil {
+			return 0, err
+		}
+		f.data = nil
+	}
+
+	if err := f.reserve(f.sizeBytes + int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := f.file.Write(p)
+	f.sizeBytes += int64(n)
+	return n, err
+}
+
+// ReadAt reads data from the file at a given offset.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.file != nil {
+		return f.file.ReadAt(p, off)
+	}
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+// Close the file, removing it from the scratch directory and releasing
+// the space reserved for it.
+func (f *File) Close() error {
+	var err error
+	if f.file != nil {
+		path := f.file.Name()
+		err = f.file.Close()
+		if removeErr := os.Remove(path); err == nil && removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+			err = removeErr
+		}
+		f.file = nil
+	}
+	f.data = nil
+	if f.reservedBytes > 0 {
+		f.storage.quota.Release(f.reservedBytes)
+		f.reservedBytes = 0
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package scratch_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/buildbarn/bb-remote-asset/pkg/scratch"
+	"github.com/buildbarn/bb-storage/pkg/testutil"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func requireDirectoryEntries(t *testing.T, directory string, count int) {
+	t.Helper()
+
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	require.Len(t, entries, count)
+}
+
+func requireContents(t *testing.T, f *scratch.File, expected string) {
+	t.Helper()
+
+	data := make([]byte, len(expected)+1)
+	n, err := f.ReadAt(data, 0)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, expected, string(data[:n]))
+}
+
+func TestStorageInMemory(t *testing.T) {
+	directory := t.TempDir()
+	storage := scratch.NewStorage(directory, 0, 10)
+
+	t.Run("KnownSize", func(t *testing.T) {
+		f, err := storage.NewFile(context.Background(), 5)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("Hello"))
+		require.NoError(t, err)
+		requireDirectoryEntries(t, directory, 0)
+		requireContents(t, f, "Hello")
+		require.NoError(t, f.Close())
+	})
+
+	t.Run("SpilledToDisk", func(t *testing.T) {
+		// Files of unknown size are moved to the scratch
+		// directory once they exceed the threshold.
+		f, err := storage.NewFile(context.Background(), -1)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("Hello"))
+		require.NoError(t, err)
+		requireDirectoryEntries(t, directory, 0)
+		_, err = f.Write([]byte(", world!"))
+		require.NoError(t, err)
+		requireDirectoryEntries(t, directory, 1)
+		requireContents(t, f, "Hello, world!")
+		require.NoError(t, f.Close())
+		requireDirectoryEntries(t, directory, 0)
+	})
+}
+
+func TestStorageQuota(t *testing.T) {
+	directory := t.TempDir()
+	storage := scratch.NewStorage(directory, 100, 0)
+
+	t.Run("TooLarge", func(t *testing.T) {
+		_, err := storage.NewFile(context.Background(), 101)
+		testutil.RequireEqualStatus(t, status.Error(codes.ResourceExhausted, "File has a size of 101 bytes, which exceeds the scratch directory quota of 100 bytes"), err)
+	})
+
+	t.Run("Queued", func(t *testing.T) {
+		// Files of known size wait for space to become
+		// available.
+		f1, err := storage.NewFile(context.Background(), 60)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = storage.NewFile(ctx, 60)
+		testutil.RequireEqualStatus(t, status.Error(codes.DeadlineExceeded, "Failed to reserve space in scratch directory: context deadline exceeded"), err)
+
+		f2Done := make(chan *scratch.File)
+		go func() {
+			f2, err := storage.NewFile(context.Background(), 60)
+			require.NoError(t, err)
+			f2Done <- f2
+		}()
+		require.NoError(t, f1.Close())
+		require.NoError(t, (<-f2Done).Close())
+	})
+
+	t.Run("NotQueued", func(t *testing.T) {
+		// Callers that may hold space already should fail
+		// immediately, instead of waiting.
+		f1, err := storage.NewFile(context.Background(), 60)
+		require.NoError(t, err)
+		_, err = storage.TryNewFile(60)
+		testutil.RequireEqualStatus(t, status.Error(codes.ResourceExhausted, "Scratch directory quota of 100 bytes has been used up"), err)
+		f2, err := storage.TryNewFile(40)
+		require.NoError(t, err)
+		require.NoError(t, f1.Close())
+		require.NoError(t, f2.Close())
+		requireDirectoryEntries(t, directory, 0)
+	})
+
+	t.Run("UnknownSize", func(t *testing.T) {
+		// Files of unknown size fail once the quota is used up.
+		f1, err := storage.NewFile(context.Background(), 60)
+		require.NoError(t, err)
+		f2, err := storage.NewFile(context.Background(), -1)
+		require.NoError(t, err)
+		_, err = f2.Write(make([]byte, 40))
+		require.NoError(t, err)
+		_, err = f2.Write(make([]byte, 1))
+		testutil.RequireEqualStatus(t, status.Error(codes.ResourceExhausted, "Scratch directory quota of 100 bytes has been used up"), err)
+		require.NoError(t, f1.Close())
+		require.NoError(t, f2.Close())
+		requireDirectoryEntries(t, directory, 0)
+	})
+}
+
+func TestStorageRemoveLeftoverFiles(t *testing.T) {
+	directory := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "bb-remote-asset-123"), []byte("Hello"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "unrelated"), []byte("Hello"), 0o600))
+
+	require.NoError(t, scratch.NewStorage(directory, 0, 0).RemoveLeftoverFiles())
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "unrelated", entries[0].Name())
+}
@@ -14,6 +14,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -136,6 +137,15 @@ func (rs *actionCacheAssetStore) assetToActionResult(ctx context.Context, data *
 			QueuedTimestamp: data.LastUpdated,
 		},
 	}
+	if data.UpstreamValidators != nil {
+		// Preserve the validators of the upstream resource, so
+		// that the asset can be revalidated once it is stale.
+		upstreamValidators, err := anypb.New(data.UpstreamValidators)
+		if err != nil {
+			return nil, util.StatusWrapWithCode(err, codes.Internal, "Failed to marshal upstream validators")
+		}
+		result.ExecutionMetadata.AuxiliaryMetadata = []*anypb.Any{upstreamValidators}
+	}
 
 	if data.Type == asset.Asset_DIRECTORY {
 		// If the asset is a Directory, then we need to convert it into
@@ -221,11 +231,20 @@ func (rs *actionCacheAssetStore) actionResultToAsset(a *remoteexecution.ActionRe
 		return nil, status.Errorf(codes.InvalidArgument, "could not find digest (either directory or blob) in ActionResult")
 	}
 
+	var upstreamValidators *asset.UpstreamValidators
+	for _, auxiliaryMetadata := range a.ExecutionMetadata.GetAuxiliaryMetadata() {
+		var v asset.UpstreamValidators
+		if auxiliaryMetadata.UnmarshalTo(&v) == nil {
+			upstreamValidators = &v
+		}
+	}
+
 	return &asset.Asset{
-		Digest:      digest,
-		ExpireAt:    getDefaultTimestamp(),
-		LastUpdated: a.ExecutionMetadata.QueuedTimestamp,
-		Type:        assetType,
+		Digest:             digest,
+		ExpireAt:           getDefaultTimestamp(),
+		LastUpdated:        a.ExecutionMetadata.QueuedTimestamp,
+		Type:               assetType,
+		UpstreamValidators: upstreamValidators,
 	}, nil
 }
 
@@ -518,6 +518,7 @@ func roundTripTest(t *testing.T, assetRef *asset.AssetReference, assetData *asse
 		asset, err := assetStore.Get(ctx, assetRef, digestFunction)
 		require.NoError(t, err)
 		require.Equal(t, asset.Digest, assetData.Digest)
+		require.True(t, proto.Equal(asset.UpstreamValidators, assetData.UpstreamValidators))
 	}
 }
 
@@ -567,6 +568,24 @@ func TestActionCacheAssetStoreRoundTripWithSpecialQualifiers(t *testing.T) {
 	roundTripTest(t, assetRef, assetData)
 }
 
+func TestActionCacheAssetStoreRoundTripWithUpstreamValidators(t *testing.T) {
+	expectedDigest := &remoteexecution.Digest{
+		Hash:      "58de0f27ce00781e5c109f18b0ee6905bdf64f2b1009e225ac67a27f656a0643",
+		SizeBytes: 115,
+	}
+	uri := "https://example.com/example.txt"
+	assetRef := storage.NewAssetReference([]string{uri},
+		[]*remoteasset.Qualifier{{Name: "test", Value: "test"}})
+
+	assetData := storage.NewBlobAsset(expectedDigest, timestamppb.Now())
+	assetData.UpstreamValidators = &asset.UpstreamValidators{
+		Etag:         `"v1"`,
+		LastModified: "Wed, 21 Oct 2015 07:28:00 GMT",
+	}
+
+	roundTripTest(t, assetRef, assetData)
+}
+
 func TestActionCacheAssetStoreGetBlob(t *testing.T) {
 	ctrl, ctx := gomock.WithContext(context.Background(), t)
 